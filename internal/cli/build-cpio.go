@@ -40,6 +40,8 @@ func buildCPIO() *cobra.Command {
 	var extraRepos []string
 	var extraPackages []string
 	var sizeLimits options.SizeLimits
+	var fetchConcurrency int
+	var disableHTTP2 bool
 
 	cmd := &cobra.Command{
 		Use:     "build-cpio",
@@ -59,6 +61,8 @@ func buildCPIO() *cobra.Command {
 				build.WithSBOM(sbomPath),
 				build.WithArch(types.ParseArchitecture(buildArch)),
 				build.WithSizeLimits(sizeLimits),
+				build.WithFetchConcurrency(fetchConcurrency),
+				build.WithDisableHTTP2(disableHTTP2),
 			)
 		},
 	}
@@ -71,6 +75,8 @@ func buildCPIO() *cobra.Command {
 	cmd.Flags().StringSliceVarP(&extraRepos, "repository-append", "r", []string{}, "path to extra repositories to include")
 	cmd.Flags().StringSliceVarP(&extraPackages, "package-append", "p", []string{}, "extra packages to include")
 	addClientLimitFlags(cmd, &sizeLimits)
+	addFetchConcurrencyFlag(cmd, &fetchConcurrency)
+	addDisableHTTP2Flag(cmd, &disableHTTP2)
 
 	return cmd
 }
@@ -88,6 +94,7 @@ func BuildCPIOCmd(ctx context.Context, dest string, opts ...build.Option) error
 	if err != nil {
 		return err
 	}
+	defer bc.Cleanup(ctx)
 
 	ic := bc.ImageConfiguration()
 
@@ -40,6 +40,8 @@ func buildMinirootFS() *cobra.Command {
 	var extraRepos []string
 	var extraPackages []string
 	var sizeLimits options.SizeLimits
+	var fetchConcurrency int
+	var disableHTTP2 bool
 
 	cmd := &cobra.Command{
 		Use:     "build-minirootfs",
@@ -60,6 +62,8 @@ func buildMinirootFS() *cobra.Command {
 				build.WithArch(types.ParseArchitecture(buildArch)),
 				build.WithIgnoreSignatures(ignoreSignatures),
 				build.WithSizeLimits(sizeLimits),
+				build.WithFetchConcurrency(fetchConcurrency),
+				build.WithDisableHTTP2(disableHTTP2),
 			)
 		},
 	}
@@ -73,6 +77,8 @@ func buildMinirootFS() *cobra.Command {
 	cmd.Flags().StringSliceVarP(&extraRepos, "repository-append", "r", []string{}, "path to extra repositories to include")
 	cmd.Flags().StringSliceVarP(&extraPackages, "package-append", "p", []string{}, "extra packages to include")
 	addClientLimitFlags(cmd, &sizeLimits)
+	addFetchConcurrencyFlag(cmd, &fetchConcurrency)
+	addDisableHTTP2Flag(cmd, &disableHTTP2)
 
 	return cmd
 }
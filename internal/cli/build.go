@@ -19,10 +19,13 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"os"
 	"path/filepath"
 	"slices"
+	"strings"
 	"sync"
+	"time"
 
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/layout"
@@ -44,22 +47,78 @@ import (
 
 func buildCmd() *cobra.Command {
 	var withVCS bool
+	var configHistory bool
+	var pruneEmptyDirs bool
+	var pruneKeepDirs []string
+	var canonicalApkDB bool
+	var brokenSymlinks string
+	var compressionConcurrency int
+	var maxLayerSize int64
+	var maxLayerSizeCompressed bool
+	var sbomConcurrency int
+	var reproducibilityManifest bool
 	var buildDate string
 	var archstrs []string
 	var writeSBOM bool
 	var sbomPath string
 	var sbomFormats []string
+	var sbomComment string
+	var sbomLicenseListVersion string
+	var sbomNormalizeLicenses bool
+	var sbomPackageNameTemplate string
+	var sbomIndexSignatures bool
+	var sbomRelationshipComments bool
+	var sbomGeneratedFiles bool
+	var sbomSplitVersions bool
+	var keepTempDir bool
 	var extraKeys []string
 	var extraBuildRepos []string
 	var extraRepos []string
 	var extraPackages []string
 	var rawAnnotations []string
+	var rawFileCapabilities []string
+	var verifyDependencies bool
+	var forceRemovePackages bool
+	var stdDirs bool
+	var checkFileOwnership bool
+	var stalePins bool
+	var packageMtimes bool
+	var sbomIndexDigests bool
+	var sbomEmbedConfig bool
+	var requireLicenses bool
+	var licenseExceptions []string
+	var sbomDigestAnnotation bool
+	var sbomStreaming bool
+	var noScripts bool
+	var caBundle string
+	var apkDBRoot string
+	var sbomContentNamespace bool
+	var sbomPackageVCS bool
+	var sbomPackageVCSURL string
+	var distroless bool
+	var distrolessPaths []string
+	var sbomPackageLabel string
+	var sbomPackagesOnly bool
+	var sbomSigningKey string
+	var sbomImagePurlType, sbomImagePurlNamespace string
+	var sbomLint bool
+	var sbomDuplicateVersions string
+	var sbomPackagePurposes bool
+	var rawSBOMPackagePurposes []string
+	var sbomAppPackages []string
+	var sbomAppPackageRelationship string
+	var rawSBOMFileNames []string
+	var rawSBOMPriorities []string
+	var sbomTimestampFormat string
 	var cacheDir string
 	var offline bool
 	var lockfile string
 	var includePaths []string
 	var ignoreSignatures bool
 	var sizeLimits options.SizeLimits
+	var fetchConcurrency int
+	var disableHTTP2 bool
+	var buildTimeout time.Duration
 
 	cmd := &cobra.Command{
 		Use:   "build",
@@ -86,6 +145,18 @@ Along the image, apko will generate SBOMs (software bill of materials) describin
 			if err != nil {
 				return fmt.Errorf("parsing annotations from command line: %w", err)
 			}
+			fileCapabilities, err := parseFileCapabilities(rawFileCapabilities)
+			if err != nil {
+				return fmt.Errorf("parsing file capabilities from command line: %w", err)
+			}
+			packagePurposes, err := parsePackagePurposes(rawSBOMPackagePurposes)
+			if err != nil {
+				return fmt.Errorf("parsing SBOM package purposes from command line: %w", err)
+			}
+			sbomOutputs, err := parseSBOMOutputs(rawSBOMFileNames, rawSBOMPriorities)
+			if err != nil {
+				return fmt.Errorf("parsing SBOM outputs from command line: %w", err)
+			}
 
 			var sbomGenerators []generator.Generator
 			if writeSBOM && len(sbomFormats) > 0 {
@@ -96,7 +167,7 @@ Along the image, apko will generate SBOMs (software bill of materials) describin
 			if err != nil {
 				return fmt.Errorf("creating tempdir: %w", err)
 			}
-			defer os.RemoveAll(tmp)
+			defer build.RemoveTempDir(cmd.Context(), tmp, keepTempDir)
 
 			return BuildCmd(cmd.Context(), args[1], args[2], archs,
 				[]string{args[1]},
@@ -106,6 +177,42 @@ Along the image, apko will generate SBOMs (software bill of materials) describin
 				build.WithBuildDate(buildDate),
 				build.WithSBOM(sbomPath),
 				build.WithSBOMGenerators(sbomGenerators...),
+				build.WithSBOMComment(sbomComment),
+				build.WithSBOMLicenseListVersion(sbomLicenseListVersion),
+				build.WithSBOMNormalizeLicenses(sbomNormalizeLicenses),
+				build.WithSBOMPackageNameTemplate(sbomPackageNameTemplate),
+				build.WithSBOMIndexSignatures(sbomIndexSignatures),
+				build.WithSBOMRelationshipComments(sbomRelationshipComments),
+				build.WithSBOMGeneratedFiles(sbomGeneratedFiles),
+				build.WithSBOMSplitVersions(sbomSplitVersions),
+				build.WithFileCapabilities(fileCapabilities),
+				build.WithVerifyDependencies(verifyDependencies),
+				build.WithForceRemovePackages(forceRemovePackages),
+				build.WithStandardDirs(standardDirs(stdDirs)),
+				build.WithFileOwnershipCheck(checkFileOwnership),
+				build.WithStalePins(stalePins),
+				build.WithPackageMtimes(packageMtimes),
+				build.WithSBOMIndexDigests(sbomIndexDigests),
+				build.WithSBOMEmbedConfig(sbomEmbedConfig),
+				build.WithRequireLicenses(requireLicenses, licenseExceptions),
+				build.WithSBOMDigestAnnotation(sbomDigestAnnotation),
+				build.WithSBOMStreaming(sbomStreaming),
+				build.WithNoScripts(noScripts),
+				build.WithCABundle(caBundle),
+				build.WithApkDBRoot(apkDBRoot),
+				build.WithSBOMContentNamespace(sbomContentNamespace),
+				build.WithSBOMPackageVCS(sbomPackageVCS, sbomPackageVCSURL),
+				build.WithDistroless(distroless, distrolessPaths),
+				build.WithSBOMPackageLabel(sbomPackageLabel),
+				build.WithSBOMPackagesOnly(sbomPackagesOnly),
+				build.WithSBOMSigningKey(sbomSigningKey),
+				build.WithSBOMImagePurl(sbomImagePurlType, sbomImagePurlNamespace),
+				build.WithSBOMLint(sbomLint),
+				build.WithSBOMDuplicateVersions(sbomDuplicateVersions),
+				build.WithSBOMPackagePurposes(sbomPackagePurposes, packagePurposes),
+				build.WithSBOMAppPackages(sbomAppPackages, sbomAppPackageRelationship),
+				build.WithSBOMTimestampFormat(sbomTimestampFormat),
+				build.WithSBOMOutputs(sbomOutputs),
 				build.WithExtraKeys(extraKeys),
 				build.WithExtraBuildRepos(extraBuildRepos),
 				build.WithExtraRepos(extraRepos),
@@ -116,43 +223,111 @@ Along the image, apko will generate SBOMs (software bill of materials) describin
 				build.WithCache(cacheDir, offline, apk.NewCache(true)),
 				build.WithLockFile(lockfile),
 				build.WithTempDir(tmp),
+				build.WithKeepTempDir(keepTempDir),
 				build.WithIncludePaths(includePaths),
 				build.WithIgnoreSignatures(ignoreSignatures),
 				build.WithSizeLimits(sizeLimits),
+				build.WithFetchConcurrency(fetchConcurrency),
+				build.WithDisableHTTP2(disableHTTP2),
+				build.WithCompressionConcurrency(compressionConcurrency),
+				build.WithMaxLayerSize(maxLayerSize, maxLayerSizeCompressed),
+				build.WithSBOMConcurrency(sbomConcurrency),
+				build.WithBuildTimeout(buildTimeout),
+				build.WithConfigHistory(configHistory),
+				build.WithPruneEmptyDirs(pruneEmptyDirs, pruneKeepDirs...),
+				build.WithCanonicalApkDB(canonicalApkDB),
+				build.WithBrokenSymlinks(brokenSymlinks),
+				build.WithReproducibilityManifest(reproducibilityManifest),
 			)
 		},
 	}
 
 	cmd.Flags().BoolVar(&withVCS, "vcs", true, "detect and embed VCS URLs")
+	addConfigHistoryFlag(cmd, &configHistory)
+	addPruneEmptyDirsFlags(cmd, &pruneEmptyDirs, &pruneKeepDirs)
+	addCanonicalApkDBFlag(cmd, &canonicalApkDB)
+	addBrokenSymlinksFlag(cmd, &brokenSymlinks)
+	addReproducibilityManifestFlag(cmd, &reproducibilityManifest)
 	cmd.Flags().StringVar(&buildDate, "build-date", "", "date used for the timestamps of the files inside the image in RFC3339 format")
 	cmd.Flags().BoolVar(&writeSBOM, "sbom", true, "generate SBOMs")
 	cmd.Flags().StringVar(&sbomPath, "sbom-path", "", "generate SBOMs in dir (defaults to image directory)")
 	cmd.Flags().StringSliceVar(&archstrs, "arch", nil, "architectures to build for (e.g., x86_64,ppc64le,arm64) -- default is all, unless specified in config. Can also use 'host' to indicate arch of host this is running on")
 	cmd.Flags().StringSliceVarP(&extraKeys, "keyring-append", "k", []string{}, "path to extra keys to include in the keyring")
 	cmd.Flags().StringSliceVar(&sbomFormats, "sbom-formats", []string{"spdx"}, "SBOM formats to output")
+	addSBOMCommentFlag(cmd, &sbomComment)
+	addSBOMLicenseFlags(cmd, &sbomLicenseListVersion, &sbomNormalizeLicenses)
+	addSBOMPackageNameTemplateFlag(cmd, &sbomPackageNameTemplate)
+	addSBOMIndexSignaturesFlag(cmd, &sbomIndexSignatures)
+	addSBOMRelationshipCommentsFlag(cmd, &sbomRelationshipComments)
+	addSBOMGeneratedFilesFlag(cmd, &sbomGeneratedFiles)
+	addSBOMSplitVersionsFlag(cmd, &sbomSplitVersions)
 	cmd.Flags().StringSliceVarP(&extraBuildRepos, "build-repository-append", "b", []string{}, "path to extra repositories to include")
 	cmd.Flags().StringSliceVarP(&extraRepos, "repository-append", "r", []string{}, "path to extra repositories to include")
 	cmd.Flags().StringSliceVarP(&extraPackages, "package-append", "p", []string{}, "extra packages to include")
 	cmd.Flags().StringSliceVar(&rawAnnotations, "annotations", []string{}, "OCI annotations to add. Separate with colon (key:value)")
+	addFileCapabilitiesFlag(cmd, &rawFileCapabilities)
+	addStandardDirsFlag(cmd, &stdDirs)
+	addVerifyDependenciesFlag(cmd, &verifyDependencies)
+	addForceRemovePackagesFlag(cmd, &forceRemovePackages)
+	addCheckFileOwnershipFlag(cmd, &checkFileOwnership)
+	addStalePinsFlag(cmd, &stalePins)
+	addPackageMtimesFlag(cmd, &packageMtimes)
+	addSBOMIndexDigestsFlag(cmd, &sbomIndexDigests)
+	addSBOMEmbedConfigFlag(cmd, &sbomEmbedConfig)
+	addRequireLicensesFlags(cmd, &requireLicenses, &licenseExceptions)
+	addSBOMDigestAnnotationFlag(cmd, &sbomDigestAnnotation)
+	addSBOMStreamingFlag(cmd, &sbomStreaming)
+	addNoScriptsFlag(cmd, &noScripts)
+	addCABundleFlag(cmd, &caBundle)
+	addApkDBRootFlag(cmd, &apkDBRoot)
+	addSBOMContentNamespaceFlag(cmd, &sbomContentNamespace)
+	addSBOMPackageVCSFlags(cmd, &sbomPackageVCS, &sbomPackageVCSURL)
+	addDistrolessFlags(cmd, &distroless, &distrolessPaths)
+	addSBOMPackageLabelFlag(cmd, &sbomPackageLabel)
+	addSBOMPackagesOnlyFlag(cmd, &sbomPackagesOnly)
+	addSBOMSigningKeyFlag(cmd, &sbomSigningKey)
+	addSBOMImagePurlFlags(cmd, &sbomImagePurlType, &sbomImagePurlNamespace)
+	addSBOMLintFlag(cmd, &sbomLint)
+	addSBOMDuplicateVersionsFlag(cmd, &sbomDuplicateVersions)
 	cmd.Flags().StringVar(&cacheDir, "cache-dir", "", "directory to use for caching apk packages and indexes (default '' means to use system-defined cache directory)")
 	cmd.Flags().BoolVar(&offline, "offline", false, "do not use network to fetch packages (cache must be pre-populated)")
 	cmd.Flags().StringVar(&lockfile, "lockfile", "", "a path to .lock.json file (e.g. produced by apko lock) that constraints versions of packages to the listed ones (default '' means no additional constraints)")
 	cmd.Flags().StringSliceVar(&includePaths, "include-paths", []string{}, "Additional include paths where to look for input files (config, base image, etc.). By default apko will search for paths only in workdir. Include paths may be absolute, or relative. Relative paths are interpreted relative to workdir. For adding extra paths for packages, use --repository-append.")
 	cmd.Flags().BoolVar(&ignoreSignatures, "ignore-signatures", false, "ignore repository signature verification")
 	addClientLimitFlags(cmd, &sizeLimits)
+	addFetchConcurrencyFlag(cmd, &fetchConcurrency)
+	addDisableHTTP2Flag(cmd, &disableHTTP2)
+	addCompressionConcurrencyFlag(cmd, &compressionConcurrency)
+	addMaxLayerSizeFlags(cmd, &maxLayerSize, &maxLayerSizeCompressed)
+	addSBOMConcurrencyFlag(cmd, &sbomConcurrency)
+	addSBOMPackagePurposeFlags(cmd, &sbomPackagePurposes, &rawSBOMPackagePurposes)
+	addSBOMAppPackageFlags(cmd, &sbomAppPackages, &sbomAppPackageRelationship)
+	addSBOMTimestampFormatFlag(cmd, &sbomTimestampFormat)
+	addSBOMOutputFlags(cmd, &rawSBOMFileNames, &rawSBOMPriorities)
+	addBuildTimeoutFlag(cmd, &buildTimeout)
+	addKeepTempDirFlag(cmd, &keepTempDir)
 	return cmd
 }
 
-func BuildCmd(ctx context.Context, imageRef, output string, archs []types.Architecture, tags []string, wantSBOM bool, sbomPath string, opts ...build.Option) error {
+func BuildCmd(ctx context.Context, imageRef, output string, archs []types.Architecture, tags []string, wantSBOM bool, sbomPath string, opts ...build.Option) (err error) {
 	log := clog.FromContext(ctx)
-	wd, err := os.MkdirTemp("", "apko-*")
+	o, _, err := build.NewOptions(opts...)
 	if err != nil {
-		return fmt.Errorf("failed to create working directory: %w", err)
+		return err
 	}
-	defer os.RemoveAll(wd)
+
+	// The timeout covers writing the index too.
+	ctx, done := build.WithTimeout(ctx, o.BuildTimeout)
+	defer func() { err = done(err) }()
+
+	wd, opts, cleanup, err := makeBuildDirs(ctx, o, opts)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
 
 	// build all of the components in the working directory
-	idx, sboms, err := buildImageComponents(ctx, wd, archs, opts...)
+	idx, sboms, manifest, err := buildImageComponents(ctx, wd, archs, opts...)
 	if err != nil {
 		return err
 	}
@@ -166,35 +341,46 @@ func BuildCmd(ctx context.Context, imageRef, output string, archs []types.Archit
 	} else {
 		// bundle the parts of the image into a tarball
 		if _, err := oci.BuildIndex(output, idx, append([]string{imageRef}, tags...)); err != nil {
+			// Don't leave a partial tarball behind.
+			_ = os.Remove(output)
 			return fmt.Errorf("bundling image: %w", err)
 		}
 		log.Debugf("Final index tgz at: %s", output)
 	}
 
-	// copy sboms over to the sbomPath target directory
+	// copy sboms over to the sbomPath target directory, and list them in
+	// their order, the primary one of each architecture first
 	for _, sbom := range sboms {
+		dest := filepath.Join(sbomPath, filepath.Base(sbom.Path))
 		// because os.Rename fails across partitions, we do our own
-		if err := rename(sbom.Path, filepath.Join(sbomPath, filepath.Base(sbom.Path))); err != nil {
+		if err := rename(sbom.Path, dest); err != nil {
 			return fmt.Errorf("moving sbom: %w", err)
 		}
+		log.Infof("wrote %s SBOM %s", sbom.Format, dest)
+	}
+
+	if manifest != nil {
+		if err := manifest.WriteFile(filepath.Join(sbomPath, build.ReproducibilityManifestFileName)); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
 // buildImage build all of the components of an image in a single working directory.
 // Each layer is a separate file, as are config, manifests, index and sbom.
-func buildImageComponents(ctx context.Context, workDir string, archs []types.Architecture, opts ...build.Option) (idx v1.ImageIndex, sboms []types.SBOM, err error) {
+func buildImageComponents(ctx context.Context, workDir string, archs []types.Architecture, opts ...build.Option) (idx v1.ImageIndex, sboms []types.SBOM, manifest *build.ReproducibilityManifest, err error) {
 	log := clog.FromContext(ctx)
 	ctx, span := otel.Tracer("apko").Start(ctx, "buildImageComponents")
 	defer span.End()
 
 	o, ic, err := build.NewOptions(opts...)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
 	if ic.Contents.BaseImage != nil && o.Lockfile == "" {
-		return nil, nil, fmt.Errorf("building with base image is supported only with a lockfile")
+		return nil, nil, nil, fmt.Errorf("building with base image is supported only with a lockfile")
 	}
 
 	// cases:
@@ -228,14 +414,16 @@ func buildImageComponents(ctx context.Context, workDir string, archs []types.Arc
 
 	log.Debugf("building tags %v", o.Tags)
 
+	manifests := map[types.Architecture]*build.ReproducibilityManifest{}
 	var errg errgroup.Group
 	imageDir := filepath.Join(workDir, "image")
 	if err := os.MkdirAll(imageDir, 0755); err != nil {
-		return nil, nil, fmt.Errorf("unable to create working image directory %s: %w", imageDir, err)
+		return nil, nil, nil, fmt.Errorf("unable to create working image directory %s: %w", imageDir, err)
 	}
 	opts = append(opts, build.WithSBOM(imageDir))
 
 	imgs := map[types.Architecture]v1.Image{}
+	archSBOMs := map[types.Architecture][]types.SBOM{}
 
 	mtx := sync.Mutex{}
 
@@ -247,7 +435,7 @@ func buildImageComponents(ctx context.Context, workDir string, archs []types.Arc
 
 	configs, _, err := build.LockImageConfiguration(ctx, *ic, opts...)
 	if err != nil {
-		return nil, nil, fmt.Errorf("locking config: %w", err)
+		return nil, nil, nil, fmt.Errorf("locking config: %w", err)
 	}
 
 	for arch, ic := range configs {
@@ -288,6 +476,12 @@ func buildImageComponents(ctx context.Context, workDir string, archs []types.Arc
 			if err != nil {
 				return fmt.Errorf("failed to build OCI image for %q: %w", arch, err)
 			}
+			if o.ConfigHistory {
+				img, err = oci.AppendConfigHistory(img, bc.ImageConfiguration(), bde)
+				if err != nil {
+					return fmt.Errorf("failed to add config history for %q: %w", arch, err)
+				}
+			}
 
 			var outputs []types.SBOM
 			if len(o.SBOMGenerators) != 0 {
@@ -301,26 +495,37 @@ func buildImageComponents(ctx context.Context, workDir string, archs []types.Arc
 			defer mtx.Unlock()
 
 			imgs[arch] = img
+			if m := bc.ReproducibilityManifest(); m != nil {
+				manifests[arch] = m
+			}
 
 			if bde.After(multiArchBDE) {
 				multiArchBDE = bde
 			}
 
 			if len(o.SBOMGenerators) != 0 {
-				sboms = append(sboms, outputs...)
+				archSBOMs[arch] = outputs
 			}
 
 			return nil
 		})
 	}
 	if err := errg.Wait(); err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
+	}
+
+	// List the SBOMs in the order of their architectures, rather than in
+	// that in which the builds completed.
+	for _, arch := range slices.SortedFunc(maps.Keys(archSBOMs), func(a, b types.Architecture) int {
+		return strings.Compare(a.String(), b.String())
+	}) {
+		sboms = append(sboms, archSBOMs[arch]...)
 	}
 
 	// generate the index
-	finalDigest, idx, err := oci.GenerateIndex(ctx, *ic, imgs, multiArchBDE)
+	finalDigest, idx, err := build.GenerateIndex(ctx, o, *ic, imgs, archSBOMs, multiArchBDE)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to generate OCI index: %w", err)
+		return nil, nil, nil, fmt.Errorf("failed to generate OCI index: %w", err)
 	}
 
 	opts = append(opts,
@@ -328,25 +533,65 @@ func buildImageComponents(ctx context.Context, workDir string, archs []types.Arc
 		build.WithSourceDateEpoch(multiArchBDE), // Maximum child's time.
 	)
 
+	if o.ReproducibilityManifest {
+		manifest = build.NewReproducibilityManifest(*o, *ic, multiArchBDE)
+		for _, m := range manifests {
+			manifest.Merge(m)
+		}
+		h, err := manifest.Digest()
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("computing reproducibility manifest digest: %w", err)
+		}
+		opts = append(opts, build.WithReproducibilityManifestDigest(h.String()))
+	}
+
 	o, ic, err = build.NewOptions(opts...)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
 	if _, err := build.WriteIndex(ctx, o, idx); err != nil {
-		return nil, nil, fmt.Errorf("failed to write OCI index: %w", err)
+		return nil, nil, nil, fmt.Errorf("failed to write OCI index: %w", err)
 	}
 
 	// the sboms are saved to the same working directory as the image components
 	if len(o.SBOMGenerators) != 0 {
 		files, err := build.GenerateIndexSBOM(ctx, *o, *ic, finalDigest, imgs)
 		if err != nil {
-			return nil, nil, fmt.Errorf("generating index SBOM: %w", err)
+			return nil, nil, nil, fmt.Errorf("generating index SBOM: %w", err)
 		}
 		sboms = append(sboms, files...)
 	}
 
-	return idx, sboms, nil
+	return idx, sboms, manifest, nil
+}
+
+// makeBuildDirs creates the working directory of a build. If o sets no
+// temporary directory, it creates one too and adds it to the returned opts.
+// The returned function removes the directories, unless o keeps them, and
+// must be called however the build ends.
+func makeBuildDirs(ctx context.Context, o *options.Options, opts []build.Option) (string, []build.Option, func(), error) {
+	wd, err := os.MkdirTemp("", "apko-*")
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("failed to create working directory: %w", err)
+	}
+	dirs := []string{wd}
+
+	if o.TempDirPath == "" {
+		tmp, err := os.MkdirTemp(os.TempDir(), "apko-temp-*")
+		if err != nil {
+			_ = os.RemoveAll(wd)
+			return "", nil, nil, fmt.Errorf("creating tempdir: %w", err)
+		}
+		dirs = append(dirs, tmp)
+		opts = append(slices.Clone(opts), build.WithTempDir(tmp))
+	}
+
+	return wd, opts, func() {
+		for _, dir := range dirs {
+			build.RemoveTempDir(ctx, dir, o.KeepTempDir)
+		}
+	}, nil
 }
 
 // rename just like os.Rename, but does a copy and delete if the rename fails
@@ -18,11 +18,15 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/layout"
 	"github.com/google/go-containerregistry/pkg/v1/validate"
 	"github.com/stretchr/testify/require"
@@ -30,6 +34,7 @@ import (
 	"chainguard.dev/apko/internal/cli"
 	"chainguard.dev/apko/pkg/build"
 	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/options"
 	"chainguard.dev/apko/pkg/sbom/generator/spdx"
 )
 
@@ -113,6 +118,65 @@ func TestBuild(t *testing.T) {
 	}
 }
 
+func TestBuildTimeout(t *testing.T) {
+	ctx := context.Background()
+	tmp := t.TempDir()
+	output := filepath.Join(tmp, "image.tar")
+
+	archs := types.ParseArchitectures([]string{"amd64", "arm64"})
+	opts := []build.Option{
+		build.WithConfig(filepath.Join("testdata", "apko.yaml"), []string{}),
+		build.WithSBOMGenerators(spdx.New()),
+		build.WithTags("golden:latest"),
+		build.WithBuildTimeout(time.Nanosecond),
+	}
+
+	start := time.Now()
+	err := cli.BuildCmd(ctx, "golden:latest", output, archs, []string{}, true, tmp, opts...)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Less(t, time.Since(start), 10*time.Second)
+
+	// Nothing is left behind.
+	_, err = os.Stat(output)
+	require.ErrorIs(t, err, os.ErrNotExist)
+	entries, err := os.ReadDir(tmp)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestKeepTempDir(t *testing.T) {
+	ctx := context.Background()
+
+	for _, keep := range []bool{false, true} {
+		t.Run(fmt.Sprintf("keep=%t", keep), func(t *testing.T) {
+			// The working and temporary directories are created in TMPDIR.
+			tmpdir := t.TempDir()
+			t.Setenv("TMPDIR", tmpdir)
+			out := t.TempDir()
+
+			opts := []build.Option{
+				build.WithConfig(filepath.Join("testdata", "apko.yaml"), []string{}),
+				build.WithTags("golden:latest"),
+				build.WithKeepTempDir(keep),
+			}
+			archs := types.ParseArchitectures([]string{"amd64"})
+			require.NoError(t, cli.BuildCmd(ctx, "golden:latest", filepath.Join(out, "image.tar"), archs, []string{}, false, out, opts...))
+
+			entries, err := os.ReadDir(tmpdir)
+			require.NoError(t, err)
+			if !keep {
+				require.Empty(t, entries)
+				return
+			}
+			var names []string
+			for _, e := range entries {
+				names = append(names, strings.TrimRight(e.Name(), "0123456789"))
+			}
+			require.ElementsMatch(t, []string{"apko-", "apko-temp-"}, names)
+		})
+	}
+}
+
 func TestBuildWithBase(t *testing.T) {
 	// top_image golden file can be regenerated using ./internal/cli/testdata/regenerate_golden_top_image.sh script.
 
@@ -155,3 +219,140 @@ func TestBuildWithBase(t *testing.T) {
 
 	require.Equal(t, want, got)
 }
+
+func TestBuildReproducibilityManifest(t *testing.T) {
+	ctx := context.Background()
+	tmp := t.TempDir()
+
+	config := filepath.Join("testdata", "apko.yaml")
+	archs := types.ParseArchitectures([]string{"amd64", "arm64"})
+	opts := []build.Option{
+		build.WithConfig(config, []string{}),
+		build.WithSBOMGenerators(spdx.New()),
+		build.WithTags("golden:latest"),
+		build.WithReproducibilityManifest(true),
+		build.WithSourceDateEpoch(time.Unix(1700000000, 0)),
+	}
+
+	sbomPath := filepath.Join(tmp, "sboms")
+	require.NoError(t, os.MkdirAll(sbomPath, 0o750))
+
+	require.NoError(t, cli.BuildCmd(ctx, "golden:latest", tmp, archs, []string{}, true, sbomPath, opts...))
+
+	manifestPath := filepath.Join(sbomPath, build.ReproducibilityManifestFileName)
+	b, err := os.ReadFile(manifestPath)
+	require.NoError(t, err)
+
+	var manifest build.ReproducibilityManifest
+	require.NoError(t, json.Unmarshal(b, &manifest))
+
+	require.NotEmpty(t, manifest.ApkoVersion)
+	require.Regexp(t, `^sha256-`, manifest.ConfigDigest)
+	require.Equal(t, []string{"./testdata/packages"}, manifest.Repositories)
+	require.Equal(t, []string{"./testdata/melange.rsa.pub"}, manifest.Keyring)
+
+	require.Equal(t, "2023-11-14T22:13:20Z", manifest.SourceDateEpoch)
+
+	require.Len(t, manifest.Packages, 2)
+	for _, arch := range []string{"x86_64", "aarch64"} {
+		pkgs := manifest.Packages[arch]
+		require.NotEmpty(t, pkgs, arch)
+		names := make([]string, 0, len(pkgs))
+		for _, pkg := range pkgs {
+			require.NotEmpty(t, pkg.Version, pkg.Name)
+			require.Regexp(t, `^Q1`, pkg.Checksum, pkg.Name)
+			names = append(names, pkg.Name)
+		}
+		require.Contains(t, names, "replayout")
+	}
+
+	// The digest of the manifest is recorded in the index SBOM.
+	h, err := manifest.Digest()
+	require.NoError(t, err)
+	require.Equal(t, h, mustHash(t, b))
+
+	doc, err := spdx.ReadDocument(filepath.Join(sbomPath, "sbom-index.spdx.json"))
+	require.NoError(t, err)
+	require.Equal(t, "Reproducibility manifest: "+h.String(), doc.CreationInfo.Comment)
+}
+
+func TestBuildSBOMDigestAnnotation(t *testing.T) {
+	ctx := context.Background()
+	tmp := t.TempDir()
+
+	archs := types.ParseArchitectures([]string{"amd64", "arm64"})
+	opts := []build.Option{
+		build.WithConfig(filepath.Join("testdata", "apko.yaml"), []string{}),
+		build.WithSBOMGenerators(spdx.New()),
+		build.WithTags("golden:latest"),
+		build.WithSBOMDigestAnnotation(true),
+	}
+
+	sbomPath := filepath.Join(tmp, "sboms")
+	require.NoError(t, os.MkdirAll(sbomPath, 0o750))
+
+	require.NoError(t, cli.BuildCmd(ctx, "golden:latest", tmp, archs, []string{}, true, sbomPath, opts...))
+
+	idx, err := layout.ImageIndexFromPath(tmp)
+	require.NoError(t, err)
+	m, err := idx.IndexManifest()
+	require.NoError(t, err)
+
+	require.Len(t, m.Manifests, 2)
+	for _, desc := range m.Manifests {
+		b, err := os.ReadFile(filepath.Join(sbomPath, fmt.Sprintf("sbom-%s.spdx.json", types.ParseArchitecture(desc.Platform.Architecture).ToAPK())))
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{build.SBOMDigestAnnotation: mustHash(t, b).String()}, desc.Annotations)
+	}
+}
+
+func TestBuildSBOMOutputs(t *testing.T) {
+	ctx := context.Background()
+	tmp := t.TempDir()
+
+	archs := types.ParseArchitectures([]string{"amd64", "arm64"})
+	opts := []build.Option{
+		build.WithConfig(filepath.Join("testdata", "apko.yaml"), []string{}),
+		build.WithSBOMGenerators(spdx.New(), spdx.NewTagValue()),
+		build.WithSBOMOutputs(map[string]options.SBOMOutput{
+			"spdx-tv": {FileName: "{arch}.spdx", Priority: 10},
+		}),
+		build.WithTags("golden:latest"),
+		build.WithSBOMDigestAnnotation(true),
+	}
+
+	sbomPath := filepath.Join(tmp, "sboms")
+	require.NoError(t, os.MkdirAll(sbomPath, 0o750))
+
+	require.NoError(t, cli.BuildCmd(ctx, "golden:latest", tmp, archs, []string{}, true, sbomPath, opts...))
+
+	entries, err := os.ReadDir(sbomPath)
+	require.NoError(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	require.ElementsMatch(t, []string{
+		"aarch64.spdx", "x86_64.spdx", "index.spdx",
+		"sbom-aarch64.spdx.json", "sbom-x86_64.spdx.json", "sbom-index.spdx.json",
+	}, names)
+
+	// The tag-value SBOMs have the highest priority, so they are the primary
+	// SBOMs the images point at.
+	idx, err := layout.ImageIndexFromPath(tmp)
+	require.NoError(t, err)
+	m, err := idx.IndexManifest()
+	require.NoError(t, err)
+	for _, desc := range m.Manifests {
+		b, err := os.ReadFile(filepath.Join(sbomPath, types.ParseArchitecture(desc.Platform.Architecture).ToAPK()+".spdx"))
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{build.SBOMDigestAnnotation: mustHash(t, b).String()}, desc.Annotations)
+	}
+}
+
+func mustHash(t *testing.T, b []byte) v1.Hash {
+	t.Helper()
+	h, _, err := v1.SHA256(bytes.NewReader(b))
+	require.NoError(t, err)
+	return h
+}
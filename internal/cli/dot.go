@@ -48,7 +48,7 @@ func dotcmd() *cobra.Command {
 	var extraBuildRepos []string
 	var extraRepos []string
 	var archstrs []string
-	var web, span bool
+	var web, span, jsonOut bool
 	var cacheDir string
 	var offline bool
 
@@ -65,12 +65,15 @@ apko dot --web example.yaml
 
 # Open browser to explore example.yaml, rendering a (almost) minimum spanning tree
 apko dot --web -S example.yaml
+
+# Write the dependency graph of example.yaml as a JSON adjacency list
+apko dot --json example.yaml > graph.json
 `,
 		Example: `  apko dot <config.yaml>`,
 		Args:    cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			archs := types.ParseArchitectures(archstrs)
-			return DotCmd(cmd.Context(), args[0], archs, web, span,
+			return DotCmd(cmd.Context(), args[0], archs, web, span, jsonOut,
 				build.WithConfig(args[0], []string{}),
 				build.WithExtraKeys(extraKeys),
 				build.WithExtraBuildRepos(extraBuildRepos),
@@ -86,6 +89,7 @@ apko dot --web -S example.yaml
 	cmd.Flags().StringSliceVar(&archstrs, "arch", nil, "architectures to build for (e.g., x86_64,ppc64le,arm64) -- default is all, unless specified in config. Can also use 'host' to indicate arch of host this is running on")
 	cmd.Flags().BoolVarP(&span, "spanning-tree", "S", false, "does something like a spanning tree to avoid a huge number of edges")
 	cmd.Flags().BoolVar(&web, "web", false, "launch a browser")
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "output the resolved dependency graph as a JSON adjacency list instead of a digraph")
 	cmd.Flags().StringVar(&cacheDir, "cache-dir", "", "directory to use for caching apk packages and indexes (default '' means to use system-defined cache directory)")
 	cmd.Flags().BoolVar(&offline, "offline", false, "do not use network to fetch packages (cache must be pre-populated)")
 	cmd.Flags().StringVarP(&extRegistryViewer, "registry-explorer", "e", "apk.dag.dev", "FQDN of the registry explorer that rendered nodes in SVG will link to.")
@@ -93,7 +97,7 @@ apko dot --web -S example.yaml
 	return cmd
 }
 
-func DotCmd(ctx context.Context, configFile string, archs []types.Architecture, web, span bool, opts ...build.Option) error {
+func DotCmd(ctx context.Context, configFile string, archs []types.Architecture, web, span, jsonOut bool, opts ...build.Option) error {
 	log := clog.FromContext(ctx)
 	wd, err := os.MkdirTemp("", "apko-*")
 	if err != nil {
@@ -141,6 +145,12 @@ func DotCmd(ctx context.Context, configFile string, archs []types.Architecture,
 	log.Infof("using working directory %s", wd)
 
 	pkgs, _, resolveErr := bc.BuildPackageList(ctx)
+	if jsonOut {
+		if resolveErr != nil {
+			return resolveErr
+		}
+		return build.NewDependencyGraph(pkgs).Write(os.Stdout)
+	}
 	if resolveErr != nil {
 		log.Errorf("failed to get package list for image: %v", resolveErr)
 	}
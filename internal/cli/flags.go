@@ -15,9 +15,17 @@
 package cli
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/spf13/cobra"
 
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
 	"chainguard.dev/apko/pkg/options"
+	"chainguard.dev/apko/pkg/sbom/generator/spdx"
 )
 
 // addClientLimitFlags adds size limit flags for APK client operations (fetching indexes, expanding packages).
@@ -33,3 +41,370 @@ func addClientLimitFlags(cmd *cobra.Command, limits *options.SizeLimits) {
 	cmd.Flags().Int64Var(&limits.HTTPResponseMaxSize, "max-http-response-size", defaults.HTTPResponseMaxSize,
 		"maximum size for HTTP responses in bytes (0=default, -1=no limit)")
 }
+
+// addSBOMLicenseFlags adds the flags setting the SPDX license list version
+// declared in the SBOMs and normalizing their license expressions.
+func addSBOMLicenseFlags(cmd *cobra.Command, version *string, normalize *bool) {
+	cmd.Flags().StringVar(version, "sbom-license-list-version", "", "SPDX license list version to declare in the generated SBOMs, e.g. \"3.27\" (defaults to "+spdx.DefaultLicenseListVersion+")")
+	cmd.Flags().BoolVar(normalize, "sbom-normalize-licenses", false, "rewrite the license expressions in the SBOMs in their canonical SPDX form, declaring the version of the embedded SPDX license list")
+}
+
+// addSBOMLintFlag adds the flag checking the SBOMs before writing them.
+func addSBOMLintFlag(cmd *cobra.Command, lint *bool) {
+	cmd.Flags().BoolVar(lint, "sbom-lint", false, "check the SBOMs for missing required fields, invalid values, malformed identifiers and dangling references before writing them")
+}
+
+// addForceRemovePackagesFlag adds the flag removing the packages listed in
+// remove_packages even if remaining packages depend on them.
+func addForceRemovePackagesFlag(cmd *cobra.Command, force *bool) {
+	cmd.Flags().BoolVar(force, "force-remove-packages", false, "remove the packages listed in remove_packages even if remaining packages depend on them")
+}
+
+// addFetchConcurrencyFlag adds the flag limiting how many packages are fetched at once.
+func addFetchConcurrencyFlag(cmd *cobra.Command, n *int) {
+	cmd.Flags().IntVar(n, "fetch-concurrency", 0, "maximum number of packages to fetch at once (0=number of CPUs)")
+}
+
+// addDisableHTTP2Flag adds the flag restricting the requests to the
+// repositories to HTTP/1.1.
+func addDisableHTTP2Flag(cmd *cobra.Command, disable *bool) {
+	cmd.Flags().BoolVar(disable, "disable-http2", false, "fetch from the repositories over HTTP/1.1 only, e.g. for proxies which mishandle HTTP/2")
+}
+
+// addCompressionConcurrencyFlag adds the flag limiting how many layers are
+// compressed at once.
+func addCompressionConcurrencyFlag(cmd *cobra.Command, n *int) {
+	cmd.Flags().IntVar(n, "compression-concurrency", 0, "maximum number of layers of a layered image to compress at once (0=based on the number of CPUs)")
+}
+
+// addMaxLayerSizeFlags adds the flags failing the build when its layers are
+// over a maximum size.
+func addMaxLayerSizeFlags(cmd *cobra.Command, size *int64, compressed *bool) {
+	cmd.Flags().Int64Var(size, "max-layer-size", 0, "fail the build if the total size of the layers of an image is over this many bytes (0=no maximum)")
+	cmd.Flags().BoolVar(compressed, "max-layer-size-compressed", false, "apply --max-layer-size to the compressed size of the layers rather than their uncompressed size")
+}
+
+// addSBOMConcurrencyFlag adds the flag limiting how many SBOMs of an image
+// are generated at once.
+func addSBOMConcurrencyFlag(cmd *cobra.Command, n *int) {
+	cmd.Flags().IntVar(n, "sbom-concurrency", 0, "maximum number of SBOM formats of an image to generate at once (0=number of CPUs)")
+}
+
+// addSBOMPackagePurposeFlags adds the flags setting the primaryPackagePurpose
+// of the packages of the SBOMs, the overrides being parsed by
+// parsePackagePurposes.
+func addSBOMPackagePurposeFlags(cmd *cobra.Command, enabled *bool, raw *[]string) {
+	cmd.Flags().BoolVar(enabled, "sbom-package-purposes", false, "set the primaryPackagePurpose of the packages of the SBOMs by their type: CONTAINER, OPERATING_SYSTEM, APPLICATION or LIBRARY")
+	cmd.Flags().StringArrayVar(raw, "sbom-package-purpose", nil, "primaryPackagePurpose of an apk package with --sbom-package-purposes, e.g. ca-certificates-bundle=FILE (can be repeated)")
+}
+
+// parsePackagePurposes parses the package=purpose pairs of the
+// --sbom-package-purpose flag.
+func parsePackagePurposes(raw []string) (map[string]string, error) {
+	purposes := make(map[string]string, len(raw))
+	for _, s := range raw {
+		name, purpose, ok := strings.Cut(s, "=")
+		if !ok || name == "" || purpose == "" {
+			return nil, fmt.Errorf("unable to parse package purpose %q, expected package=purpose", s)
+		}
+		if _, ok := purposes[name]; ok {
+			return nil, fmt.Errorf("purpose of package %s defined more than once", name)
+		}
+		purposes[name] = purpose
+	}
+	return purposes, nil
+}
+
+// addSBOMAppPackageFlags adds the flags telling the application packages
+// from those of the operating system in the SBOMs.
+func addSBOMAppPackageFlags(cmd *cobra.Command, patterns *[]string, relationship *string) {
+	cmd.Flags().StringArrayVar(patterns, "sbom-app-package", nil, "pattern of the names of the application packages, on top of the app_packages of the configuration, e.g. myapp-* (can be repeated)")
+	cmd.Flags().StringVar(relationship, "sbom-app-package-relationship", "", "SPDX relationship type from the image to the application packages in the SBOMs, rather than CONTAINS (default OTHER, commented APPLICATION_PACKAGE)")
+}
+
+// addSBOMTimestampFormatFlag adds the flag setting the layout of the
+// timestamps of the SBOMs.
+func addSBOMTimestampFormatFlag(cmd *cobra.Command, layout *string) {
+	cmd.Flags().StringVar(layout, "sbom-timestamp-format", "", "Go time layout of the timestamps of the SBOMs, which are in UTC, e.g. 2006-01-02T15:04:05.000Z (default RFC 3339)")
+}
+
+// addSBOMOutputFlags adds the flags setting the file names and priorities of
+// the SBOMs of each format, parsed by parseSBOMOutputs.
+func addSBOMOutputFlags(cmd *cobra.Command, names, priorities *[]string) {
+	cmd.Flags().StringArrayVar(names, "sbom-file-name", nil, "file name of the SBOMs of a format, with {arch} replaced by the architecture or index, e.g. spdx={arch}.spdx.json (can be repeated)")
+	cmd.Flags().StringArrayVar(priorities, "sbom-priority", nil, "priority of the SBOMs of a format, which are written and listed from the highest priority, the first being the primary SBOM, e.g. spdx=10 (can be repeated)")
+}
+
+// parseSBOMOutputs parses the format=name and format=priority pairs of the
+// --sbom-file-name and --sbom-priority flags.
+func parseSBOMOutputs(names, priorities []string) (map[string]options.SBOMOutput, error) {
+	outputs := map[string]options.SBOMOutput{}
+	for _, s := range names {
+		format, name, ok := strings.Cut(s, "=")
+		if !ok || format == "" || name == "" {
+			return nil, fmt.Errorf("unable to parse SBOM file name %q, expected format=name", s)
+		}
+		out := outputs[format]
+		if out.FileName != "" {
+			return nil, fmt.Errorf("file name of the %s SBOMs defined more than once", format)
+		}
+		out.FileName = name
+		outputs[format] = out
+	}
+	seen := map[string]bool{}
+	for _, s := range priorities {
+		format, raw, ok := strings.Cut(s, "=")
+		if !ok || format == "" {
+			return nil, fmt.Errorf("unable to parse SBOM priority %q, expected format=priority", s)
+		}
+		priority, err := strconv.Atoi(raw)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse SBOM priority %q: %w", s, err)
+		}
+		if seen[format] {
+			return nil, fmt.Errorf("priority of the %s SBOMs defined more than once", format)
+		}
+		seen[format] = true
+		out := outputs[format]
+		out.Priority = priority
+		outputs[format] = out
+	}
+	return outputs, nil
+}
+
+// addBuildTimeoutFlag adds the flag bounding the duration of the whole build.
+func addBuildTimeoutFlag(cmd *cobra.Command, timeout *time.Duration) {
+	cmd.Flags().DurationVar(timeout, "build-timeout", 0, "maximum duration of the whole build, e.g. 30m, after which it is canceled (0=no timeout)")
+}
+
+// addKeepTempDirFlag adds the flag keeping the temporary directories of the
+// build for debugging.
+func addKeepTempDirFlag(cmd *cobra.Command, keep *bool) {
+	cmd.Flags().BoolVar(keep, "keep-temp-dir", false, "keep the temporary and working directories of the build, e.g. for debugging, rather than removing them")
+}
+
+// addStandardDirsFlag adds the flag setting up the standard directories of
+// the image, see standardDirs.
+func addStandardDirsFlag(cmd *cobra.Command, enable *bool) {
+	cmd.Flags().BoolVar(enable, "standard-dirs", false, "create /tmp, /var/tmp and /var/log if missing and give them their standard permissions, e.g. 1777 for /tmp")
+}
+
+// standardDirs returns the standard directories to set up with the
+// --standard-dirs flag.
+func standardDirs(enable bool) []types.PathMutation {
+	if !enable {
+		return nil
+	}
+	return build.DefaultStandardDirs
+}
+
+// addReproducibilityManifestFlag adds the flag writing the manifest of the
+// build inputs next to the SBOMs.
+func addReproducibilityManifestFlag(cmd *cobra.Command, enable *bool) {
+	cmd.Flags().BoolVar(enable, "reproducibility-manifest", false, "write a manifest of the build inputs (repositories, packages, build date, apko version and config digest) next to the SBOMs, and record its digest in the index SBOM")
+}
+
+// addFileCapabilitiesFlag adds the flag setting capabilities on files of the
+// image, parsed by parseFileCapabilities.
+func addFileCapabilitiesFlag(cmd *cobra.Command, raw *[]string) {
+	cmd.Flags().StringArrayVar(raw, "file-capabilities", nil, "capabilities to set on a file of the image, in the setcap(8) notation, e.g. /usr/bin/server=cap_net_bind_service+ep (can be repeated)")
+}
+
+// parseFileCapabilities parses the path=capabilities pairs of the
+// --file-capabilities flag.
+func parseFileCapabilities(raw []string) (map[string]string, error) {
+	capabilities := make(map[string]string, len(raw))
+	for _, s := range raw {
+		p, caps, ok := strings.Cut(s, "=")
+		if !ok || p == "" || caps == "" {
+			return nil, fmt.Errorf("unable to parse file capabilities %q, expected path=capabilities", s)
+		}
+		if _, ok := capabilities[p]; ok {
+			return nil, fmt.Errorf("file capabilities of %s defined more than once", p)
+		}
+		capabilities[p] = caps
+	}
+	return capabilities, nil
+}
+
+// addConfigHistoryFlag adds the flag recording the configuration-only settings
+// of the image as empty layers of its history.
+func addConfigHistoryFlag(cmd *cobra.Command, enable *bool) {
+	cmd.Flags().BoolVar(enable, "config-history", false, "record configuration-only settings (env, labels, entrypoint, ...) as empty layers in the image history")
+}
+
+// addPruneEmptyDirsFlags adds the flags removing the empty directories of the
+// image.
+func addPruneEmptyDirsFlags(cmd *cobra.Command, enable *bool, keep *[]string) {
+	cmd.Flags().BoolVar(enable, "prune-empty-dirs", false, "remove empty directories from the image, except common runtime directories (/tmp, /run, ...) and account home directories")
+	cmd.Flags().StringSliceVar(keep, "prune-keep-dir", []string{}, "additional directories to keep when pruning empty directories")
+}
+
+// addCanonicalApkDBFlag adds the flag sorting the entries of the installed apk
+// database by package name.
+func addCanonicalApkDBFlag(cmd *cobra.Command, enable *bool) {
+	cmd.Flags().BoolVar(enable, "canonical-apk-db", false, "sort the entries of the installed apk database by package name, so that it does not depend on install order")
+}
+
+// addBrokenSymlinksFlag adds the flag checking the image for broken symlinks.
+func addBrokenSymlinksFlag(cmd *cobra.Command, mode *string) {
+	cmd.Flags().StringVar(mode, "broken-symlinks", "", "check the image for symlinks whose target is missing or outside the image, and \"warn\" or \"fail\" the build if there are any")
+}
+
+// addSBOMCommentFlag adds the flag setting the comment of the SBOM documents.
+func addSBOMCommentFlag(cmd *cobra.Command, comment *string) {
+	cmd.Flags().StringVar(comment, "sbom-comment", "", "comment to set on the generated SBOM documents, e.g. \"nightly build\"")
+}
+
+// addSBOMPackageNameTemplateFlag adds the flag setting the template of the
+// names of the packages of the SBOMs.
+func addSBOMPackageNameTemplateFlag(cmd *cobra.Command, template *string) {
+	cmd.Flags().StringVar(template, "sbom-package-name-template", "", "template of the names of the packages in the SBOMs, with the {name}, {version}, {arch} and {distro} placeholders, e.g. \"{name}-{arch}\"")
+}
+
+// addSBOMIndexSignaturesFlag adds the flag annotating the packages of the SBOMs
+// with whether the signature of their index was verified.
+func addSBOMIndexSignaturesFlag(cmd *cobra.Command, enable *bool) {
+	cmd.Flags().BoolVar(enable, "sbom-index-signatures", false, "annotate each package in the SBOMs with whether the signature of its apk index was verified")
+}
+
+// addSBOMRelationshipCommentsFlag adds the flag commenting the relationships
+// from the image to its packages with why each package was installed.
+func addSBOMRelationshipCommentsFlag(cmd *cobra.Command, enable *bool) {
+	cmd.Flags().BoolVar(enable, "sbom-relationship-comments", false, "comment the relationships from the image to its packages in the SBOMs with why each package was installed")
+}
+
+// addSBOMGeneratedFilesFlag adds the flag adding the files generated by apko to
+// the SBOMs.
+func addSBOMGeneratedFilesFlag(cmd *cobra.Command, enable *bool) {
+	cmd.Flags().BoolVar(enable, "sbom-generated-files", false, "add the files generated by apko, such as the busybox links, to the SBOMs as generated from apko, and the configuration files among them as the configuration of the image")
+}
+
+// addSBOMSplitVersionsFlag adds the flag recording the parts of the versions of
+// the packages of the SBOMs separately.
+func addSBOMSplitVersionsFlag(cmd *cobra.Command, enable *bool) {
+	cmd.Flags().BoolVar(enable, "sbom-split-versions", false, "record the upstream version, epoch and release of the apk packages in the SBOMs separately, as purl qualifiers and annotations")
+}
+
+// addVerifyDependenciesFlag adds the flag failing the build when a runtime
+// dependency of an installed package is not satisfied.
+func addVerifyDependenciesFlag(cmd *cobra.Command, enable *bool) {
+	cmd.Flags().BoolVar(enable, "verify-dependencies", false, "fail the build if a runtime dependency of an installed package is not satisfied by the installed packages")
+}
+
+// addCheckFileOwnershipFlag adds the flag failing the build when packages
+// provide the same file.
+func addCheckFileOwnershipFlag(cmd *cobra.Command, enable *bool) {
+	cmd.Flags().BoolVar(enable, "check-file-ownership", false, "fail the build, before installing anything, if packages provide the same file and apk would not resolve it through replaces or a shared origin")
+}
+
+// addStalePinsFlag adds the flag warning about the packages pinned to an older
+// version than the newest one available.
+func addStalePinsFlag(cmd *cobra.Command, enable *bool) {
+	cmd.Flags().BoolVar(enable, "stale-pins", false, "warn about the packages pinned to a version older than the newest one available in the repositories")
+}
+
+// addPackageMtimesFlag adds the flag setting the mtime of the files to the
+// build date of their package.
+func addPackageMtimesFlag(cmd *cobra.Command, enable *bool) {
+	cmd.Flags().BoolVar(enable, "package-mtimes", false, "set the mtime of each file to the build date of the package owning it, and the others to the source date epoch")
+}
+
+// addSBOMIndexDigestsFlag adds the flag recording the digests of the repository
+// indexes in the SBOMs.
+func addSBOMIndexDigestsFlag(cmd *cobra.Command, enable *bool) {
+	cmd.Flags().BoolVar(enable, "sbom-index-digests", false, "record the digests of the repository indexes the packages were resolved from as annotations of the SBOMs")
+}
+
+// addSBOMEmbedConfigFlag adds the flag recording the image configuration in the
+// SBOMs.
+func addSBOMEmbedConfigFlag(cmd *cobra.Command, enable *bool) {
+	cmd.Flags().BoolVar(enable, "sbom-embed-config", false, "record the image configuration in an annotation of the SBOMs (it may contain secrets, e.g. in environment variables)")
+}
+
+// addRequireLicensesFlags adds the flags failing the build when packages have
+// no license.
+func addRequireLicensesFlags(cmd *cobra.Command, enable *bool, exceptions *[]string) {
+	cmd.Flags().BoolVar(enable, "require-licenses", false, "fail if any resolved package has an empty or NOASSERTION license")
+	cmd.Flags().StringSliceVar(exceptions, "license-exceptions", []string{}, "packages allowed to have no license with --require-licenses")
+}
+
+// addSBOMDigestAnnotationFlag adds the flag annotating the images of the index
+// with the digest of their SBOM.
+func addSBOMDigestAnnotationFlag(cmd *cobra.Command, enable *bool) {
+	cmd.Flags().BoolVar(enable, "sbom-digest-annotation", false, fmt.Sprintf("annotate each image in the index with the digest of its SBOM as %s", build.SBOMDigestAnnotation))
+}
+
+// addSBOMStreamingFlag adds the flag encoding the packages of the JSON SBOMs
+// one at a time.
+func addSBOMStreamingFlag(cmd *cobra.Command, enable *bool) {
+	cmd.Flags().BoolVar(enable, "sbom-streaming", false, "encode the packages of the JSON SBOMs to their files one at a time rather than the whole documents at once (the documents are still built in memory)")
+}
+
+// addNoScriptsFlag adds the flag neither recording package scriptlets and
+// triggers nor running their apko equivalents.
+func addNoScriptsFlag(cmd *cobra.Command, enable *bool) {
+	cmd.Flags().BoolVar(enable, "no-scripts", false, "neither record package scriptlets and triggers nor generate the busybox links and /etc/ld.so.cache in their place")
+}
+
+// addCABundleFlag adds the flag installing a CA certificates bundle when no
+// package provides one.
+func addCABundleFlag(cmd *cobra.Command, path *string) {
+	cmd.Flags().StringVar(path, "ca-bundle", "", "path to a PEM CA certificates bundle to install in /etc/ssl/certs when no package provides one")
+}
+
+// addApkDBRootFlag adds the flag setting the directory of the apk database in
+// the image.
+func addApkDBRootFlag(cmd *cobra.Command, root *string) {
+	cmd.Flags().StringVar(root, "apk-db-root", "", "directory of the apk database in the image, instead of /usr/lib/apk")
+}
+
+// addSBOMContentNamespaceFlag adds the flag deriving the namespace of the SBOM
+// documents from their packages.
+func addSBOMContentNamespaceFlag(cmd *cobra.Command, enable *bool) {
+	cmd.Flags().BoolVar(enable, "sbom-content-namespace", false, "derive the namespace of the SBOM documents from the hash of their packages")
+}
+
+// addSBOMPackageVCSFlags adds the flags adding the commits the packages were
+// built from to their purls in the SBOMs.
+func addSBOMPackageVCSFlags(cmd *cobra.Command, enable *bool, url *string) {
+	cmd.Flags().BoolVar(enable, "sbom-package-vcs", false, "add the commits the packages were built from to their purls in the SBOMs")
+	cmd.Flags().StringVar(url, "sbom-package-vcs-url", "", "URL of the repository the packages are built from, for the vcs_url qualifier of their purls with --sbom-package-vcs")
+}
+
+// addDistrolessFlags adds the flags leaving the apk tooling and the shells out
+// of the image layers.
+func addDistrolessFlags(cmd *cobra.Command, enable *bool, paths *[]string) {
+	cmd.Flags().BoolVar(enable, "distroless", false, "leave the apk tooling and database, busybox and the shells out of the image layers, keeping the packages in the SBOMs")
+	cmd.Flags().StringSliceVar(paths, "distroless-paths", nil, "paths to leave out of the image layers with --distroless, instead of the default ones")
+}
+
+// addSBOMPackageLabelFlag adds the flag restricting the packages of the SBOMs
+// to those with a label.
+func addSBOMPackageLabelFlag(cmd *cobra.Command, label *string) {
+	cmd.Flags().StringVar(label, "sbom-package-label", "", "only list the packages with this label in the package_labels of the configuration in the SBOMs")
+}
+
+// addSBOMPackagesOnlyFlag adds the flag describing only the packages in the
+// SBOMs.
+func addSBOMPackagesOnlyFlag(cmd *cobra.Command, enable *bool) {
+	cmd.Flags().BoolVar(enable, "sbom-packages-only", false, "only describe the packages, not the image and its layers, in the SBOMs")
+}
+
+// addSBOMSigningKeyFlag adds the flag signing the SBOMs with a private key.
+func addSBOMSigningKeyFlag(cmd *cobra.Command, path *string) {
+	cmd.Flags().StringVar(path, "sbom-signing-key", "", "path to a PEM encoded private key to sign the SBOMs with, writing a .sig detached signature next to each")
+}
+
+// addSBOMImagePurlFlags adds the flags setting the type and namespace of the
+// purls of the image and its layers in the SBOMs.
+func addSBOMImagePurlFlags(cmd *cobra.Command, typ, namespace *string) {
+	cmd.Flags().StringVar(typ, "sbom-image-purl-type", "", "type of the purls of the image and its layers in the SBOMs (default oci)")
+	cmd.Flags().StringVar(namespace, "sbom-image-purl-namespace", "", "namespace of the purls of the image and its layers in the SBOMs")
+}
+
+// addSBOMDuplicateVersionsFlag adds the flag handling the packages installed
+// with several versions in the SBOMs.
+func addSBOMDuplicateVersionsFlag(cmd *cobra.Command, mode *string) {
+	cmd.Flags().StringVar(mode, "sbom-duplicate-versions", "", "how to handle packages installed with several versions in the SBOMs: annotate or fail")
+}
@@ -21,10 +21,10 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/authn/github"
-	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/spf13/cobra"
 	"go.opentelemetry.io/otel"
@@ -43,19 +43,78 @@ func publish() *cobra.Command {
 	var buildDate string
 	var sbomPath string
 	var sbomFormats []string
+	var sbomComment string
+	var sbomLicenseListVersion string
+	var sbomNormalizeLicenses bool
+	var sbomPackageNameTemplate string
+	var sbomIndexSignatures bool
+	var sbomRelationshipComments bool
+	var sbomGeneratedFiles bool
+	var sbomSplitVersions bool
+	var keepTempDir bool
 	var archstrs []string
 	var extraKeys []string
 	var extraBuildRepos []string
 	var extraRepos []string
 	var extraPackages []string
 	var rawAnnotations []string
+	var rawFileCapabilities []string
+	var verifyDependencies bool
+	var forceRemovePackages bool
+	var stdDirs bool
+	var checkFileOwnership bool
+	var stalePins bool
+	var packageMtimes bool
+	var sbomIndexDigests bool
+	var sbomEmbedConfig bool
+	var requireLicenses bool
+	var licenseExceptions []string
+	var sbomDigestAnnotation bool
+	var sbomStreaming bool
+	var noScripts bool
+	var caBundle string
+	var apkDBRoot string
+	var sbomContentNamespace bool
+	var sbomPackageVCS bool
+	var sbomPackageVCSURL string
+	var distroless bool
+	var distrolessPaths []string
+	var sbomPackageLabel string
+	var sbomPackagesOnly bool
+	var sbomSigningKey string
+	var sbomImagePurlType, sbomImagePurlNamespace string
+	var sbomLint bool
+	var sbomDuplicateVersions string
+	var sbomPackagePurposes bool
+	var rawSBOMPackagePurposes []string
+	var sbomAppPackages []string
+	var sbomAppPackageRelationship string
+	var rawSBOMFileNames []string
+	var rawSBOMPriorities []string
+	var sbomTimestampFormat string
 	var withVCS bool
+	var configHistory bool
+	var pruneEmptyDirs bool
+	var pruneKeepDirs []string
+	var canonicalApkDB bool
+	var brokenSymlinks string
+	var compressionConcurrency int
+	var maxLayerSize int64
+	var maxLayerSizeCompressed bool
+	var sbomConcurrency int
+	var reproducibilityManifest bool
 	var writeSBOM bool
 	var local bool
 	var cacheDir string
 	var offline bool
 	var lockfile string
 	var ignoreSignatures bool
+	var fetchConcurrency int
+	var disableHTTP2 bool
+	var buildTimeout time.Duration
+	var registryCACert string
+	var registryCert string
+	var registryKey string
 
 	cmd := &cobra.Command{
 		Use:   "publish <config.yaml> <tag...>",
@@ -79,12 +138,31 @@ in a keychain.`,
 			if err != nil {
 				return fmt.Errorf("parsing annotations from command line: %w", err)
 			}
+			fileCapabilities, err := parseFileCapabilities(rawFileCapabilities)
+			if err != nil {
+				return fmt.Errorf("parsing file capabilities from command line: %w", err)
+			}
+			packagePurposes, err := parsePackagePurposes(rawSBOMPackagePurposes)
+			if err != nil {
+				return fmt.Errorf("parsing SBOM package purposes from command line: %w", err)
+			}
+			sbomOutputs, err := parseSBOMOutputs(rawSBOMFileNames, rawSBOMPriorities)
+			if err != nil {
+				return fmt.Errorf("parsing SBOM outputs from command line: %w", err)
+			}
 
 			keychain := authn.NewMultiKeychain(
 				authn.DefaultKeychain,
 				github.Keychain,
 			)
 			remoteOpts := []remote.Option{remote.WithAuthFromKeychain(keychain)}
+			if registryCACert != "" || registryCert != "" || registryKey != "" {
+				t, err := oci.TLSTransport(registryCACert, registryCert, registryKey)
+				if err != nil {
+					return fmt.Errorf("configuring registry TLS: %w", err)
+				}
+				remoteOpts = append(remoteOpts, remote.WithTransport(t))
+			}
 
 			pusher, err := remote.NewPusher(remoteOpts...)
 			if err != nil {
@@ -102,7 +180,7 @@ in a keychain.`,
 			if err != nil {
 				return fmt.Errorf("creating tempdir: %w", err)
 			}
-			defer os.RemoveAll(tmp)
+			defer build.RemoveTempDir(cmd.Context(), tmp, keepTempDir)
 
 			if err := PublishCmd(cmd.Context(), imageRefs, archs, remoteOpts,
 				sbomPath,
@@ -111,6 +189,42 @@ in a keychain.`,
 					build.WithBuildDate(buildDate),
 					build.WithSBOM(sbomPath),
 					build.WithSBOMGenerators(sbomGenerators...),
+					build.WithSBOMComment(sbomComment),
+					build.WithSBOMLicenseListVersion(sbomLicenseListVersion),
+					build.WithSBOMNormalizeLicenses(sbomNormalizeLicenses),
+					build.WithSBOMPackageNameTemplate(sbomPackageNameTemplate),
+					build.WithSBOMIndexSignatures(sbomIndexSignatures),
+					build.WithSBOMRelationshipComments(sbomRelationshipComments),
+					build.WithSBOMGeneratedFiles(sbomGeneratedFiles),
+					build.WithSBOMSplitVersions(sbomSplitVersions),
+					build.WithFileCapabilities(fileCapabilities),
+					build.WithVerifyDependencies(verifyDependencies),
+					build.WithForceRemovePackages(forceRemovePackages),
+					build.WithStandardDirs(standardDirs(stdDirs)),
+					build.WithFileOwnershipCheck(checkFileOwnership),
+					build.WithStalePins(stalePins),
+					build.WithPackageMtimes(packageMtimes),
+					build.WithSBOMIndexDigests(sbomIndexDigests),
+					build.WithSBOMEmbedConfig(sbomEmbedConfig),
+					build.WithRequireLicenses(requireLicenses, licenseExceptions),
+					build.WithSBOMDigestAnnotation(sbomDigestAnnotation),
+					build.WithSBOMStreaming(sbomStreaming),
+					build.WithNoScripts(noScripts),
+					build.WithCABundle(caBundle),
+					build.WithApkDBRoot(apkDBRoot),
+					build.WithSBOMContentNamespace(sbomContentNamespace),
+					build.WithSBOMPackageVCS(sbomPackageVCS, sbomPackageVCSURL),
+					build.WithDistroless(distroless, distrolessPaths),
+					build.WithSBOMPackageLabel(sbomPackageLabel),
+					build.WithSBOMPackagesOnly(sbomPackagesOnly),
+					build.WithSBOMSigningKey(sbomSigningKey),
+					build.WithSBOMImagePurl(sbomImagePurlType, sbomImagePurlNamespace),
+					build.WithSBOMLint(sbomLint),
+					build.WithSBOMDuplicateVersions(sbomDuplicateVersions),
+					build.WithSBOMPackagePurposes(sbomPackagePurposes, packagePurposes),
+					build.WithSBOMAppPackages(sbomAppPackages, sbomAppPackageRelationship),
+					build.WithSBOMTimestampFormat(sbomTimestampFormat),
+					build.WithSBOMOutputs(sbomOutputs),
 					build.WithExtraKeys(extraKeys),
 					build.WithExtraBuildRepos(extraBuildRepos),
 					build.WithExtraRepos(extraRepos),
@@ -121,7 +235,19 @@ in a keychain.`,
 					build.WithCache(cacheDir, offline, apk.NewCache(true)),
 					build.WithLockFile(lockfile),
 					build.WithTempDir(tmp),
+					build.WithKeepTempDir(keepTempDir),
 					build.WithIgnoreSignatures(ignoreSignatures),
+					build.WithFetchConcurrency(fetchConcurrency),
+					build.WithDisableHTTP2(disableHTTP2),
+					build.WithCompressionConcurrency(compressionConcurrency),
+					build.WithMaxLayerSize(maxLayerSize, maxLayerSizeCompressed),
+					build.WithSBOMConcurrency(sbomConcurrency),
+					build.WithBuildTimeout(buildTimeout),
+					build.WithConfigHistory(configHistory),
+					build.WithPruneEmptyDirs(pruneEmptyDirs, pruneKeepDirs...),
+					build.WithCanonicalApkDB(canonicalApkDB),
+					build.WithBrokenSymlinks(brokenSymlinks),
+					build.WithReproducibilityManifest(reproducibilityManifest),
 				},
 				[]PublishOption{
 					// these are extra here just for publish; everything before is the same for BuildCmd as PublishCmd
@@ -136,16 +262,52 @@ in a keychain.`,
 	}
 
 	cmd.Flags().BoolVar(&withVCS, "vcs", true, "detect and embed VCS URLs")
+	addConfigHistoryFlag(cmd, &configHistory)
+	addPruneEmptyDirsFlags(cmd, &pruneEmptyDirs, &pruneKeepDirs)
+	addCanonicalApkDBFlag(cmd, &canonicalApkDB)
+	addBrokenSymlinksFlag(cmd, &brokenSymlinks)
+	addReproducibilityManifestFlag(cmd, &reproducibilityManifest)
 	cmd.Flags().StringVar(&buildDate, "build-date", "", "date used for the timestamps of the files inside the image")
 	cmd.Flags().BoolVar(&writeSBOM, "sbom", true, "generate an SBOM")
 	cmd.Flags().StringVar(&sbomPath, "sbom-path", "", "path to write the SBOMs")
 	cmd.Flags().StringSliceVar(&archstrs, "arch", nil, "architectures to build for (e.g., x86_64,ppc64le,arm64) -- default is all, unless specified in config.")
 	cmd.Flags().StringSliceVarP(&extraKeys, "keyring-append", "k", []string{}, "path to extra keys to include in the keyring")
 	cmd.Flags().StringSliceVar(&sbomFormats, "sbom-formats", []string{"spdx"}, "SBOM formats to output")
+	addSBOMCommentFlag(cmd, &sbomComment)
+	addSBOMLicenseFlags(cmd, &sbomLicenseListVersion, &sbomNormalizeLicenses)
+	addSBOMPackageNameTemplateFlag(cmd, &sbomPackageNameTemplate)
+	addSBOMIndexSignaturesFlag(cmd, &sbomIndexSignatures)
+	addSBOMRelationshipCommentsFlag(cmd, &sbomRelationshipComments)
+	addSBOMGeneratedFilesFlag(cmd, &sbomGeneratedFiles)
+	addSBOMSplitVersionsFlag(cmd, &sbomSplitVersions)
 	cmd.Flags().StringSliceVarP(&extraBuildRepos, "build-repository-append", "b", []string{}, "path to extra repositories to include")
 	cmd.Flags().StringSliceVarP(&extraRepos, "repository-append", "r", []string{}, "path to extra repositories to include")
 	cmd.Flags().StringSliceVarP(&extraPackages, "package-append", "p", []string{}, "extra packages to include")
 	cmd.Flags().StringSliceVar(&rawAnnotations, "annotations", []string{}, "OCI annotations to add. Separate with colon (key:value)")
+	addFileCapabilitiesFlag(cmd, &rawFileCapabilities)
+	addStandardDirsFlag(cmd, &stdDirs)
+	addVerifyDependenciesFlag(cmd, &verifyDependencies)
+	addForceRemovePackagesFlag(cmd, &forceRemovePackages)
+	addCheckFileOwnershipFlag(cmd, &checkFileOwnership)
+	addStalePinsFlag(cmd, &stalePins)
+	addPackageMtimesFlag(cmd, &packageMtimes)
+	addSBOMIndexDigestsFlag(cmd, &sbomIndexDigests)
+	addSBOMEmbedConfigFlag(cmd, &sbomEmbedConfig)
+	addRequireLicensesFlags(cmd, &requireLicenses, &licenseExceptions)
+	addSBOMDigestAnnotationFlag(cmd, &sbomDigestAnnotation)
+	addSBOMStreamingFlag(cmd, &sbomStreaming)
+	addNoScriptsFlag(cmd, &noScripts)
+	addCABundleFlag(cmd, &caBundle)
+	addApkDBRootFlag(cmd, &apkDBRoot)
+	addSBOMContentNamespaceFlag(cmd, &sbomContentNamespace)
+	addSBOMPackageVCSFlags(cmd, &sbomPackageVCS, &sbomPackageVCSURL)
+	addDistrolessFlags(cmd, &distroless, &distrolessPaths)
+	addSBOMPackageLabelFlag(cmd, &sbomPackageLabel)
+	addSBOMPackagesOnlyFlag(cmd, &sbomPackagesOnly)
+	addSBOMSigningKeyFlag(cmd, &sbomSigningKey)
+	addSBOMImagePurlFlags(cmd, &sbomImagePurlType, &sbomImagePurlNamespace)
+	addSBOMLintFlag(cmd, &sbomLint)
+	addSBOMDuplicateVersionsFlag(cmd, &sbomDuplicateVersions)
 	cmd.Flags().StringVar(&cacheDir, "cache-dir", "", "directory to use for caching apk packages and indexes (default '' means to use system-defined cache directory)")
 	cmd.Flags().BoolVar(&offline, "offline", false, "do not use network to fetch packages (cache must be pre-populated)")
 	cmd.Flags().StringVar(&lockfile, "lockfile", "", "a path to .lock.json file (e.g. produced by apko lock) that constraints versions of packages to the listed ones (default '' means no additional constraints)")
@@ -154,11 +316,25 @@ in a keychain.`,
 	// these are extra here just for publish; everything before is the same for BuildCmd as PublishCmd
 	cmd.Flags().BoolVar(&local, "local", false, "publish image just to local Docker daemon")
 	cmd.Flags().StringVar(&imageRefs, "image-refs", "", "path to file where a list of the published image references will be written")
+	cmd.Flags().StringVar(&registryCACert, "registry-ca-cert", "", "path to a PEM file of additional CA certificates to trust for the registry")
+	cmd.Flags().StringVar(&registryCert, "registry-cert", "", "path to a PEM client certificate to present to the registry")
+	cmd.Flags().StringVar(&registryKey, "registry-key", "", "path to the PEM private key for --registry-cert")
+	addFetchConcurrencyFlag(cmd, &fetchConcurrency)
+	addDisableHTTP2Flag(cmd, &disableHTTP2)
+	addCompressionConcurrencyFlag(cmd, &compressionConcurrency)
+	addMaxLayerSizeFlags(cmd, &maxLayerSize, &maxLayerSizeCompressed)
+	addSBOMConcurrencyFlag(cmd, &sbomConcurrency)
+	addSBOMPackagePurposeFlags(cmd, &sbomPackagePurposes, &rawSBOMPackagePurposes)
+	addSBOMAppPackageFlags(cmd, &sbomAppPackages, &sbomAppPackageRelationship)
+	addSBOMTimestampFormatFlag(cmd, &sbomTimestampFormat)
+	addSBOMOutputFlags(cmd, &rawSBOMFileNames, &rawSBOMPriorities)
+	addBuildTimeoutFlag(cmd, &buildTimeout)
+	addKeepTempDirFlag(cmd, &keepTempDir)
 
 	return cmd
 }
 
-func PublishCmd(ctx context.Context, outputRefs string, archs []types.Architecture, ropt []remote.Option, sbomPath string, buildOpts []build.Option, publishOpts []PublishOption) error {
+func PublishCmd(ctx context.Context, outputRefs string, archs []types.Architecture, ropt []remote.Option, sbomPath string, buildOpts []build.Option, publishOpts []PublishOption) (err error) {
 	log := clog.FromContext(ctx)
 	ctx, span := otel.Tracer("apko").Start(ctx, "PublishCmd")
 	defer span.End()
@@ -170,14 +346,23 @@ func PublishCmd(ctx context.Context, outputRefs string, archs []types.Architectu
 		}
 	}
 
-	wd, err := os.MkdirTemp("", "apko-*")
+	o, _, err := build.NewOptions(buildOpts...)
 	if err != nil {
-		return fmt.Errorf("failed to create working directory: %w", err)
+		return err
 	}
-	defer os.RemoveAll(wd)
+
+	// The timeout covers publishing the images too.
+	ctx, done := build.WithTimeout(ctx, o.BuildTimeout)
+	defer func() { err = done(err) }()
+
+	wd, buildOpts, cleanup, err := makeBuildDirs(ctx, o, buildOpts)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
 
 	// build all of the components in the working directory
-	idx, sboms, err := buildImageComponents(ctx, wd, archs, buildOpts...)
+	idx, sboms, manifest, err := buildImageComponents(ctx, wd, archs, buildOpts...)
 	if err != nil {
 		return fmt.Errorf("failed to build image components: %w", err)
 	}
@@ -201,7 +386,7 @@ func PublishCmd(ctx context.Context, outputRefs string, archs []types.Architectu
 
 	// publish each arch-specific image
 	// TODO: This should just happen as part of PublishIndex.
-	ref, err := name.ParseReference(tags[0])
+	ref, err := types.NormalizeReference(tags[0])
 	if err != nil {
 		return fmt.Errorf("parsing %q as tag: %w", tags[0], err)
 	}
@@ -229,13 +414,22 @@ func PublishCmd(ctx context.Context, outputRefs string, archs []types.Architectu
 		}
 	}
 
-	// copy sboms over to the sbomPath target directory
+	// copy sboms over to the sbomPath target directory, and list them in
+	// their order, the primary one of each architecture first
 	if sbomPath != "" {
 		for _, sbom := range sboms {
+			dest := filepath.Join(sbomPath, filepath.Base(sbom.Path))
 			// because os.Rename fails across partitions, we do our own
-			if err := rename(sbom.Path, filepath.Join(sbomPath, filepath.Base(sbom.Path))); err != nil {
+			if err := rename(sbom.Path, dest); err != nil {
 				return fmt.Errorf("moving sbom: %w", err)
 			}
+			log.Infof("wrote %s SBOM %s", sbom.Format, dest)
+		}
+
+		if manifest != nil {
+			if err := manifest.WriteFile(filepath.Join(sbomPath, build.ReproducibilityManifestFileName)); err != nil {
+				return err
+			}
 		}
 	}
 
@@ -82,6 +82,12 @@ type APKIndex struct { //nolint:revive
 	Signature   []byte
 	Description string
 	Packages    []*Package
+	// Digest is the digest of the index archive, as "sha256:<hex>", when
+	// the index was fetched from a repository.
+	Digest string
+	// SignatureVerified is set when the signature of the index archive was
+	// verified as it was fetched from a repository.
+	SignatureVerified bool
 }
 
 // Splitting empty string results in single element array with one empty string, which would
@@ -17,8 +17,10 @@ package apk
 import (
 	"context"
 	"encoding/base32"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"net/http"
 	"net/url"
 	"os"
@@ -181,7 +183,7 @@ func (t *cacheTransport) RoundTrip(request *http.Request) (*http.Response, error
 		f, err := os.Open(cacheFile)
 		if err != nil {
 			if t.offline {
-				return nil, fmt.Errorf("failed to read %q in offline cache: %w", cacheFile, err)
+				return nil, fmt.Errorf("%w: %s is not in the cache: %w", ErrOffline, request.URL.Redacted(), err)
 			}
 
 			_, span := otel.Tracer("go-apk").Start(ctx, fmt.Sprintf("Request(%q)", request.URL.String()))
@@ -198,7 +200,7 @@ func (t *cacheTransport) RoundTrip(request *http.Request) (*http.Response, error
 	}
 
 	if t.offline {
-		return t.fetchOffline(cacheFile)
+		return t.fetchOffline(request, cacheFile)
 	}
 
 	return t.fetchAndCache(ctx, request, cacheFile)
@@ -312,10 +314,12 @@ func (t *cacheTransport) fetchAndCache(ctx context.Context, request *http.Reques
 	}, nil
 }
 
-func (t *cacheTransport) fetchOffline(cacheFile string) (*http.Response, error) {
+func (t *cacheTransport) fetchOffline(request *http.Request, cacheFile string) (*http.Response, error) {
 	cacheDir := cacheDirFromFile(cacheFile)
 	des, err := os.ReadDir(cacheDir)
-	if err != nil {
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s is not in the cache", ErrOffline, request.URL.Redacted())
+	} else if err != nil {
 		return nil, fmt.Errorf("listing %q for offline cache: %w", cacheDir, err)
 	}
 
@@ -328,7 +332,7 @@ func (t *cacheTransport) fetchOffline(cacheFile string) (*http.Response, error)
 	}
 
 	if len(files) == 0 {
-		return nil, fmt.Errorf("no offline cached entries for %s", cacheDir)
+		return nil, fmt.Errorf("%w: %s is not in the cache", ErrOffline, request.URL.Redacted())
 	}
 
 	newest, err := files[0].Info()
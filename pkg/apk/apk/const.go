@@ -18,6 +18,9 @@ const (
 	DefaultKeyRingPath       = "/etc/apk/keys"
 	DefaultSystemKeyRingPath = "/usr/share/apk/keys/"
 	indexFilename            = "APKINDEX.tar.gz"
+	// DefaultDBRoot is the directory of the apk database, unless set with
+	// WithDBRoot.
+	DefaultDBRoot = "usr/lib/apk"
 	// we are using these for fs.FS so should omit the leading /
 	reposFilePath     = "etc/apk/repositories"
 	archFilePath      = "etc/apk/arch"
@@ -26,6 +26,7 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
+	"maps"
 	"net/http"
 	"net/url"
 	"os"
@@ -35,6 +36,7 @@ import (
 	"runtime"
 	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/hashicorp/go-retryablehttp"
@@ -71,10 +73,18 @@ type APK struct {
 	auth               auth.Authenticator
 	packageGetter      PackageGetter
 	sizeLimits         *SizeLimits
+	fetchConcurrency   int
+	noScripts          bool
+	dbRoot             string
 
 	// filename to owning package, last write wins
 	installedFiles map[string]*Package
 
+	// indexDigests are the digests of the indexes used by the last
+	// resolution, keyed by the URI of the index.
+	indexDigestsMu sync.Mutex
+	indexDigests   map[string]string
+
 	// This is a map of arch to apk.APK for every arch in a mult-arch situation.
 	// It's stuffed here to avoid plumbing it across every method, but it's optional.
 	ByArch map[string]*APK
@@ -88,6 +98,31 @@ func (a *APK) apkIndexDecompressedMaxSize() int64 {
 	return 0 // use default
 }
 
+// fetchJobs returns how many packages to fetch and expand at once.
+func (a *APK) fetchJobs() int {
+	if a.fetchConcurrency > 0 {
+		return a.fetchConcurrency
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+// dbPath returns where p, a path under DefaultDBRoot, is with the database
+// root of a. Other paths are returned as is.
+func (a *APK) dbPath(p string) string {
+	if a.dbRoot == DefaultDBRoot {
+		return p
+	}
+	abs := strings.HasPrefix(p, "/")
+	rest, ok := strings.CutPrefix(strings.TrimPrefix(p, "/"), DefaultDBRoot)
+	if !ok || (rest != "" && !strings.HasPrefix(rest, "/")) {
+		return p
+	}
+	if abs {
+		return "/" + a.dbRoot + rest
+	}
+	return a.dbRoot + rest
+}
+
 func New(ctx context.Context, options ...Option) (*APK, error) {
 	opt := defaultOpts()
 	for _, o := range options {
@@ -101,8 +136,24 @@ func New(ctx context.Context, options ...Option) (*APK, error) {
 		opt.fs = apkfs.DirFS(ctx, "/")
 	}
 
-	// Wrap transport with response size limiter
+	if opt.cache != nil && opt.cache.offline {
+		opt.offline = true
+	} else if opt.cache != nil && opt.offline {
+		opt.cache.offline = true
+	}
+
 	transport := opt.transport
+	if opt.offline {
+		transport = offlineTransport{}
+	} else if opt.disableHTTP2 {
+		t, ok := transport.(*http.Transport)
+		if !ok {
+			return nil, fmt.Errorf("cannot disable HTTP/2 on a %T transport", transport)
+		}
+		transport = http1Transport(t)
+	}
+
+	// Wrap transport with response size limiter
 	var httpResponseMaxSize int64
 	if opt.sizeLimits != nil {
 		httpResponseMaxSize = opt.sizeLimits.HTTPResponseMaxSize
@@ -112,6 +163,12 @@ func New(ctx context.Context, options ...Option) (*APK, error) {
 	client := retryablehttp.NewClient()
 	client.HTTPClient = &http.Client{Transport: transport}
 	client.Logger = clog.FromContext(ctx)
+	client.CheckRetry = func(ctx context.Context, resp *http.Response, err error) (bool, error) {
+		if errors.Is(err, ErrOffline) {
+			return false, err
+		}
+		return retryablehttp.DefaultRetryPolicy(ctx, resp, err)
+	}
 
 	httpClient := client.StandardClient()
 
@@ -144,6 +201,9 @@ func New(ctx context.Context, options ...Option) (*APK, error) {
 		auth:               opt.auth,
 		packageGetter:      packageGetter,
 		sizeLimits:         opt.sizeLimits,
+		fetchConcurrency:   opt.fetchConcurrency,
+		noScripts:          opt.noScripts,
+		dbRoot:             opt.dbRoot,
 	}, nil
 }
 
@@ -226,7 +286,7 @@ func (a *APK) ListInitFiles() []tar.Header {
 
 	for _, e := range initDirectories {
 		headers = append(headers, tar.Header{
-			Name:     e.path,
+			Name:     a.dbPath(e.path),
 			Mode:     int64(e.perms),
 			Typeflag: tar.TypeDir,
 			Uid:      0,
@@ -235,7 +295,7 @@ func (a *APK) ListInitFiles() []tar.Header {
 	}
 	for _, e := range append(initFiles, additionalFiles...) {
 		headers = append(headers, tar.Header{
-			Name:     e.path,
+			Name:     a.dbPath(e.path),
 			Mode:     int64(e.perms),
 			Typeflag: tar.TypeReg,
 			Uid:      0,
@@ -254,7 +314,7 @@ func (a *APK) ListInitFiles() []tar.Header {
 
 	// add scripts.tar with nothing in it
 	headers = append(headers, tar.Header{
-		Name:     scriptsFilePath,
+		Name:     a.dbPath(scriptsFilePath),
 		Mode:     int64(scriptsTarPerms),
 		Typeflag: tar.TypeReg,
 		Uid:      0,
@@ -300,24 +360,32 @@ func (a *APK) InitDB(ctx context.Context, buildRepos ...string) error {
 			return fmt.Errorf("base directory %s has incorrect permissions: %o", e.path, stat.Mode().Perm())
 		}
 	}
+	if a.dbRoot != DefaultDBRoot {
+		// The parents of a custom database root are not in initDirectories.
+		if err := a.fs.MkdirAll(path.Dir(a.dbRoot), 0o755); err != nil {
+			return fmt.Errorf("failed to create the parents of the apk database root %s: %w", a.dbRoot, err)
+		}
+	}
 	for _, e := range initDirectories {
-		err := a.fs.Mkdir(e.path, e.perms)
+		dirPath := a.dbPath(e.path)
+		err := a.fs.Mkdir(dirPath, e.perms)
 		switch {
 		case err != nil && !errors.Is(err, fs.ErrExist):
-			return fmt.Errorf("failed to create directory %s: %w", e.path, err)
+			return fmt.Errorf("failed to create directory %s: %w", dirPath, err)
 		case err != nil && errors.Is(err, fs.ErrExist):
-			stat, err := a.fs.Stat(e.path)
+			stat, err := a.fs.Stat(dirPath)
 			if err != nil {
-				return fmt.Errorf("failed to stat directory %s: %w", e.path, err)
+				return fmt.Errorf("failed to stat directory %s: %w", dirPath, err)
 			}
 			if !stat.IsDir() {
-				return fmt.Errorf("failed to create directory %s: already exists as file", e.path)
+				return fmt.Errorf("failed to create directory %s: already exists as file", dirPath)
 			}
 		}
 	}
 	for _, e := range append(initFiles, additionalFiles...) {
-		if err := a.fs.WriteFile(e.path, e.contents, e.perms); err != nil {
-			return fmt.Errorf("failed to create file %s: %w", e.path, err)
+		filePath := a.dbPath(e.path)
+		if err := a.fs.WriteFile(filePath, e.contents, e.perms); err != nil {
+			return fmt.Errorf("failed to create file %s: %w", filePath, err)
 		}
 	}
 	for _, e := range initDeviceFiles {
@@ -330,9 +398,9 @@ func (a *APK) InitDB(ctx context.Context, buildRepos ...string) error {
 
 	// add scripts.tar with nothing in it
 	scriptsTarPerms := 0o644
-	TarFile, err := a.fs.OpenFile(scriptsFilePath, os.O_CREATE|os.O_WRONLY, fs.FileMode(scriptsTarPerms))
+	TarFile, err := a.fs.OpenFile(a.dbPath(scriptsFilePath), os.O_CREATE|os.O_WRONLY, fs.FileMode(scriptsTarPerms))
 	if err != nil {
-		return fmt.Errorf("could not create tarball file '%s', got error '%w'", scriptsFilePath, err)
+		return fmt.Errorf("could not create tarball file '%s', got error '%w'", a.dbPath(scriptsFilePath), err)
 	}
 	defer TarFile.Close()
 	tarWriter := tar.NewWriter(TarFile)
@@ -392,6 +460,13 @@ func (a *APK) resolveApkDB(ctx context.Context) error {
 	_, span := otel.Tracer("go-apk").Start(ctx, "resolveApkDB")
 	defer span.End()
 
+	// A custom database root is where it was configured to be, there is
+	// nothing to link.
+	if a.dbRoot != DefaultDBRoot {
+		log.Debugf("apk database in /%s", a.dbRoot)
+		return nil
+	}
+
 	// Do nothing more if /lib already points at usr/lib (absolute or relative).
 	if target, err := a.fs.Readlink("/lib"); err == nil {
 		// MemFS will only let Readlink succeed on a real symlink.
@@ -624,6 +699,9 @@ func (a *APK) ResolveWorld(ctx context.Context) (toInstall []*RepositoryPackage,
 	}
 	// debugging info, if requested
 	log.Debugf("got %d indexes:\n%s", len(indexes), strings.Join(indexNames(indexes), "\n"))
+	a.indexDigestsMu.Lock()
+	a.indexDigests = IndexDigests(indexes)
+	a.indexDigestsMu.Unlock()
 
 	// 2. Get the dependency tree for each package from the world file
 	directPkgs, err := a.GetWorld()
@@ -650,12 +728,18 @@ func (a *APK) ResolveWorld(ctx context.Context) (toInstall []*RepositoryPackage,
 	return
 }
 
-func (a *APK) CalculateWorld(ctx context.Context, allpkgs []*RepositoryPackage) ([]*APKResolved, error) {
-	// TODO: Consider making this configurable option.
-	jobs := runtime.GOMAXPROCS(0)
+// ResolvedIndexDigests returns the digests of the index archives the last
+// ResolveWorld resolved the packages from, keyed by the URI of the index, so
+// that the repository snapshot a package set came from can be recorded.
+func (a *APK) ResolvedIndexDigests() map[string]string {
+	a.indexDigestsMu.Lock()
+	defer a.indexDigestsMu.Unlock()
+	return maps.Clone(a.indexDigests)
+}
 
+func (a *APK) CalculateWorld(ctx context.Context, allpkgs []*RepositoryPackage) ([]*APKResolved, error) {
 	var g errgroup.Group
-	g.SetLimit(jobs + 1)
+	g.SetLimit(a.fetchJobs() + 1)
 
 	resolved := make([]*APKResolved, len(allpkgs))
 
@@ -710,7 +794,8 @@ func (a *APK) FixateWorld(ctx context.Context, sourceDateEpoch *time.Time) ([]In
 		equivalent of: "apk fix --arch arch --root root"
 		with possible options for --no-scripts, --no-cache, --update-cache
 
-		current default is: cache=false, updateCache=true, executeScripts=false
+		current default is: cache=false, updateCache=true, executeScripts=false;
+		WithNoScripts also skips recording the scripts and triggers
 	*/
 	log.Debug("synchronizing with desired apk world")
 
@@ -724,6 +809,14 @@ func (a *APK) FixateWorld(ctx context.Context, sourceDateEpoch *time.Time) ([]In
 		return nil, fmt.Errorf("error getting package dependencies: %w", err)
 	}
 
+	return a.FixateResolvedWorld(ctx, sourceDateEpoch, allpkgs, conflicts)
+}
+
+// FixateResolvedWorld installs allpkgs, with the conflicts, as returned by
+// ResolveWorld, like FixateWorld does once it has resolved the world. This
+// lets callers inspect the resolved packages before installing them
+// without resolving the world twice.
+func (a *APK) FixateResolvedWorld(ctx context.Context, sourceDateEpoch *time.Time, allpkgs []*RepositoryPackage, conflicts []string) ([]InstalledDiff, error) {
 	// 3. For each name on the list:
 	//     a. Check if it is installed, if so, skip
 	//     b. Get the .apk file
@@ -759,11 +852,9 @@ type InstalledDiff struct {
 }
 
 func (a *APK) InstallPackages(ctx context.Context, sourceDateEpoch *time.Time, allpkgs []InstallablePackage) ([]InstalledDiff, error) {
-	// TODO: Consider making this configurable option.
-	jobs := runtime.GOMAXPROCS(0)
-
+	// One more job than fetchJobs for the goroutine installing the packages.
 	var g errgroup.Group
-	g.SetLimit(jobs + 1)
+	g.SetLimit(a.fetchJobs() + 1)
 
 	expanded := make([]*expandapk.APKExpanded, len(allpkgs))
 
@@ -1204,6 +1295,10 @@ func (a *APK) installPackage(ctx context.Context, pkg *Package, expanded *expand
 		}
 	}
 
+	if a.noScripts {
+		return installedFiles, nil
+	}
+
 	// update the scripts.tar
 	controlData, err := expanded.ControlData()
 	if err != nil {
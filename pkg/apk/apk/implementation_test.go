@@ -105,6 +105,29 @@ func TestInitDB(t *testing.T) {
 	require.Len(t, ent, 0) // No keys discovered
 }
 
+func TestInitDB_DBRoot(t *testing.T) {
+	src := apkfs.NewMemFS()
+	apk, err := New(t.Context(), WithFS(src), WithIgnoreMknodErrors(ignoreMknodErrors), WithDBRoot("/var/lib/apk"))
+	require.NoError(t, err)
+	require.NoError(t, apk.InitDB(context.Background()))
+
+	for _, f := range []string{"var/lib/apk/db/installed", "var/lib/apk/db/triggers", "var/lib/apk/db/scripts.tar", "var/lib/apk/db/lock"} {
+		fi, err := fs.Stat(src, f)
+		require.NoError(t, err, "error statting %s", f)
+		require.True(t, fi.Mode().IsRegular(), "expected %s to be a regular file, got %v", f, fi.Mode())
+	}
+	_, err = fs.Stat(src, "usr/lib/apk/db")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+	require.Equal(t, "var/lib/apk/db/installed", apk.InstalledDBPath())
+
+	installed, err := apk.GetInstalled()
+	require.NoError(t, err)
+	require.Empty(t, installed)
+
+	_, err = New(t.Context(), WithFS(src), WithDBRoot("../apk"))
+	require.Error(t, err)
+}
+
 func TestInitDB_ChainguardDiscovery(t *testing.T) {
 	src := apkfs.NewMemFS()
 	apk, err := New(t.Context(), WithFS(src), WithIgnoreMknodErrors(ignoreMknodErrors))
@@ -19,6 +19,8 @@ import (
 	"bytes"
 	"context"
 	"crypto"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -343,7 +345,8 @@ func parseRepositoryIndex(ctx context.Context, u string, keys map[string][]byte,
 	_, span := otel.Tracer("go-apk").Start(ctx, "parseRepositoryIndex")
 	defer span.End()
 	// validate the signature
-	if shouldCheckSignatureForIndex(u, arch, opts) {
+	checkSignature := shouldCheckSignatureForIndex(u, arch, opts)
+	if checkSignature {
 		if len(keys) == 0 {
 			return nil, fmt.Errorf("no keys provided to verify signature")
 		}
@@ -465,6 +468,9 @@ func parseRepositoryIndex(ctx context.Context, u string, keys map[string][]byte,
 	if err != nil {
 		return nil, fmt.Errorf("unable to read convert repository index bytes to index struct: %w", err)
 	}
+	digest := sha256.Sum256(b)
+	index.Digest = "sha256:" + hex.EncodeToString(digest[:])
+	index.SignatureVerified = checkSignature
 
 	return index, err
 }
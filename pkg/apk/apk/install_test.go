@@ -22,14 +22,21 @@ import (
 	"crypto/sha1" //nolint:gosec // this is what apk tools is using
 	"crypto/sha256"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 	"text/template"
+	"time"
 
 	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/apk/expandapk"
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
 )
 
 type testDirEntry struct {
@@ -298,6 +305,124 @@ func TestInstallAPKFiles(t *testing.T) {
 	})
 }
 
+// slowPackageGetter delays fetching the first package, and records how many
+// packages were fetched at once.
+type slowPackageGetter struct {
+	PackageGetter
+	first string
+
+	mu          sync.Mutex
+	inFlight    int
+	maxInFlight int
+}
+
+func (g *slowPackageGetter) GetPackage(ctx context.Context, pkg InstallablePackage) (*expandapk.APKExpanded, error) {
+	g.mu.Lock()
+	g.inFlight++
+	g.maxInFlight = max(g.maxInFlight, g.inFlight)
+	g.mu.Unlock()
+	defer func() {
+		g.mu.Lock()
+		g.inFlight--
+		g.mu.Unlock()
+	}()
+
+	if pkg.PackageName() == g.first {
+		time.Sleep(100 * time.Millisecond)
+	}
+	return g.PackageGetter.GetPackage(ctx, pkg)
+}
+
+func TestInstallPackagesFetchConcurrency(t *testing.T) {
+	_, err := New(t.Context(), WithFetchConcurrency(-1))
+	require.Error(t, err)
+
+	apk, src, err := testGetTestAPK()
+	require.NoError(t, err)
+	apk.fetchConcurrency = 2
+	getter := &slowPackageGetter{PackageGetter: apk.packageGetter, first: "first"}
+	apk.packageGetter = getter
+
+	var pkgs []InstallablePackage
+	for i, name := range []string{"first", "second", "third", "fourth"} {
+		pkg := &Package{Name: name, Origin: name}
+		if i > 0 {
+			// Each package replaces the one before it, so the content of
+			// the shared file depends on the installation order.
+			pkg.Replaces = []string{pkgs[i-1].PackageName()}
+		}
+		pkgs = append(pkgs, fakePackage(t, pkg, []testDirEntry{
+			{"etc", 0o755, true, nil, nil},
+			{"etc/shared", 0o644, false, []byte(name), nil},
+		}))
+	}
+
+	_, err = apk.InstallPackages(t.Context(), nil, pkgs)
+	require.NoError(t, err)
+	require.LessOrEqual(t, getter.maxInFlight, 2)
+
+	actual, err := src.ReadFile("etc/shared")
+	require.NoError(t, err)
+	require.Equal(t, "fourth", string(actual))
+
+	installed, err := apk.GetInstalled()
+	require.NoError(t, err)
+	var names []string
+	for _, pkg := range installed {
+		names = append(names, pkg.Name)
+	}
+	require.Equal(t, []string{"first", "second", "third", "fourth"}, names[len(names)-4:])
+}
+
+func TestInstallPackagesNoScripts(t *testing.T) {
+	for _, noScripts := range []bool{false, true} {
+		t.Run(fmt.Sprintf("noScripts=%t", noScripts), func(t *testing.T) {
+			apk, err := New(t.Context(), WithFS(apkfs.NewMemFS()), WithIgnoreMknodErrors(true), WithNoScripts(noScripts))
+			require.NoError(t, err)
+			require.NoError(t, apk.InitDB(t.Context()))
+
+			// alpine-baselayout has pre- and post-install scriptlets.
+			pkg := testPkg
+			diffs, err := apk.InstallPackages(t.Context(), nil, []InstallablePackage{&testPackage{
+				pkg:      &pkg,
+				file:     filepath.Join(testPrimaryPkgDir, testPkgFilename),
+				checksum: base64.StdEncoding.EncodeToString(testPkg.Checksum),
+			}})
+			require.NoError(t, err)
+
+			// The package is installed either way.
+			require.Len(t, diffs, 1)
+			require.Equal(t, testPkg.Name, diffs[0].Package.Name)
+
+			if noScripts {
+				require.Zero(t, countScripts(t, apk))
+			} else {
+				require.NotZero(t, countScripts(t, apk))
+			}
+		})
+	}
+}
+
+// countScripts returns the number of scripts in scripts.tar.
+func countScripts(t *testing.T, apk *APK) int {
+	t.Helper()
+
+	scriptsTar, err := apk.readScriptsTar()
+	require.NoError(t, err)
+	defer scriptsTar.Close()
+
+	n := 0
+	tr := tar.NewReader(scriptsTar)
+	for {
+		_, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return n
+		}
+		require.NoError(t, err)
+		n++
+	}
+}
+
 func checkDuplicateIDBEntries(t *testing.T, apk *APK) {
 	t.Helper()
 
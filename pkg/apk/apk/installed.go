@@ -17,6 +17,7 @@ package apk
 import (
 	"archive/tar"
 	"bufio"
+	"bytes"
 	"encoding/base64"
 	"encoding/hex"
 	"errors"
@@ -24,6 +25,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -35,11 +37,17 @@ type InstalledPackage struct {
 	Files []tar.Header
 }
 
+// InstalledDBPath returns the path of the installed database, relative to
+// the root of the filesystem, e.g. "usr/lib/apk/db/installed".
+func (a *APK) InstalledDBPath() string {
+	return a.dbPath(installedFilePath)
+}
+
 // getInstalledPackages get list of installed packages
 func (a *APK) GetInstalled() ([]*InstalledPackage, error) {
-	installedFile, err := a.fs.Open(installedFilePath)
+	installedFile, err := a.fs.Open(a.dbPath(installedFilePath))
 	if err != nil {
-		return nil, fmt.Errorf("could not open installed file in %s at %s: %w", a.fs, installedFilePath, err)
+		return nil, fmt.Errorf("could not open installed file in %s at %s: %w", a.fs, a.dbPath(installedFilePath), err)
 	}
 	defer installedFile.Close()
 	return ParseInstalled(installedFile)
@@ -49,9 +57,9 @@ func (a *APK) GetInstalled() ([]*InstalledPackage, error) {
 // the _incremental_ diff installing the package had on the idb file.
 func (a *APK) AddInstalledPackage(pkg *Package, files []tar.Header) ([]byte, error) {
 	// be sure to open the file in append mode so we add to the end
-	installedFile, err := a.fs.OpenFile(installedFilePath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	installedFile, err := a.fs.OpenFile(a.dbPath(installedFilePath), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
 	if err != nil {
-		return nil, fmt.Errorf("could not open installed file at %s: %w", installedFilePath, err)
+		return nil, fmt.Errorf("could not open installed file at %s: %w", a.dbPath(installedFilePath), err)
 	}
 	defer installedFile.Close()
 
@@ -104,6 +112,221 @@ func (a *APK) AddInstalledPackage(pkg *Package, files []tar.Header) ([]byte, err
 	return b, nil
 }
 
+// RemoveInstalledPackage removes the package named name from the list of
+// installed packages, along with its scripts and triggers, and returns its
+// entry. The files of the package and the world are left in place.
+func (a *APK) RemoveInstalledPackage(name string) (*InstalledPackage, error) {
+	entries, err := a.readInstalledEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	var removed *InstalledPackage
+	kept := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !slices.Contains(strings.Split(entry, "\n"), "P:"+name) {
+			kept = append(kept, entry)
+			continue
+		}
+		pkgs, err := ParseInstalled(strings.NewReader(entry + "\n\n"))
+		if err != nil {
+			return nil, fmt.Errorf("parsing installed entry for %s: %w", name, err)
+		}
+		if len(pkgs) == 1 {
+			removed = pkgs[0]
+		}
+	}
+	if removed == nil {
+		return nil, fmt.Errorf("package %s is not installed", name)
+	}
+
+	if err := a.writeInstalledEntries(kept); err != nil {
+		return nil, err
+	}
+	if err := a.removeScripts(&removed.Package); err != nil {
+		return nil, err
+	}
+	if err := a.removeTriggers(&removed.Package); err != nil {
+		return nil, err
+	}
+	return removed, nil
+}
+
+// removeScripts removes the scripts of pkg from the scripts tarball, if any.
+func (a *APK) removeScripts(pkg *Package) error {
+	b, err := a.fs.ReadFile(a.dbPath(scriptsFilePath))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("unable to read scripts file %s: %w", a.dbPath(scriptsFilePath), err)
+	}
+
+	prefix := fmt.Sprintf("%s-%s.Q1%s", pkg.Name, pkg.Version, base64.StdEncoding.EncodeToString(pkg.Checksum))
+	var buf bytes.Buffer
+	tr := tar.NewReader(bytes.NewReader(b))
+	tw := tar.NewWriter(&buf)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("unable to read scripts file %s: %w", a.dbPath(scriptsFilePath), err)
+		}
+		if strings.HasPrefix(header.Name, prefix) {
+			continue
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return fmt.Errorf("unable to write scripts header for %s: %w", header.Name, err)
+		}
+		if _, err := io.CopyN(tw, tr, header.Size); err != nil {
+			return fmt.Errorf("unable to write content for %s: %w", header.Name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("unable to write scripts file %s: %w", a.dbPath(scriptsFilePath), err)
+	}
+
+	if err := a.fs.WriteFile(a.dbPath(scriptsFilePath), buf.Bytes(), scriptsTarPerms); err != nil {
+		return fmt.Errorf("unable to write scripts file %s: %w", a.dbPath(scriptsFilePath), err)
+	}
+	return nil
+}
+
+// removeTriggers removes the triggers of pkg from the triggers file, if any.
+func (a *APK) removeTriggers(pkg *Package) error {
+	b, err := a.fs.ReadFile(a.dbPath(triggersFilePath))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("unable to read triggers file %s: %w", a.dbPath(triggersFilePath), err)
+	}
+	fi, err := a.fs.Stat(a.dbPath(triggersFilePath))
+	if err != nil {
+		return fmt.Errorf("unable to stat triggers file %s: %w", a.dbPath(triggersFilePath), err)
+	}
+
+	cksum := "Q1" + base64.StdEncoding.EncodeToString(pkg.Checksum)
+	var kept strings.Builder
+	for line := range strings.Lines(string(b)) {
+		if fields := strings.Fields(line); len(fields) != 0 && fields[0] == cksum {
+			continue
+		}
+		kept.WriteString(line)
+	}
+
+	if err := a.fs.WriteFile(a.dbPath(triggersFilePath), []byte(kept.String()), fi.Mode().Perm()); err != nil {
+		return fmt.Errorf("unable to write triggers file %s: %w", a.dbPath(triggersFilePath), err)
+	}
+	return nil
+}
+
+// RemoveInstalledFiles removes the files and directories for which remove
+// returns true from the file lists of the installed packages. The contents
+// of a removed directory are removed too. The files themselves are left in
+// place.
+func (a *APK) RemoveInstalledFiles(remove func(path string) bool) error {
+	entries, err := a.readInstalledEntries()
+	if err != nil {
+		return err
+	}
+
+	for i, entry := range entries {
+		var (
+			lines       = strings.Split(entry, "\n")
+			kept        = make([]string, 0, len(lines))
+			dir         string
+			dirRemoved  bool
+			fileRemoved bool
+		)
+		for _, line := range lines {
+			switch {
+			case strings.HasPrefix(line, "F:"):
+				dir = line[2:]
+				dirRemoved = dir != "" && remove(dir)
+				fileRemoved = false
+				if dirRemoved {
+					continue
+				}
+			case strings.HasPrefix(line, "M:"):
+				if dirRemoved {
+					continue
+				}
+			case strings.HasPrefix(line, "R:"):
+				fileRemoved = dirRemoved || remove(filepath.Join(dir, line[2:]))
+				if fileRemoved {
+					continue
+				}
+			case strings.HasPrefix(line, "a:"), strings.HasPrefix(line, "Z:"):
+				if fileRemoved {
+					continue
+				}
+			}
+			kept = append(kept, line)
+		}
+		entries[i] = strings.Join(kept, "\n")
+	}
+
+	return a.writeInstalledEntries(entries)
+}
+
+// CanonicalizeInstalled sorts the entries of the installed database by
+// package name and version, so that the database does not depend on the
+// order in which packages were installed. The entries themselves are left
+// as they are.
+func (a *APK) CanonicalizeInstalled() error {
+	entries, err := a.readInstalledEntries()
+	if err != nil {
+		return err
+	}
+
+	field := func(entry, key string) string {
+		for line := range strings.SplitSeq(entry, "\n") {
+			if v, ok := strings.CutPrefix(line, key); ok {
+				return v
+			}
+		}
+		return ""
+	}
+	slices.SortStableFunc(entries, func(x, y string) int {
+		if c := strings.Compare(field(x, "P:"), field(y, "P:")); c != 0 {
+			return c
+		}
+		return strings.Compare(field(x, "V:"), field(y, "V:"))
+	})
+
+	return a.writeInstalledEntries(entries)
+}
+
+// readInstalledEntries returns the entries of the installed database, one
+// per package, without the blank lines separating them.
+func (a *APK) readInstalledEntries() ([]string, error) {
+	b, err := a.fs.ReadFile(a.dbPath(installedFilePath))
+	if err != nil {
+		return nil, fmt.Errorf("could not read installed file at %s: %w", a.dbPath(installedFilePath), err)
+	}
+	var entries []string
+	for entry := range strings.SplitSeq(string(b), "\n\n") {
+		if entry = strings.Trim(entry, "\n"); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// writeInstalledEntries replaces the installed database with entries.
+func (a *APK) writeInstalledEntries(entries []string) error {
+	var b strings.Builder
+	for _, entry := range entries {
+		b.WriteString(entry)
+		b.WriteString("\n\n")
+	}
+	if err := a.fs.WriteFile(a.dbPath(installedFilePath), []byte(b.String()), 0o644); err != nil {
+		return fmt.Errorf("could not write installed file at %s: %w", a.dbPath(installedFilePath), err)
+	}
+	return nil
+}
+
 // isInstalledPackage check if a specific package is installed
 func (a *APK) isInstalledPackage(pkg string) (bool, error) {
 	installedPackages, err := a.GetInstalled()
@@ -121,13 +344,13 @@ func (a *APK) isInstalledPackage(pkg string) (bool, error) {
 // updateScriptsTar insert the scripts into the tarball
 func (a *APK) updateScriptsTar(pkg *Package, controlData io.Reader, sourceDateEpoch *time.Time) error {
 	tr := tar.NewReader(controlData)
-	fi, err := a.fs.Stat(scriptsFilePath)
+	fi, err := a.fs.Stat(a.dbPath(scriptsFilePath))
 	if err != nil {
 		return fmt.Errorf("unable to stat scripts file: %w", err)
 	}
-	scripts, err := a.fs.OpenFile(scriptsFilePath, os.O_RDWR, 0)
+	scripts, err := a.fs.OpenFile(a.dbPath(scriptsFilePath), os.O_RDWR, 0)
 	if err != nil {
-		return fmt.Errorf("unable to open scripts file %s: %w", scriptsFilePath, err)
+		return fmt.Errorf("unable to open scripts file %s: %w", a.dbPath(scriptsFilePath), err)
 	}
 	defer scripts.Close()
 
@@ -186,20 +409,20 @@ func (a *APK) updateScriptsTar(pkg *Package, controlData io.Reader, sourceDateEp
 
 // readScriptsTar returns a reader for the current scripts.tar. It is up to the caller to close it.
 func (a *APK) readScriptsTar() (io.ReadCloser, error) {
-	return a.fs.Open(scriptsFilePath)
+	return a.fs.Open(a.dbPath(scriptsFilePath))
 }
 
 // updateTriggers insert the triggers into the triggers file
 func (a *APK) updateTriggers(pkg *Package, values []string) error {
-	triggers, err := a.fs.OpenFile(triggersFilePath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0)
+	triggers, err := a.fs.OpenFile(a.dbPath(triggersFilePath), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0)
 	if err != nil {
-		return fmt.Errorf("unable to open triggers file %s: %w", triggersFilePath, err)
+		return fmt.Errorf("unable to open triggers file %s: %w", a.dbPath(triggersFilePath), err)
 	}
 	defer triggers.Close()
 
 	for _, value := range values {
 		if _, err := fmt.Fprintf(triggers, "Q1%s %s\n", base64.StdEncoding.EncodeToString(pkg.Checksum), value); err != nil {
-			return fmt.Errorf("unable to write triggers file %s: %w", triggersFilePath, err)
+			return fmt.Errorf("unable to write triggers file %s: %w", a.dbPath(triggersFilePath), err)
 		}
 	}
 
@@ -208,7 +431,7 @@ func (a *APK) updateTriggers(pkg *Package, values []string) error {
 
 // readTriggers returns a reader for the current triggers. It is up to the caller to close it.
 func (a *APK) readTriggers() (io.ReadCloser, error) {
-	return a.fs.Open(triggersFilePath)
+	return a.fs.Open(a.dbPath(triggersFilePath))
 }
 
 // parseInstalled parses an installed file. It returns the installed packages.
@@ -26,6 +26,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"slices"
 	"sort"
 	"strings"
 	"testing"
@@ -334,6 +335,124 @@ func TestIsInstalledPackage(t *testing.T) {
 	}
 }
 
+func TestRemoveInstalledPackage(t *testing.T) {
+	a, _, err := testGetTestAPK()
+	require.NoError(t, err)
+
+	removed, err := a.RemoveInstalledPackage("busybox")
+	require.NoError(t, err)
+	require.Equal(t, "busybox", removed.Name)
+	require.NotEmpty(t, removed.Files)
+
+	pkgs, err := a.GetInstalled()
+	require.NoError(t, err)
+	require.Len(t, pkgs, len(testInstalledPackages)-1)
+	for _, pkg := range pkgs {
+		require.NotEqual(t, "busybox", pkg.Name)
+	}
+
+	// The scripts and the trigger of busybox are gone, those of the other
+	// packages are kept.
+	scriptsTar, err := a.readScriptsTar()
+	require.NoError(t, err)
+	defer scriptsTar.Close()
+	var scripts []string
+	tr := tar.NewReader(scriptsTar)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		scripts = append(scripts, header.Name)
+	}
+	require.Equal(t, []string{
+		"alpine-baselayout-3.2.0-r22.Q1PGxwzLd7SQ/SZjUGrncnpjjtpKY=.pre-install",
+		"alpine-baselayout-3.2.0-r22.Q1PGxwzLd7SQ/SZjUGrncnpjjtpKY=.post-install",
+		"alpine-baselayout-3.2.0-r22.Q1PGxwzLd7SQ/SZjUGrncnpjjtpKY=.pre-upgrade",
+		"alpine-baselayout-3.2.0-r22.Q1PGxwzLd7SQ/SZjUGrncnpjjtpKY=.post-upgrade",
+	}, scripts)
+
+	triggers, err := a.readTriggers()
+	require.NoError(t, err)
+	defer triggers.Close()
+	b, err := io.ReadAll(triggers)
+	require.NoError(t, err)
+	require.Empty(t, b)
+
+	_, err = a.RemoveInstalledPackage("busybox")
+	require.Error(t, err)
+}
+
+func TestCanonicalizeInstalled(t *testing.T) {
+	a, _, err := testGetTestAPK()
+	require.NoError(t, err)
+	for _, name := range []string{"zzz-test", "aaa-test", "mmm-test"} {
+		_, err := a.AddInstalledPackage(&Package{Name: name, Version: "1.0.0"}, []tar.Header{
+			{Name: "usr", Typeflag: tar.TypeDir, Mode: 0o755},
+			{Name: "usr/" + name, Typeflag: tar.TypeReg, Mode: 0o644},
+		})
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, a.CanonicalizeInstalled())
+	first, err := a.fs.ReadFile(installedFilePath)
+	require.NoError(t, err)
+
+	// The result is still a valid database, with all packages sorted.
+	pkgs, err := a.GetInstalled()
+	require.NoError(t, err)
+	require.Len(t, pkgs, len(testInstalledPackages)+3)
+	require.True(t, slices.IsSortedFunc(pkgs, func(x, y *InstalledPackage) int {
+		return strings.Compare(x.Name, y.Name)
+	}))
+	for _, pkg := range pkgs {
+		if pkg.Name == "aaa-test" {
+			require.Len(t, pkg.Files, 2)
+			require.Equal(t, "usr/aaa-test", pkg.Files[1].Name)
+		}
+	}
+
+	// Canonicalizing is idempotent.
+	require.NoError(t, a.CanonicalizeInstalled())
+	second, err := a.fs.ReadFile(installedFilePath)
+	require.NoError(t, err)
+	require.Equal(t, string(first), string(second))
+}
+
+func TestRemoveInstalledFiles(t *testing.T) {
+	a, _, err := testGetTestAPK()
+	require.NoError(t, err)
+	_, err = a.AddInstalledPackage(&Package{Name: "testpkg", Version: "1.0.0"}, []tar.Header{
+		{Name: "usr", Typeflag: tar.TypeDir, Mode: 0o755},
+		{Name: "usr/doc", Typeflag: tar.TypeDir, Mode: 0o700},
+		{Name: "usr/doc/README", Typeflag: tar.TypeReg, Mode: 0o600},
+		{Name: "usr/bin", Typeflag: tar.TypeDir, Mode: 0o755},
+		{Name: "usr/bin/keep", Typeflag: tar.TypeReg, Mode: 0o755},
+		{Name: "usr/bin/drop", Typeflag: tar.TypeReg, Mode: 0o700},
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, a.RemoveInstalledFiles(func(name string) bool {
+		return name == "usr/bin/drop" || name == "usr/doc" || strings.HasPrefix(name, "usr/doc/")
+	}))
+
+	pkgs, err := a.GetInstalled()
+	require.NoError(t, err)
+	require.Len(t, pkgs, len(testInstalledPackages)+1)
+	var names []string
+	for _, f := range pkgs[len(pkgs)-1].Files {
+		names = append(names, f.Name)
+	}
+	require.Equal(t, []string{"usr", "usr/bin", "usr/bin/keep"}, names)
+
+	// The permissions of the kept file are kept, those of the removed
+	// file and directory are not.
+	b, err := a.fs.ReadFile(installedFilePath)
+	require.NoError(t, err)
+	require.True(t, strings.HasSuffix(string(b), "F:usr\nF:usr/bin\nR:keep\na:0:0:0755\n\n"), string(b))
+}
+
 func TestUpdateScriptsTar(t *testing.T) {
 	a, _, err := testGetTestAPK()
 	require.NoError(t, err, "unable to initialize APK implementation")
@@ -15,10 +15,14 @@
 package apk
 
 import (
+	"fmt"
+	"io/fs"
 	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 	"runtime"
+	"strings"
 
 	"github.com/hashicorp/go-cleanhttp"
 
@@ -39,6 +43,11 @@ type opts struct {
 	transport          http.RoundTripper
 	packageGetter      PackageGetter
 	sizeLimits         *SizeLimits
+	fetchConcurrency   int
+	disableHTTP2       bool
+	offline            bool
+	noScripts          bool
+	dbRoot             string
 }
 
 // SizeLimits configures maximum sizes for various APK operations.
@@ -96,7 +105,7 @@ func WithFS(fs apkfs.FullFS) Option {
 // If not provided, will not cache.
 //
 // If offline is true, only read from the cache and do not make any network requests to
-// populate it.
+// populate it: a cache miss fails with ErrOffline. See WithOffline.
 func WithCache(cacheDir string, offline bool, shared *Cache) Option {
 	return func(o *opts) error {
 		var err error
@@ -121,6 +130,19 @@ func WithCache(cacheDir string, offline bool, shared *Cache) Option {
 	}
 }
 
+// WithFetchConcurrency sets the maximum number of packages fetched and
+// expanded at once while installing. Packages are still installed in order,
+// whichever finishes downloading first. Zero, the default, uses GOMAXPROCS.
+func WithFetchConcurrency(n int) Option {
+	return func(o *opts) error {
+		if n < 0 {
+			return fmt.Errorf("fetch concurrency must not be negative, got %d", n)
+		}
+		o.fetchConcurrency = n
+		return nil
+	}
+}
+
 // WithIgnoreIndexSignatures sets whether to ignore repository signature verification.
 // Default is false.
 func WithIgnoreIndexSignatures(ignore bool) Option {
@@ -154,6 +176,55 @@ func WithTransport(t http.RoundTripper) Option {
 	}
 }
 
+// WithOffline makes every network request fail immediately with ErrOffline,
+// so that a build relies entirely on the cache and on local repositories.
+// WithCache with offline set implies it.
+func WithOffline(offline bool) Option {
+	return func(o *opts) error {
+		o.offline = offline
+		return nil
+	}
+}
+
+// WithNoScripts is the equivalent of apk --no-scripts: the scriptlets and
+// triggers of the installed packages are not recorded in scripts.tar and
+// the triggers database, so that nothing runs them later, e.g. "apk fix".
+// The packages are still recorded as installed.
+func WithNoScripts(noScripts bool) Option {
+	return func(o *opts) error {
+		o.noScripts = noScripts
+		return nil
+	}
+}
+
+// WithDBRoot puts the apk database, i.e. the installed, scripts.tar and
+// triggers files, in root rather than DefaultDBRoot, e.g. in a separate state
+// directory of an image with a read-only root. root is relative to the root
+// of the filesystem. Unlike with the default, no /lib/apk link to it is
+// created.
+func WithDBRoot(root string) Option {
+	return func(o *opts) error {
+		clean := path.Clean(strings.TrimPrefix(root, "/"))
+		if clean == "." || !fs.ValidPath(clean) {
+			return fmt.Errorf("invalid apk database root %q", root)
+		}
+		o.dbRoot = clean
+		return nil
+	}
+}
+
+// WithDisableHTTP2 restricts the HTTP transport to HTTP/1.1, for proxies
+// which mishandle HTTP/2. By default, HTTP/2 is negotiated with the servers
+// supporting it, multiplexing the requests on a single connection, and
+// HTTP/1.1 connections are kept alive and reused. It requires the transport
+// to be an *http.Transport.
+func WithDisableHTTP2(disable bool) Option {
+	return func(o *opts) error {
+		o.disableHTTP2 = disable
+		return nil
+	}
+}
+
 // WithPackageGetter sets a custom PackageGetter for fetching, expanding, and caching packages.
 // If not provided, a DefaultPackageGetter will be created automatically.
 func WithPackageGetter(pg PackageGetter) Option {
@@ -177,5 +248,6 @@ func defaultOpts() *opts {
 		ignoreMknodErrors: false,
 		auth:              auth.DefaultAuthenticators,
 		transport:         cleanhttp.DefaultPooledTransport(),
+		dbRoot:            DefaultDBRoot,
 	}
 }
@@ -0,0 +1,170 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+
+	"go.opentelemetry.io/otel"
+	"golang.org/x/sync/errgroup"
+)
+
+// OwnershipConflict is a path provided, with different contents, by more
+// than one package.
+type OwnershipConflict struct {
+	// The full path of the file.
+	Path string
+
+	// The packages providing the file, as a map from the package name to
+	// its origin.
+	Origins map[string]string
+
+	// Replaced is true if one of the packages declares that it replaces
+	// all of the others, in which case installation will succeed and the
+	// replacing package's copy of the file wins.
+	Replaced bool
+
+	// SameOrigin is true if all the packages are built from the same
+	// origin, which apk allows too: the copy of the package installed last
+	// wins.
+	SameOrigin bool
+}
+
+type ownedFile struct {
+	pkg      *PackageInfo
+	checksum []byte
+}
+
+// FindOwnershipConflicts reports the regular files that more than one of
+// pkgs provides with different contents, based on the file lists in the
+// packages. Packages are fetched and expanded, but nothing is installed, so
+// this can run before InstallPackages to explain which packages conflict.
+//
+// Unlike the check done while installing, this reports conflicts between
+// packages sharing an origin or replacing each other too; see
+// OwnershipConflict.Replaced and OwnershipConflict.SameOrigin.
+func (a *APK) FindOwnershipConflicts(ctx context.Context, pkgs []InstallablePackage) ([]OwnershipConflict, error) {
+	ctx, span := otel.Tracer("go-apk").Start(ctx, "FindOwnershipConflicts")
+	defer span.End()
+
+	var g errgroup.Group
+	g.SetLimit(a.fetchJobs() + 1)
+
+	infos := make([]*PackageInfo, len(pkgs))
+	files := make([]map[string][]byte, len(pkgs))
+	for i, pkg := range pkgs {
+		g.Go(func() error {
+			exp, err := a.packageGetter.GetPackage(ctx, pkg)
+			if err != nil {
+				return fmt.Errorf("expanding %s: %w", pkg, err)
+			}
+
+			info, err := exp.PkgInfo()
+			if err != nil {
+				return fmt.Errorf("failed to read .PKGINFO for %s: %w", pkg, err)
+			}
+			infos[i] = info
+
+			files[i] = map[string][]byte{}
+			for _, entry := range exp.TarFS.Entries() {
+				if !entry.Header.FileInfo().Mode().IsRegular() {
+					continue
+				}
+				checksum, err := checksumFromHeader(&entry.Header)
+				if err != nil {
+					return fmt.Errorf("reading checksum of %s in %s: %w", entry.Header.Name, pkg, err)
+				}
+				files[i][entry.Header.Name] = checksum
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, fmt.Errorf("finding ownership conflicts: %w", withCause(ctx, err))
+	}
+
+	owners := map[string][]ownedFile{}
+	for i, info := range infos {
+		for path, checksum := range files[i] {
+			owners[path] = append(owners[path], ownedFile{pkg: info, checksum: checksum})
+		}
+	}
+
+	var conflicts []OwnershipConflict
+	for path, owned := range owners {
+		if len(owned) < 2 || identicalFiles(owned) {
+			continue
+		}
+
+		origins := make(map[string]string, len(owned))
+		for _, o := range owned {
+			origins[o.pkg.Name] = o.pkg.Origin
+		}
+		conflicts = append(conflicts, OwnershipConflict{
+			Path:       path,
+			Origins:    origins,
+			Replaced:   replacesOthers(owned),
+			SameOrigin: sameOrigin(owned),
+		})
+	}
+	sort.Slice(conflicts, func(i, j int) bool {
+		return conflicts[i].Path < conflicts[j].Path
+	})
+
+	return conflicts, nil
+}
+
+// identicalFiles returns true if all the files have the same, known,
+// checksum.
+func identicalFiles(owned []ownedFile) bool {
+	for _, o := range owned {
+		if o.checksum == nil || !bytes.Equal(o.checksum, owned[0].checksum) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameOrigin returns true if all the packages have the same, known, origin.
+func sameOrigin(owned []ownedFile) bool {
+	for _, o := range owned {
+		if o.pkg.Origin == "" || o.pkg.Origin != owned[0].pkg.Origin {
+			return false
+		}
+	}
+	return true
+}
+
+// replacesOthers returns true if one of the packages replaces all of the
+// others.
+func replacesOthers(owned []ownedFile) bool {
+	for _, o := range owned {
+		replacesAll := true
+		for _, other := range owned {
+			if other.pkg != o.pkg && !slices.Contains(o.pkg.Replaces, other.pkg.Name) {
+				replacesAll = false
+				break
+			}
+		}
+		if replacesAll {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apk
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOwnershipHelpers(t *testing.T) {
+	foo := &PackageInfo{Name: "foo", Origin: "foo"}
+	bar := &PackageInfo{Name: "bar", Origin: "bar", Replaces: []string{"foo"}}
+	baz := &PackageInfo{Name: "baz", Origin: "baz", Replaces: []string{"foo"}}
+
+	require.True(t, identicalFiles([]ownedFile{{foo, []byte{1}}, {bar, []byte{1}}}))
+	require.False(t, identicalFiles([]ownedFile{{foo, []byte{1}}, {bar, []byte{2}}}))
+	// Without checksums we can't tell, so assume they differ.
+	require.False(t, identicalFiles([]ownedFile{{foo, nil}, {bar, nil}}))
+
+	require.True(t, replacesOthers([]ownedFile{{foo, nil}, {bar, nil}}))
+	require.True(t, replacesOthers([]ownedFile{{bar, nil}, {foo, nil}}))
+	require.False(t, replacesOthers([]ownedFile{{foo, nil}, {baz, nil}, {bar, nil}}))
+	require.False(t, replacesOthers([]ownedFile{{bar, nil}, {baz, nil}}))
+
+	fooCompat := &PackageInfo{Name: "foo-compat", Origin: "foo"}
+	require.True(t, sameOrigin([]ownedFile{{foo, nil}, {fooCompat, nil}}))
+	require.False(t, sameOrigin([]ownedFile{{foo, nil}, {fooCompat, nil}, {bar, nil}}))
+	// Packages without an origin are never the same.
+	require.False(t, sameOrigin([]ownedFile{{&PackageInfo{Name: "a"}, nil}, {&PackageInfo{Name: "b"}, nil}}))
+}
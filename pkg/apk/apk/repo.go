@@ -55,6 +55,21 @@ func indexNames(indexes []NamedIndex) []string {
 	return names
 }
 
+// IndexDigests returns the digests of the index archives of indexes, keyed
+// by the URI of the index. The indexes whose digest is not known are left
+// out.
+func IndexDigests(indexes []NamedIndex) map[string]string {
+	digests := make(map[string]string, len(indexes))
+	for _, idx := range indexes {
+		n, ok := idx.(*namedRepositoryWithIndex)
+		if !ok || n.repo == nil || n.repo.IndexDigest() == "" {
+			continue
+		}
+		digests[n.Source()] = n.repo.IndexDigest()
+	}
+	return digests
+}
+
 type namedRepositoryWithIndex struct {
 	name string
 	repo *RepositoryWithIndex
@@ -136,6 +151,14 @@ func (a *APK) GetRepositories() (repos []string, err error) {
 	return
 }
 
+// IndexSignatureVerified reports whether the signature of the index pkg was
+// resolved from was verified when the index was fetched. It is false for
+// the packages of an unknown index.
+func (a *APK) IndexSignatureVerified(pkg *RepositoryPackage) bool {
+	repo := pkg.Repository()
+	return repo != nil && repo.IndexSignatureVerified()
+}
+
 // GetRepositoryIndexes returns the indexes for the repositories in the specified root.
 // The signatures for each index are verified unless ignoreSignatures is set to true.
 func (a *APK) GetRepositoryIndexes(ctx context.Context, ignoreSignatures bool) ([]NamedIndex, error) {
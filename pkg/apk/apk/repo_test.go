@@ -16,6 +16,7 @@ package apk
 
 import (
 	"context"
+	"crypto/sha256"
 	"encoding/base32"
 	"fmt"
 	"io/fs"
@@ -29,7 +30,9 @@ import (
 	"slices"
 	"sort"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"golang.org/x/sync/errgroup"
@@ -308,6 +311,33 @@ func TestIndexAuth_good(t *testing.T) {
 	require.True(t, called, "did not make request")
 }
 
+func TestIndexDigests(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.URL.Path = strings.TrimPrefix(r.URL.Path, "/x86_64")
+		http.FileServer(http.Dir(testPrimaryPkgDir)).ServeHTTP(w, r)
+	}))
+	defer s.Close()
+
+	b, err := os.ReadFile(filepath.Join(testPrimaryPkgDir, "APKINDEX.tar.gz"))
+	require.NoError(t, err)
+	want := map[string]string{s.URL + "/x86_64/APKINDEX.tar.gz": fmt.Sprintf("sha256:%x", sha256.Sum256(b))}
+
+	ctx := context.Background()
+
+	a, err := New(ctx, WithFS(apkfs.NewMemFS()), WithArch("x86_64"), WithIgnoreIndexSignatures(true))
+	require.NoErrorf(t, err, "unable to create APK")
+	require.NoError(t, a.InitDB(ctx), "unable to init db")
+	require.NoError(t, a.SetRepositories(ctx, []string{s.URL}), "unable to set repositories")
+	indexes, err := a.GetRepositoryIndexes(ctx, true)
+	require.NoErrorf(t, err, "unable to get indexes")
+	require.Equal(t, want, IndexDigests(indexes))
+
+	require.Empty(t, a.ResolvedIndexDigests())
+	_, _, err = a.ResolveWorld(ctx)
+	require.NoError(t, err)
+	require.Equal(t, want, a.ResolvedIndexDigests())
+}
+
 func TestIndexAuth_bad(t *testing.T) {
 	called := false
 	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -337,6 +367,42 @@ func TestIndexAuth_bad(t *testing.T) {
 	require.True(t, called, "did not make request")
 }
 
+func TestIndexOffline(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		opts []Option
+	}{
+		{name: "cache miss", opts: []Option{WithCache(t.TempDir(), true, NewCache(false))}},
+		{name: "no cache", opts: []Option{WithOffline(true)}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				r.URL.Path = strings.TrimPrefix(r.URL.Path, "/x86_64")
+				http.FileServer(http.Dir(testPrimaryPkgDir)).ServeHTTP(w, r)
+			}))
+			defer s.Close()
+
+			ctx := context.Background()
+
+			a, err := New(ctx, append([]Option{WithFS(apkfs.NewMemFS()), WithArch("x86_64")}, tt.opts...)...)
+			require.NoErrorf(t, err, "unable to create APK")
+			err = a.InitDB(ctx)
+			require.NoError(t, err, "unable to init db")
+			err = a.SetRepositories(ctx, []string{s.URL})
+			require.NoError(t, err, "unable to set repositories")
+
+			start := time.Now()
+			_, err = a.GetRepositoryIndexes(ctx, true)
+			require.ErrorIs(t, err, ErrOffline)
+			require.ErrorContains(t, err, s.URL+"/x86_64/APKINDEX.tar.gz")
+			require.Less(t, time.Since(start), time.Second, "offline errors should not be retried")
+			require.Zero(t, calls.Load(), "made a request in offline mode")
+		})
+	}
+}
+
 func testGetPackagesAndIndex() ([]*RepositoryPackage, []*RepositoryWithIndex) {
 	// create a tree of packages, including some multiple that depend on the same one
 	// but no circular dependencies; this is an acyclic graph
@@ -1003,3 +1069,33 @@ func TestDisqualifyingOtherArchitectures(t *testing.T) {
 	_, _, err := resolver.GetPackagesWithDependencies(context.Background(), names, byArch)
 	require.ErrorContains(t, err, "package \"onlyinarm64-1.0.0.apk\" not available for arch \"x86_64\"")
 }
+
+func TestIndexSignatureVerified(t *testing.T) {
+	ctx := t.Context()
+	b, err := os.ReadFile("testdata/signing/APKINDEX.tar.gz")
+	require.NoError(t, err)
+	files, err := os.ReadDir("testdata/signing/keys")
+	require.NoError(t, err)
+	keys := map[string][]byte{}
+	for _, f := range files {
+		key, err := os.ReadFile(filepath.Join("testdata/signing/keys", f.Name()))
+		require.NoError(t, err)
+		keys[f.Name()] = key
+	}
+
+	// The result is that of the verification when the index was fetched,
+	// not of the signature settings afterwards.
+	pkg := func(opts *indexOpts) *RepositoryPackage {
+		idx, err := parseRepositoryIndex(ctx, IndexURL("testdata/signing", "aarch64"), keys, "aarch64", b, opts)
+		require.NoError(t, err)
+		repo := &Repository{URI: "testdata/signing"}
+		return NewRepositoryPackage(&Package{Name: "foo"}, repo.WithIndex(idx))
+	}
+
+	a, err := New(ctx, WithFS(apkfs.NewMemFS()), WithArch("aarch64"), WithIgnoreIndexSignatures(true))
+	require.NoError(t, err)
+	require.True(t, a.IndexSignatureVerified(pkg(&indexOpts{})))
+	require.False(t, a.IndexSignatureVerified(pkg(&indexOpts{ignoreSignatures: true})))
+	require.False(t, a.IndexSignatureVerified(pkg(&indexOpts{noSignatureIndexes: []string{"testdata/signing"}})))
+	require.False(t, a.IndexSignatureVerified(NewRepositoryPackage(&Package{Name: "foo"}, nil)))
+}
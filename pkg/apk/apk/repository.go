@@ -65,6 +65,21 @@ func (r *RepositoryWithIndex) Count() int {
 	return len(r.index.Packages)
 }
 
+// IndexDigest returns the digest of the index archive of this repository,
+// as "sha256:<hex>", or an empty string if it is not known.
+func (r *RepositoryWithIndex) IndexDigest() string {
+	if r.index == nil {
+		return ""
+	}
+	return r.index.Digest
+}
+
+// IndexSignatureVerified reports whether the signature of the index archive
+// of this repository was verified when it was fetched.
+func (r *RepositoryWithIndex) IndexSignatureVerified() bool {
+	return r.index != nil && r.index.SignatureVerified
+}
+
 // RepoAbbr returns a short name of this repository consisting of the repo name
 // and the architecture.
 func (r *RepositoryWithIndex) RepoAbbr() string {
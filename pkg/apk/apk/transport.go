@@ -19,8 +19,37 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"slices"
 )
 
+// ErrOffline is returned for the requests which would reach the network in
+// offline mode.
+var ErrOffline = errors.New("offline mode")
+
+// offlineTransport fails every request, for offline mode.
+type offlineTransport struct{}
+
+func (offlineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return nil, fmt.Errorf("%w: not fetching %s", ErrOffline, req.URL.Redacted())
+}
+
+// http1Transport returns a copy of t which only speaks HTTP/1.1.
+func http1Transport(t *http.Transport) *http.Transport {
+	t = t.Clone()
+	t.ForceAttemptHTTP2 = false
+	var protocols http.Protocols
+	protocols.SetHTTP1(true)
+	t.Protocols = &protocols
+	// Cloning sets up HTTP/2 on t, advertising it over ALPN in the TLS
+	// configuration copied to the clone.
+	if t.TLSClientConfig != nil {
+		t.TLSClientConfig.NextProtos = slices.DeleteFunc(slices.Clone(t.TLSClientConfig.NextProtos), func(proto string) bool {
+			return proto == "h2"
+		})
+	}
+	return t
+}
+
 type rangeRetryTransport struct {
 	base http.RoundTripper
 }
@@ -16,12 +16,22 @@ package apk
 
 import (
 	"bytes"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"sync/atomic"
 	"testing"
 	"testing/iotest"
+
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/stretchr/testify/require"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
 )
 
 type testReader struct {
@@ -208,3 +218,61 @@ func TestTransport(t *testing.T) {
 		})
 	}
 }
+
+func TestConnectionReuse(t *testing.T) {
+	var dials atomic.Int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, "index")
+	}))
+	srv.EnableHTTP2 = true
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			dials.Add(1)
+		}
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	// fetch makes n requests with a new APK, as for the indexes of a build,
+	// and returns the protocol used and the number of connections opened.
+	fetch := func(t *testing.T, n int, keepAlive bool, opts ...Option) (string, int32) {
+		t.Helper()
+		transport := cleanhttp.DefaultPooledTransport()
+		roots := x509.NewCertPool()
+		roots.AddCert(srv.Certificate())
+		transport.TLSClientConfig = &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}
+		transport.DisableKeepAlives = !keepAlive
+		a, err := New(t.Context(), append([]Option{WithFS(apkfs.NewMemFS()), WithTransport(transport)}, opts...)...)
+		require.NoError(t, err)
+
+		dials.Store(0)
+		var proto string
+		for i := range n {
+			resp, err := a.client.Get(fmt.Sprintf("%s/%d/APKINDEX.tar.gz", srv.URL, i))
+			require.NoError(t, err)
+			_, err = io.Copy(io.Discard, resp.Body)
+			require.NoError(t, err)
+			require.NoError(t, resp.Body.Close())
+			proto = resp.Proto
+		}
+		return proto, dials.Load()
+	}
+
+	proto, n := fetch(t, 10, true)
+	require.Equal(t, "HTTP/2.0", proto)
+	require.EqualValues(t, 1, n)
+
+	proto, n = fetch(t, 10, true, WithDisableHTTP2(true))
+	require.Equal(t, "HTTP/1.1", proto)
+	require.EqualValues(t, 1, n)
+
+	// Without keep-alive, each request dials a new connection.
+	proto, n = fetch(t, 10, false, WithDisableHTTP2(true))
+	require.Equal(t, "HTTP/1.1", proto)
+	require.EqualValues(t, 10, n)
+}
+
+func TestDisableHTTP2Transport(t *testing.T) {
+	_, err := New(t.Context(), WithFS(apkfs.NewMemFS()), WithTransport(&testTransport{}), WithDisableHTTP2(true))
+	require.ErrorContains(t, err, "cannot disable HTTP/2")
+}
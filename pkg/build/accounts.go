@@ -60,7 +60,51 @@ func userToUserEntry(user types.User) passwd.UserEntry {
 	}
 }
 
-func mutateAccounts(fsys apkfs.FullFS, ic *types.ImageConfiguration) error {
+// writeShadow writes /etc/shadow with an entry for each of the accounts in
+// /etc/passwd. Existing entries are kept, unless a password hash is
+// configured for the user, and accounts without one are locked.
+func writeShadow(fsys apkfs.FullFS, accounts []passwd.UserEntry, users []types.User) error {
+	path := filepath.Join("etc", "shadow")
+
+	sf, err := passwd.ReadOrCreateShadowFile(fsys, path)
+	if err != nil {
+		return err
+	}
+
+	hashes := make(map[string]string, len(users))
+	for _, u := range users {
+		if u.PasswordHash != "" {
+			hashes[u.UserName] = u.PasswordHash
+		}
+	}
+
+	existing := make(map[string]int, len(sf.Entries))
+	for i, se := range sf.Entries {
+		existing[se.UserName] = i
+	}
+
+	for _, ue := range accounts {
+		i, ok := existing[ue.UserName]
+		if !ok {
+			sf.Entries = append(sf.Entries, passwd.ShadowEntry{
+				UserName: ue.UserName,
+				Password: passwd.LockedPassword,
+			})
+			i = len(sf.Entries) - 1
+			existing[ue.UserName] = i
+		}
+		if hash, ok := hashes[ue.UserName]; ok {
+			sf.Entries[i].Password = hash
+		}
+	}
+
+	return sf.WriteFile(path)
+}
+
+// mutateAccounts adds the configured groups and users to /etc/group and
+// /etc/passwd, creates missing home directories and records the changes in
+// report, which may be nil.
+func mutateAccounts(fsys apkfs.FullFS, ic *types.ImageConfiguration, report *MutationReport) error {
 	var eg errgroup.Group
 
 	if len(ic.Accounts.Groups) != 0 {
@@ -75,6 +119,7 @@ func mutateAccounts(fsys apkfs.FullFS, ic *types.ImageConfiguration) error {
 
 			for _, g := range ic.Accounts.Groups {
 				gf.Entries = appendGroup(gf.Entries, g)
+				report.addGroup(g)
 			}
 
 			if err := gf.WriteFile(fsys, path); err != nil {
@@ -97,6 +142,7 @@ func mutateAccounts(fsys apkfs.FullFS, ic *types.ImageConfiguration) error {
 		for _, u := range ic.Accounts.Users {
 			ue := userToUserEntry(u)
 			uf.Entries = append(uf.Entries, ue)
+			report.addUser(ue)
 		}
 		for _, ue := range uf.Entries {
 			// This is what the home directory is set to for our homeless users.
@@ -131,12 +177,25 @@ func mutateAccounts(fsys apkfs.FullFS, ic *types.ImageConfiguration) error {
 			if err := fsys.Chown(targetHomedir, int(ue.UID), int(ue.GID)); err != nil {
 				return fmt.Errorf("chowning homedir: %w", err)
 			}
+			report.addPath(types.PathMutation{
+				Path:        targetHomedir,
+				Type:        "directory",
+				UID:         ue.UID,
+				GID:         ue.GID,
+				Permissions: 0o700,
+			}, MutationOriginAccounts)
 		}
 
 		if err := uf.WriteFile(path); err != nil {
 			return err
 		}
 
+		if ic.Accounts.Shadow {
+			if err := writeShadow(fsys, uf.Entries, ic.Accounts.Users); err != nil {
+				return err
+			}
+		}
+
 		// Resolve run-as user if requested.
 		if ic.Accounts.RunAs != "" {
 			for _, ue := range uf.Entries {
@@ -15,8 +15,13 @@
 package build
 
 import (
+	"archive/tar"
+	"io/fs"
 	"testing"
 
+	"github.com/stretchr/testify/require"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
 	"chainguard.dev/apko/pkg/build/types"
 )
 
@@ -78,3 +83,104 @@ func Test_userToUserEntry_UID_GID_mapping(t *testing.T) {
 		}
 	}
 }
+
+func Test_mutateAccounts_shell_and_home(t *testing.T) {
+	fsys := apkfs.NewMemFS()
+	require.NoError(t, fsys.MkdirAll("etc", 0o755))
+
+	ic := types.ImageConfiguration{
+		Accounts: types.ImageAccounts{
+			Users: []types.User{
+				// A service account, with no login shell and no home.
+				{UserName: "svc", UID: 100, Shell: "/sbin/nologin", HomeDir: "/dev/null"},
+				// A user whose home directory is created.
+				{UserName: "app", UID: 10000, GID: id1235T, HomeDir: "/var/lib/app"},
+				// A user with the default shell and home.
+				{UserName: "dflt", UID: 10001},
+			},
+		},
+	}
+	require.NoError(t, mutateAccounts(fsys, &ic, nil))
+
+	passwd, err := fsys.ReadFile("etc/passwd")
+	require.NoError(t, err)
+	require.Equal(t, "svc:x:100:100:Account created by apko:/dev/null:/sbin/nologin\n"+
+		"app:x:10000:1235:Account created by apko:/var/lib/app:/bin/sh\n"+
+		"dflt:x:10001:10001:Account created by apko:/home/dflt:/bin/sh\n", string(passwd))
+
+	// The home directory is created with the user's ownership and mode 0700,
+	// and missing parents with mode 0755.
+	fi, err := fsys.Stat("var/lib/app")
+	require.NoError(t, err)
+	require.True(t, fi.IsDir())
+	require.Equal(t, fs.FileMode(0o700), fi.Mode().Perm())
+	hdr, ok := fi.Sys().(*tar.Header)
+	require.True(t, ok)
+	require.Equal(t, 10000, hdr.Uid)
+	require.Equal(t, 1235, hdr.Gid)
+
+	fi, err = fsys.Stat("var/lib")
+	require.NoError(t, err)
+	require.Equal(t, fs.FileMode(0o755), fi.Mode().Perm())
+
+	_, err = fsys.Stat("home/dflt")
+	require.NoError(t, err)
+}
+
+func TestAccountsReproducible(t *testing.T) {
+	gid := uint32(20000)
+	ic := testConfig(t)
+	ic.Accounts = types.ImageAccounts{
+		Groups: []types.Group{
+			{GroupName: "nonroot", GID: 10000, Members: []string{"nonroot"}},
+			{GroupName: "shared", GID: 20000, Members: []string{"nonroot", "other"}},
+		},
+		Users: []types.User{
+			{UserName: "nonroot", UID: 10000},
+			{UserName: "other", UID: 10001, GID: &gid},
+		},
+		RunAs: "nonroot",
+	}
+
+	accounts := func() (passwd, group []byte) {
+		fsys := apkfs.NewMemFS()
+		buildTestImage(t, fsys, WithImageConfiguration(ic))
+
+		passwd, err := fsys.ReadFile("etc/passwd")
+		require.NoError(t, err)
+		group, err = fsys.ReadFile("etc/group")
+		require.NoError(t, err)
+		return passwd, group
+	}
+
+	passwd1, group1 := accounts()
+	passwd2, group2 := accounts()
+	require.Equal(t, string(passwd1), string(passwd2))
+	require.Equal(t, string(group1), string(group2))
+
+	require.Contains(t, string(passwd1), "nonroot:x:10000:10000:")
+	require.Contains(t, string(passwd1), "other:x:10001:20000:")
+	require.Contains(t, string(group1), "shared:x:20000:nonroot,other")
+}
+
+func TestShadow(t *testing.T) {
+	ic := testConfig(t)
+	ic.Accounts = types.ImageAccounts{
+		Users: []types.User{
+			{UserName: "nonroot", UID: 10000},
+			{UserName: "admin", UID: 10001, PasswordHash: "$6$salt$hash"},
+		},
+		Shadow: true,
+	}
+
+	fsys := apkfs.NewMemFS()
+	buildTestImage(t, fsys, WithImageConfiguration(ic))
+
+	shadow, err := fsys.ReadFile("etc/shadow")
+	require.NoError(t, err)
+	require.Equal(t, "nonroot:!:::::::\nadmin:$6$salt$hash:::::::\n", string(shadow))
+
+	fi, err := fsys.Stat("etc/shadow")
+	require.NoError(t, err)
+	require.Equal(t, "-rw-------", fi.Mode().Perm().String())
+}
@@ -16,11 +16,15 @@ package build
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
+	"github.com/chainguard-dev/clog"
 	"go.opentelemetry.io/otel"
 	"golang.org/x/sync/errgroup"
 	"k8s.io/apimachinery/pkg/util/sets"
+
+	"chainguard.dev/apko/pkg/apk/apk"
 )
 
 func (bc *Context) postBuildSetApk(ctx context.Context) error {
@@ -41,6 +45,34 @@ func (bc *Context) postBuildSetApk(ctx context.Context) error {
 	return nil
 }
 
+// checkFileOwnership looks for files provided by more than one of pkgs,
+// using the package file lists rather than the installed filesystem.
+func (bc *Context) checkFileOwnership(ctx context.Context, pkgs []apk.InstallablePackage) error {
+	log := clog.FromContext(ctx)
+
+	conflicts, err := bc.apk.FindOwnershipConflicts(ctx, pkgs)
+	if err != nil {
+		return wrapError(ErrInstall, err)
+	}
+
+	var errs []error
+	for _, c := range conflicts {
+		switch {
+		case c.Replaced:
+			log.Infof("packages %v provide %q, resolved by replaces", c.Origins, c.Path)
+			continue
+		case c.SameOrigin:
+			log.Infof("packages %v provide %q, resolved by their shared origin", c.Origins, c.Path)
+			continue
+		}
+		errs = append(errs, apk.FileConflictError{Path: c.Path, Origins: c.Origins})
+	}
+	if len(errs) != 0 {
+		return wrapError(ErrPackageConflict, fmt.Errorf("checking file ownership: %w", errors.Join(errs...)))
+	}
+	return nil
+}
+
 func (bc *Context) initializeApk(ctx context.Context) error {
 	ctx, span := otel.Tracer("apko").Start(ctx, "initializeApk")
 	defer span.End()
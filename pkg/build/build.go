@@ -15,6 +15,7 @@
 package build
 
 import (
+	"cmp"
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
@@ -44,6 +45,7 @@ import (
 	"chainguard.dev/apko/pkg/options"
 	"chainguard.dev/apko/pkg/paths"
 	"chainguard.dev/apko/pkg/s6"
+	"chainguard.dev/apko/pkg/tarfs"
 )
 
 // compressionCache stores descriptor information for already-compressed layers,
@@ -64,6 +66,47 @@ type Context struct {
 	fs      apkfs.FullFS
 	apk     *apk.APK
 	baseimg *baseimg.BaseImage
+
+	// indexSignatures records, for each package resolved from an index,
+	// whether the signature of the index was verified.
+	indexSignatures map[string]bool
+
+	// indexDigests are the digests of the repository indexes the packages
+	// were resolved from, keyed by the URI of the index.
+	indexDigests map[string]string
+
+	// busyboxApplets are the links to busybox applets installed in the
+	// image, keyed by the name of the package providing busybox.
+	busyboxApplets map[string][]string
+
+	// generatedFiles are the paths of the files generated by apko in the
+	// image, rather than installed from packages.
+	generatedFiles []string
+
+	// configFiles are the paths, among generatedFiles, of the configuration
+	// files generated from the image configuration.
+	configFiles []string
+
+	// mutations records the accounts and path mutations applied to the
+	// image filesystem.
+	mutations *MutationReport
+
+	// stalePins are the StalePins of the resolved packages, if requested.
+	stalePins []StalePin
+
+	// permissions is the PermissionsSummary of the filesystem, if requested.
+	permissions *PermissionsSummary
+
+	// manifest is the ReproducibilityManifest of the build, if requested.
+	manifest *ReproducibilityManifest
+
+	// deadline is when the build times out, BuildTimeout after the Context
+	// was created, or zero without a timeout.
+	deadline time.Time
+
+	// ownsTempDir is set when no temporary directory was given with
+	// WithTempDir, so the build creates its own and removes it on error.
+	ownsTempDir bool
 }
 
 func (bc *Context) Summarize(ctx context.Context) {
@@ -78,28 +121,89 @@ func (bc *Context) BaseImage() v1.Image {
 }
 
 func (bc *Context) GetBuildDateEpoch() (time.Time, error) {
-	if _, ok := os.LookupEnv("SOURCE_DATE_EPOCH"); ok {
+	if explicitSourceDateEpoch(&bc.o) {
 		return bc.o.SourceDateEpoch, nil
 	}
 	pl, err := bc.apk.GetInstalled()
 	if err != nil {
 		return time.Time{}, fmt.Errorf("failed to determine installed packages: %w", err)
 	}
-	bde := bc.o.SourceDateEpoch
-	for _, p := range pl {
+	return buildDateEpoch(&bc.o, pl), nil
+}
+
+// sourceDateEpochEnv returns the value of SOURCE_DATE_EPOCH, if set and not
+// empty.
+func sourceDateEpochEnv() (string, bool) {
+	v, ok := os.LookupEnv("SOURCE_DATE_EPOCH")
+	if !ok || len(strings.TrimSpace(v)) == 0 {
+		return "", false
+	}
+	return v, true
+}
+
+// applySourceDateEpoch sets the SourceDateEpoch of o to the timestamp for
+// its architecture, if any, then to SOURCE_DATE_EPOCH, if set, which always
+// overwrites the build flag.
+func applySourceDateEpoch(o *options.Options) error {
+	if t, ok := o.ArchSourceDateEpochs[o.Arch]; ok {
+		o.SourceDateEpoch = t
+	}
+
+	if v, ok := sourceDateEpochEnv(); ok {
+		// The value MUST be an ASCII representation of an integer
+		// with no fractional component, identical to the output
+		// format of date +%s.
+		sec, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			// If the value is malformed, the build process
+			// SHOULD exit with a non-zero error code.
+			return wrapError(ErrInvalidConfig, fmt.Errorf("failed to parse SOURCE_DATE_EPOCH: %w", err))
+		}
+
+		o.SourceDateEpoch = time.Unix(sec, 0).UTC()
+	}
+	return nil
+}
+
+// explicitSourceDateEpoch returns whether the SourceDateEpoch of o was set
+// explicitly, with SOURCE_DATE_EPOCH or for its architecture, in which case
+// it is used as-is rather than dated by the installed packages.
+func explicitSourceDateEpoch(o *options.Options) bool {
+	if _, ok := sourceDateEpochEnv(); ok {
+		return true
+	}
+	_, ok := o.ArchSourceDateEpochs[o.Arch]
+	return ok
+}
+
+// buildDateEpoch returns the date of a build with o of an image with pkgs
+// installed: the explicit SourceDateEpoch of o if any, otherwise the latest
+// of SourceDateEpoch and the build times of the packages.
+func buildDateEpoch(o *options.Options, pkgs []*apk.InstalledPackage) time.Time {
+	bde := o.SourceDateEpoch
+	if explicitSourceDateEpoch(o) {
+		return bde
+	}
+	for _, p := range pkgs {
 		if p.BuildTime.After(bde) {
 			bde = p.BuildTime
 		}
 	}
-	return bde, nil
+	return bde
 }
 
-func (bc *Context) BuildImage(ctx context.Context) error {
+func (bc *Context) BuildImage(ctx context.Context) (err error) {
 	log := clog.FromContext(ctx)
 
 	ctx, span := otel.Tracer("apko").Start(ctx, "BuildImage")
 	defer span.End()
 
+	ctx, done := bc.withTimeout(ctx)
+	defer func() {
+		err = done(err)
+		bc.cleanupOnError(ctx, err)
+	}()
+
 	if _, err := bc.buildImage(ctx); err != nil {
 		log.Debugf("buildImage failed: %v", err)
 		b, err2 := yaml.Marshal(bc.ic)
@@ -108,7 +212,7 @@ func (bc *Context) BuildImage(ctx context.Context) error {
 		} else {
 			log.Debugf("image configuration:\n%s", string(b))
 		}
-		return err
+		return wrapError(ErrInstall, err)
 	}
 	return nil
 }
@@ -120,13 +224,19 @@ func (bc *Context) BuildImage(ctx context.Context) error {
 // and sets everything up in the directory. Then
 // packages it all up into a standard OCI image layer
 // tar.gz file.
-func (bc *Context) BuildLayer(ctx context.Context) (string, v1.Layer, error) {
+func (bc *Context) BuildLayer(ctx context.Context) (_ string, _ v1.Layer, err error) {
 	ctx, span := otel.Tracer("apko").Start(ctx, "BuildLayer")
 	defer span.End()
 
+	ctx, done := bc.withTimeout(ctx)
+	defer func() {
+		err = done(err)
+		bc.cleanupOnError(ctx, err)
+	}()
+
 	// Check if a non-empty layering strategy is supplied
 	if bc.ic.Layering != nil && (bc.ic.Layering.Strategy != "" || bc.ic.Layering.Budget != 0) {
-		return "", nil, fmt.Errorf("cannot use BuildLayer with a layering strategy, use BuildLayers instead")
+		return "", nil, wrapError(ErrInvalidConfig, fmt.Errorf("cannot use BuildLayer with a layering strategy, use BuildLayers instead"))
 	}
 
 	// build image filesystem
@@ -141,10 +251,16 @@ func (bc *Context) BuildLayer(ctx context.Context) (string, v1.Layer, error) {
 }
 
 // BuildLayers is like BuildLayer but has the potential to return multiple layers.
-func (bc *Context) BuildLayers(ctx context.Context) ([]v1.Layer, error) {
+func (bc *Context) BuildLayers(ctx context.Context) (_ []v1.Layer, err error) {
 	ctx, span := otel.Tracer("apko").Start(ctx, "BuildLayers")
 	defer span.End()
 
+	ctx, done := bc.withTimeout(ctx)
+	defer func() {
+		err = done(err)
+		bc.cleanupOnError(ctx, err)
+	}()
+
 	// Use the legacy (single-layer) strategy when:
 	// 1. Layering is nil (original behavior)
 	// 2. Layering is empty (i.e., layering: {})
@@ -168,7 +284,7 @@ func (bc *Context) ImageLayoutToLayer(ctx context.Context) (string, v1.Layer, er
 	defer span.End()
 
 	if err := bc.checkPaths(ctx); err != nil {
-		return "", nil, err
+		return "", nil, wrapError(ErrTarball, err)
 	}
 
 	var (
@@ -182,20 +298,34 @@ func (bc *Context) ImageLayoutToLayer(ctx context.Context) (string, v1.Layer, er
 		outfile, err = os.Create(filepath.Join(bc.o.TempDir(), bc.o.TarballFileName()))
 	}
 	if err != nil {
-		return "", nil, fmt.Errorf("creating tarball file: %w", err)
+		return "", nil, wrapError(ErrTarball, fmt.Errorf("creating tarball file: %w", err))
 	}
 	bc.o.TarballPath = outfile.Name()
 	defer outfile.Close()
 
+	mtime, err := bc.mtimeFunc()
+	if err != nil {
+		_ = os.Remove(outfile.Name())
+		return "", nil, wrapError(ErrTarball, err)
+	}
+
 	lw := newLayerWriter(outfile)
 
-	if err := writeTar(ctx, lw.w, bc.fs); err != nil {
-		return "", nil, fmt.Errorf("generating tarball: %w", err)
+	if err := writeTar(ctx, lw.w, bc.layerFS(), mtime); err != nil {
+		// Don't leave a partial tarball behind, e.g. when the build is
+		// canceled.
+		_ = os.Remove(outfile.Name())
+		return "", nil, wrapError(ErrTarball, fmt.Errorf("generating tarball: %w", err))
 	}
 
 	l, err := lw.finalize()
 	if err != nil {
-		return "", nil, fmt.Errorf("finalizing layer: %w", err)
+		_ = os.Remove(outfile.Name())
+		return "", nil, wrapError(ErrTarball, fmt.Errorf("finalizing layer: %w", err))
+	}
+
+	if err := bc.checkLayerSize([]v1.Layer{l}); err != nil {
+		return "", nil, wrapError(ErrTarball, err)
 	}
 
 	return outfile.Name(), l, nil
@@ -236,6 +366,8 @@ func NewOptions(opts ...Option) (*options.Options, *types.ImageConfiguration, er
 // New creates a build context.
 // The SOURCE_DATE_EPOCH env variable is supported and will
 // overwrite the provided timestamp if present.
+// The image is built in fs; if it is nil, the filesystem is created with
+// the factory set by WithFilesystemFactory, or is an in-memory tarfs.
 func New(ctx context.Context, fs apkfs.FullFS, opts ...Option) (*Context, error) {
 	log := clog.FromContext(ctx)
 
@@ -253,20 +385,18 @@ func New(ctx context.Context, fs apkfs.FullFS, opts ...Option) (*Context, error)
 		}
 	}
 
-	// SOURCE_DATE_EPOCH will always overwrite the build flag
-	if v, ok := os.LookupEnv("SOURCE_DATE_EPOCH"); ok && len(strings.TrimSpace(v)) != 0 {
-		// The value MUST be an ASCII representation of an integer
-		// with no fractional component, identical to the output
-		// format of date +%s.
-		sec, err := strconv.ParseInt(v, 10, 64)
-		if err != nil {
-			// If the value is malformed, the build process
-			// SHOULD exit with a non-zero error code.
-			return nil, fmt.Errorf("failed to parse SOURCE_DATE_EPOCH: %w", err)
+	if bc.fs == nil {
+		if bc.o.NewFilesystem != nil {
+			bc.fs = bc.o.NewFilesystem()
+		} else {
+			bc.fs = tarfs.New()
 		}
+	}
 
-		bc.o.SourceDateEpoch = time.Unix(sec, 0).UTC()
+	if bc.o.BuildTimeout > 0 {
+		bc.deadline = time.Now().Add(bc.o.BuildTimeout)
 	}
+	bc.ownsTempDir = bc.o.TempDirPath == ""
 
 	// if arch is missing default to the running program's arch
 	zeroArch := types.Architecture("")
@@ -274,6 +404,10 @@ func New(ctx context.Context, fs apkfs.FullFS, opts ...Option) (*Context, error)
 		bc.o.Arch = types.ParseArchitecture(runtime.GOARCH)
 	}
 
+	if err := applySourceDateEpoch(&bc.o); err != nil {
+		return nil, err
+	}
+
 	apkOpts := []apk.Option{
 		apk.WithFS(bc.fs),
 		apk.WithArch(bc.o.Arch.ToAPK()),
@@ -282,6 +416,11 @@ func New(ctx context.Context, fs apkfs.FullFS, opts ...Option) (*Context, error)
 		apk.WithAuthenticator(bc.o.Auth),
 		apk.WithTransport(bc.o.Transport),
 		apk.WithPackageGetter(bc.o.PackageGetter),
+		apk.WithFetchConcurrency(bc.o.FetchConcurrency),
+		apk.WithDisableHTTP2(bc.o.DisableHTTP2),
+		apk.WithOffline(bc.o.Offline),
+		apk.WithNoScripts(bc.o.NoScripts),
+		apk.WithDBRoot(cmp.Or(bc.o.ApkDBRoot, apk.DefaultDBRoot)),
 		apk.WithSizeLimits(&apk.SizeLimits{
 			APKIndexDecompressedMaxSize: bc.o.SizeLimits.APKIndexDecompressedMaxSize,
 			APKControlMaxSize:           bc.o.SizeLimits.APKControlMaxSize,
@@ -335,11 +474,11 @@ func New(ctx context.Context, fs apkfs.FullFS, opts ...Option) (*Context, error)
 
 	log.Debugf("doing pre-flight checks")
 	if err := bc.ic.Validate(); err != nil {
-		return nil, fmt.Errorf("failed to validate configuration: %w", err)
+		return nil, wrapError(ErrInvalidConfig, fmt.Errorf("failed to validate configuration: %w", err))
 	}
 
 	if err := bc.initializeApk(ctx); err != nil {
-		return nil, fmt.Errorf("initializing apk: %w", err)
+		return nil, wrapError(ErrInvalidConfig, fmt.Errorf("initializing apk: %w", err))
 	}
 
 	bc.s6 = s6.New(bc.fs)
@@ -508,6 +647,36 @@ func (bc *Context) WantSBOM() bool {
 	return len(bc.o.SBOMGenerators) != 0
 }
 
+// MutationReport returns the accounts created and the path ownership and
+// modes applied by the last build of the image filesystem, or nil if it has
+// not been built.
+func (bc *Context) MutationReport() *MutationReport {
+	return bc.mutations
+}
+
+// PermissionsSummary returns the PermissionsSummary of the filesystem of the
+// last build of the image, or nil if it has not been built or the summary
+// was not requested with WithPermissionsSummary.
+func (bc *Context) PermissionsSummary() *PermissionsSummary {
+	return bc.permissions
+}
+
+// StalePins returns the packages pinned in the image configuration to a
+// version older than the newest one available, as of the last resolution of
+// the packages, or nil if there are none or the check was not requested with
+// WithStalePins. Packages installed from a lockfile or pre-resolved are not
+// checked.
+func (bc *Context) StalePins() []StalePin {
+	return bc.stalePins
+}
+
+// IndexDigests returns the digests of the repository index archives the
+// packages were resolved from, as "sha256:<hex>" keyed by the URI of the
+// index, or nil if nothing was resolved, e.g. when building from a lockfile.
+func (bc *Context) IndexDigests() map[string]string {
+	return bc.indexDigests
+}
+
 func (bc *Context) APK() *apk.APK {
 	return bc.apk
 }
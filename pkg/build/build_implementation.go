@@ -24,11 +24,16 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
 	"runtime"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/chainguard-dev/clog"
+	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	v1types "github.com/google/go-containerregistry/pkg/v1/types"
 	gzip "github.com/klauspost/pgzip"
@@ -36,6 +41,8 @@ import (
 	ldsocache "chainguard.dev/apko/internal/ldso-cache"
 	"chainguard.dev/apko/pkg/apk/apk"
 	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build/oci"
+	"chainguard.dev/apko/pkg/build/types"
 	"chainguard.dev/apko/pkg/lock"
 	"chainguard.dev/apko/pkg/options"
 )
@@ -156,44 +163,133 @@ func (bc *Context) buildImage(ctx context.Context) ([]apk.InstalledDiff, error)
 		log.Debugf("Using lockfile: %s", bc.o.Lockfile)
 		lock, err := lock.FromFile(bc.o.Lockfile)
 		if err != nil {
-			return nil, fmt.Errorf("failed to load lock-file: %w", err)
+			return nil, wrapError(ErrInvalidConfig, fmt.Errorf("failed to load lock-file: %w", err))
 		}
 		err = bc.VerifyLockfileConsistency(ctx, lock.Config)
 		if err != nil {
-			return nil, err
+			return nil, wrapError(ErrInvalidConfig, err)
 		}
 		allPkgs, err := installablePackagesForArch(lock, bc.Arch())
 		if err != nil {
-			return nil, fmt.Errorf("failed getting packages for install from lockfile %s: %w", bc.o.Lockfile, err)
+			return nil, wrapError(ErrInvalidConfig, fmt.Errorf("failed getting packages for install from lockfile %s: %w", bc.o.Lockfile, err))
+		}
+		if err := bc.checkResolvedPackages(ctx, lockedPackagesForArch(lock, bc.Arch()), allPkgs, true); err != nil {
+			return nil, err
 		}
 		pkgs, err = bc.apk.InstallPackages(ctx, &bc.o.SourceDateEpoch, allPkgs)
 		if err != nil {
 			return nil, fmt.Errorf("failed installation from lockfile %s: %w", bc.o.Lockfile, err)
 		}
+		// The lockfile does not record licenses, so they are only known once
+		// the packages are installed.
+		if bc.o.RequireLicenses {
+			if err := bc.checkInstalledLicenses(); err != nil {
+				return nil, err
+			}
+		}
+	} else if bc.o.ResolvedPackages != nil {
+		log.Debugf("Installing %d pre-resolved packages", len(bc.o.ResolvedPackages))
+		if err := validateResolvedPackages(bc.o.ResolvedPackages, bc.Arch().ToAPK()); err != nil {
+			return nil, wrapError(ErrInvalidConfig, err)
+		}
+		if err := bc.checkResolvedPackages(ctx, bc.o.ResolvedPackages, installable(bc.o.ResolvedPackages), false); err != nil {
+			return nil, err
+		}
+		pkgs, err = bc.apk.InstallPackages(ctx, &bc.o.SourceDateEpoch, installable(bc.o.ResolvedPackages))
+		if err != nil {
+			return nil, fmt.Errorf("installing pre-resolved apk packages: %w", err)
+		}
 	} else {
-		pkgs, err = bc.apk.FixateWorld(ctx, &bc.o.SourceDateEpoch)
+		// The checks run on the resolved packages, which are then installed
+		// as is rather than resolved again.
+		toInstall, conflicts, err := bc.apk.ResolveWorld(ctx)
+		if err != nil {
+			return nil, wrapError(ErrResolution, fmt.Errorf("resolving apk packages: %w", err))
+		}
+		bc.indexDigests = bc.apk.ResolvedIndexDigests()
+		if err := bc.checkResolvedPackages(ctx, toInstall, installable(toInstall), false); err != nil {
+			return nil, err
+		}
+		pkgs, err = bc.apk.FixateResolvedWorld(ctx, &bc.o.SourceDateEpoch, toInstall, conflicts)
 		if err != nil {
 			return nil, fmt.Errorf("installing apk packages: %w", err)
 		}
 	}
 
+	if bc.o.CanonicalApkDB {
+		if err := bc.apk.CanonicalizeInstalled(); err != nil {
+			return nil, wrapError(ErrInstall, fmt.Errorf("canonicalizing installed database: %w", err))
+		}
+	}
+
+	if len(bc.ic.Contents.RemovePackages) != 0 || len(bc.ic.Contents.RemovePaths) != 0 {
+		removed, err := bc.removeContents(ctx)
+		if err != nil {
+			return nil, wrapError(ErrInstall, err)
+		}
+		pkgs = slices.DeleteFunc(pkgs, func(diff apk.InstalledDiff) bool {
+			return removed.Has(diff.Package.Name)
+		})
+	}
+
+	// The dependencies are checked once the packages to remove are gone,
+	// since they may be depended on.
+	if bc.o.VerifyDependencies {
+		if err := bc.verifyDependencies(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	bc.mutations = &MutationReport{}
+
 	// For now adding additional accounts is banned when using base image. On the other hand, we don't want to
 	// wipe out the users set in base.
 	// If one wants to add a support for adding additional users they would need to look into this piece of code.
 	if bc.ic.Contents.BaseImage == nil {
-		if err := mutateAccounts(bc.fs, &bc.ic); err != nil {
-			return nil, fmt.Errorf("failed to mutate accounts: %w", err)
+		if err := mutateAccounts(bc.fs, &bc.ic, bc.mutations); err != nil {
+			return nil, wrapError(ErrInstall, fmt.Errorf("failed to mutate accounts: %w", err))
 		}
 	}
 
 	if err := bc.WriteEtcApkoConfig(ctx); err != nil {
 		return nil, fmt.Errorf("failed to install apko config: %w", err)
 	}
+	generated := []string{"/etc/apko.json"}
+	config := []string{"/etc/apko.json"}
 
-	if err := mutatePaths(bc.fs, &bc.o, &bc.ic); err != nil {
+	if bc.ic.NSSwitch != nil {
+		written, err := writeNSSwitch(bc.fs, bc.ic.NSSwitch)
+		if err != nil {
+			return nil, fmt.Errorf("failed to write nsswitch.conf: %w", err)
+		}
+		if written {
+			generated = append(generated, "/etc/nsswitch.conf")
+			config = append(config, "/etc/nsswitch.conf")
+		} else {
+			log.Debug("/etc/nsswitch.conf provided by the image contents, not generating it")
+		}
+	}
+
+	if err := writeProfileSnippets(bc.fs, bc.ic.Profile); err != nil {
+		return nil, fmt.Errorf("failed to write profile snippets: %w", err)
+	}
+	for _, snippet := range bc.ic.Profile {
+		generated = append(generated, "/"+path.Join(profileDir, snippet.Name+".sh"))
+		config = append(config, "/"+path.Join(profileDir, snippet.Name+".sh"))
+	}
+
+	if err := applyStandardDirs(bc.fs, bc.o.StandardDirs, bc.mutations); err != nil {
+		return nil, fmt.Errorf("failed to set standard directory permissions: %w", err)
+	}
+
+	if err := mutatePaths(bc.fs, &bc.o, &bc.ic, bc.mutations); err != nil {
 		return nil, fmt.Errorf("failed to mutate paths: %w", err)
 	}
 
+	if err := bc.installCABundle(ctx); err != nil {
+		return nil, fmt.Errorf("failed to install CA bundle: %w", err)
+	}
+
 	if err := bc.installCertificates(ctx); err != nil {
 		return nil, fmt.Errorf("failed to install certificates: %w", err)
 	}
@@ -201,26 +297,83 @@ func (bc *Context) buildImage(ctx context.Context) ([]apk.InstalledDiff, error)
 	if err := bc.s6.WriteSupervisionTree(ctx, bc.ic.Entrypoint.Services); err != nil {
 		return nil, fmt.Errorf("failed to write supervision tree: %w", err)
 	}
-
-	// add busybox symlinks
-	installed, err := bc.apk.GetInstalled()
-	if err != nil {
-		return nil, fmt.Errorf("getting installed packages: %w", err)
+	for service := range bc.ic.Entrypoint.Services {
+		generated = append(generated, "/"+path.Join("sv", service, "run"))
 	}
 
-	if err := installBusyboxLinks(bc.fs, installed); err != nil {
-		return nil, err
+	// add busybox symlinks, in place of the busybox trigger
+	if !bc.o.NoScripts {
+		installed, err := bc.apk.GetInstalled()
+		if err != nil {
+			return nil, fmt.Errorf("getting installed packages: %w", err)
+		}
+
+		busyboxProvider, applets, err := installBusyboxLinks(bc.fs, installed)
+		if err != nil {
+			return nil, err
+		}
+		if busyboxProvider != "" {
+			bc.busyboxApplets = map[string][]string{busyboxProvider: applets}
+			for _, applet := range applets {
+				generated = append(generated, "/"+strings.TrimPrefix(applet, "/"))
+			}
+		}
 	}
 
 	// add necessary character devices
-	if err := installCharDevices(bc.fs); err != nil {
+	if err := installCharDevices(bc.fs, defaultCharDevices); err != nil {
 		return nil, err
 	}
 
-	if err := updateCache(ctx, bc.fs); err != nil {
+	if err := applyFileCapabilities(bc.fs, bc.o.FileCapabilities); err != nil {
 		return nil, err
 	}
 
+	// generate /etc/ld.so.cache, in place of the ldconfig trigger
+	if !bc.o.NoScripts {
+		if err := updateCache(ctx, bc.fs); err != nil {
+			return nil, err
+		}
+	}
+
+	if bc.o.PruneEmptyDirs {
+		pruned, err := pruneEmptyDirs(bc.fs, &bc.ic, append(slices.Clone(DefaultPruneKeepDirs), bc.o.PruneKeepDirs...))
+		if err != nil {
+			return nil, fmt.Errorf("pruning empty directories: %w", err)
+		}
+		log.Infof("pruned %d empty directories", pruned)
+	}
+
+	if bc.o.BrokenSymlinks != "" {
+		broken, err := findBrokenSymlinks(bc.fs)
+		if err != nil {
+			return nil, fmt.Errorf("checking symlinks: %w", err)
+		}
+		for _, b := range broken {
+			log.Warnf("broken symlink %s", b)
+		}
+		if len(broken) != 0 && bc.o.BrokenSymlinks == BrokenSymlinksFail {
+			return nil, fmt.Errorf("image contains %d broken symlinks, first: %s", len(broken), broken[0])
+		}
+	}
+
+	if bc.o.PermissionsSummary {
+		if bc.permissions, err = summarizePermissions(bc.layerFS()); err != nil {
+			return nil, err
+		}
+	}
+
+	slices.Sort(generated)
+	bc.generatedFiles = generated
+	slices.Sort(config)
+	bc.configFiles = config
+
+	if bc.o.ReproducibilityManifest {
+		if err := bc.buildReproducibilityManifest(); err != nil {
+			return nil, err
+		}
+	}
+
 	log.Debug("finished building filesystem")
 
 	return pkgs, nil
@@ -286,6 +439,27 @@ func (bc *Context) WriteEtcApkoConfig(_ context.Context) error {
 	return nil
 }
 
+// GenerateIndex generates the index of imgs, the images of each
+// architecture of a build with o and ic, created at created. With
+// WithSBOMDigestAnnotation, the image of each architecture is annotated
+// with the digest of its primary SBOM in sboms, see SBOMDigestAnnotation.
+func GenerateIndex(ctx context.Context, o *options.Options, ic types.ImageConfiguration, imgs map[types.Architecture]v1.Image, sboms map[types.Architecture][]types.SBOM, created time.Time) (name.Digest, v1.ImageIndex, error) {
+	var annotations map[types.Architecture]map[string]string
+	if o.SBOMDigestAnnotation {
+		annotations = make(map[types.Architecture]map[string]string, len(sboms))
+		for arch, s := range sboms {
+			a, err := SBOMDigestAnnotations(s)
+			if err != nil {
+				return name.Digest{}, nil, wrapError(ErrSBOM, err)
+			}
+			if a != nil {
+				annotations[arch] = a
+			}
+		}
+	}
+	return oci.GenerateIndexWithManifestAnnotations(ctx, ic, imgs, annotations, created)
+}
+
 // WriteIndex saves the index file from the given image configuration.
 func WriteIndex(ctx context.Context, o *options.Options, idx v1.ImageIndex) (string, error) {
 	log := clog.FromContext(ctx)
@@ -296,6 +470,7 @@ func WriteIndex(ctx context.Context, o *options.Options, idx v1.ImageIndex) (str
 		return "", fmt.Errorf("getting raw manifest: %w", err)
 	}
 	if err := os.WriteFile(outfile, b, 0644); err != nil { //nolint:gosec // this file is fine to be readable
+		_ = os.Remove(outfile)
 		return "", fmt.Errorf("writing index file: %w", err)
 	}
 	log.Infof("built index file as %s", outfile)
@@ -309,17 +484,92 @@ func (bc *Context) BuildPackageList(ctx context.Context) (toInstall []*apk.Repos
 	if bc.o.Lockfile != "" {
 		return nil, nil, fmt.Errorf("assertion: cannot ResolveWorld if LockFile:%s is given", bc.o.Lockfile)
 	}
+	if bc.o.ResolvedPackages != nil {
+		return bc.o.ResolvedPackages, nil, nil
+	}
 
 	if toInstall, conflicts, err = bc.apk.ResolveWorld(ctx); err != nil {
-		return toInstall, conflicts, fmt.Errorf("resolving apk packages: %w", err)
+		return toInstall, conflicts, wrapError(ErrResolution, fmt.Errorf("resolving apk packages: %w", err))
+	}
+	bc.indexDigests = bc.apk.ResolvedIndexDigests()
+	if bc.o.StalePins {
+		if err := bc.checkStalePins(ctx, toInstall); err != nil {
+			return nil, nil, wrapError(ErrResolution, err)
+		}
 	}
 	log.Infof("finished gathering apk info")
 
 	return toInstall, conflicts, err
 }
 
+// InstalledSize returns the total installed size, in bytes, of the given
+// packages as recorded in their repository index metadata. Callers of
+// BuildPackageList can use it to estimate the size of an image before
+// anything is installed.
+func InstalledSize(pkgs []*apk.RepositoryPackage) uint64 {
+	var total uint64
+	for _, pkg := range pkgs {
+		total += pkg.InstalledSize
+	}
+	return total
+}
+
+// Estimate is the cost of a build, as estimated from the repository index
+// metadata of the packages it installs.
+type Estimate struct {
+	// Packages is the number of packages.
+	Packages int
+	// DownloadSize is the total size, in bytes, of the .apk files to fetch.
+	DownloadSize uint64
+	// InstalledSize is the total size, in bytes, of the installed packages.
+	InstalledSize uint64
+}
+
+// EstimatePackages returns the Estimate of installing the given packages,
+// e.g. as returned by BuildPackageList. Nothing is downloaded.
+func EstimatePackages(pkgs []*apk.RepositoryPackage) Estimate {
+	est := Estimate{Packages: len(pkgs), InstalledSize: InstalledSize(pkgs)}
+	for _, pkg := range pkgs {
+		est.DownloadSize += pkg.Size
+	}
+	return est
+}
+
+// Estimate resolves the packages of the build and returns the Estimate of
+// installing them, so callers can decide whether to proceed with the build.
+func (bc *Context) Estimate(ctx context.Context) (Estimate, error) {
+	pkgs, _, err := bc.BuildPackageList(ctx)
+	if err != nil {
+		return Estimate{}, err
+	}
+	return EstimatePackages(pkgs), nil
+}
+
+// PackagesFingerprint returns a digest of the names, versions and checksums
+// of the given packages, in the form "sha256:<hex>". It does not depend on
+// the order of pkgs, so callers of BuildPackageList can compare it against
+// the fingerprint of a previous build to tell whether the resolved package
+// set changed.
+func PackagesFingerprint(pkgs []*apk.RepositoryPackage) string {
+	entries := make([]string, 0, len(pkgs))
+	for _, pkg := range pkgs {
+		entries = append(entries, fmt.Sprintf("%s\x00%s\x00%s\n", pkg.Name, pkg.Version, pkg.ChecksumString()))
+	}
+	slices.Sort(entries)
+
+	h := sha256.New()
+	for _, entry := range entries {
+		io.WriteString(h, entry) //nolint:errcheck // hash writes never fail
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
 func (bc *Context) Resolve(ctx context.Context) ([]*apk.APKResolved, error) {
-	return bc.apk.ResolveAndCalculateWorld(ctx)
+	resolved, err := bc.apk.ResolveAndCalculateWorld(ctx)
+	if err != nil {
+		return nil, wrapError(ErrResolution, err)
+	}
+	return resolved, nil
 }
 
 func (bc *Context) ResolveWithBase(ctx context.Context) ([]*apk.APKResolved, error) {
@@ -328,7 +578,7 @@ func (bc *Context) ResolveWithBase(ctx context.Context) ([]*apk.APKResolved, err
 	// and doesn't fetch actual packages.
 	allPkgs, _, err := bc.apk.ResolveWorld(ctx)
 	if err != nil {
-		return nil, err
+		return nil, wrapError(ErrResolution, err)
 	}
 	var existingPkgs []*apk.InstalledPackage
 	if bc.baseimg != nil {
@@ -350,7 +600,7 @@ func (bc *Context) ResolveWithBase(ctx context.Context) ([]*apk.APKResolved, err
 	// Note: CalculateWorld fetches the packages - they have to be available in the repository.
 	resolvedPkgs, err := bc.apk.CalculateWorld(ctx, toInstall)
 	if err != nil {
-		return nil, err
+		return nil, wrapError(ErrResolution, err)
 	}
 	return resolvedPkgs, nil
 }
@@ -0,0 +1,157 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+)
+
+func TestInstalledSize(t *testing.T) {
+	pkgs, _, err := newTestContext(t, nil).BuildPackageList(t.Context())
+	require.NoError(t, err)
+	require.Len(t, pkgs, 2)
+
+	// The installed sizes of pretend-baselayout and replayout in the test
+	// index.
+	require.Equal(t, uint64(2725+2638), InstalledSize(pkgs))
+	require.Zero(t, InstalledSize(nil))
+}
+
+func TestEstimate(t *testing.T) {
+	ctx := t.Context()
+	bc := newTestContext(t, nil)
+
+	est, err := bc.Estimate(ctx)
+	require.NoError(t, err)
+
+	// The sizes of pretend-baselayout and replayout in the test index.
+	want := Estimate{Packages: 2, DownloadSize: 2768 + 2787, InstalledSize: 2725 + 2638}
+	require.Equal(t, want, est)
+
+	pkgs, _, err := bc.BuildPackageList(ctx)
+	require.NoError(t, err)
+	require.Equal(t, want, EstimatePackages(pkgs))
+	require.Equal(t, Estimate{}, EstimatePackages(nil))
+}
+
+func TestPackagesFingerprint(t *testing.T) {
+	resolve := func() []*apk.RepositoryPackage {
+		pkgs, _, err := newTestContext(t, nil).BuildPackageList(t.Context())
+		require.NoError(t, err)
+		require.Len(t, pkgs, 2)
+		return pkgs
+	}
+
+	pkgs := resolve()
+	want := PackagesFingerprint(pkgs)
+	require.Regexp(t, `^sha256:[0-9a-f]{64}$`, want)
+
+	// Stable across resolutions and independent of order.
+	require.Equal(t, want, PackagesFingerprint(resolve()))
+	require.Equal(t, want, PackagesFingerprint([]*apk.RepositoryPackage{pkgs[1], pkgs[0]}))
+
+	// Sensitive to a version or checksum change.
+	bumped := *pkgs[0].Package
+	bumped.Version += "-r1"
+	require.NotEqual(t, want, PackagesFingerprint([]*apk.RepositoryPackage{apk.NewRepositoryPackage(&bumped, nil), pkgs[1]}))
+
+	rebuilt := *pkgs[0].Package
+	rebuilt.Checksum = []byte("not the same checksum")
+	require.NotEqual(t, want, PackagesFingerprint([]*apk.RepositoryPackage{apk.NewRepositoryPackage(&rebuilt, nil), pkgs[1]}))
+}
+
+func TestCanonicalApkDB(t *testing.T) {
+	installedDB := func(packages ...string) []byte {
+		ic := testConfig(t)
+		ic.Contents.Packages = packages
+
+		fsys := apkfs.NewMemFS()
+		bc := buildTestImage(t, fsys, WithImageConfiguration(ic), WithCanonicalApkDB(true))
+
+		// The database is still valid.
+		installed, err := bc.InstalledPackages()
+		require.NoError(t, err)
+		require.Len(t, installed, 2)
+		require.Equal(t, "pretend-baselayout", installed[0].Name)
+		require.Equal(t, "replayout", installed[1].Name)
+
+		b, err := fsys.ReadFile("lib/apk/db/installed")
+		require.NoError(t, err)
+		return b
+	}
+
+	require.Equal(t, string(installedDB("replayout")), string(installedDB("replayout", "pretend-baselayout")))
+}
+
+func TestCanonicalApkDBInstallOrder(t *testing.T) {
+	dir := t.TempDir()
+	var pkgs []*apk.RepositoryPackage
+	for _, name := range []string{"aaa", "mmm", "zzz"} {
+		pkgs = append(pkgs, writeTestAPK(t, dir, &apk.Package{Name: name, Origin: name}, map[string]string{"usr/share/" + name: name}))
+	}
+
+	installedDB := func(canonical bool, order ...int) string {
+		var ordered []*apk.RepositoryPackage
+		for _, i := range order {
+			ordered = append(ordered, pkgs[i])
+		}
+		bc := newRepoContext(t, repoConfig(dir), ordered, WithCanonicalApkDB(canonical))
+		require.NoError(t, bc.BuildImage(t.Context()))
+		b, err := bc.fs.ReadFile("usr/lib/apk/db/installed")
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	require.NotEqual(t, installedDB(false, 0, 1, 2), installedDB(false, 2, 0, 1))
+	require.Equal(t, installedDB(true, 0, 1, 2), installedDB(true, 2, 0, 1))
+	require.Equal(t, installedDB(false, 0, 1, 2), installedDB(true, 1, 2, 0))
+}
+
+func TestNoScripts(t *testing.T) {
+	for _, noScripts := range []bool{false, true} {
+		t.Run(fmt.Sprintf("noScripts=%t", noScripts), func(t *testing.T) {
+			// With /etc/ld.so.conf, apko generates /etc/ld.so.cache as the
+			// ldconfig trigger would.
+			fsys := apkfs.NewMemFS()
+			require.NoError(t, fsys.MkdirAll("etc", 0o755))
+			require.NoError(t, fsys.WriteFile("etc/ld.so.conf", nil, 0o644))
+
+			bc := buildTestImage(t, fsys, WithNoScripts(noScripts))
+
+			_, err := fsys.Stat("etc/ld.so.cache")
+			if noScripts {
+				require.ErrorIs(t, err, os.ErrNotExist)
+			} else {
+				require.NoError(t, err)
+			}
+
+			// The packages are installed either way, and so in the SBOMs.
+			installed, err := bc.InstalledPackages()
+			require.NoError(t, err)
+			var names []string
+			for _, pkg := range installed {
+				names = append(names, pkg.Name)
+			}
+			require.ElementsMatch(t, []string{"pretend-baselayout", "replayout"}, names)
+		})
+	}
+}
@@ -16,18 +16,27 @@ package build_test
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	iofs "io/fs"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/google/go-containerregistry/pkg/v1/empty"
 	"github.com/stretchr/testify/require"
 
 	"chainguard.dev/apko/pkg/apk/auth"
 	"chainguard.dev/apko/pkg/apk/fs"
 	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/oci"
 	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/sbom/generator/spdx"
 )
 
 func TestBuildLayers(t *testing.T) {
@@ -243,3 +252,114 @@ func TestAuth_bad(t *testing.T) {
 	require.Error(t, err, "build should have failed to init keyring")
 	require.True(t, called)
 }
+
+func TestArchSourceDateEpoch(t *testing.T) {
+	ctx := context.Background()
+
+	amd64 := types.ParseArchitecture("amd64")
+	arm64 := types.ParseArchitecture("arm64")
+	epochs := map[types.Architecture]time.Time{
+		amd64: time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC),
+		arm64: time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	opts := []build.Option{
+		build.WithConfig("apko.yaml", []string{"testdata"}),
+		build.WithSBOMGenerators(spdx.New()),
+		build.WithSBOM(t.TempDir()),
+	}
+	for arch, epoch := range epochs {
+		opts = append(opts, build.WithArchSourceDateEpoch(arch, epoch))
+	}
+
+	m, err := build.NewMultiArch(ctx, []types.Architecture{amd64, arm64}, opts...)
+	require.NoError(t, err)
+
+	for arch, bc := range m.Contexts {
+		_, layer, err := bc.BuildLayer(ctx)
+		require.NoError(t, err)
+
+		bde, err := bc.GetBuildDateEpoch()
+		require.NoError(t, err)
+		require.Equal(t, epochs[arch], bde)
+
+		img, err := oci.BuildImageFromLayer(ctx, empty.Image, layer, bc.ImageConfiguration(), bde, arch)
+		require.NoError(t, err)
+
+		sboms, err := bc.GenerateImageSBOM(ctx, arch, img)
+		require.NoError(t, err)
+		require.Len(t, sboms, 1)
+
+		b, err := os.ReadFile(sboms[0].Path)
+		require.NoError(t, err)
+		var doc spdx.Document
+		require.NoError(t, json.Unmarshal(b, &doc))
+		require.Equal(t, epochs[arch].Format(time.RFC3339), doc.CreationInfo.Created)
+
+		// The SBOM is also returned for embedding in an annotation.
+		require.Equal(t, b, sboms[0].Content)
+		require.Equal(t, base64.StdEncoding.EncodeToString(b), sboms[0].AnnotationValue())
+	}
+}
+
+// recordingFS is a filesystem backend which records the files written to it
+// through the FullFS interface.
+type recordingFS struct {
+	fs.FullFS
+	mu      sync.Mutex
+	written []string
+}
+
+func (r *recordingFS) OpenFile(name string, flag int, perm iofs.FileMode) (fs.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+		r.record(name)
+	}
+	return r.FullFS.OpenFile(name, flag, perm)
+}
+
+func (r *recordingFS) WriteFile(name string, b []byte, mode iofs.FileMode) error {
+	r.record(name)
+	return r.FullFS.WriteFile(name, b, mode)
+}
+
+func (r *recordingFS) record(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.written = append(r.written, strings.TrimPrefix(name, "/"))
+}
+
+func TestFilesystemFactory(t *testing.T) {
+	ctx := context.Background()
+
+	var (
+		mu       sync.Mutex
+		backends []*recordingFS
+	)
+	newFS := func() fs.FullFS {
+		mu.Lock()
+		defer mu.Unlock()
+		r := &recordingFS{FullFS: fs.NewMemFS()}
+		backends = append(backends, r)
+		return r
+	}
+
+	archs := []types.Architecture{types.ParseArchitecture("amd64"), types.ParseArchitecture("arm64")}
+	m, err := build.NewMultiArch(ctx, archs,
+		build.WithConfig("apko.yaml", []string{"testdata"}),
+		build.WithFilesystemFactory(newFS),
+	)
+	require.NoError(t, err)
+	require.Len(t, backends, len(archs))
+
+	layers, err := m.BuildLayers(ctx)
+	require.NoError(t, err)
+	require.Len(t, layers, len(archs))
+
+	// The whole build, from the installation of the packages to the
+	// runtime apk configuration, went through the backends.
+	for _, r := range backends {
+		require.Contains(t, r.written, "usr/lib/apk/db/installed")
+		require.Contains(t, r.written, "etc/os-release")
+		require.Contains(t, r.written, "etc/apk/repositories")
+	}
+}
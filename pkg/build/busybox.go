@@ -29,6 +29,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 
 	"chainguard.dev/apko/pkg/apk/apk"
@@ -51,14 +52,17 @@ var busyboxLinks map[string][]string
 // note that it changes based on version of busybox,
 // so this should be updated to match busybox version.
 
-func installBusyboxLinks(fsys apkfs.FullFS, installed []*apk.InstalledPackage) error {
+// installBusyboxLinks creates the links to the busybox applets. It returns
+// the name of the package providing busybox, and the links it created, in
+// order.
+func installBusyboxLinks(fsys apkfs.FullFS, installed []*apk.InstalledPackage) (string, []string, error) {
 	// does busybox exist? if not, do not bother with symlinks
 	busyboxInfo, err := fsys.Stat(busybox)
 	if err != nil {
 		if !errors.Is(err, os.ErrNotExist) {
-			return err
+			return "", nil, err
 		}
-		return nil
+		return "", nil, nil
 	}
 	var (
 		installedVersion string
@@ -81,7 +85,7 @@ func installBusyboxLinks(fsys apkfs.FullFS, installed []*apk.InstalledPackage) e
 		}
 	}
 	if installedVersion == "" {
-		return fmt.Errorf("busybox package not installed")
+		return "", nil, fmt.Errorf("busybox package not installed")
 	}
 
 	var links []string
@@ -95,7 +99,7 @@ func installBusyboxLinks(fsys apkfs.FullFS, installed []*apk.InstalledPackage) e
 		// convert to a basic semver
 		matches := basicSemverRegex.FindAllStringSubmatch(installedVersion, -1)
 		if len(matches) != 1 || len(matches[0]) < 4 {
-			return fmt.Errorf("invalid busybox version: %s", installedVersion)
+			return "", nil, fmt.Errorf("invalid busybox version: %s", installedVersion)
 		}
 		installedVersion = matches[0][1]
 		links, ok = busyboxLinks[installedVersion]
@@ -104,6 +108,7 @@ func installBusyboxLinks(fsys apkfs.FullFS, installed []*apk.InstalledPackage) e
 		}
 	}
 
+	var created []string
 	for _, link := range links {
 		if link == busybox || link == "" {
 			continue
@@ -115,10 +120,10 @@ func installBusyboxLinks(fsys apkfs.FullFS, installed []*apk.InstalledPackage) e
 		}
 
 		if err := fsys.MkdirAll(dir, 0755); err != nil {
-			return fmt.Errorf("creating directory %s: %w", dir, err)
+			return "", nil, fmt.Errorf("creating directory %s: %w", dir, err)
 		}
 		if err := fsys.Chtimes(dir, busyboxInfo.ModTime(), busyboxInfo.ModTime()); err != nil {
-			return fmt.Errorf("error chtimes on %s: %w", dir, err)
+			return "", nil, fmt.Errorf("error chtimes on %s: %w", dir, err)
 		}
 
 		if err := fsys.Symlink(busybox, link); err != nil {
@@ -136,8 +141,10 @@ func installBusyboxLinks(fsys apkfs.FullFS, installed []*apk.InstalledPackage) e
 					}
 				}
 			}
-			return fmt.Errorf("creating busybox link %s: %w", link, err)
+			return "", nil, fmt.Errorf("creating busybox link %s: %w", link, err)
 		}
+		created = append(created, link)
 	}
-	return nil
+	sort.Strings(created)
+	return pkgName, created, nil
 }
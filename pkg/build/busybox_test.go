@@ -55,8 +55,10 @@ func TestInstallBusyboxSymlinks(t *testing.T) {
 		buildBusybox(fsys, t)
 		err = fsys.WriteFile("/etc/busybox-paths.d/busybox", []byte(strings.Join(fakeLinks, "\n")), 0755)
 		require.NoError(t, err)
-		err = installBusyboxLinks(fsys, installed)
+		provider, created, err := installBusyboxLinks(fsys, installed)
 		require.NoError(t, err)
+		require.Equal(t, "busybox", provider)
+		require.Equal(t, []string{"/bin/bar", "/bin/foo"}, created)
 		for _, link := range fakeLinks {
 			_, err := fsys.Lstat(link)
 			require.NoError(t, err)
@@ -73,8 +75,9 @@ func TestInstallBusyboxSymlinks(t *testing.T) {
 		var err error
 		fsys := apkfs.NewMemFS()
 		buildBusybox(fsys, t)
-		err = installBusyboxLinks(fsys, installed)
+		_, created, err := installBusyboxLinks(fsys, installed)
 		require.NoError(t, err)
+		require.Subset(t, created, trueLinks)
 		for _, link := range fakeLinks {
 			_, err := fsys.Lstat(link)
 			require.Error(t, err, "those links should not exist")
@@ -0,0 +1,157 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"encoding/binary"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+)
+
+// capabilityXattr is the extended attribute holding the file capabilities,
+// written to the layers as a SCHILY.xattr PAX record by the tar writer.
+const capabilityXattr = "security.capability"
+
+// The VFS_CAP_REVISION_2 layout of security.capability, see
+// linux/capability.h: a little endian magic word, whose lowest bit marks the
+// permitted capabilities as effective, followed by the permitted and
+// inheritable masks of each 32 bit half of the capabilities.
+const (
+	vfsCapRevision2       = 0x02000000
+	vfsCapFlagsEffective  = 0x000001
+	vfsCapRevision2Length = 20
+)
+
+// capabilityNames are the names of the Linux capabilities, indexed by number.
+var capabilityNames = []string{
+	"cap_chown",
+	"cap_dac_override",
+	"cap_dac_read_search",
+	"cap_fowner",
+	"cap_fsetid",
+	"cap_kill",
+	"cap_setgid",
+	"cap_setuid",
+	"cap_setpcap",
+	"cap_linux_immutable",
+	"cap_net_bind_service",
+	"cap_net_broadcast",
+	"cap_net_admin",
+	"cap_net_raw",
+	"cap_ipc_lock",
+	"cap_ipc_owner",
+	"cap_sys_module",
+	"cap_sys_rawio",
+	"cap_sys_chroot",
+	"cap_sys_ptrace",
+	"cap_sys_pacct",
+	"cap_sys_admin",
+	"cap_sys_boot",
+	"cap_sys_nice",
+	"cap_sys_resource",
+	"cap_sys_time",
+	"cap_sys_tty_config",
+	"cap_mknod",
+	"cap_lease",
+	"cap_audit_write",
+	"cap_audit_control",
+	"cap_setfcap",
+	"cap_mac_override",
+	"cap_mac_admin",
+	"cap_syslog",
+	"cap_wake_alarm",
+	"cap_block_suspend",
+	"cap_audit_read",
+	"cap_perfmon",
+	"cap_bpf",
+	"cap_checkpoint_restore",
+}
+
+// encodeCapabilities parses capabilities in the setcap(8) notation, i.e. a
+// comma separated list of capability names followed by "=" or "+" and the
+// flags, among "e" (effective), "i" (inheritable) and "p" (permitted), e.g.
+// "cap_net_bind_service+ep", and returns the security.capability xattr
+// setting them.
+func encodeCapabilities(s string) ([]byte, error) {
+	i := strings.IndexAny(s, "=+")
+	if i < 0 {
+		return nil, fmt.Errorf("capabilities %q: missing flags, e.g. %q", s, s+"+ep")
+	}
+	names, flags := s[:i], s[i+1:]
+
+	var mask uint64
+	for name := range strings.SplitSeq(names, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		n := slices.Index(capabilityNames, name)
+		if n < 0 {
+			return nil, fmt.Errorf("capabilities %q: unknown capability %q", s, name)
+		}
+		mask |= 1 << n
+	}
+
+	var permitted, inheritable uint64
+	magic := uint32(vfsCapRevision2)
+	for _, f := range flags {
+		switch f {
+		case 'e':
+			magic |= vfsCapFlagsEffective
+		case 'i':
+			inheritable = mask
+		case 'p':
+			permitted = mask
+		default:
+			return nil, fmt.Errorf("capabilities %q: unknown flag %q, expected e, i or p", s, f)
+		}
+	}
+	if permitted == 0 && inheritable == 0 {
+		return nil, fmt.Errorf("capabilities %q: neither permitted nor inheritable", s)
+	}
+
+	data := make([]byte, 0, vfsCapRevision2Length)
+	data = binary.LittleEndian.AppendUint32(data, magic)
+	data = binary.LittleEndian.AppendUint32(data, uint32(permitted))
+	data = binary.LittleEndian.AppendUint32(data, uint32(inheritable))
+	data = binary.LittleEndian.AppendUint32(data, uint32(permitted>>32))
+	data = binary.LittleEndian.AppendUint32(data, uint32(inheritable>>32))
+	return data, nil
+}
+
+// applyFileCapabilities sets the capabilities of the given files, keyed by
+// their absolute paths, as the security.capability xattr. The files must be
+// regular files installed in the image.
+func applyFileCapabilities(fsys apkfs.FullFS, capabilities map[string]string) error {
+	for _, p := range slices.Sorted(maps.Keys(capabilities)) {
+		data, err := encodeCapabilities(capabilities[p])
+		if err != nil {
+			return fmt.Errorf("setting capabilities of %s: %w", p, err)
+		}
+		fi, err := fsys.Lstat(p)
+		if err != nil {
+			return fmt.Errorf("setting capabilities of %s: %w", p, err)
+		}
+		// Not every FullFS implements Lstat without following symlinks.
+		if _, err := fsys.Readlink(p); err == nil || !fi.Mode().IsRegular() {
+			return fmt.Errorf("setting capabilities of %s: not a regular file", p)
+		}
+		if err := fsys.SetXattr(p, capabilityXattr, data); err != nil {
+			return fmt.Errorf("setting capabilities of %s: %w", p, err)
+		}
+	}
+	return nil
+}
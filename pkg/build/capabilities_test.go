@@ -0,0 +1,112 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/apk/fs"
+)
+
+func TestEncodeCapabilities(t *testing.T) {
+	for _, tt := range []struct {
+		caps    string
+		want    []byte
+		wantErr string
+	}{{
+		caps: "cap_net_bind_service+ep",
+		want: []byte{
+			0x01, 0x00, 0x00, 0x02,
+			0x00, 0x04, 0x00, 0x00,
+			0x00, 0x00, 0x00, 0x00,
+			0x00, 0x00, 0x00, 0x00,
+			0x00, 0x00, 0x00, 0x00,
+		},
+	}, {
+		caps: "cap_net_raw,CAP_BPF=pi",
+		want: []byte{
+			0x00, 0x00, 0x00, 0x02,
+			0x00, 0x20, 0x00, 0x00,
+			0x00, 0x20, 0x00, 0x00,
+			0x80, 0x00, 0x00, 0x00,
+			0x80, 0x00, 0x00, 0x00,
+		},
+	}, {
+		caps:    "cap_net_bind_service",
+		wantErr: "missing flags",
+	}, {
+		caps:    "cap_bogus+ep",
+		wantErr: `unknown capability "cap_bogus"`,
+	}, {
+		caps:    "cap_net_raw+ex",
+		wantErr: "unknown flag 'x'",
+	}, {
+		caps:    "cap_net_raw+e",
+		wantErr: "neither permitted nor inheritable",
+	}} {
+		t.Run(tt.caps, func(t *testing.T) {
+			got, err := encodeCapabilities(tt.caps)
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestApplyFileCapabilities(t *testing.T) {
+	m := fs.NewMemFS()
+	require.NoError(t, m.MkdirAll("usr/bin", 0o755))
+	require.NoError(t, m.WriteFile("usr/bin/server", []byte("#!/bin/sh\n"), 0o755))
+	require.NoError(t, m.Symlink("server", "usr/bin/link"))
+
+	require.NoError(t, applyFileCapabilities(m, map[string]string{"/usr/bin/server": "cap_net_bind_service+ep"}))
+	require.ErrorContains(t, applyFileCapabilities(m, map[string]string{"/usr/bin/link": "cap_net_raw+ep"}), "not a regular file")
+	require.Error(t, applyFileCapabilities(m, map[string]string{"/usr/bin/missing": "cap_net_raw+ep"}))
+
+	want, err := encodeCapabilities("cap_net_bind_service+ep")
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, writeTar(context.Background(), tar.NewWriter(&buf), m, nil))
+
+	tr := tar.NewReader(&buf)
+	for {
+		hdr, err := tr.Next()
+		require.NoError(t, err, "usr/bin/server not found in the tar")
+		if hdr.Name != "usr/bin/server" {
+			continue
+		}
+		require.Equal(t, string(want), hdr.PAXRecords[xattrTarPAXRecordsPrefix+capabilityXattr])
+		break
+	}
+}
+
+func TestWithFileCapabilities(t *testing.T) {
+	for _, caps := range []map[string]string{
+		{"usr/bin/server": "cap_net_bind_service+ep"},
+		{"/usr/bin/server": "cap_bogus+ep"},
+	} {
+		_, err := New(context.Background(), fs.NewMemFS(), WithFileCapabilities(caps))
+		require.ErrorIs(t, err, ErrInvalidConfig)
+	}
+}
@@ -17,8 +17,11 @@ package build
 import (
 	"bytes"
 	"context"
+	"crypto/sha1" //nolint:gosec // for the OpenSSL subject hash
 	"crypto/sha256"
 	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
 	"encoding/hex"
 	"encoding/pem"
 	"errors"
@@ -27,7 +30,10 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
+	"unicode/utf16"
 
+	"github.com/chainguard-dev/clog"
 	"github.com/pavlo-v-chernykh/keystore-go/v4"
 	"go.opentelemetry.io/otel"
 )
@@ -35,6 +41,9 @@ import (
 const (
 	// Directory for individual certificate files (used by update-ca-certificates).
 	caCertsDir = "usr/local/share/ca-certificates"
+
+	// Directory OpenSSL looks certificates up in by the hash of their subject.
+	caCertsHashDir = "etc/ssl/certs"
 )
 
 var (
@@ -178,6 +187,190 @@ func (bc *Context) installCertificates(ctx context.Context) error {
 	return nil
 }
 
+// installCABundle installs the CA bundle of the build options, unless a
+// package, e.g. ca-certificates-bundle, already installed one: the bundle is
+// written to the default bundle path, and each of its certificates to its
+// own file in /etc/ssl/certs, along with the subject hash symlinks c_rehash
+// would create for it.
+func (bc *Context) installCABundle(ctx context.Context) error {
+	ctx, span := otel.Tracer("apko").Start(ctx, "installCABundle")
+	defer span.End()
+	log := clog.FromContext(ctx)
+
+	if bc.o.CABundle == "" {
+		return nil
+	}
+	if _, err := bc.fs.Stat(caBundlePaths[0]); err == nil {
+		log.Infof("/%s provided by the image contents, not installing %s", caBundlePaths[0], bc.o.CABundle)
+		return nil
+	}
+
+	data, err := os.ReadFile(bc.o.CABundle)
+	if err != nil {
+		return wrapError(ErrInvalidConfig, fmt.Errorf("reading CA bundle: %w", err))
+	}
+	certs, err := parseCertificateBundle(data)
+	if err != nil {
+		return wrapError(ErrInvalidConfig, fmt.Errorf("parsing CA bundle %s: %w", bc.o.CABundle, err))
+	}
+
+	builtTime, err := bc.GetBuildDateEpoch()
+	if err != nil {
+		return fmt.Errorf("failed to get build date epoch: %w", err)
+	}
+
+	if err := bc.fs.MkdirAll(caCertsHashDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", caCertsHashDir, err)
+	}
+
+	var bundle bytes.Buffer
+	seen := map[string]bool{}
+	for _, cert := range certs {
+		if seen[cert.fingerprint] {
+			continue
+		}
+		seen[cert.fingerprint] = true
+
+		bundle.Write(cert.pem)
+		bundle.WriteString("\n")
+
+		name := fmt.Sprintf("ca-bundle-%s.pem", cert.fingerprint)
+		certPath := filepath.Join(caCertsHashDir, name)
+		if err := bc.fs.WriteFile(certPath, cert.pem, 0o644); err != nil {
+			return fmt.Errorf("failed to write certificate file %s: %w", certPath, err)
+		}
+		if err := bc.fs.Chtimes(certPath, builtTime, builtTime); err != nil {
+			return fmt.Errorf("failed to change times on certificate file %s: %w", certPath, err)
+		}
+
+		// As c_rehash, link <hash>.<n> to the certificate, with the first n
+		// not taken by a certificate with the same subject hash.
+		hash, err := subjectHash(cert.structured)
+		if err != nil {
+			return fmt.Errorf("hashing the subject of certificate %s: %w", cert.fingerprint, err)
+		}
+		for n := 0; ; n++ {
+			link := filepath.Join(caCertsHashDir, fmt.Sprintf("%s.%d", hash, n))
+			if _, err := bc.fs.Lstat(link); err == nil {
+				continue
+			}
+			if err := bc.fs.Symlink(name, link); err != nil {
+				return fmt.Errorf("failed to link %s to %s: %w", link, name, err)
+			}
+			break
+		}
+	}
+
+	if err := bc.fs.WriteFile(caBundlePaths[0], bundle.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("failed to write CA bundle %s: %w", caBundlePaths[0], err)
+	}
+	return bc.fs.Chtimes(caBundlePaths[0], builtTime, builtTime)
+}
+
+// subjectHash returns the hash of the subject of cert as OpenSSL computes
+// it for c_rehash and certificate directory lookups, X509_NAME_hash: the
+// first four bytes, little endian, of the SHA1 of the canonical encoding of
+// the subject.
+func subjectHash(cert *x509.Certificate) (string, error) {
+	var rdns []canonicalRDNSET
+	if rest, err := asn1.Unmarshal(cert.RawSubject, &rdns); err != nil {
+		return "", err
+	} else if len(rest) != 0 {
+		return "", errors.New("trailing data after subject")
+	}
+
+	// The canonical encoding is that of the RDNs of the subject, without
+	// the enclosing sequence, with their string values lowercased, their
+	// whitespace collapsed and encoded as UTF8String. Other values keep
+	// their original encoding.
+	var canon []byte
+	for _, rdn := range rdns {
+		for i, atv := range rdn {
+			s, ok := decodeNameString(atv.Value)
+			if !ok {
+				continue
+			}
+			b, err := asn1.MarshalWithParams(canonicalString(s), "utf8")
+			if err != nil {
+				return "", err
+			}
+			rdn[i].Value = asn1.RawValue{FullBytes: b}
+		}
+		b, err := asn1.Marshal(rdn)
+		if err != nil {
+			return "", err
+		}
+		canon = append(canon, b...)
+	}
+
+	sum := sha1.Sum(canon) //nolint:gosec // this is what OpenSSL uses
+	return fmt.Sprintf("%08x", binary.LittleEndian.Uint32(sum[:4])), nil
+}
+
+// canonicalATV is an attribute of an RDN, with its value left encoded.
+type canonicalATV struct {
+	Type  asn1.ObjectIdentifier
+	Value asn1.RawValue
+}
+
+// canonicalRDNSET is an RDN, the SET suffix having encoding/asn1 handle it
+// as a SET OF.
+type canonicalRDNSET []canonicalATV
+
+// decodeNameString decodes the name attribute value v if it is one of the
+// string types OpenSSL canonicalizes.
+func decodeNameString(v asn1.RawValue) (string, bool) {
+	if v.Class != asn1.ClassUniversal {
+		return "", false
+	}
+	switch v.Tag {
+	case asn1.TagUTF8String, asn1.TagPrintableString, asn1.TagT61String, asn1.TagIA5String, 26 /* VisibleString */ :
+		return string(v.Bytes), true
+	case 30: // BMPString
+		if len(v.Bytes)%2 != 0 {
+			return "", false
+		}
+		u := make([]uint16, len(v.Bytes)/2)
+		for i := range u {
+			u[i] = binary.BigEndian.Uint16(v.Bytes[2*i:])
+		}
+		return string(utf16.Decode(u)), true
+	case 28: // UniversalString
+		if len(v.Bytes)%4 != 0 {
+			return "", false
+		}
+		r := make([]rune, len(v.Bytes)/4)
+		for i := range r {
+			r[i] = rune(binary.BigEndian.Uint32(v.Bytes[4*i:]))
+		}
+		return string(r), true
+	}
+	return "", false
+}
+
+// canonicalString returns s as OpenSSL canonicalizes the string values of
+// names: without leading and trailing whitespace, with the runs of
+// whitespace collapsed to a single space, and with ASCII lowercased.
+func canonicalString(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range strings.Trim(s, " \t\n\v\f\r") {
+		switch {
+		case strings.ContainsRune(" \t\n\v\f\r", r):
+			space = true
+			continue
+		case space:
+			b.WriteByte(' ')
+			space = false
+		}
+		if r >= 'A' && r <= 'Z' {
+			r += 'a' - 'A'
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
 // loadJavaTruststores loads all existing Java truststores from the configured paths.
 // It is ok if no truststores exist; in that case, an empty slice is returned.
 func (bc *Context) loadJavaTruststores() ([]loadedTruststore, error) {
@@ -220,16 +413,27 @@ func parseCertificates(pemData string) (*parsedCertificate, error) {
 		return nil, fmt.Errorf("no certificate data provided")
 	}
 
-	var cert *parsedCertificate
-	rest := []byte(pemData)
+	certs, err := parseCertificateBundle([]byte(pemData))
+	if err != nil {
+		return nil, err
+	}
+	if len(certs) > 1 {
+		// More than one certificate found.
+		return nil, fmt.Errorf("multiple certificates found; only one is allowed")
+	}
+	return certs[0], nil
+}
+
+// parseCertificateBundle parses PEM-encoded certificates, e.g. a CA bundle,
+// and returns a parsedCertificate struct for each.
+func parseCertificateBundle(pemData []byte) ([]*parsedCertificate, error) {
+	var certs []*parsedCertificate
+	rest := pemData
 	for {
 		var block *pem.Block
 		block, rest = pem.Decode(rest)
 		if block == nil {
 			break
-		} else if cert != nil {
-			// More than one certificate found.
-			return nil, fmt.Errorf("multiple certificates found; only one is allowed")
 		}
 
 		if block.Type != "CERTIFICATE" {
@@ -252,15 +456,15 @@ func parseCertificates(pemData string) (*parsedCertificate, error) {
 			return nil, fmt.Errorf("failed to re-encode certificate to PEM: %w", err)
 		}
 
-		cert = &parsedCertificate{
+		certs = append(certs, &parsedCertificate{
 			structured:  parsed,
 			pem:         pemBuf.Bytes(),
 			fingerprint: fingerprint,
-		}
+		})
 	}
 
-	if cert == nil {
+	if len(certs) == 0 {
 		return nil, fmt.Errorf("no certificates found in PEM data")
 	}
-	return cert, nil
+	return certs, nil
 }
@@ -19,6 +19,7 @@ import (
 	"context"
 	"fmt"
 	"io/fs"
+	"os"
 	"path/filepath"
 	"testing"
 	"time"
@@ -374,3 +375,91 @@ func TestInstallCertificates(t *testing.T) {
 		})
 	}
 }
+
+func TestSubjectHash(t *testing.T) {
+	// As computed by openssl x509 -noout -subject_hash.
+	for pemData, want := range map[string]string{
+		testCertPEM:  "63bc25b1",
+		testCertPEM2: "b5023534",
+	} {
+		cert, err := parseCertificates(pemData)
+		if err != nil {
+			t.Fatalf("parseCertificates() error = %v", err)
+		}
+		got, err := subjectHash(cert.structured)
+		if err != nil {
+			t.Fatalf("subjectHash() error = %v", err)
+		}
+		if got != want {
+			t.Errorf("subjectHash() = %s, want %s", got, want)
+		}
+	}
+}
+
+func TestInstallCABundle(t *testing.T) {
+	epoch := time.Unix(1337, 0)
+	t.Setenv("SOURCE_DATE_EPOCH", fmt.Sprintf("%d", epoch.Unix()))
+	bundlePath := filepath.Join(t.TempDir(), "bundle.pem")
+	if err := os.WriteFile(bundlePath, []byte(testCertPEM+"\n"+testCertPEM2+"\n"+testCertPEM), 0o644); err != nil {
+		t.Fatalf("failed to write bundle: %v", err)
+	}
+
+	t.Run("installed", func(t *testing.T) {
+		fsys := apkfs.NewMemFS()
+		bc := &Context{o: options.Options{SourceDateEpoch: epoch, CABundle: bundlePath}, fs: fsys}
+		if err := bc.installCABundle(context.Background()); err != nil {
+			t.Fatalf("installCABundle() error = %v", err)
+		}
+
+		got, err := fsys.ReadFile("etc/ssl/certs/ca-certificates.crt")
+		if err != nil {
+			t.Fatalf("failed to read bundle: %v", err)
+		}
+		if diff := cmp.Diff(testCertPEM+"\n"+testCertPEM2+"\n", string(got)); diff != "" {
+			t.Errorf("bundle mismatch (-want +got):\n%s", diff)
+		}
+
+		for link, want := range map[string]string{
+			"etc/ssl/certs/63bc25b1.0": "ca-bundle-" + testCertPEMFingerprint + ".pem",
+			"etc/ssl/certs/b5023534.0": "ca-bundle-" + testCertPEM2Fingerprint + ".pem",
+		} {
+			target, err := fsys.Readlink(link)
+			if err != nil {
+				t.Fatalf("failed to read link %s: %v", link, err)
+			}
+			if target != want {
+				t.Errorf("%s links to %s, want %s", link, target, want)
+			}
+			if _, err := fsys.Stat(link); err != nil {
+				t.Errorf("%s is dangling: %v", link, err)
+			}
+		}
+		if _, err := fsys.Lstat("etc/ssl/certs/63bc25b1.1"); err == nil {
+			t.Errorf("duplicate certificate linked twice")
+		}
+	})
+
+	t.Run("provided by a package", func(t *testing.T) {
+		fsys := apkfs.NewMemFS()
+		if err := fsys.MkdirAll("etc/ssl/certs", 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := fsys.WriteFile("etc/ssl/certs/ca-certificates.crt", []byte(testCertPEM2), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		bc := &Context{o: options.Options{SourceDateEpoch: epoch, CABundle: bundlePath}, fs: fsys}
+		if err := bc.installCABundle(context.Background()); err != nil {
+			t.Fatalf("installCABundle() error = %v", err)
+		}
+		got, err := fsys.ReadFile("etc/ssl/certs/ca-certificates.crt")
+		if err != nil {
+			t.Fatalf("failed to read bundle: %v", err)
+		}
+		if string(got) != testCertPEM2 {
+			t.Errorf("bundle of the package was overwritten")
+		}
+		if _, err := fsys.Lstat("etc/ssl/certs/63bc25b1.0"); err == nil {
+			t.Errorf("hash link created though a package provides the bundle")
+		}
+	})
+}
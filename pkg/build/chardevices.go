@@ -2,6 +2,7 @@ package build
 
 import (
 	"fmt"
+	"path"
 	"path/filepath"
 
 	"golang.org/x/sys/unix"
@@ -9,17 +10,31 @@ import (
 	apkfs "chainguard.dev/apko/pkg/apk/fs"
 )
 
-func installCharDevices(fsys apkfs.FullFS) error {
-	devices := []struct {
-		path  string
-		major uint32
-		minor uint32
-	}{
-		{"/dev/zero", 1, 5},
-		{"/dev/urandom", 1, 9},
-		{"/dev/null", 1, 3},
-		{"/dev/random", 1, 8},
-		{"/dev/console", 5, 1},
+// Largest device numbers Linux supports: 12 bits for the major, 20 bits for
+// the minor.
+const (
+	maxDeviceMajor = 1<<12 - 1
+	maxDeviceMinor = 1<<20 - 1
+)
+
+// charDevice is a character device node to create in the image.
+type charDevice struct {
+	path  string
+	major uint32
+	minor uint32
+}
+
+var defaultCharDevices = []charDevice{
+	{"/dev/zero", 1, 5},
+	{"/dev/urandom", 1, 9},
+	{"/dev/null", 1, 3},
+	{"/dev/random", 1, 8},
+	{"/dev/console", 5, 1},
+}
+
+func installCharDevices(fsys apkfs.FullFS, devices []charDevice) error {
+	if err := validateCharDevices(devices); err != nil {
+		return wrapError(ErrInvalidConfig, err)
 	}
 	for _, dev := range devices {
 		if _, err := fsys.Stat(dev.path); err == nil {
@@ -35,3 +50,33 @@ func installCharDevices(fsys apkfs.FullFS) error {
 	}
 	return nil
 }
+
+// validateCharDevices fails on the first device whose path is not a clean
+// absolute path, whose numbers are out of the range Linux supports, or which
+// conflicts with another device by its path or numbers, before any is
+// created.
+func validateCharDevices(devices []charDevice) error {
+	byPath := map[string]charDevice{}
+	byNumbers := map[[2]uint32]charDevice{}
+	for _, dev := range devices {
+		if !path.IsAbs(dev.path) || path.Clean(dev.path) != dev.path || dev.path == "/" {
+			return fmt.Errorf("character device path %q is not a clean absolute path", dev.path)
+		}
+		if dev.major == 0 || dev.major > maxDeviceMajor {
+			return fmt.Errorf("character device %s: major number %d out of range 1-%d", dev.path, dev.major, maxDeviceMajor)
+		}
+		if dev.minor > maxDeviceMinor {
+			return fmt.Errorf("character device %s: minor number %d out of range 0-%d", dev.path, dev.minor, maxDeviceMinor)
+		}
+		if other, ok := byPath[dev.path]; ok {
+			return fmt.Errorf("character device %s listed twice, as %d:%d and %d:%d", dev.path, other.major, other.minor, dev.major, dev.minor)
+		}
+		numbers := [2]uint32{dev.major, dev.minor}
+		if other, ok := byNumbers[numbers]; ok {
+			return fmt.Errorf("character devices %s and %s are both %d:%d", other.path, dev.path, dev.major, dev.minor)
+		}
+		byPath[dev.path] = dev
+		byNumbers[numbers] = dev
+	}
+	return nil
+}
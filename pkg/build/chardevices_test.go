@@ -0,0 +1,65 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/apk/fs"
+)
+
+func TestValidateCharDevices(t *testing.T) {
+	require.NoError(t, validateCharDevices(defaultCharDevices))
+
+	for _, tt := range []struct {
+		devices []charDevice
+		wantErr string
+	}{{
+		devices: []charDevice{{"dev/null", 1, 3}},
+		wantErr: "not a clean absolute path",
+	}, {
+		devices: []charDevice{{"/dev/../null", 1, 3}},
+		wantErr: "not a clean absolute path",
+	}, {
+		devices: []charDevice{{"/dev/null", 0, 3}},
+		wantErr: "major number 0 out of range",
+	}, {
+		devices: []charDevice{{"/dev/null", 4096, 3}},
+		wantErr: "major number 4096 out of range",
+	}, {
+		devices: []charDevice{{"/dev/null", 1, 1 << 20}},
+		wantErr: "minor number 1048576 out of range",
+	}, {
+		devices: []charDevice{{"/dev/null", 1, 3}, {"/dev/null", 1, 5}},
+		wantErr: "/dev/null listed twice",
+	}, {
+		devices: []charDevice{{"/dev/null", 1, 3}, {"/dev/nothing", 1, 3}},
+		wantErr: "/dev/null and /dev/nothing are both 1:3",
+	}} {
+		require.ErrorContains(t, validateCharDevices(tt.devices), tt.wantErr)
+	}
+}
+
+func TestInstallCharDevicesInvalid(t *testing.T) {
+	m := fs.NewMemFS()
+	err := installCharDevices(m, []charDevice{{"/dev/zero", 1, 5}, {"/dev/bogus", 1, 1 << 20}})
+	require.ErrorIs(t, err, ErrInvalidConfig)
+
+	// Nothing is created when a device is invalid.
+	_, err = m.Stat("dev/zero")
+	require.Error(t, err)
+}
@@ -0,0 +1,114 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/chainguard-dev/clog"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+)
+
+// unsatisfiedDependency is a runtime dependency of an installed package which
+// no installed package satisfies.
+type unsatisfiedDependency struct {
+	// Package is the name of the package declaring the dependency.
+	Package string
+	// Dependency is the dependency, as declared, e.g. "so:libc.musl-x86_64.so.1"
+	// or "foo>=1.2".
+	Dependency string
+}
+
+func (u unsatisfiedDependency) String() string {
+	return fmt.Sprintf("%s depends on %s", u.Package, u.Dependency)
+}
+
+// verifyDependencies fails if the runtime dependencies of the installed
+// packages are not all satisfied, logging each unsatisfied one.
+func (bc *Context) verifyDependencies(ctx context.Context) error {
+	log := clog.FromContext(ctx)
+
+	installed, err := bc.apk.GetInstalled()
+	if err != nil {
+		return fmt.Errorf("getting installed packages: %w", err)
+	}
+	unsatisfied := findUnsatisfiedDependencies(installed)
+	for _, u := range unsatisfied {
+		log.Errorf("unsatisfied dependency: %s", u)
+	}
+	if len(unsatisfied) != 0 {
+		return wrapError(ErrInstall, fmt.Errorf("%d unsatisfied dependencies, first: %s", len(unsatisfied), unsatisfied[0]))
+	}
+	return nil
+}
+
+// findUnsatisfiedDependencies returns the dependencies of the installed
+// packages which are neither satisfied by the name and version of another
+// installed package nor by what it provides, sorted by package. Conflicts,
+// i.e. "!" dependencies, are left out.
+func findUnsatisfiedDependencies(installed []*apk.InstalledPackage) []unsatisfiedDependency {
+	// The versions by which each name is provided, empty for the provides
+	// without a version.
+	versions := map[string][]string{}
+	for _, pkg := range installed {
+		versions[pkg.Name] = append(versions[pkg.Name], pkg.Version)
+		for _, prov := range pkg.Provides {
+			p := apk.ResolvePackageNameVersionPin(prov)
+			versions[p.Name] = append(versions[p.Name], p.Version)
+		}
+	}
+
+	var unsatisfied []unsatisfiedDependency
+	for _, pkg := range installed {
+		for _, dep := range pkg.Dependencies {
+			if strings.HasPrefix(dep, "!") {
+				continue
+			}
+			if !dependencySatisfied(apk.ResolvePackageNameVersionPin(dep), versions) {
+				unsatisfied = append(unsatisfied, unsatisfiedDependency{Package: pkg.Name, Dependency: dep})
+			}
+		}
+	}
+	slices.SortStableFunc(unsatisfied, func(a, b unsatisfiedDependency) int {
+		return strings.Compare(a.Package, b.Package)
+	})
+	return unsatisfied
+}
+
+// dependencySatisfied returns whether one of the versions providing the name
+// of dep satisfies its version constraint. As for apk, a provide without a
+// version only satisfies dependencies without a version constraint.
+func dependencySatisfied(dep apk.ParsedConstraint, versions map[string][]string) bool {
+	for _, v := range versions[dep.Name] {
+		if dep.Version == "" {
+			return true
+		}
+		if v == "" {
+			continue
+		}
+		pv, err := apk.ParseVersion(v)
+		if err != nil {
+			continue
+		}
+		if ok, err := dep.SatisfiedBy(pv); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+)
+
+func TestFindUnsatisfiedDependencies(t *testing.T) {
+	installed := []*apk.InstalledPackage{
+		{Package: apk.Package{
+			Name:         "app",
+			Version:      "1.0-r0",
+			Dependencies: []string{"libfoo>=2", "so:libc.so.1", "cmd:sh", "!legacy", "libbar=1.0-r0", "helper"},
+		}},
+		{Package: apk.Package{
+			Name:         "libfoo",
+			Version:      "1.5-r0",
+			Dependencies: []string{"so:libc.so.1"},
+		}},
+		{Package: apk.Package{
+			Name:     "libc",
+			Version:  "1.2.5-r0",
+			Provides: []string{"so:libc.so.1=1", "cmd:sh"},
+		}},
+		{Package: apk.Package{
+			Name:     "bar-compat",
+			Version:  "3.0-r0",
+			Provides: []string{"libbar"},
+		}},
+	}
+
+	require.Equal(t, []unsatisfiedDependency{
+		{Package: "app", Dependency: "libfoo>=2"},
+		{Package: "app", Dependency: "libbar=1.0-r0"},
+		{Package: "app", Dependency: "helper"},
+	}, findUnsatisfiedDependencies(installed))
+
+	installed[1].Version = "2.1-r0"
+	installed[3].Provides = []string{"libbar=1.0-r0"}
+	installed = append(installed, &apk.InstalledPackage{Package: apk.Package{Name: "helper", Version: "0.1-r3"}})
+	require.Empty(t, findUnsatisfiedDependencies(installed))
+}
+
+func TestVerifyDependencies(t *testing.T) {
+	buildTestImage(t, nil, WithVerifyDependencies(true))
+}
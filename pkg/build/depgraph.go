@@ -0,0 +1,93 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+)
+
+// DependencyGraph is the dependency graph of a resolved package set, as an
+// adjacency list, so that external tools can render why a package was
+// pulled in.
+type DependencyGraph struct {
+	// Packages are the resolved packages, sorted by name.
+	Packages []DependencyGraphPackage `json:"packages"`
+}
+
+// DependencyGraphPackage is a node of a DependencyGraph.
+type DependencyGraphPackage struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	// Dependencies are the names of the resolved packages which satisfy the
+	// dependencies of this package, either by name or by what they provide.
+	Dependencies []string `json:"dependencies"`
+}
+
+// NewDependencyGraph returns the dependency graph of pkgs, as returned by
+// BuildPackageList. Dependencies which no package in pkgs satisfies, and
+// conflicts, are left out.
+func NewDependencyGraph(pkgs []*apk.RepositoryPackage) *DependencyGraph {
+	providers := map[string][]string{}
+	for _, pkg := range pkgs {
+		providers[pkg.Name] = append(providers[pkg.Name], pkg.Name)
+		for _, prov := range pkg.Provides {
+			name := apk.ResolvePackageNameVersionPin(prov).Name
+			providers[name] = append(providers[name], pkg.Name)
+		}
+	}
+
+	g := &DependencyGraph{Packages: make([]DependencyGraphPackage, 0, len(pkgs))}
+	for _, pkg := range pkgs {
+		deps := sets.New[string]()
+		for _, dep := range pkg.Dependencies {
+			if strings.HasPrefix(dep, "!") {
+				continue
+			}
+			for _, provider := range providers[apk.ResolvePackageNameVersionPin(dep).Name] {
+				if provider != pkg.Name {
+					deps.Insert(provider)
+				}
+			}
+		}
+		g.Packages = append(g.Packages, DependencyGraphPackage{
+			Name:         pkg.Name,
+			Version:      pkg.Version,
+			Dependencies: sets.List(deps),
+		})
+	}
+	slices.SortFunc(g.Packages, func(a, b DependencyGraphPackage) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return g
+}
+
+// Write writes the graph to w as JSON.
+func (g *DependencyGraph) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(g); err != nil {
+		return fmt.Errorf("encoding dependency graph: %w", err)
+	}
+	return nil
+}
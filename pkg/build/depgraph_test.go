@@ -0,0 +1,50 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+)
+
+func TestDependencyGraph(t *testing.T) {
+	pkgs, _, err := newTestContext(t, nil).BuildPackageList(t.Context())
+	require.NoError(t, err)
+
+	g := NewDependencyGraph(pkgs)
+	require.Len(t, g.Packages, 2)
+	require.Equal(t, "pretend-baselayout", g.Packages[0].Name)
+	require.Empty(t, g.Packages[0].Dependencies)
+	require.Equal(t, "replayout", g.Packages[1].Name)
+	require.Equal(t, []string{"pretend-baselayout"}, g.Packages[1].Dependencies)
+
+	// A dependency on something a package provides is an edge to it.
+	g = NewDependencyGraph([]*apk.RepositoryPackage{
+		apk.NewRepositoryPackage(&apk.Package{Name: "app", Version: "1.0-r0", Dependencies: []string{"so:libfoo.so.1", "cmd:missing", "!conflict"}}, nil),
+		apk.NewRepositoryPackage(&apk.Package{Name: "libfoo", Version: "1.2-r0", Provides: []string{"so:libfoo.so.1=1"}}, nil),
+	})
+	require.Equal(t, []string{"libfoo"}, g.Packages[0].Dependencies)
+
+	var buf bytes.Buffer
+	require.NoError(t, g.Write(&buf))
+	var decoded DependencyGraph
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	require.Equal(t, *g, decoded)
+}
@@ -0,0 +1,90 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	gzip "github.com/klauspost/pgzip"
+)
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// DiffIDMismatchError is returned by VerifyDiffID when the content of a
+// layer does not hash to the expected diffid.
+type DiffIDMismatchError struct {
+	Path string
+	Want v1.Hash
+	Got  v1.Hash
+}
+
+func (e *DiffIDMismatchError) Error() string {
+	return fmt.Sprintf("layer %s has diffid %s, expected %s", e.Path, e.Got, e.Want)
+}
+
+// VerifyDiffID checks that the layer tarball at path, gzip compressed or
+// not, has the diffid want, i.e. that its uncompressed content hashes to
+// want the same way it is hashed when apko writes the layer. It returns a
+// *DiffIDMismatchError if it does not, so that a cached layer can be trusted
+// without rebuilding it.
+func VerifyDiffID(path string, want v1.Hash) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening layer: %w", err)
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	var r io.Reader = br
+	if magic, err := br.Peek(len(gzipMagic)); err == nil && bytes.Equal(magic, gzipMagic) {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return fmt.Errorf("decompressing layer %s: %w", path, err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	got, _, err := v1.SHA256(r)
+	if err != nil {
+		return fmt.Errorf("hashing layer %s: %w", path, err)
+	}
+	if got != want {
+		return &DiffIDMismatchError{Path: path, Want: want, Got: got}
+	}
+	return nil
+}
+
+// LayerDigests returns the digests of the layer l, e.g. as returned by
+// BuildLayer, in the form "sha256:<hex>": uncompressed is the digest of the
+// uncompressed tar, i.e. its diffid, which some registries and tools key
+// off, and compressed is the digest of the gzipped blob, i.e. of what is
+// pushed and referenced from the manifest.
+func LayerDigests(l v1.Layer) (uncompressed, compressed string, err error) {
+	diffid, err := l.DiffID()
+	if err != nil {
+		return "", "", fmt.Errorf("getting layer diffid: %w", err)
+	}
+	digest, err := l.Digest()
+	if err != nil {
+		return "", "", fmt.Errorf("getting layer digest: %w", err)
+	}
+	return diffid.String(), digest.String(), nil
+}
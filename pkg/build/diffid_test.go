@@ -0,0 +1,84 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyDiffID(t *testing.T) {
+	bc := newTestContext(t, nil, WithTempDir(t.TempDir()))
+
+	path, layer, err := bc.BuildLayer(t.Context())
+	require.NoError(t, err)
+	diffid, err := layer.DiffID()
+	require.NoError(t, err)
+
+	// Both the uncompressed tar and the tar.gz match the diffid.
+	require.NoError(t, VerifyDiffID(path, diffid))
+	rc, err := layer.Compressed()
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+	require.NoError(t, VerifyDiffID(path+".gz", diffid))
+
+	other := diffid
+	other.Hex = strings.Repeat("0", 64)
+	var mismatch *DiffIDMismatchError
+	require.ErrorAs(t, VerifyDiffID(path+".gz", other), &mismatch)
+	require.Equal(t, diffid, mismatch.Got)
+	require.Equal(t, other, mismatch.Want)
+
+	require.Error(t, VerifyDiffID(filepath.Join(t.TempDir(), "missing.tar.gz"), diffid))
+}
+
+func TestLayerDigests(t *testing.T) {
+	digests := func() (string, string) {
+		bc := newTestContext(t, nil, WithTempDir(t.TempDir()))
+
+		path, layer, err := bc.BuildLayer(t.Context())
+		require.NoError(t, err)
+		uncompressed, compressed, err := LayerDigests(layer)
+		require.NoError(t, err)
+
+		// The uncompressed digest is the one of the tar, and the compressed
+		// one the one of the tar.gz.
+		tarball, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, fmt.Sprintf("sha256:%x", sha256.Sum256(tarball)), uncompressed)
+		rc, err := layer.Compressed()
+		require.NoError(t, err)
+		defer rc.Close()
+		gz, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		require.Equal(t, fmt.Sprintf("sha256:%x", sha256.Sum256(gz)), compressed)
+		return uncompressed, compressed
+	}
+
+	uncompressed, compressed := digests()
+	require.NotEqual(t, uncompressed, compressed)
+
+	// Both are stable across builds.
+	again, againCompressed := digests()
+	require.Equal(t, uncompressed, again)
+	require.Equal(t, compressed, againCompressed)
+}
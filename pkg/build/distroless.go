@@ -0,0 +1,200 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+)
+
+// DefaultDistrolessPaths are the paths left out of the layers of distroless
+// images when none are given: the apk tooling, its configuration, cache and
+// database, and busybox with its shells.
+var DefaultDistrolessPaths = []string{
+	"/bin/apk",
+	"/bin/ash",
+	"/bin/busybox",
+	"/bin/sh",
+	"/etc/apk",
+	"/lib/apk",
+	"/sbin/apk",
+	"/usr/bin/apk",
+	"/usr/lib/apk",
+	"/usr/sbin/apk",
+	"/var/cache/apk",
+}
+
+// layerFS returns the filesystem to write the layers of the image from: the
+// filesystem of the build, without the distroless paths in distroless mode.
+func (bc *Context) layerFS() apkfs.FullFS {
+	if !bc.o.Distroless {
+		return bc.fs
+	}
+	paths := bc.o.DistrolessPaths
+	if len(paths) == 0 {
+		paths = DefaultDistrolessPaths
+	}
+	excluded := make([]string, 0, len(paths))
+	for _, p := range paths {
+		excluded = append(excluded, cleanPath(p))
+	}
+	return &excludeFS{FullFS: bc.fs, excluded: excluded}
+}
+
+// cleanPath returns name cleaned and relative to the root, e.g. "bin/sh"
+// for "/bin/sh".
+func cleanPath(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// excludeFS hides the excluded paths, their contents and the symlinks to
+// them, e.g. the busybox applets, from the reads of the filesystem, which
+// is how the layers are written: they do not exist in it. The filesystem
+// itself, and so what the SBOMs are generated from, is left as is, and the
+// writes go through.
+type excludeFS struct {
+	apkfs.FullFS
+	excluded []string
+	// dir is the path of the filesystem in the image, for those returned
+	// by Sub.
+	dir string
+}
+
+// hidden reports whether name is excluded, is in an excluded directory, or
+// is a symlink to an excluded path.
+func (e *excludeFS) hidden(name string) bool {
+	name = cleanPath(name)
+	if e.excludedPath(path.Join(e.dir, name)) {
+		return true
+	}
+	target, err := e.FullFS.Readlink(name)
+	if err != nil {
+		return false
+	}
+	if !path.IsAbs(target) {
+		target = path.Join("/", e.dir, path.Dir(name), target)
+	}
+	return e.excludedPath(cleanPath(target))
+}
+
+// excludedPath reports whether p, relative to the root of the image, is
+// excluded or in an excluded directory.
+func (e *excludeFS) excludedPath(p string) bool {
+	for _, x := range e.excluded {
+		if p == x || strings.HasPrefix(p, x+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func notExist(op, name string) error {
+	return &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+}
+
+func (e *excludeFS) Open(name string) (fs.File, error) {
+	if e.hidden(name) {
+		return nil, notExist("open", name)
+	}
+	return e.FullFS.Open(name)
+}
+
+func (e *excludeFS) OpenReaderAt(name string) (apkfs.File, error) {
+	if e.hidden(name) {
+		return nil, notExist("open", name)
+	}
+	return e.FullFS.OpenReaderAt(name)
+}
+
+func (e *excludeFS) OpenFile(name string, flag int, perm fs.FileMode) (apkfs.File, error) {
+	if e.hidden(name) {
+		return nil, notExist("open", name)
+	}
+	return e.FullFS.OpenFile(name, flag, perm)
+}
+
+func (e *excludeFS) ReadFile(name string) ([]byte, error) {
+	if e.hidden(name) {
+		return nil, notExist("open", name)
+	}
+	return e.FullFS.ReadFile(name)
+}
+
+func (e *excludeFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if e.hidden(name) {
+		return nil, notExist("readdir", name)
+	}
+	entries, err := e.FullFS.ReadDir(name)
+	return slices.DeleteFunc(entries, func(entry fs.DirEntry) bool {
+		return e.hidden(path.Join(name, entry.Name()))
+	}), err
+}
+
+func (e *excludeFS) Readnod(name string) (int, error) {
+	if e.hidden(name) {
+		return 0, notExist("readnod", name)
+	}
+	return e.FullFS.Readnod(name)
+}
+
+func (e *excludeFS) Readlink(name string) (string, error) {
+	if e.hidden(name) {
+		return "", notExist("readlink", name)
+	}
+	return e.FullFS.Readlink(name)
+}
+
+func (e *excludeFS) Stat(name string) (fs.FileInfo, error) {
+	if e.hidden(name) {
+		return nil, notExist("stat", name)
+	}
+	return e.FullFS.Stat(name)
+}
+
+func (e *excludeFS) Lstat(name string) (fs.FileInfo, error) {
+	if e.hidden(name) {
+		return nil, notExist("lstat", name)
+	}
+	return e.FullFS.Lstat(name)
+}
+
+func (e *excludeFS) GetXattr(name string, attr string) ([]byte, error) {
+	if e.hidden(name) {
+		return nil, notExist("getxattr", name)
+	}
+	return e.FullFS.GetXattr(name, attr)
+}
+
+func (e *excludeFS) ListXattrs(name string) (map[string][]byte, error) {
+	if e.hidden(name) {
+		return nil, notExist("listxattrs", name)
+	}
+	return e.FullFS.ListXattrs(name)
+}
+
+func (e *excludeFS) Sub(dir string) (apkfs.FullFS, error) {
+	if e.hidden(dir) {
+		return nil, notExist("sub", dir)
+	}
+	sub, err := e.FullFS.Sub(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &excludeFS{FullFS: sub, excluded: e.excluded, dir: path.Join(e.dir, cleanPath(dir))}, nil
+}
@@ -0,0 +1,118 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/sbom/generator/spdx"
+)
+
+func TestExcludeFS(t *testing.T) {
+	fsys := apkfs.NewMemFS()
+	require.NoError(t, fsys.MkdirAll("bin", 0o755))
+	require.NoError(t, fsys.MkdirAll("etc/apk/keys", 0o755))
+	require.NoError(t, fsys.WriteFile("etc/apk/keys/key.rsa.pub", []byte("key"), 0o644))
+	require.NoError(t, fsys.WriteFile("bin/busybox", []byte("busybox"), 0o755))
+	require.NoError(t, fsys.Symlink("/bin/busybox", "bin/ls"))
+	require.NoError(t, fsys.Symlink("busybox", "bin/cat"))
+	require.NoError(t, fsys.WriteFile("bin/app", []byte("app"), 0o755))
+	require.NoError(t, fsys.Symlink("app", "bin/app-link"))
+
+	e := &excludeFS{FullFS: fsys, excluded: []string{"bin/busybox", "etc/apk"}}
+
+	for _, name := range []string{"bin/busybox", "/bin/busybox", "bin/ls", "bin/cat", "etc/apk", "etc/apk/keys/key.rsa.pub"} {
+		_, err := e.Open(name)
+		require.ErrorIs(t, err, fs.ErrNotExist, name)
+		_, err = e.ReadFile(name)
+		require.ErrorIs(t, err, fs.ErrNotExist, name)
+		_, err = e.Stat(name)
+		require.ErrorIs(t, err, fs.ErrNotExist, name)
+		_, err = e.Lstat(name)
+		require.ErrorIs(t, err, fs.ErrNotExist, name)
+		_, err = e.Readlink(name)
+		require.ErrorIs(t, err, fs.ErrNotExist, name)
+	}
+	_, err := e.ReadDir("etc/apk")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+
+	for _, name := range []string{"bin/app", "bin/app-link"} {
+		_, err := e.Stat(name)
+		require.NoError(t, err, name)
+	}
+	target, err := e.Readlink("bin/app-link")
+	require.NoError(t, err)
+	require.Equal(t, "app", target)
+
+	entries, err := e.ReadDir("bin")
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	require.ElementsMatch(t, []string{"app", "app-link"}, names)
+
+	// The paths of a sub filesystem are those of the image.
+	sub, err := e.Sub("bin")
+	require.NoError(t, err)
+	_, err = sub.Stat("busybox")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+	_, err = sub.Stat("cat")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+	_, err = sub.Stat("app")
+	require.NoError(t, err)
+
+	// The filesystem itself is left as is.
+	_, err = fsys.Stat("bin/busybox")
+	require.NoError(t, err)
+}
+
+func TestDistroless(t *testing.T) {
+	// Stand-ins for apk-tools and the busybox shell.
+	fsys := apkfs.NewMemFS()
+	require.NoError(t, fsys.MkdirAll("sbin", 0o755))
+	require.NoError(t, fsys.WriteFile("sbin/apk", []byte("apk"), 0o755))
+	require.NoError(t, fsys.MkdirAll("bin", 0o755))
+	require.NoError(t, fsys.WriteFile("bin/sh", []byte("sh"), 0o755))
+	require.NoError(t, fsys.WriteFile("bin/app", []byte("app"), 0o755))
+
+	bc, img := buildSBOMImage(t, fsys, WithDistroless(true, nil), WithSBOMGenerators(spdx.New()))
+
+	layers, err := img.Layers()
+	require.NoError(t, err)
+	require.Len(t, layers, 1)
+	hdrs := layerHeaders(t, layers[0])
+	require.Contains(t, hdrs, "etc/os-release")
+	require.Contains(t, hdrs, "bin/app")
+	for name := range hdrs {
+		for _, p := range []string{"sbin/apk", "bin/sh", "etc/apk", "usr/lib/apk", "lib/apk"} {
+			require.False(t, name == p || strings.HasPrefix(name, p+"/"), "%s in the layer", name)
+		}
+	}
+
+	_, err = fsys.Stat("usr/lib/apk/db/installed")
+	require.NoError(t, err)
+
+	// The SBOM is generated from the whole filesystem, and so still lists
+	// all the installed packages.
+	names := sbomPackageNames(imageSBOM(t, bc, img))
+	require.Contains(t, names, "replayout")
+	require.Contains(t, names, "pretend-baselayout")
+}
@@ -0,0 +1,111 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"errors"
+	"net"
+	"net/url"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+)
+
+// Failure categories for errors returned by a build. Use errors.Is to test
+// which category an error belongs to, or errors.As with *Error to get at
+// both the category and the underlying cause.
+var (
+	// ErrInvalidConfig indicates a problem with the image configuration or
+	// build options supplied by the user.
+	ErrInvalidConfig = errors.New("invalid configuration")
+	// ErrNetwork indicates that a repository, keyring or package could not
+	// be fetched.
+	ErrNetwork = errors.New("network failure")
+	// ErrResolution indicates that the requested packages could not be
+	// resolved into an installable set.
+	ErrResolution = errors.New("package resolution failed")
+	// ErrPackageConflict indicates that two or more packages, or a package
+	// and a path mutation, provide conflicting files.
+	ErrPackageConflict = errors.New("package conflict")
+	// ErrInstall indicates a failure while installing packages or laying out
+	// the image filesystem.
+	ErrInstall = errors.New("package installation failed")
+	// ErrTarball indicates a failure while writing the image layer.
+	ErrTarball = errors.New("layer generation failed")
+	// ErrSBOM indicates a failure while generating an SBOM.
+	ErrSBOM = errors.New("SBOM generation failed")
+	// ErrPolicy indicates that the image violates a policy enabled in the
+	// build options, e.g. that every package has a license.
+	ErrPolicy = errors.New("policy violation")
+)
+
+// Error is a build failure tagged with one of the failure categories above.
+//
+// The message is that of the underlying error, so wrapping does not change
+// what is reported to users.
+type Error struct {
+	// Kind is the failure category, e.g. ErrResolution.
+	Kind error
+
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// wrapError tags err with the most specific category that applies to it,
+// falling back to kind. Errors that have already been tagged are returned
+// as-is, as are nil errors.
+func wrapError(kind error, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var be *Error
+	if errors.As(err, &be) {
+		return err
+	}
+
+	return &Error{Kind: classifyError(kind, err), Err: err}
+}
+
+func classifyError(fallback error, err error) error {
+	var (
+		urlErr        *url.Error
+		opErr         *net.OpError
+		dnsErr        *net.DNSError
+		fileConflict  apk.FileConflictError
+		pathConflict  *PathMutationFileConflictError
+		constraintErr *apk.ConstraintError
+		depErr        *apk.DepError
+		dqErr         *apk.DisqualifiedError
+	)
+
+	switch {
+	case errors.As(err, &urlErr), errors.As(err, &opErr), errors.As(err, &dnsErr):
+		return ErrNetwork
+	case errors.As(err, &fileConflict), errors.As(err, &pathConflict):
+		return ErrPackageConflict
+	case errors.As(err, &constraintErr), errors.As(err, &depErr), errors.As(err, &dqErr):
+		return ErrResolution
+	}
+
+	return fallback
+}
@@ -0,0 +1,164 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/sbom/generator/spdx"
+)
+
+func TestWrapError(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		fallback error
+		err      error
+		want     error
+	}{{
+		name:     "fallback",
+		fallback: ErrInstall,
+		err:      errors.New("boom"),
+		want:     ErrInstall,
+	}, {
+		name:     "network",
+		fallback: ErrResolution,
+		err:      fmt.Errorf("fetching index: %w", &net.OpError{Op: "dial", Err: errors.New("connection refused")}),
+		want:     ErrNetwork,
+	}, {
+		name:     "file conflict",
+		fallback: ErrInstall,
+		err:      fmt.Errorf("installing: %w", apk.FileConflictError{Path: "/etc/foo"}),
+		want:     ErrPackageConflict,
+	}, {
+		name:     "path mutation conflict",
+		fallback: ErrInstall,
+		err:      fmt.Errorf("mutating paths: %w", &PathMutationFileConflictError{Path: "/etc/foo"}),
+		want:     ErrPackageConflict,
+	}, {
+		name:     "unsatisfiable constraint",
+		fallback: ErrInstall,
+		err:      &apk.ConstraintError{Constraint: "foo", Wrapped: errors.New("nope")},
+		want:     ErrResolution,
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := wrapError(tc.fallback, tc.err)
+			require.ErrorIs(t, err, tc.want)
+			require.ErrorIs(t, err, tc.err)
+			require.Equal(t, tc.err.Error(), err.Error())
+
+			var be *Error
+			require.ErrorAs(t, err, &be)
+			require.Equal(t, tc.want, be.Kind)
+		})
+	}
+
+	require.NoError(t, wrapError(ErrInstall, nil))
+
+	// Already classified errors keep their original category.
+	inner := wrapError(ErrTarball, errors.New("boom"))
+	outer := wrapError(ErrInstall, fmt.Errorf("building: %w", inner))
+	require.ErrorIs(t, outer, ErrTarball)
+	require.NotErrorIs(t, outer, ErrInstall)
+}
+
+func TestBuildErrorKinds(t *testing.T) {
+	ctx := t.Context()
+
+	t.Run("invalid config", func(t *testing.T) {
+		bc, err := New(ctx, apkfs.NewMemFS(), WithConfig("layering.yaml", []string{"testdata"}))
+		require.NoError(t, err)
+
+		_, _, err = bc.BuildLayer(ctx)
+		require.ErrorIs(t, err, ErrInvalidConfig)
+
+		var be *Error
+		require.ErrorAs(t, err, &be)
+		require.Equal(t, ErrInvalidConfig, be.Kind)
+	})
+
+	t.Run("accounts", func(t *testing.T) {
+		// A package with /etc/passwd as a directory.
+		dir := t.TempDir()
+		foo := writeTestAPK(t, dir, &apk.Package{Name: "foo", Origin: "foo"}, map[string]string{"etc/passwd/foo": "foo"})
+		ic := repoConfig(dir)
+		ic.Accounts = types.ImageAccounts{Users: []types.User{{UserName: "app", UID: 10000}}}
+		bc := newRepoContext(t, ic, []*apk.RepositoryPackage{foo})
+
+		err := bc.BuildImage(ctx)
+		require.ErrorContains(t, err, "failed to mutate accounts")
+		var be *Error
+		require.ErrorAs(t, err, &be)
+		require.Equal(t, ErrInstall, be.Kind)
+	})
+
+	t.Run("resolution", func(t *testing.T) {
+		bc := newTestContext(t, nil, WithExtraPackages([]string{"does-not-exist"}))
+
+		_, _, err := bc.BuildPackageList(ctx)
+		require.ErrorIs(t, err, ErrResolution)
+		require.NotErrorIs(t, err, ErrNetwork)
+	})
+
+	t.Run("network", func(t *testing.T) {
+		// The server's certificate is untrusted, which fails the request
+		// without the client retrying it.
+		s := httptest.NewTLSServer(http.NotFoundHandler())
+		defer s.Close()
+
+		bc := newTestContext(t, nil, WithExtraRepos([]string{s.URL}))
+
+		_, _, err := bc.BuildPackageList(ctx)
+		require.ErrorIs(t, err, ErrNetwork)
+	})
+
+	t.Run("tarball", func(t *testing.T) {
+		bc := newTestContext(t, nil, WithTarball(filepath.Join(t.TempDir(), "missing", "layer.tar.gz")))
+
+		_, _, err := bc.BuildLayer(ctx)
+		require.ErrorIs(t, err, ErrTarball)
+	})
+
+	t.Run("sbom", func(t *testing.T) {
+		o, ic, err := NewOptions(
+			WithConfig("apko.yaml", []string{"testdata"}),
+			WithSBOM(t.TempDir()),
+			WithSBOMGenerators(spdx.New()),
+		)
+		require.NoError(t, err)
+
+		digest, err := name.NewDigest("example.com/image@sha256:" + strings.Repeat("0", 64))
+		require.NoError(t, err)
+
+		// No per-arch SBOMs have been written, so the index SBOM cannot
+		// reference them.
+		_, err = GenerateIndexSBOM(ctx, *o, *ic, digest, map[types.Architecture]v1.Image{testArch: empty.Image})
+		require.ErrorIs(t, err, ErrSBOM)
+	})
+}
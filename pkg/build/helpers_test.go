@@ -0,0 +1,217 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"archive/tar"
+	"bytes"
+	"cmp"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build/oci"
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/sbom/generator/spdx"
+)
+
+// testArch is the architecture the test images are built for.
+var testArch = types.ParseArchitecture("amd64")
+
+// testConfig returns the configuration of the test image, in
+// testdata/apko.yaml, for the tests to adjust.
+func testConfig(tb testing.TB) types.ImageConfiguration {
+	tb.Helper()
+	_, ic, err := NewOptions(WithConfig("apko.yaml", []string{"testdata"}))
+	require.NoError(tb, err)
+	return *ic
+}
+
+// newTestContext returns the build context of the test image for testArch,
+// built in fsys or in memory if fsys is nil. The options in opts apply after
+// the configuration, e.g. WithImageConfiguration replaces it.
+func newTestContext(tb testing.TB, fsys apkfs.FullFS, opts ...Option) *Context {
+	tb.Helper()
+	if fsys == nil {
+		fsys = apkfs.NewMemFS()
+	}
+	bc, err := New(tb.Context(), fsys, append([]Option{
+		WithConfig("apko.yaml", []string{"testdata"}),
+		WithArch(testArch),
+	}, opts...)...)
+	require.NoError(tb, err)
+	return bc
+}
+
+// buildTestImage builds the image of newTestContext and returns its build
+// context.
+func buildTestImage(tb testing.TB, fsys apkfs.FullFS, opts ...Option) *Context {
+	tb.Helper()
+	bc := newTestContext(tb, fsys, opts...)
+	require.NoError(tb, bc.BuildImage(tb.Context()))
+	return bc
+}
+
+// repoConfig returns the configuration of an image of the packages of the
+// repository at dir, for the tests to adjust.
+func repoConfig(dir string) types.ImageConfiguration {
+	return types.ImageConfiguration{Contents: types.ImageContents{Repositories: []string{dir}}}
+}
+
+// newRepoContext returns the build context of an image configured with ic
+// for testArch, built in memory from pkgs, e.g. written with writeTestAPK to
+// the repository of ic.
+func newRepoContext(tb testing.TB, ic types.ImageConfiguration, pkgs []*apk.RepositoryPackage, opts ...Option) *Context {
+	tb.Helper()
+	bc, err := New(tb.Context(), apkfs.NewMemFS(), append([]Option{
+		WithImageConfiguration(ic),
+		WithArch(testArch),
+		WithResolvedPackages(pkgs),
+	}, opts...)...)
+	require.NoError(tb, err)
+	return bc
+}
+
+// writeTestAPK writes an unsigned x86_64 apk of pkg to dir and returns it as
+// a package of the repository at dir. The apk holds the regular files in
+// files, keyed by path, and their parent directories. The version of pkg
+// defaults to 1.0.0-r0.
+func writeTestAPK(t *testing.T, dir string, pkg *apk.Package, files map[string]string) *apk.RepositoryPackage {
+	t.Helper()
+	pkg.Version = cmp.Or(pkg.Version, "1.0.0-r0")
+	pkg.Arch = "x86_64"
+
+	// The data section comes first, since the control section records its
+	// hash.
+	var data bytes.Buffer
+	zw := gzip.NewWriter(&data)
+	tw := tar.NewWriter(zw)
+	dirs := map[string]bool{}
+	for name, content := range files {
+		var parents []string
+		for d := path.Dir(name); d != "." && !dirs[d]; d = path.Dir(d) {
+			dirs[d] = true
+			parents = append([]string{d}, parents...)
+		}
+		for _, d := range parents {
+			require.NoError(t, tw.WriteHeader(&tar.Header{Name: d + "/", Typeflag: tar.TypeDir, Mode: 0o755}))
+		}
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(content))}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, zw.Close())
+	dataHash := sha256.Sum256(data.Bytes())
+
+	pkginfo := fmt.Sprintf("pkgname = %s\npkgver = %s\narch = %s\norigin = %s\ndatahash = %x\n",
+		pkg.Name, pkg.Version, pkg.Arch, pkg.Origin, dataHash)
+	if pkg.License != "" {
+		pkginfo += fmt.Sprintf("license = %s\n", pkg.License)
+	}
+	if pkg.BuildDate != 0 {
+		pkginfo += fmt.Sprintf("builddate = %d\n", pkg.BuildDate)
+	}
+	for _, dep := range pkg.Dependencies {
+		pkginfo += fmt.Sprintf("depend = %s\n", dep)
+	}
+	var control bytes.Buffer
+	zw = gzip.NewWriter(&control)
+	tw = tar.NewWriter(zw)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: ".PKGINFO", Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(pkginfo))}))
+	_, err := tw.Write([]byte(pkginfo))
+	require.NoError(t, err)
+	// The control section is a tar stream without its end-of-archive
+	// marker, which the data section provides.
+	require.NoError(t, tw.Flush())
+	require.NoError(t, zw.Close())
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, pkg.Filename()), append(control.Bytes(), data.Bytes()...), 0o644))
+	repo := &apk.Repository{URI: dir}
+	return apk.NewRepositoryPackage(pkg, repo.WithIndex(&apk.APKIndex{}))
+}
+
+// layerHeaders returns the headers of the entries of layer, keyed by name.
+func layerHeaders(tb testing.TB, layer v1.Layer) map[string]*tar.Header {
+	tb.Helper()
+	rc, err := layer.Uncompressed()
+	require.NoError(tb, err)
+	defer rc.Close()
+	hdrs := map[string]*tar.Header{}
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return hdrs
+		}
+		require.NoError(tb, err)
+		hdrs[hdr.Name] = hdr
+	}
+}
+
+// buildSBOMImage builds the layer of the test image with the options of
+// newTestContext, writing the SBOMs to a temporary directory, and returns its
+// build context and image to generate its SBOMs from.
+func buildSBOMImage(tb testing.TB, fsys apkfs.FullFS, opts ...Option) (*Context, v1.Image) {
+	tb.Helper()
+	ctx := tb.Context()
+
+	bc := newTestContext(tb, fsys, append([]Option{WithSBOM(tb.TempDir())}, opts...)...)
+	_, layer, err := bc.BuildLayer(ctx)
+	require.NoError(tb, err)
+	bde, err := bc.GetBuildDateEpoch()
+	require.NoError(tb, err)
+	img, err := oci.BuildImageFromLayer(ctx, empty.Image, layer, bc.ImageConfiguration(), bde, testArch)
+	require.NoError(tb, err)
+	return bc, img
+}
+
+// imageSBOM generates the SBOM of img, built by bc with a single SBOM
+// generator, and returns it.
+func imageSBOM(tb testing.TB, bc *Context, img v1.Image) *spdx.Document {
+	tb.Helper()
+	sboms, err := bc.GenerateImageSBOM(tb.Context(), testArch, img)
+	require.NoError(tb, err)
+	require.Len(tb, sboms, 1)
+	return readSBOM(tb, sboms[0])
+}
+
+// readSBOM reads the SPDX SBOM s.
+func readSBOM(tb testing.TB, s types.SBOM) *spdx.Document {
+	tb.Helper()
+	doc, err := spdx.ReadDocument(s.Path)
+	require.NoError(tb, err)
+	return doc
+}
+
+// sbomPackageNames returns the names of the packages of doc.
+func sbomPackageNames(doc *spdx.Document) []string {
+	names := make([]string, len(doc.Packages))
+	for i, p := range doc.Packages {
+		names[i] = p.Name
+	}
+	return names
+}
@@ -0,0 +1,79 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	"chainguard.dev/apko/pkg/build/oci"
+)
+
+// Labels AppendBuildMetadata sets in the image config.
+const (
+	// BuildMetadataConfigLabel is the checksum of the image configuration
+	// and the files it includes, when it was loaded from a file.
+	BuildMetadataConfigLabel = "dev.apko.config.checksum"
+	// BuildMetadataPackagesLabel is the number of installed packages.
+	BuildMetadataPackagesLabel = "dev.apko.packages.count"
+)
+
+// AppendBuildMetadata returns a copy of cfg, e.g. the config of an image
+// built from the layers of the build, recording what apko contributed to
+// it: the BuildMetadata labels, and empty_layer history entries for the
+// packages installed and the image configuration. The entries are in a
+// fixed order and use the build date epoch as their timestamp, so the
+// config remains reproducible.
+func (bc *Context) AppendBuildMetadata(cfg *v1.ConfigFile) (*v1.ConfigFile, error) {
+	installed, err := bc.InstalledPackages()
+	if err != nil {
+		return nil, fmt.Errorf("getting installed packages: %w", err)
+	}
+	created, err := bc.GetBuildDateEpoch()
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine build date epoch: %w", err)
+	}
+	return appendBuildMetadata(cfg, installed, bc.o.ImageConfigChecksum, created), nil
+}
+
+// appendBuildMetadata is AppendBuildMetadata for the installed packages and
+// the image configuration checksum configChecksum, which may be empty.
+func appendBuildMetadata(cfg *v1.ConfigFile, installed []*apk.InstalledPackage, configChecksum string, created time.Time) *v1.ConfigFile {
+	cfg = cfg.DeepCopy()
+	if cfg.Config.Labels == nil {
+		cfg.Config.Labels = map[string]string{}
+	}
+
+	pkgs := make([]string, 0, len(installed))
+	for _, pkg := range installed {
+		pkgs = append(pkgs, pkg.Name+"="+pkg.Version)
+	}
+	slices.Sort(pkgs)
+
+	steps := []string{"apk add " + strings.Join(pkgs, " ")}
+	cfg.Config.Labels[BuildMetadataPackagesLabel] = strconv.Itoa(len(pkgs))
+	if configChecksum != "" {
+		steps = append(steps, "apko config "+configChecksum)
+		cfg.Config.Labels[BuildMetadataConfigLabel] = configChecksum
+	}
+	oci.AppendEmptyLayerHistory(cfg, steps, created)
+	return cfg
+}
@@ -0,0 +1,61 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"testing"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+)
+
+func TestAppendBuildMetadata(t *testing.T) {
+	created := time.Unix(1000, 0).UTC()
+	installed := []*apk.InstalledPackage{
+		{Package: apk.Package{Name: "zlib", Version: "1.3-r0"}},
+		{Package: apk.Package{Name: "busybox", Version: "1.36-r1"}},
+	}
+	cfg := &v1.ConfigFile{
+		Config:  v1.Config{Labels: map[string]string{"foo": "bar"}},
+		History: []v1.History{{Author: "apko", CreatedBy: "apko", Comment: "layer"}},
+	}
+
+	got := appendBuildMetadata(cfg, installed, "sha256-abc", created)
+	require.Equal(t, map[string]string{
+		"foo":                      "bar",
+		BuildMetadataConfigLabel:   "sha256-abc",
+		BuildMetadataPackagesLabel: "2",
+	}, got.Config.Labels)
+	require.Equal(t, []v1.History{
+		{Author: "apko", CreatedBy: "apko", Comment: "layer"},
+		{Author: "apko", CreatedBy: "apko", Comment: "apk add busybox=1.36-r1 zlib=1.3-r0", Created: v1.Time{Time: created}, EmptyLayer: true},
+		{Author: "apko", CreatedBy: "apko", Comment: "apko config sha256-abc", Created: v1.Time{Time: created}, EmptyLayer: true},
+	}, got.History)
+
+	// The config passed in is left as is.
+	require.Equal(t, map[string]string{"foo": "bar"}, cfg.Config.Labels)
+	require.Len(t, cfg.History, 1)
+
+	// The same build gives the same config, whatever the order of the
+	// packages, and without a checksum there is nothing recorded for it.
+	reversed := []*apk.InstalledPackage{installed[1], installed[0]}
+	require.Equal(t, appendBuildMetadata(cfg, installed, "", created), appendBuildMetadata(cfg, reversed, "", created))
+	noChecksum := appendBuildMetadata(&v1.ConfigFile{}, installed, "", created)
+	require.NotContains(t, noChecksum.Config.Labels, BuildMetadataConfigLabel)
+	require.Len(t, noChecksum.History, 1)
+}
@@ -34,3 +34,21 @@ func installablePackagesForArch(l lock.Lock, arch types.Architecture) ([]apk.Ins
 	}
 	return pkgs, nil
 }
+
+// lockedPackagesForArch returns the packages of the lock l for arch with
+// the metadata the lock records of them, i.e. their name, version and
+// architecture.
+func lockedPackagesForArch(l lock.Lock, arch types.Architecture) []*apk.RepositoryPackage {
+	pkgs := make([]*apk.RepositoryPackage, 0, len(l.Contents.Packages))
+	for _, p := range l.Contents.Packages {
+		if p.Architecture != arch.ToAPK() {
+			continue
+		}
+		pkgs = append(pkgs, apk.NewRepositoryPackage(&apk.Package{
+			Name:    p.Name,
+			Version: p.Version,
+			Arch:    p.Architecture,
+		}, nil))
+	}
+	return pkgs
+}
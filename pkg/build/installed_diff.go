@@ -0,0 +1,95 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	"chainguard.dev/apko/pkg/options"
+	"chainguard.dev/apko/pkg/sbom"
+)
+
+// legacyInstalledDBPath is where older images have the installed apk
+// database.
+const legacyInstalledDBPath = "lib/apk/db/installed"
+
+// installedDBPaths returns the locations of the installed apk database of
+// images built with o: the one under its apk database root, then, with the
+// default root, the one used by older images.
+func installedDBPaths(o *options.Options) []string {
+	paths := []string{o.InstalledDBPath()}
+	if cmp.Or(o.ApkDBRoot, apk.DefaultDBRoot) == apk.DefaultDBRoot {
+		paths = append(paths, legacyInstalledDBPath)
+	}
+	return paths
+}
+
+// ReadInstalledPackages reads the installed apk database of a built image
+// filesystem, such as the filesystem of a build context or an extracted
+// root filesystem opened with os.DirFS, under the apk database root set
+// with WithApkDBRoot in opts.
+func ReadInstalledPackages(fsys fs.FS, opts ...Option) ([]*apk.InstalledPackage, error) {
+	o, _, err := NewOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return readInstalledPackages(fsys, installedDBPaths(o))
+}
+
+// readInstalledPackages reads the installed apk database of fsys from the
+// first of paths it exists at.
+func readInstalledPackages(fsys fs.FS, paths []string) ([]*apk.InstalledPackage, error) {
+	for _, p := range paths {
+		f, err := fsys.Open(p)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("opening /%s: %w", p, err)
+		}
+		defer f.Close()
+
+		pkgs, err := apk.ParseInstalled(f)
+		if err != nil {
+			return nil, fmt.Errorf("parsing /%s: %w", p, err)
+		}
+		return pkgs, nil
+	}
+	return nil, fmt.Errorf("no installed apk database found: %w", fs.ErrNotExist)
+}
+
+// DiffInstalledPackages compares the installed apk databases of two built
+// image filesystems, read as ReadInstalledPackages does with opts, and
+// returns the packages added, removed and changed going from the old one to
+// the new one.
+func DiffInstalledPackages(oldFS, newFS fs.FS, opts ...Option) (*sbom.Diff, error) {
+	o, _, err := NewOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+	paths := installedDBPaths(o)
+	oldPkgs, err := readInstalledPackages(oldFS, paths)
+	if err != nil {
+		return nil, fmt.Errorf("reading old packages: %w", err)
+	}
+	newPkgs, err := readInstalledPackages(newFS, paths)
+	if err != nil {
+		return nil, fmt.Errorf("reading new packages: %w", err)
+	}
+	return sbom.Compare(sbom.InstalledComponents(oldPkgs), sbom.InstalledComponents(newPkgs)), nil
+}
@@ -0,0 +1,111 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/sbom"
+	"chainguard.dev/apko/pkg/sbom/generator/spdx"
+)
+
+func TestDiffInstalledPackages(t *testing.T) {
+	buildFS := func(packages ...string) apkfs.FullFS {
+		ic := testConfig(t)
+		ic.Contents.Packages = packages
+
+		fsys := apkfs.NewMemFS()
+		buildTestImage(t, fsys, WithImageConfiguration(ic))
+		return fsys
+	}
+
+	base := buildFS("pretend-baselayout")
+	full := buildFS("replayout")
+
+	diff, err := DiffInstalledPackages(base, full)
+	require.NoError(t, err)
+	require.Equal(t, &sbom.Diff{
+		Added:   []sbom.Component{{Name: "replayout", Version: "1.0.0-r0"}},
+		Removed: []sbom.Component{},
+		Changed: []sbom.VersionChange{},
+	}, diff)
+
+	diff, err = DiffInstalledPackages(full, full)
+	require.NoError(t, err)
+	require.True(t, diff.Empty())
+
+	// An extracted root filesystem with the database at its older location.
+	rootfs := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(rootfs, "lib", "apk", "db"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(rootfs, "lib", "apk", "db", "installed"),
+		[]byte("P:pretend-baselayout\nV:0.9.0-r0\n\n"), 0o644))
+	diff, err = DiffInstalledPackages(os.DirFS(rootfs), base)
+	require.NoError(t, err)
+	require.Equal(t, []sbom.VersionChange{{
+		Name: "pretend-baselayout", FromVersion: "0.9.0-r0", ToVersion: "1.0.0-r0",
+	}}, diff.Changed)
+
+	_, err = DiffInstalledPackages(os.DirFS(t.TempDir()), base)
+	require.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestApkDBRoot(t *testing.T) {
+	fsys := apkfs.NewMemFS()
+	bc := newTestContext(t, fsys, WithApkDBRoot("/var/lib/apk"), WithTempDir(t.TempDir()))
+	layerPath, layer, err := bc.BuildLayer(t.Context())
+	require.NoError(t, err)
+
+	// The installed database is in the configured root, and not in the
+	// default one.
+	b, err := fsys.ReadFile("var/lib/apk/db/installed")
+	require.NoError(t, err)
+	require.Contains(t, string(b), "P:replayout\n")
+	_, err = fsys.Stat("usr/lib/apk/db/installed")
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	installed, err := bc.InstalledPackages()
+	require.NoError(t, err)
+	require.Len(t, installed, 2)
+
+	// The database is in the layer as well.
+	require.Contains(t, layerHeaders(t, layer), "var/lib/apk/db/installed")
+
+	// The packages are read from there, given the root.
+	pkgs, err := ReadInstalledPackages(fsys, WithApkDBRoot("/var/lib/apk"))
+	require.NoError(t, err)
+	require.Len(t, pkgs, 2)
+	_, err = ReadInstalledPackages(fsys)
+	require.ErrorIs(t, err, fs.ErrNotExist)
+
+	diff, err := DiffInstalledPackages(fsys, fsys, WithApkDBRoot("/var/lib/apk"))
+	require.NoError(t, err)
+	require.True(t, diff.Empty())
+
+	sboms, err := GenerateLayerSBOM(t.Context(), layerPath,
+		WithArch(testArch),
+		WithApkDBRoot("/var/lib/apk"),
+		WithSBOMGenerators(spdx.New()),
+		WithSBOM(t.TempDir()),
+	)
+	require.NoError(t, err)
+	require.Len(t, sboms, 1)
+	require.Contains(t, sbomPackageNames(readSBOM(t, sboms[0])), "replayout")
+}
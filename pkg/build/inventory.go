@@ -0,0 +1,104 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+)
+
+// Columns of a package inventory.
+const (
+	InventoryName       = "name"
+	InventoryVersion    = "version"
+	InventoryArch       = "arch"
+	InventoryLicense    = "license"
+	InventoryOrigin     = "origin"
+	InventoryRepository = "repo"
+	InventoryURL        = "url"
+	InventoryChecksum   = "checksum"
+)
+
+// DefaultInventoryColumns are the columns of a package inventory when none
+// are given.
+var DefaultInventoryColumns = []string{InventoryName, InventoryVersion, InventoryLicense, InventoryRepository}
+
+var inventoryColumns = map[string]func(*apk.RepositoryPackage) string{
+	InventoryName:    func(p *apk.RepositoryPackage) string { return p.Name },
+	InventoryVersion: func(p *apk.RepositoryPackage) string { return p.Version },
+	InventoryArch:    func(p *apk.RepositoryPackage) string { return p.Arch },
+	InventoryLicense: func(p *apk.RepositoryPackage) string { return p.License },
+	InventoryOrigin:  func(p *apk.RepositoryPackage) string { return p.Origin },
+	InventoryRepository: func(p *apk.RepositoryPackage) string {
+		if p.Repository() == nil || p.Repository().Repository == nil {
+			return ""
+		}
+		return p.Repository().URI
+	},
+	InventoryURL: func(p *apk.RepositoryPackage) string {
+		if p.Repository() == nil || p.Repository().Repository == nil {
+			return ""
+		}
+		return p.URL()
+	},
+	InventoryChecksum: func(p *apk.RepositoryPackage) string { return p.ChecksumString() },
+}
+
+// WriteInventory writes pkgs, as returned by BuildPackageList, to w as a
+// package inventory for spreadsheets and audits: a header row followed by a
+// row per package, sorted by name, with the given columns, or
+// DefaultInventoryColumns if none. comma separates the fields, e.g. ',' for
+// CSV or '\t' for TSV.
+func WriteInventory(w io.Writer, pkgs []*apk.RepositoryPackage, columns []string, comma rune) error {
+	if len(columns) == 0 {
+		columns = DefaultInventoryColumns
+	}
+	fields := make([]func(*apk.RepositoryPackage) string, len(columns))
+	for i, c := range columns {
+		f, ok := inventoryColumns[c]
+		if !ok {
+			return fmt.Errorf("unknown inventory column %q", c)
+		}
+		fields[i] = f
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Comma = comma
+	if err := cw.Write(columns); err != nil {
+		return fmt.Errorf("writing inventory: %w", err)
+	}
+	sorted := slices.SortedFunc(slices.Values(pkgs), func(a, b *apk.RepositoryPackage) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	record := make([]string, len(fields))
+	for _, pkg := range sorted {
+		for i, f := range fields {
+			record[i] = f(pkg)
+		}
+		if err := cw.Write(record); err != nil {
+			return fmt.Errorf("writing inventory: %w", err)
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("writing inventory: %w", err)
+	}
+	return nil
+}
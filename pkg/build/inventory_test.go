@@ -0,0 +1,52 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+)
+
+func TestWriteInventory(t *testing.T) {
+	repo := &apk.Repository{URI: "https://packages.example.com/x86_64"}
+	pkgs := repo.WithIndex(&apk.APKIndex{Packages: []*apk.Package{
+		{Name: "zlib", Version: "1.3.1-r0", Arch: "x86_64", License: "Zlib"},
+		{Name: "busybox", Version: "1.36.1-r5", Arch: "x86_64", License: "GPL-2.0-only", Origin: "busybox"},
+		{Name: "ca-certificates", Version: "20240705-r0", Arch: "x86_64", License: "MPL-2.0 AND MIT"},
+	}}).Packages()
+	// A package with a comma in its license, and no repository.
+	pkgs = append(pkgs, apk.NewRepositoryPackage(&apk.Package{Name: "local", Version: "0.1-r0", License: "MIT, BSD-3-Clause"}, nil))
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteInventory(&buf, pkgs, nil, ','))
+	require.Equal(t, `name,version,license,repo
+busybox,1.36.1-r5,GPL-2.0-only,https://packages.example.com/x86_64
+ca-certificates,20240705-r0,MPL-2.0 AND MIT,https://packages.example.com/x86_64
+local,0.1-r0,"MIT, BSD-3-Clause",
+zlib,1.3.1-r0,Zlib,https://packages.example.com/x86_64
+`, buf.String())
+
+	buf.Reset()
+	require.NoError(t, WriteInventory(&buf, pkgs[:2], []string{InventoryName, InventoryOrigin, InventoryURL}, '\t'))
+	require.Equal(t, "name\torigin\turl\n"+
+		"busybox\tbusybox\thttps://packages.example.com/x86_64/busybox-1.36.1-r5.apk\n"+
+		"zlib\t\thttps://packages.example.com/x86_64/zlib-1.3.1-r0.apk\n", buf.String())
+
+	require.ErrorContains(t, WriteInventory(&buf, pkgs, []string{"name", "maintainer"}, ','), `unknown inventory column "maintainer"`)
+}
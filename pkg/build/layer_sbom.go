@@ -0,0 +1,179 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"go.opentelemetry.io/otel"
+	"gopkg.in/yaml.v3"
+
+	"github.com/chainguard-dev/clog"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+// layerSBOMPaths are the files of a layer its SBOMs are generated from, on
+// top of the installed apk database and the SBOMs of the packages: its
+// os-release, which may be a link to the one under /usr/lib.
+var layerSBOMPaths = []string{
+	"etc/os-release",
+	"usr/lib/os-release",
+}
+
+// layerSBOMDir is the directory of the SBOMs of the installed packages.
+const layerSBOMDir = "var/lib/db/sbom/"
+
+// GenerateLayerSBOM generates the SBOMs of the layer built previously with
+// the gzipped, or plain, tarball at tarballPath, without rebuilding it: the packages
+// are read from the installed apk database in the layer, under the root set
+// with WithApkDBRoot, and the operating
+// system from its os-release. The SBOM generators, output path and other
+// SBOM options are taken from opts, as for New, and the layer is the root of
+// the SBOMs, whose digest is the one of the layer, since there is no image.
+//
+// This is meant to issue the SBOMs of layers again, e.g. with newer
+// generators or other options.
+func GenerateLayerSBOM(ctx context.Context, tarballPath string, opts ...Option) (_ []types.SBOM, err error) {
+	defer func() { err = wrapError(ErrSBOM, err) }()
+
+	o, ic, err := NewOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := applySourceDateEpoch(o); err != nil {
+		return nil, err
+	}
+
+	log := clog.FromContext(ctx).With("arch", o.Arch.ToAPK())
+	ctx = clog.WithLogger(ctx, log)
+
+	_, span := otel.Tracer("apko").Start(ctx, "GenerateLayerSBOM")
+	defer span.End()
+
+	if len(o.SBOMGenerators) == 0 {
+		log.Warnf("skipping SBOM generation")
+		return nil, nil
+	}
+
+	layer, err := tarball.LayerFromFile(tarballPath)
+	if err != nil {
+		return nil, fmt.Errorf("opening layer %s: %w", tarballPath, err)
+	}
+	dbPaths := installedDBPaths(o)
+	fsys, err := extractLayerSBOMFiles(layer, dbPaths)
+	if err != nil {
+		return nil, fmt.Errorf("reading layer %s: %w", tarballPath, err)
+	}
+
+	pkgs, err := readInstalledPackages(fsys, dbPaths)
+	if err != nil {
+		return nil, fmt.Errorf("reading apk package index: %w", err)
+	}
+
+	// As for a build, the packages date the layer, unless the timestamp is
+	// set explicitly.
+	s := newSBOM(ctx, fsys, *o, *ic, buildDateEpoch(o, pkgs))
+	log.Debug("Generating layer SBOM")
+	if o.SBOMEmbedConfig {
+		if s.Config, err = yaml.Marshal(ic); err != nil {
+			return nil, fmt.Errorf("encoding image configuration: %w", err)
+		}
+	}
+
+	info, err := fetchFSReleaseData(fsys)
+	if err != nil {
+		return nil, fmt.Errorf("reading release data: %w", err)
+	}
+	s.OS.Name = info.Name
+	s.OS.ID = info.ID
+	s.OS.Version = info.VersionID
+	s.Packages = pkgs
+	if o.SBOMRelationshipComments {
+		s.RelationshipComments = packageProvenance(ic.Contents.Packages, pkgs)
+	}
+
+	digest, err := layer.Digest()
+	if err != nil {
+		return nil, fmt.Errorf("getting layer digest: %w", err)
+	}
+	size, err := layer.Size()
+	if err != nil {
+		return nil, fmt.Errorf("getting layer size: %w", err)
+	}
+	mediaType, err := layer.MediaType()
+	if err != nil {
+		return nil, fmt.Errorf("getting layer media type: %w", err)
+	}
+	s.ImageInfo.Layers = []v1.Descriptor{{MediaType: mediaType, Size: size, Digest: digest}}
+	s.ImageInfo.Arch = o.Arch
+
+	return generateImageSBOMs(ctx, *o, s, o.Arch, digest)
+}
+
+// extractLayerSBOMFiles returns a filesystem with the files of layer the
+// SBOMs are generated from: the installed apk database, at one of dbPaths,
+// layerSBOMPaths and the SBOMs of the packages.
+func extractLayerSBOMFiles(layer v1.Layer, dbPaths []string) (apkfs.FullFS, error) {
+	rc, err := layer.Uncompressed()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	fsys := apkfs.NewMemFS()
+	tr := tar.NewReader(rc)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return fsys, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		name := strings.TrimPrefix(path.Clean("/"+hdr.Name), "/")
+		if !slices.Contains(dbPaths, name) && !slices.Contains(layerSBOMPaths, name) &&
+			!strings.HasPrefix(name, layerSBOMDir) {
+			continue
+		}
+		if err := fsys.MkdirAll(path.Dir(name), 0o755); err != nil {
+			return nil, err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeReg:
+			b, err := io.ReadAll(tr)
+			if err != nil {
+				return nil, fmt.Errorf("reading /%s: %w", name, err)
+			}
+			if err := fsys.WriteFile(name, b, 0o644); err != nil {
+				return nil, err
+			}
+		case tar.TypeSymlink:
+			if err := fsys.Symlink(hdr.Linkname, name); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
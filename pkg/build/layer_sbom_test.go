@@ -0,0 +1,63 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/sbom/generator/spdx"
+)
+
+func TestGenerateLayerSBOM(t *testing.T) {
+	ctx := t.Context()
+
+	bc := newTestContext(t, nil, WithTempDir(t.TempDir()))
+	path, layer, err := bc.BuildLayer(ctx)
+	require.NoError(t, err)
+	rc, err := layer.Compressed()
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+	digest, err := layer.Digest()
+	require.NoError(t, err)
+
+	generate := func(opts ...Option) *spdx.Document {
+		sboms, err := GenerateLayerSBOM(ctx, path+".gz", append([]Option{
+			WithArch(testArch),
+			WithSBOMGenerators(spdx.New()),
+			WithSBOM(t.TempDir()),
+		}, opts...)...)
+		require.NoError(t, err)
+		require.Len(t, sboms, 1)
+		require.Equal(t, digest, sboms[0].Digest)
+		return readSBOM(t, sboms[0])
+	}
+
+	names := sbomPackageNames(generate())
+	require.Contains(t, names, "pretend-baselayout")
+	require.Contains(t, names, "replayout")
+	require.Contains(t, names, digest.String())
+
+	// The layer is dated as a build would be: by the timestamp for the
+	// architecture, overridden by SOURCE_DATE_EPOCH.
+	created := func() string {
+		return generate(WithArchSourceDateEpoch(testArch, time.Unix(1700000000, 0).UTC())).CreationInfo.Created
+	}
+	require.Equal(t, "2023-11-14T22:13:20Z", created())
+	t.Setenv("SOURCE_DATE_EPOCH", "1600000000")
+	require.Equal(t, "2020-09-13T12:26:40Z", created())
+}
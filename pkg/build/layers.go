@@ -24,6 +24,7 @@ import (
 	"maps"
 	"os"
 	"path"
+	"runtime"
 	"slices"
 
 	"chainguard.dev/apko/pkg/apk/apk"
@@ -31,23 +32,24 @@ import (
 
 	"github.com/chainguard-dev/clog"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"golang.org/x/sync/errgroup"
 )
 
 func (bc *Context) buildLayers(ctx context.Context) ([]v1.Layer, error) {
 	log := clog.FromContext(ctx)
 
 	if strategy := bc.ic.Layering.Strategy; strategy != "origin" {
-		return nil, fmt.Errorf("unrecognized layering strategy %q", strategy)
+		return nil, wrapError(ErrInvalidConfig, fmt.Errorf("unrecognized layering strategy %q", strategy))
 	}
 
 	if bc.ic.Contents.BaseImage != nil {
-		return nil, fmt.Errorf("layering with %q is unsupported", "baseimage")
+		return nil, wrapError(ErrInvalidConfig, fmt.Errorf("layering with %q is unsupported", "baseimage"))
 	}
 
 	// Build a single fs.FS, the normal way (this writes to bc.fs).
 	diffs, err := bc.buildImage(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("building filesystem: %w", err)
+		return nil, wrapError(ErrInstall, fmt.Errorf("building filesystem: %w", err))
 	}
 
 	pkgs := make([]*apk.Package, 0, len(diffs))
@@ -85,7 +87,52 @@ func (bc *Context) buildLayers(ctx context.Context) ([]v1.Layer, error) {
 	}
 
 	// Then partition that single fs.FS into multiple layers based on our layering strategy.
-	return splitLayers(ctx, bc.fs, groups, pkgToDiff, bc.o.TempDir())
+	mtime, err := bc.mtimeFunc()
+	if err != nil {
+		return nil, wrapError(ErrTarball, err)
+	}
+	layers, err := splitLayers(ctx, bc.layerFS(), mtime, groups, pkgToDiff, bc.apk.InstalledDBPath(), bc.o.TempDir())
+	if err != nil {
+		return nil, wrapError(ErrTarball, err)
+	}
+
+	// The layers are otherwise compressed one at a time, when the image is
+	// assembled.
+	if err := CompressLayers(ctx, layers, bc.o.CompressionConcurrency); err != nil {
+		return nil, wrapError(ErrTarball, err)
+	}
+
+	if err := bc.checkLayerSize(layers); err != nil {
+		return nil, wrapError(ErrTarball, err)
+	}
+
+	return layers, nil
+}
+
+// CompressLayers compresses the layers, at most concurrency of them at once,
+// so that their digests and compressed contents are ready when the image is
+// assembled. A concurrency of zero picks a limit based on GOMAXPROCS. Each
+// layer is compressed to its own file, and the layers are left in order.
+func CompressLayers(ctx context.Context, layers []v1.Layer, concurrency int) error {
+	if concurrency <= 0 {
+		concurrency = max(1, runtime.GOMAXPROCS(0)/pgzipThreads)
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(concurrency)
+	for i, l := range layers {
+		g.Go(func() error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			// Computing the digest compresses the layer.
+			if _, err := l.Digest(); err != nil {
+				return fmt.Errorf("compressing layer %d: %w", i, err)
+			}
+			return nil
+		})
+	}
+	return g.Wait()
 }
 
 func replacesGroup(rep string, g *group) (bool, error) {
@@ -253,7 +300,7 @@ func merge(groups ...*group) *group {
 	return merged
 }
 
-func splitLayers(ctx context.Context, fsys apkfs.FullFS, groups []*group, pkgToDiff map[*apk.Package][]byte, tmpdir string) ([]v1.Layer, error) {
+func splitLayers(ctx context.Context, fsys apkfs.FullFS, mtime mtimeFunc, groups []*group, pkgToDiff map[*apk.Package][]byte, installedDB, tmpdir string) ([]v1.Layer, error) {
 	buf := make([]byte, 1<<20)
 
 	// We'll create a writer for each layer and a map to quickly access the writer given a package or group.
@@ -261,7 +308,7 @@ func splitLayers(ctx context.Context, fsys apkfs.FullFS, groups []*group, pkgToD
 	groupToWriter := map[*group]*layerWriter{}
 
 	for _, g := range groups {
-		f, err := os.CreateTemp(tmpdir, "layer-*.tar.gz")
+		f, err := os.CreateTemp(tmpdir, "layer-*.tar")
 		if err != nil {
 			return nil, err
 		}
@@ -276,7 +323,7 @@ func splitLayers(ctx context.Context, fsys apkfs.FullFS, groups []*group, pkgToD
 	}
 
 	// The top layer holds anything that doesn't belong to a package.
-	f, err := os.CreateTemp(tmpdir, "layer-*.tar.gz")
+	f, err := os.CreateTemp(tmpdir, "layer-*.tar")
 	if err != nil {
 		return nil, err
 	}
@@ -291,7 +338,7 @@ func splitLayers(ctx context.Context, fsys apkfs.FullFS, groups []*group, pkgToD
 	// any missing directory entries to the layer before we write the actual file entry.
 	stack := []*file{}
 
-	for f, err := range walkFS(ctx, fsys) {
+	for f, err := range walkFS(ctx, fsys, mtime) {
 		if err != nil {
 			return nil, err
 		}
@@ -377,7 +424,7 @@ func splitLayers(ctx context.Context, fsys apkfs.FullFS, groups []*group, pkgToD
 			}
 		}
 
-		if f.header.Name == "usr/lib/apk/db/installed" {
+		if f.header.Name == installedDB {
 			// Add a partial installed db to each layer to satisfy scanners.
 			for _, g := range groups {
 				w := groupToWriter[g]
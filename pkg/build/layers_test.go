@@ -19,9 +19,14 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"math/rand"
 	"os"
 	"slices"
 	"testing"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/stretchr/testify/require"
 
 	"chainguard.dev/apko/pkg/apk/apk"
 	apkfs "chainguard.dev/apko/pkg/apk/fs"
@@ -280,7 +285,7 @@ func TestSplitLayersDirectoryCreation(t *testing.T) {
 
 	// Call splitLayers to create the layers
 	ctx := context.Background()
-	layers, err := splitLayers(ctx, fsys, groups, pkgToDiff, tmpDir)
+	layers, err := splitLayers(ctx, fsys, nil, groups, pkgToDiff, "usr/lib/apk/db/installed", tmpDir)
 	if err != nil {
 		t.Fatalf("splitLayers failed: %v", err)
 	}
@@ -348,3 +353,91 @@ func TestSplitLayersDirectoryCreation(t *testing.T) {
 		}
 	}
 }
+
+// newTestLayers writes n layers of one file of size pseudo-random bytes each
+// to dir. seed makes the contents, and thus the diffids, unique so that the
+// layers are not found in compressionCache.
+func newTestLayers(tb testing.TB, dir string, n, size int, seed int64) []v1.Layer {
+	tb.Helper()
+	rnd := rand.New(rand.NewSource(seed)) //nolint:gosec // Test data.
+	data := make([]byte, size)
+	layers := make([]v1.Layer, 0, n)
+	for i := range n {
+		// Half random, half zeros, so that there is something to compress.
+		if _, err := rnd.Read(data[:size/2]); err != nil {
+			tb.Fatal(err)
+		}
+		f, err := os.CreateTemp(dir, "layer-*.tar")
+		if err != nil {
+			tb.Fatal(err)
+		}
+		lw := newLayerWriter(f)
+		if err := lw.w.WriteHeader(&tar.Header{
+			Name:     fmt.Sprintf("file-%d", i),
+			Typeflag: tar.TypeReg,
+			Mode:     0o644,
+			Size:     int64(size),
+		}); err != nil {
+			tb.Fatal(err)
+		}
+		if _, err := lw.w.Write(data); err != nil {
+			tb.Fatal(err)
+		}
+		l, err := lw.finalize()
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			tb.Fatal(err)
+		}
+		layers = append(layers, l)
+	}
+	return layers
+}
+
+func TestCompressLayers(t *testing.T) {
+	dir := t.TempDir()
+	layers := newTestLayers(t, dir, 4, 1<<16, time.Now().UnixNano())
+
+	require.NoError(t, CompressLayers(context.Background(), layers, 2))
+
+	for _, l := range layers {
+		ll := l.(*layer)
+		require.Equal(t, ll.uncompressed+".gz", ll.compressed)
+
+		// The recorded digest and size are those of the layer's own
+		// compressed file.
+		f, err := os.Open(ll.compressed)
+		require.NoError(t, err)
+		h, n, err := v1.SHA256(f)
+		require.NoError(t, f.Close())
+		require.NoError(t, err)
+		require.Equal(t, h, ll.desc.Digest)
+		require.Equal(t, n, ll.desc.Size)
+
+		diffid, err := l.DiffID()
+		require.NoError(t, err)
+		require.NoError(t, VerifyDiffID(ll.compressed, diffid))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.ErrorIs(t, CompressLayers(ctx, newTestLayers(t, dir, 2, 1<<10, time.Now().UnixNano()), 1), context.Canceled)
+}
+
+func BenchmarkCompressLayers(b *testing.B) {
+	for _, concurrency := range []int{1, 2, 4} {
+		b.Run(fmt.Sprintf("concurrency=%d", concurrency), func(b *testing.B) {
+			dir := b.TempDir()
+			for i := range b.N {
+				b.StopTimer()
+				layers := newTestLayers(b, dir, 8, 8<<20, int64(i)<<8|int64(concurrency))
+				b.StartTimer()
+
+				if err := CompressLayers(context.Background(), layers, concurrency); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// layerSizeErrorPackages is the number of packages listed in the message of
+// a LayerSizeError.
+const layerSizeErrorPackages = 5
+
+// PackageSize is the installed size, in bytes, of a package.
+type PackageSize struct {
+	Name          string
+	InstalledSize uint64
+}
+
+// LayerSizeError is returned by BuildLayer and BuildLayers when the layers of
+// the image exceed the maximum size set with WithMaxLayerSize.
+type LayerSizeError struct {
+	// Size is the total size, in bytes, of the layers, compressed if
+	// Compressed.
+	Size int64
+	// Max is the maximum size, in bytes.
+	Max        int64
+	Compressed bool
+	// Packages are the installed packages, the largest first, to help trim
+	// the image.
+	Packages []PackageSize
+}
+
+func (e *LayerSizeError) Error() string {
+	kind := "uncompressed"
+	if e.Compressed {
+		kind = "compressed"
+	}
+	msg := fmt.Sprintf("layers are %d bytes %s, %d bytes over the maximum of %d", e.Size, kind, e.Size-e.Max, e.Max)
+	if len(e.Packages) == 0 {
+		return msg
+	}
+	largest := make([]string, 0, layerSizeErrorPackages)
+	for _, p := range e.Packages[:min(len(e.Packages), layerSizeErrorPackages)] {
+		largest = append(largest, fmt.Sprintf("%s (%d bytes)", p.Name, p.InstalledSize))
+	}
+	return msg + "; largest installed packages: " + strings.Join(largest, ", ")
+}
+
+// checkLayerSize returns a LayerSizeError if the total size of layers is
+// over the maximum set with WithMaxLayerSize, if any.
+func (bc *Context) checkLayerSize(layers []v1.Layer) error {
+	if bc.o.MaxLayerSize == 0 {
+		return nil
+	}
+
+	var total int64
+	for _, l := range layers {
+		size, err := layerSize(l, bc.o.MaxLayerSizeCompressed)
+		if err != nil {
+			return fmt.Errorf("getting layer size: %w", err)
+		}
+		total += size
+	}
+	if total <= bc.o.MaxLayerSize {
+		return nil
+	}
+
+	installed, err := bc.apk.GetInstalled()
+	if err != nil {
+		return fmt.Errorf("getting installed packages: %w", err)
+	}
+	pkgs := make([]PackageSize, 0, len(installed))
+	for _, pkg := range installed {
+		pkgs = append(pkgs, PackageSize{Name: pkg.Name, InstalledSize: pkg.InstalledSize})
+	}
+	slices.SortFunc(pkgs, func(a, b PackageSize) int {
+		return cmp.Or(cmp.Compare(b.InstalledSize, a.InstalledSize), strings.Compare(a.Name, b.Name))
+	})
+	return &LayerSizeError{
+		Size:       total,
+		Max:        bc.o.MaxLayerSize,
+		Compressed: bc.o.MaxLayerSizeCompressed,
+		Packages:   pkgs,
+	}
+}
+
+// layerSize returns the size of l, compressed or not. The uncompressed size
+// of the layers written by the build is the one of their tarball, other
+// layers are read through.
+func layerSize(l v1.Layer, compressed bool) (int64, error) {
+	if compressed {
+		return l.Size()
+	}
+	if ll, ok := l.(*layer); ok {
+		fi, err := os.Stat(ll.uncompressed)
+		if err != nil {
+			return 0, err
+		}
+		return fi.Size(), nil
+	}
+	rc, err := l.Uncompressed()
+	if err != nil {
+		return 0, err
+	}
+	defer rc.Close()
+	return io.Copy(io.Discard, rc)
+}
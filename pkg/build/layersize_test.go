@@ -0,0 +1,46 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaxLayerSize(t *testing.T) {
+	buildLayer := func(size int64, compressed bool) error {
+		bc := newTestContext(t, nil, WithTempDir(t.TempDir()), WithMaxLayerSize(size, compressed))
+		_, _, err := bc.BuildLayer(t.Context())
+		return err
+	}
+
+	for _, compressed := range []bool{false, true} {
+		err := buildLayer(1024, compressed)
+		require.ErrorIs(t, err, ErrTarball)
+		var sizeErr *LayerSizeError
+		require.ErrorAs(t, err, &sizeErr)
+		require.Equal(t, int64(1024), sizeErr.Max)
+		require.Greater(t, sizeErr.Size, sizeErr.Max)
+		require.Equal(t, compressed, sizeErr.Compressed)
+		require.Len(t, sizeErr.Packages, 2)
+		require.GreaterOrEqual(t, sizeErr.Packages[0].InstalledSize, sizeErr.Packages[1].InstalledSize)
+		require.Contains(t, err.Error(), fmt.Sprintf("%d bytes over the maximum of 1024", sizeErr.Size-1024))
+		require.Contains(t, err.Error(), sizeErr.Packages[0].Name)
+	}
+
+	require.NoError(t, buildLayer(1<<30, true))
+}
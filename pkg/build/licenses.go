@@ -0,0 +1,56 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+)
+
+// checkInstalledLicenses runs checkLicenses on the installed packages.
+func (bc *Context) checkInstalledLicenses() error {
+	installed, err := bc.apk.GetInstalled()
+	if err != nil {
+		return fmt.Errorf("getting installed packages: %w", err)
+	}
+	pkgs := make([]*apk.Package, len(installed))
+	for i, pkg := range installed {
+		pkgs[i] = &pkg.Package
+	}
+	return checkLicenses(pkgs, bc.o.LicenseExceptions)
+}
+
+// checkLicenses fails if any of pkgs has no license, i.e. an empty or
+// NOASSERTION one, unless its name is in allowed. The error lists all the
+// offending packages.
+func checkLicenses(pkgs []*apk.Package, allowed []string) error {
+	var unlicensed []string
+	for _, pkg := range pkgs {
+		if slices.Contains(allowed, pkg.Name) {
+			continue
+		}
+		if l := strings.TrimSpace(pkg.License); l == "" || strings.EqualFold(l, "NOASSERTION") {
+			unlicensed = append(unlicensed, fmt.Sprintf("%s-%s", pkg.Name, pkg.Version))
+		}
+	}
+	if len(unlicensed) == 0 {
+		return nil
+	}
+	slices.Sort(unlicensed)
+	return wrapError(ErrPolicy, fmt.Errorf("%d packages without a license: %s", len(unlicensed), strings.Join(unlicensed, ", ")))
+}
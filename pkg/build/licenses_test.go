@@ -0,0 +1,60 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+)
+
+func TestCheckLicenses(t *testing.T) {
+	pkgs := []*apk.Package{
+		{Name: "libfoo", Version: "1.0-r0", License: "MIT"},
+		{Name: "mystery", Version: "0.3-r1"},
+		{Name: "vendored", Version: "2.0-r0", License: "NOASSERTION"},
+		{Name: "app", Version: "1.2-r0", License: "Apache-2.0 AND MIT"},
+	}
+
+	err := checkLicenses(pkgs, nil)
+	require.ErrorIs(t, err, ErrPolicy)
+	require.ErrorContains(t, err, "2 packages without a license: mystery-0.3-r1, vendored-2.0-r0")
+
+	err = checkLicenses(pkgs, []string{"vendored"})
+	require.ErrorContains(t, err, "1 packages without a license: mystery-0.3-r1")
+
+	require.NoError(t, checkLicenses(pkgs, []string{"mystery", "vendored"}))
+}
+
+func TestRequireLicenses(t *testing.T) {
+	// The test packages are all MIT licensed.
+	buildTestImage(t, nil, WithRequireLicenses(true, nil))
+
+	// A package without a license fails the build, unless it is an
+	// exception.
+	dir := t.TempDir()
+	foo := writeTestAPK(t, dir, &apk.Package{Name: "foo", Version: "1.0.0-r0", Origin: "foo", License: "MIT"}, map[string]string{"usr/share/foo": "foo"})
+	bar := writeTestAPK(t, dir, &apk.Package{Name: "bar", Version: "1.0.0-r0", Origin: "bar"}, map[string]string{"usr/share/bar": "bar"})
+	buildImage := func(exceptions ...string) error {
+		bc := newRepoContext(t, repoConfig(dir), []*apk.RepositoryPackage{foo, bar}, WithRequireLicenses(true, exceptions))
+		return bc.BuildImage(t.Context())
+	}
+	err := buildImage()
+	require.ErrorIs(t, err, ErrPolicy)
+	require.ErrorContains(t, err, "1 packages without a license: bar-1.0.0-r0")
+	require.NoError(t, buildImage("bar"))
+}
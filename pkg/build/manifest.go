@@ -0,0 +1,160 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"sort"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/release-utils/version"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/options"
+)
+
+// ReproducibilityManifestFileName is the name the reproducibility manifest
+// is written under, next to the SBOMs.
+const ReproducibilityManifestFileName = "reproducibility-manifest.json"
+
+// ReproducibilityManifest lists the inputs that determine the output of a
+// build, so that a rebuild can be checked against them.
+type ReproducibilityManifest struct {
+	ApkoVersion string `json:"apkoVersion"`
+	// ConfigDigest covers the image configuration and the files it
+	// includes.
+	ConfigDigest    string   `json:"configDigest,omitempty"`
+	SourceDateEpoch string   `json:"sourceDateEpoch"`
+	Repositories    []string `json:"repositories"`
+	Keyring         []string `json:"keyring"`
+	// Packages are the installed packages for each architecture, keyed by
+	// the apk name of the architecture.
+	Packages map[string][]ManifestPackage `json:"packages"`
+}
+
+// ManifestPackage is a package installed in the image.
+type ManifestPackage struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	// Checksum is the apk style 'Q1' prefixed SHA1 hash of the package
+	// control section, which pins the exact package that was installed.
+	Checksum string `json:"checksum"`
+}
+
+// NewReproducibilityManifest returns a manifest of the inputs of a build
+// using o and ic. Packages are added with AddPackages as each architecture
+// is built.
+func NewReproducibilityManifest(o options.Options, ic types.ImageConfiguration, sourceDateEpoch time.Time) *ReproducibilityManifest {
+	return &ReproducibilityManifest{
+		ApkoVersion:     version.GetVersionInfo().GitVersion,
+		ConfigDigest:    o.ImageConfigChecksum,
+		SourceDateEpoch: sourceDateEpoch.UTC().Format(time.RFC3339),
+		Repositories: sets.List(
+			sets.New(ic.Contents.BuildRepositories...).
+				Insert(ic.Contents.Repositories...).
+				Insert(ic.Contents.RuntimeOnlyRepositories...).
+				Insert(o.ExtraBuildRepos...).
+				Insert(o.ExtraRepos...),
+		),
+		Keyring:  sets.List(sets.New(ic.Contents.Keyring...).Insert(o.ExtraKeyFiles...)),
+		Packages: map[string][]ManifestPackage{},
+	}
+}
+
+// buildReproducibilityManifest sets the ReproducibilityManifest of the
+// build from the installed packages.
+func (bc *Context) buildReproducibilityManifest() error {
+	installed, err := bc.apk.GetInstalled()
+	if err != nil {
+		return fmt.Errorf("getting installed packages: %w", err)
+	}
+	bde, err := bc.GetBuildDateEpoch()
+	if err != nil {
+		return fmt.Errorf("determining build date epoch: %w", err)
+	}
+	bc.manifest = NewReproducibilityManifest(bc.o, bc.ic, bde)
+	bc.manifest.AddPackages(bc.Arch(), installed)
+	return nil
+}
+
+// ReproducibilityManifest returns the manifest of the inputs of the build,
+// built by BuildImage, BuildLayer and BuildLayers with
+// WithReproducibilityManifest, or nil.
+func (bc *Context) ReproducibilityManifest() *ReproducibilityManifest {
+	return bc.manifest
+}
+
+// Merge adds the packages of other, the manifest of the build of other
+// architectures of the same image, to m. The source date epoch of m becomes
+// the latest of both, as that of the index.
+func (m *ReproducibilityManifest) Merge(other *ReproducibilityManifest) {
+	maps.Copy(m.Packages, other.Packages)
+	// The epochs are formatted alike, in UTC, so they sort as strings.
+	m.SourceDateEpoch = max(m.SourceDateEpoch, other.SourceDateEpoch)
+}
+
+// AddPackages records the packages installed for arch.
+func (m *ReproducibilityManifest) AddPackages(arch types.Architecture, pkgs []*apk.InstalledPackage) {
+	mpkgs := make([]ManifestPackage, 0, len(pkgs))
+	for _, pkg := range pkgs {
+		mpkgs = append(mpkgs, ManifestPackage{
+			Name:     pkg.Name,
+			Version:  pkg.Version,
+			Checksum: pkg.ChecksumString(),
+		})
+	}
+	sort.Slice(mpkgs, func(i, j int) bool {
+		return mpkgs[i].Name < mpkgs[j].Name
+	})
+	m.Packages[arch.ToAPK()] = mpkgs
+}
+
+// Bytes returns the JSON encoding of the manifest, as written by WriteFile.
+func (m *ReproducibilityManifest) Bytes() ([]byte, error) {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("encoding reproducibility manifest: %w", err)
+	}
+	return append(b, '\n'), nil
+}
+
+// Digest returns the SHA256 digest of the manifest as written by WriteFile.
+func (m *ReproducibilityManifest) Digest() (v1.Hash, error) {
+	b, err := m.Bytes()
+	if err != nil {
+		return v1.Hash{}, err
+	}
+	h, _, err := v1.SHA256(bytes.NewReader(b))
+	return h, err
+}
+
+// WriteFile writes the manifest to path as JSON.
+func (m *ReproducibilityManifest) WriteFile(path string) error {
+	b, err := m.Bytes()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		return fmt.Errorf("writing reproducibility manifest: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build_test
+
+import (
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func TestReproducibilityManifest(t *testing.T) {
+	ctx := t.Context()
+
+	manifest := func(arch string, enable bool) *build.ReproducibilityManifest {
+		bc, err := build.New(ctx, fs.NewMemFS(),
+			build.WithConfig("apko.yaml", []string{"testdata"}),
+			build.WithArch(types.ParseArchitecture(arch)),
+			build.WithReproducibilityManifest(enable),
+		)
+		require.NoError(t, err)
+		require.NoError(t, bc.BuildImage(ctx))
+		return bc.ReproducibilityManifest()
+	}
+
+	require.Nil(t, manifest("amd64", false))
+
+	m := manifest("amd64", true)
+	require.NotNil(t, m)
+	require.Equal(t, []string{"x86_64"}, slices.Collect(maps.Keys(m.Packages)))
+	var names []string
+	for _, pkg := range m.Packages["x86_64"] {
+		require.NotEmpty(t, pkg.Checksum)
+		names = append(names, pkg.Name+"-"+pkg.Version)
+	}
+	require.Equal(t, []string{"pretend-baselayout-1.0.0-r0", "replayout-1.0.0-r0"}, names)
+
+	// The manifests of the architectures of an image merge into one, with
+	// the latest source date epoch.
+	other := manifest("arm64", true)
+	other.SourceDateEpoch = time.Unix(1<<31, 0).UTC().Format(time.RFC3339)
+	m.Merge(other)
+	require.ElementsMatch(t, []string{"x86_64", "aarch64"}, slices.Collect(maps.Keys(m.Packages)))
+	require.Equal(t, other.SourceDateEpoch, m.SourceDateEpoch)
+}
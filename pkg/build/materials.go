@@ -0,0 +1,85 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"context"
+	"encoding/hex"
+	"maps"
+	"slices"
+	"strings"
+
+	purl "github.com/package-url/packageurl-go"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+)
+
+// Material is an input artifact of a build, with its digests keyed by
+// algorithm, as listed in the materials of SLSA provenance, or its
+// resolvedDependencies from v1 on, in in-toto statements.
+type Material struct {
+	URI    string            `json:"uri"`
+	Digest map[string]string `json:"digest"`
+}
+
+// ControlChecksumDigest is the key of the digest of a package in Materials,
+// the SHA-1 of its control section as recorded in the repository index. It
+// is not a digest of the .apk file.
+const ControlChecksumDigest = "apk-control-sha1"
+
+// Materials returns the materials of a build installing pkgs, as returned by
+// BuildPackageList, from the repository indexes with the digests in
+// indexDigests, keyed by URI as returned by IndexDigests.
+//
+// The packages are listed by name, by purl, qualified by the repository they
+// are fetched from when it is known, with the checksum apk verifies them
+// against, which the SBOMs record too, as ControlChecksumDigest. The indexes
+// follow, by URI.
+func Materials(pkgs []*apk.RepositoryPackage, indexDigests map[string]string) []Material {
+	materials := make([]Material, 0, len(pkgs)+len(indexDigests))
+	sorted := slices.SortedFunc(slices.Values(pkgs), func(a, b *apk.RepositoryPackage) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	for _, pkg := range sorted {
+		qualifiers := map[string]string{"arch": pkg.Arch}
+		if pkg.Repository() != nil && pkg.Repository().Repository != nil {
+			qualifiers["repository_url"] = pkg.Repository().URI
+		}
+		uri := purl.NewPackageURL(purl.TypeApk, "", pkg.Name, pkg.Version,
+			purl.QualifiersFromMap(qualifiers), "").ToString()
+		materials = append(materials, Material{
+			URI:    uri,
+			Digest: map[string]string{ControlChecksumDigest: hex.EncodeToString(pkg.Checksum)},
+		})
+	}
+	for _, uri := range slices.Sorted(maps.Keys(indexDigests)) {
+		alg, digest, ok := strings.Cut(indexDigests[uri], ":")
+		if !ok {
+			continue
+		}
+		materials = append(materials, Material{URI: uri, Digest: map[string]string{alg: digest}})
+	}
+	return materials
+}
+
+// Materials resolves the packages of the build and returns the Materials of
+// installing them.
+func (bc *Context) Materials(ctx context.Context) ([]Material, error) {
+	pkgs, _, err := bc.BuildPackageList(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return Materials(pkgs, bc.IndexDigests()), nil
+}
@@ -0,0 +1,54 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+)
+
+func TestMaterials(t *testing.T) {
+	ctx := t.Context()
+	bc := newTestContext(t, nil)
+
+	materials, err := bc.Materials(ctx)
+	require.NoError(t, err)
+	pkgs, _, err := bc.BuildPackageList(ctx)
+	require.NoError(t, err)
+	require.Len(t, materials, len(pkgs)+len(bc.IndexDigests()))
+	for _, m := range materials {
+		require.NotEmpty(t, m.URI)
+		require.NotEmpty(t, m.Digest, "%s has no digest", m.URI)
+		for alg, d := range m.Digest {
+			require.NotEmpty(t, alg, "%s has no digest algorithm", m.URI)
+			require.NotEmpty(t, d, "%s has no %s digest", m.URI, alg)
+		}
+	}
+	require.True(t, strings.HasPrefix(materials[0].URI, "pkg:apk/pretend-baselayout@1.0.0-r0?arch="), materials[0].URI)
+	require.Contains(t, materials[0].URI, "repository_url=")
+	require.True(t, strings.HasPrefix(materials[1].URI, "pkg:apk/replayout@1.0.0-r0?arch="), materials[1].URI)
+	require.Contains(t, materials[0].Digest, ControlChecksumDigest)
+
+	// Packages whose repository is not known are listed without one.
+	pkg := apk.NewRepositoryPackage(&apk.Package{Name: "zlib", Version: "1.3-r0", Arch: "x86_64", Checksum: []byte{0xab, 0xcd}}, nil)
+	require.Equal(t, []Material{
+		{URI: "pkg:apk/zlib@1.3-r0?arch=x86_64", Digest: map[string]string{ControlChecksumDigest: "abcd"}},
+		{URI: "https://example.com/x86_64/APKINDEX.tar.gz", Digest: map[string]string{"sha256": "1234"}},
+	}, Materials([]*apk.RepositoryPackage{pkg}, map[string]string{"https://example.com/x86_64/APKINDEX.tar.gz": "sha256:1234"}))
+}
@@ -0,0 +1,62 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+)
+
+// mtimeFunc returns the mtime to record in the layers for the file at the
+// given path, relative to the root of the image.
+type mtimeFunc func(path string) time.Time
+
+// mtimeFunc returns the mtimeFunc of the build: nil, i.e. the mtimes of the
+// filesystem, unless PackageMtimes is set.
+func (bc *Context) mtimeFunc() (mtimeFunc, error) {
+	if !bc.o.PackageMtimes {
+		return nil, nil
+	}
+	installed, err := bc.apk.GetInstalled()
+	if err != nil {
+		return nil, fmt.Errorf("getting installed packages: %w", err)
+	}
+	return packageMtimes(installed, bc.o.SourceDateEpoch), nil
+}
+
+// packageMtimes returns an mtimeFunc setting the mtime of each file to the
+// build date of the installed package owning it, and to sourceDateEpoch for
+// the files no package owns, or whose package has no build date. Directories
+// owned by several packages get the build date of the last one installed.
+func packageMtimes(installed []*apk.InstalledPackage, sourceDateEpoch time.Time) mtimeFunc {
+	mtimes := map[string]time.Time{}
+	for _, pkg := range installed {
+		if pkg.BuildDate == 0 {
+			continue
+		}
+		for _, f := range pkg.Files {
+			mtimes[strings.TrimSuffix(f.Name, "/")] = pkg.BuildTime
+		}
+	}
+	return func(path string) time.Time {
+		if t, ok := mtimes[path]; ok {
+			return t
+		}
+		return sourceDateEpoch
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	"chainguard.dev/apko/pkg/apk/fs"
+)
+
+func TestPackageMtimes(t *testing.T) {
+	sde := time.Unix(1000, 0).UTC()
+	installed := []*apk.InstalledPackage{{
+		Package: apk.Package{Name: "base", BuildDate: 2000, BuildTime: time.Unix(2000, 0).UTC()},
+		Files: []tar.Header{
+			{Name: "usr", Typeflag: tar.TypeDir},
+			{Name: "usr/bin", Typeflag: tar.TypeDir},
+			{Name: "usr/bin/base", Typeflag: tar.TypeReg},
+		},
+	}, {
+		Package: apk.Package{Name: "app", BuildDate: 3000, BuildTime: time.Unix(3000, 0).UTC()},
+		Files: []tar.Header{
+			{Name: "usr/bin", Typeflag: tar.TypeDir},
+			{Name: "usr/bin/app", Typeflag: tar.TypeReg},
+		},
+	}, {
+		Package: apk.Package{Name: "undated"},
+		Files: []tar.Header{
+			{Name: "usr/bin/undated", Typeflag: tar.TypeReg},
+		},
+	}}
+
+	m := fs.NewMemFS()
+	require.NoError(t, m.MkdirAll("usr/bin", 0o755))
+	require.NoError(t, m.MkdirAll("etc", 0o755))
+	for _, f := range []string{"usr/bin/base", "usr/bin/app", "usr/bin/undated", "etc/apko.json"} {
+		require.NoError(t, m.WriteFile(f, []byte(f), 0o644))
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, writeTar(context.Background(), tar.NewWriter(&buf), m, packageMtimes(installed, sde)))
+
+	got := map[string]int64{}
+	tr := tar.NewReader(&buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		got[hdr.Name] = hdr.ModTime.Unix()
+	}
+	require.Equal(t, map[string]int64{
+		"etc":             1000,
+		"etc/apko.json":   1000,
+		"usr":             2000,
+		"usr/bin":         3000,
+		"usr/bin/app":     3000,
+		"usr/bin/base":    2000,
+		"usr/bin/undated": 1000,
+	}, got)
+}
+
+func TestBuildLayerPackageMtimes(t *testing.T) {
+	sde := time.Date(2021, 2, 3, 4, 5, 6, 0, time.UTC)
+
+	// mtimes returns the mtimes of the files of layer named in want.
+	mtimes := func(layer v1.Layer, want map[string]time.Time) map[string]time.Time {
+		got := map[string]time.Time{}
+		for name, hdr := range layerHeaders(t, layer) {
+			if _, ok := want[name]; ok {
+				got[name] = hdr.ModTime.UTC()
+			}
+		}
+		return got
+	}
+
+	bc := newTestContext(t, nil, WithSourceDateEpoch(sde), WithPackageMtimes(true))
+	_, layer, err := bc.BuildLayer(t.Context())
+	require.NoError(t, err)
+
+	installed, err := bc.InstalledPackages()
+	require.NoError(t, err)
+	want := map[string]time.Time{"etc/apko.json": sde}
+	for _, pkg := range installed {
+		// The test packages have no build date.
+		mtime := pkg.BuildTime
+		if pkg.BuildDate == 0 {
+			mtime = sde
+		}
+		for _, f := range pkg.Files {
+			if f.Typeflag != tar.TypeDir {
+				want[f.Name] = mtime
+			}
+		}
+	}
+	require.Len(t, want, 4)
+
+	require.Equal(t, want, mtimes(layer, want))
+
+	// Without SOURCE_DATE_EPOCH, the files of packages with a build date
+	// get it.
+	t.Setenv("SOURCE_DATE_EPOCH", "")
+	dir := t.TempDir()
+	fooDate := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	barDate := time.Date(2024, 6, 7, 8, 9, 10, 0, time.UTC)
+	foo := writeTestAPK(t, dir, &apk.Package{Name: "foo", Origin: "foo", BuildDate: fooDate.Unix()}, map[string]string{"usr/share/foo/a": "a", "usr/share/foo/b": "b"})
+	bar := writeTestAPK(t, dir, &apk.Package{Name: "bar", Origin: "bar", BuildDate: barDate.Unix()}, map[string]string{"usr/bin/bar": "bar"})
+	bc = newRepoContext(t, repoConfig(dir), []*apk.RepositoryPackage{foo, bar}, WithPackageMtimes(true))
+	_, layer, err = bc.BuildLayer(t.Context())
+	require.NoError(t, err)
+
+	want = map[string]time.Time{
+		"usr/share/foo/a": fooDate,
+		"usr/share/foo/b": fooDate,
+		"usr/bin/bar":     barDate,
+	}
+	require.Equal(t, want, mtimes(layer, want))
+}
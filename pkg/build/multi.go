@@ -23,7 +23,6 @@ import (
 
 	"chainguard.dev/apko/pkg/apk/apk"
 	"chainguard.dev/apko/pkg/build/types"
-	"chainguard.dev/apko/pkg/tarfs"
 
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"golang.org/x/sync/errgroup"
@@ -42,10 +41,11 @@ func NewMultiArch(ctx context.Context, archs []types.Architecture, opts ...Optio
 	}
 
 	for _, arch := range archs {
-		fs := tarfs.New()
 		bopts := slices.Clone(opts)
 		bopts = append(bopts, WithArch(arch))
-		c, err := New(ctx, fs, bopts...)
+		// New creates the filesystem, with the factory of the options if
+		// there is one.
+		c, err := New(ctx, nil, bopts...)
 		if err != nil {
 			return nil, err
 		}
@@ -0,0 +1,127 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/passwd"
+)
+
+// Origins of the paths in a MutationReport.
+const (
+	// MutationOriginPaths is a mutation from the paths of the image
+	// configuration.
+	MutationOriginPaths = "paths"
+	// MutationOriginAccounts is a home directory created for an account.
+	MutationOriginAccounts = "accounts"
+	// MutationOriginDefaults is one of the directories given with
+	// WithStandardDirs.
+	MutationOriginDefaults = "defaults"
+)
+
+// MutationReport records the accounts created and the path ownership and
+// modes applied while building the image filesystem, so that the hardening
+// of an image can be reviewed without diffing filesystems.
+type MutationReport struct {
+	Groups []MutatedGroup `json:"groups,omitempty"`
+	Users  []MutatedUser  `json:"users,omitempty"`
+	Paths  []MutatedPath  `json:"paths,omitempty"`
+}
+
+// MutatedGroup is a group added to /etc/group.
+type MutatedGroup struct {
+	GroupName string   `json:"groupname"`
+	GID       uint32   `json:"gid"`
+	Members   []string `json:"members,omitempty"`
+}
+
+// MutatedUser is a user added to /etc/passwd.
+type MutatedUser struct {
+	UserName string `json:"username"`
+	UID      uint32 `json:"uid"`
+	GID      uint32 `json:"gid"`
+	HomeDir  string `json:"homedir"`
+	Shell    string `json:"shell"`
+}
+
+// MutatedPath is a path whose ownership and mode were set.
+type MutatedPath struct {
+	Path string `json:"path"`
+	// Type is the type of path mutation, e.g. "directory" or "permissions".
+	Type string `json:"type"`
+	// Origin is one of the MutationOrigin constants.
+	Origin string `json:"origin"`
+	UID    uint32 `json:"uid"`
+	GID    uint32 `json:"gid"`
+	// Mode is the octal permission bits, including the setuid, setgid and
+	// sticky bits, e.g. "1777".
+	Mode      string `json:"mode"`
+	Source    string `json:"source,omitempty"`
+	Recursive bool   `json:"recursive,omitempty"`
+}
+
+func (r *MutationReport) addGroup(g types.Group) {
+	if r == nil {
+		return
+	}
+	r.Groups = append(r.Groups, MutatedGroup{
+		GroupName: g.GroupName,
+		GID:       g.GID,
+		Members:   g.Members,
+	})
+}
+
+func (r *MutationReport) addUser(ue passwd.UserEntry) {
+	if r == nil {
+		return
+	}
+	r.Users = append(r.Users, MutatedUser{
+		UserName: ue.UserName,
+		UID:      ue.UID,
+		GID:      ue.GID,
+		HomeDir:  ue.HomeDir,
+		Shell:    ue.Shell,
+	})
+}
+
+func (r *MutationReport) addPath(mut types.PathMutation, origin string) {
+	if r == nil {
+		return
+	}
+	r.Paths = append(r.Paths, MutatedPath{
+		Path:      mut.Path,
+		Type:      mut.Type,
+		Origin:    origin,
+		UID:       mut.UID,
+		GID:       mut.GID,
+		Mode:      fmt.Sprintf("%04o", mut.Permissions),
+		Source:    mut.Source,
+		Recursive: mut.Recursive,
+	})
+}
+
+// Write writes the report to w as JSON.
+func (r *MutationReport) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(r); err != nil {
+		return fmt.Errorf("encoding mutation report: %w", err)
+	}
+	return nil
+}
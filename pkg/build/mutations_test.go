@@ -0,0 +1,68 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func TestMutationReport(t *testing.T) {
+	gid := uint32(10000)
+	ic := testConfig(t)
+	ic.Accounts = types.ImageAccounts{
+		Groups: []types.Group{{GroupName: "app", GID: 10000, Members: []string{"app"}}},
+		Users:  []types.User{{UserName: "app", UID: 10000, GID: &gid}},
+	}
+	ic.Paths = []types.PathMutation{{
+		Path:        "/srv/app",
+		Type:        "directory",
+		UID:         10000,
+		GID:         10000,
+		Permissions: 0o750,
+	}, {
+		Path:   "/srv/current",
+		Type:   "symlink",
+		Source: "/srv/app",
+	}}
+
+	bc := newTestContext(t, nil, WithImageConfiguration(ic), WithStandardDirs(DefaultStandardDirs))
+	require.Nil(t, bc.MutationReport())
+	require.NoError(t, bc.BuildImage(t.Context()))
+
+	report := bc.MutationReport()
+	require.NotNil(t, report)
+	require.Equal(t, []MutatedGroup{{GroupName: "app", GID: 10000, Members: []string{"app"}}}, report.Groups)
+	require.Equal(t, []MutatedUser{{UserName: "app", UID: 10000, GID: 10000, HomeDir: "/home/app", Shell: "/bin/sh"}}, report.Users)
+	require.Equal(t, []MutatedPath{
+		{Path: "/home/app", Type: "directory", Origin: MutationOriginAccounts, UID: 10000, GID: 10000, Mode: "0700"},
+		{Path: "/tmp", Type: "permissions", Origin: MutationOriginDefaults, Mode: "1777"},
+		{Path: "/var/tmp", Type: "permissions", Origin: MutationOriginDefaults, Mode: "1777"},
+		{Path: "/var/log", Type: "permissions", Origin: MutationOriginDefaults, Mode: "0755"},
+		{Path: "/srv/app", Type: "directory", Origin: MutationOriginPaths, UID: 10000, GID: 10000, Mode: "0750"},
+		{Path: "/srv/current", Type: "symlink", Origin: MutationOriginPaths, Mode: "0000", Source: "/srv/app"},
+	}, report.Paths)
+
+	var buf bytes.Buffer
+	require.NoError(t, report.Write(&buf))
+	var decoded MutationReport
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	require.Equal(t, *report, decoded)
+}
@@ -0,0 +1,86 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"slices"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+const nsswitchPath = "etc/nsswitch.conf"
+
+// defaultNSSwitchDatabases are the databases written to /etc/nsswitch.conf,
+// in order, unless they are overridden.
+var defaultNSSwitchDatabases = [][2]string{
+	{"passwd", "files"},
+	{"group", "files"},
+	{"shadow", "files"},
+	{"hosts", "files dns"},
+	{"networks", "files"},
+	{"protocols", "files"},
+	{"services", "files"},
+	{"ethers", "files"},
+	{"rpc", "files"},
+}
+
+// writeNSSwitch writes /etc/nsswitch.conf as configured by cfg, unless the
+// file already exists, e.g. because a package provides it. It returns true
+// if the file was written.
+func writeNSSwitch(fsys apkfs.FullFS, cfg *types.ImageNSSwitch) (bool, error) {
+	if cfg == nil {
+		return false, nil
+	}
+
+	if _, err := fsys.Lstat(nsswitchPath); err == nil {
+		return false, nil
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return false, fmt.Errorf("checking for /%s: %w", nsswitchPath, err)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("# Generated by apko.\n\n")
+	for _, db := range defaultNSSwitchDatabases {
+		sources := db[1]
+		if s, ok := cfg.Databases[db[0]]; ok {
+			sources = s
+		}
+		fmt.Fprintf(&buf, "%s: %s\n", db[0], sources)
+	}
+	for _, db := range slices.Sorted(maps.Keys(cfg.Databases)) {
+		if slices.ContainsFunc(defaultNSSwitchDatabases, func(d [2]string) bool { return d[0] == db }) {
+			continue
+		}
+		fmt.Fprintf(&buf, "%s: %s\n", db, cfg.Databases[db])
+	}
+
+	if err := fsys.MkdirAll("etc", 0o755); err != nil {
+		return false, fmt.Errorf("creating /etc: %w", err)
+	}
+	if err := fsys.WriteFile(nsswitchPath, buf.Bytes(), 0o644); err != nil {
+		return false, fmt.Errorf("writing /%s: %w", nsswitchPath, err)
+	}
+	if err := fsys.Chown(nsswitchPath, 0, 0); err != nil {
+		return false, fmt.Errorf("chowning /%s: %w", nsswitchPath, err)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,86 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func Test_writeNSSwitch(t *testing.T) {
+	t.Run("create", func(t *testing.T) {
+		fsys := apkfs.NewMemFS()
+		written, err := writeNSSwitch(fsys, &types.ImageNSSwitch{
+			Databases: map[string]string{
+				"hosts":      "files myhostname dns",
+				"automount":  "files",
+				"aliases":    "files",
+				"initgroups": "files",
+			},
+		})
+		require.NoError(t, err)
+		require.True(t, written)
+
+		b, err := fsys.ReadFile("etc/nsswitch.conf")
+		require.NoError(t, err)
+		require.Equal(t, `# Generated by apko.
+
+passwd: files
+group: files
+shadow: files
+hosts: files myhostname dns
+networks: files
+protocols: files
+services: files
+ethers: files
+rpc: files
+aliases: files
+automount: files
+initgroups: files
+`, string(b))
+
+		fi, err := fsys.Stat("etc/nsswitch.conf")
+		require.NoError(t, err)
+		require.EqualValues(t, 0o644, fi.Mode().Perm())
+	})
+
+	t.Run("skip if present", func(t *testing.T) {
+		fsys := apkfs.NewMemFS()
+		require.NoError(t, fsys.MkdirAll("etc", 0o755))
+		require.NoError(t, fsys.WriteFile("etc/nsswitch.conf", []byte("hosts: files\n"), 0o644))
+
+		written, err := writeNSSwitch(fsys, &types.ImageNSSwitch{})
+		require.NoError(t, err)
+		require.False(t, written)
+
+		b, err := fsys.ReadFile("etc/nsswitch.conf")
+		require.NoError(t, err)
+		require.Equal(t, "hosts: files\n", string(b))
+	})
+
+	t.Run("not configured", func(t *testing.T) {
+		fsys := apkfs.NewMemFS()
+		written, err := writeNSSwitch(fsys, nil)
+		require.NoError(t, err)
+		require.False(t, written)
+
+		_, err = fsys.Stat("etc/nsswitch.conf")
+		require.Error(t, err)
+	})
+}
@@ -19,6 +19,7 @@ import (
 	"errors"
 	"fmt"
 	"maps"
+	"slices"
 	"sort"
 	"strings"
 	"time"
@@ -60,6 +61,9 @@ func BuildImageFromLayers(ctx context.Context, baseImage v1.Image, layers []v1.L
 	if titleok && vendorok {
 		comment = title + " by " + vendor
 	}
+	if ic.Comment != "" {
+		comment = ic.Comment
+	}
 
 	adds := make([]mutate.Addendum, 0, len(layers))
 	for _, layer := range layers {
@@ -117,6 +121,9 @@ func BuildImageFromLayers(ctx context.Context, baseImage v1.Image, layers []v1.L
 
 	cfg = cfg.DeepCopy()
 	cfg.Author = "github.com/chainguard-dev/apko"
+	if ic.Author != "" {
+		cfg.Author = ic.Author
+	}
 	platform := arch.ToOCIPlatform()
 	cfg.Architecture = platform.Architecture
 	cfg.Variant = platform.Variant
@@ -192,6 +199,84 @@ func BuildImageFromLayers(ctx context.Context, baseImage v1.Image, layers []v1.L
 	return img, nil
 }
 
+// AppendConfigHistory adds an empty_layer history entry to img for each
+// configuration-only setting in ic (environment, labels, entrypoint, etc.),
+// so the image history reflects the steps that did not add any filesystem
+// content. The entries use created as their timestamp, so builds remain
+// reproducible.
+func AppendConfigHistory(img v1.Image, ic types.ImageConfiguration, created time.Time) (v1.Image, error) {
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		return nil, fmt.Errorf("unable to get oci config file: %w", err)
+	}
+	cfg = cfg.DeepCopy()
+	AppendEmptyLayerHistory(cfg, configSteps(cfg.Config, ic), created)
+
+	img, err = mutate.ConfigFile(img, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("unable to update oci config file: %w", err)
+	}
+	return img, nil
+}
+
+// AppendEmptyLayerHistory appends to the history of cfg an empty_layer entry
+// by apko for each of steps, described in its comment, with created as its
+// timestamp.
+func AppendEmptyLayerHistory(cfg *v1.ConfigFile, steps []string, created time.Time) {
+	for _, step := range steps {
+		cfg.History = append(cfg.History, v1.History{
+			Author:     "apko",
+			CreatedBy:  "apko",
+			Comment:    step,
+			Created:    v1.Time{Time: created},
+			EmptyLayer: true,
+		})
+	}
+}
+
+// configSteps describes, in a fixed order, each setting of the image
+// configuration that was set in ic, using its final value from cfg. The
+// environment and labels are therefore described with the defaults and
+// annotations that apko adds to them.
+func configSteps(cfg v1.Config, ic types.ImageConfiguration) []string {
+	var steps []string
+
+	if len(ic.Environment) != 0 && len(cfg.Env) != 0 {
+		envs := slices.Clone(cfg.Env)
+		sort.Strings(envs)
+		steps = append(steps, "ENV "+strings.Join(envs, " "))
+	}
+	if len(ic.Annotations) != 0 && len(cfg.Labels) != 0 {
+		labels := make([]string, 0, len(cfg.Labels))
+		for k, v := range cfg.Labels {
+			labels = append(labels, fmt.Sprintf("%s=%s", k, v))
+		}
+		sort.Strings(labels)
+		steps = append(steps, "LABEL "+strings.Join(labels, " "))
+	}
+	if len(cfg.Entrypoint) != 0 {
+		steps = append(steps, "ENTRYPOINT "+strings.Join(cfg.Entrypoint, " "))
+	}
+	if len(cfg.Cmd) != 0 {
+		steps = append(steps, "CMD "+strings.Join(cfg.Cmd, " "))
+	}
+	if cfg.WorkingDir != "" {
+		steps = append(steps, "WORKDIR "+cfg.WorkingDir)
+	}
+	if len(ic.Volumes) != 0 && len(cfg.Volumes) != 0 {
+		volumes := slices.Sorted(maps.Keys(cfg.Volumes))
+		steps = append(steps, "VOLUME "+strings.Join(volumes, " "))
+	}
+	if cfg.User != "" {
+		steps = append(steps, "USER "+cfg.User)
+	}
+	if cfg.StopSignal != "" {
+		steps = append(steps, "STOPSIGNAL "+cfg.StopSignal)
+	}
+
+	return steps
+}
+
 func BuildImageTarballFromLayer(ctx context.Context, imageRef string, layer v1.Layer, outputTarGZ string, ic types.ImageConfiguration, opts options.Options) error {
 	log := clog.FromContext(ctx)
 	emptyImage := empty.Image
@@ -16,6 +16,7 @@ package oci
 
 import (
 	"context"
+	"encoding/json"
 	"testing"
 	"time"
 
@@ -24,6 +25,7 @@ import (
 	"github.com/google/go-containerregistry/pkg/v1/empty"
 	"github.com/google/go-containerregistry/pkg/v1/static"
 	ggcrtypes "github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/google/go-containerregistry/pkg/v1/validate"
 	"github.com/stretchr/testify/require"
 
 	"chainguard.dev/apko/pkg/build/types"
@@ -169,3 +171,87 @@ func TestBuildImageFromLayer(t *testing.T) {
 		})
 	}
 }
+
+func TestImageAuthorComment(t *testing.T) {
+	ctx := context.Background()
+	layer := static.NewLayer([]byte("hello"), ggcrtypes.OCILayer)
+	created := time.Unix(1700000000, 0).UTC()
+
+	ic := types.ImageConfiguration{
+		Author:  "Jane Doe <jane@example.com>",
+		Comment: "nginx web server",
+	}
+	build := func() []byte {
+		img, err := BuildImageFromLayer(ctx, empty.Image, layer, ic, created, types.ParseArchitecture("amd64"))
+		require.NoError(t, err)
+		raw, err := img.RawConfigFile()
+		require.NoError(t, err)
+		return raw
+	}
+	raw := build()
+
+	var cfg struct {
+		Author  string `json:"author"`
+		History []struct {
+			Comment string `json:"comment"`
+		} `json:"history"`
+	}
+	require.NoError(t, json.Unmarshal(raw, &cfg))
+	require.Equal(t, "Jane Doe <jane@example.com>", cfg.Author)
+	require.Len(t, cfg.History, 1)
+	require.Equal(t, "nginx web server", cfg.History[0].Comment)
+
+	// Nothing time dependent is added, the config is reproducible.
+	require.Equal(t, raw, build())
+}
+
+func TestAppendConfigHistory(t *testing.T) {
+	ctx := context.Background()
+	layer := static.NewLayer([]byte("hello"), ggcrtypes.OCILayer)
+	created := time.Unix(1700000000, 0).UTC()
+
+	ic := types.ImageConfiguration{
+		Environment: map[string]string{"FOO": "bar"},
+		Annotations: map[string]string{"org.opencontainers.image.title": "Title"},
+		Entrypoint:  types.ImageEntrypoint{Command: "/bin/sh -l"},
+		WorkDir:     "/work",
+		Volumes:     []string{"/data", "/cache"},
+	}
+	img, err := BuildImageFromLayer(ctx, empty.Image, layer, ic, created, types.ParseArchitecture("amd64"))
+	require.NoError(t, err)
+
+	img, err = AppendConfigHistory(img, ic, created)
+	require.NoError(t, err)
+	require.NoError(t, validate.Image(img, validate.Fast))
+
+	cfg, err := img.ConfigFile()
+	require.NoError(t, err)
+	require.Len(t, cfg.RootFS.DiffIDs, 1)
+
+	var comments []string
+	var emptyLayers []bool
+	for _, h := range cfg.History {
+		require.Equal(t, created, h.Created.Time)
+		comments = append(comments, h.Comment)
+		emptyLayers = append(emptyLayers, h.EmptyLayer)
+	}
+	require.Equal(t, []string{
+		"This is an apko single-layer image",
+		// The environment and labels include what apko adds to them.
+		"ENV FOO=bar PATH=/usr/local/sbin:/usr/local/bin:/usr/bin:/usr/sbin:/sbin:/bin SSL_CERT_FILE=/etc/ssl/certs/ca-certificates.crt",
+		"LABEL org.opencontainers.image.created=2023-11-14T22:13:20Z org.opencontainers.image.title=Title",
+		"ENTRYPOINT /bin/sh -l",
+		"WORKDIR /work",
+		"VOLUME /cache /data",
+	}, comments)
+	require.Equal(t, []bool{false, true, true, true, true, true}, emptyLayers)
+
+	// Without configuration-only settings, only the layer is in the history.
+	img, err = BuildImageFromLayer(ctx, empty.Image, layer, types.ImageConfiguration{}, created, types.ParseArchitecture("amd64"))
+	require.NoError(t, err)
+	img, err = AppendConfigHistory(img, types.ImageConfiguration{}, created)
+	require.NoError(t, err)
+	cfg, err = img.ConfigFile()
+	require.NoError(t, err)
+	require.Len(t, cfg.History, 1)
+}
@@ -44,19 +44,27 @@ func GenerateIndex(ctx context.Context, ic types.ImageConfiguration, imgs map[ty
 	_, span := otel.Tracer("apko").Start(ctx, "GenerateIndex")
 	defer span.End()
 
-	return generateIndexWithMediaType(ggcrtypes.OCIImageIndex, ic, imgs, created)
+	return generateIndexWithMediaType(ggcrtypes.OCIImageIndex, ic, imgs, nil, created)
+}
+
+// GenerateIndexWithManifestAnnotations is GenerateIndex with annotations on the image descriptors.
+func GenerateIndexWithManifestAnnotations(ctx context.Context, ic types.ImageConfiguration, imgs map[types.Architecture]v1.Image, annotations map[types.Architecture]map[string]string, created time.Time) (name.Digest, v1.ImageIndex, error) {
+	_, span := otel.Tracer("apko").Start(ctx, "GenerateIndex")
+	defer span.End()
+
+	return generateIndexWithMediaType(ggcrtypes.OCIImageIndex, ic, imgs, annotations, created)
 }
 
 // GenerateDockerIndex generates a docker multi-arch manifest from the given imgs. The index type
 // will be "application/vnd.docker.distribution.manifest.list.v2+json".
 // The index is stored in memory.
 func GenerateDockerIndex(ctx context.Context, ic types.ImageConfiguration, imgs map[types.Architecture]v1.Image, created time.Time) (name.Digest, v1.ImageIndex, error) {
-	return generateIndexWithMediaType(ggcrtypes.DockerManifestList, ic, imgs, created)
+	return generateIndexWithMediaType(ggcrtypes.DockerManifestList, ic, imgs, nil, created)
 }
 
 // generateIndexWithMediaType generates an index or docker manifest list from the given imgs. The index type
 // is provided by the `mediaType` parameter.
-func generateIndexWithMediaType(mediaType ggcrtypes.MediaType, ic types.ImageConfiguration, imgs map[types.Architecture]v1.Image, created time.Time) (name.Digest, v1.ImageIndex, error) {
+func generateIndexWithMediaType(mediaType ggcrtypes.MediaType, ic types.ImageConfiguration, imgs map[types.Architecture]v1.Image, annotations map[types.Architecture]map[string]string, created time.Time) (name.Digest, v1.ImageIndex, error) {
 	// If annotations are set and we're using the OCI mediaType, set annotations on the index.
 	annCopy := make(map[string]string, len(ic.Annotations))
 	if mediaType == ggcrtypes.OCIImageIndex {
@@ -100,10 +108,11 @@ func generateIndexWithMediaType(mediaType ggcrtypes.MediaType, ic types.ImageCon
 		idx = mutate.AppendManifests(idx, mutate.IndexAddendum{
 			Add: img,
 			Descriptor: v1.Descriptor{
-				MediaType: mt,
-				Digest:    h,
-				Size:      size,
-				Platform:  arch.ToOCIPlatform(),
+				MediaType:   mt,
+				Digest:      h,
+				Size:        size,
+				Platform:    arch.ToOCIPlatform(),
+				Annotations: annotations[arch],
 			},
 		})
 	}
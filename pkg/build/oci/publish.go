@@ -16,7 +16,10 @@ package oci
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"net/http"
 	"os"
 	"strings"
 
@@ -28,8 +31,52 @@ import (
 	"golang.org/x/sync/errgroup"
 
 	"github.com/chainguard-dev/clog"
+
+	"chainguard.dev/apko/pkg/build/types"
 )
 
+// TLSTransport returns a transport for pushing to registries that are served
+// with a private CA or that require a client certificate. caFile is a PEM
+// bundle trusted in addition to the system roots, and certFile and keyFile
+// are a PEM encoded client certificate and key. Any of them may be empty.
+//
+// Use it with remote.WithTransport.
+func TLSTransport(caFile, certFile, keyFile string) (http.RoundTripper, error) {
+	if (certFile == "") != (keyFile == "") {
+		return nil, fmt.Errorf("a client certificate and key must be provided together")
+	}
+
+	t := remote.DefaultTransport.(*http.Transport).Clone()
+	if t.TLSClientConfig == nil {
+		t.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA certificates: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		t.TLSClientConfig.RootCAs = pool
+	}
+
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		t.TLSClientConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return t, nil
+}
+
 func LoadImage(ctx context.Context, image v1.Image, tags []string) (name.Reference, error) {
 	log := clog.FromContext(ctx)
 	hash, err := image.Digest()
@@ -73,7 +120,7 @@ func PublishIndex(ctx context.Context, idx v1.ImageIndex, tags []string, remoteO
 
 	// TODO(jason): Also set annotations on the index.
 
-	ref, err := name.ParseReference(tags[0])
+	ref, err := types.NormalizeReference(tags[0])
 	if err != nil {
 		return name.Digest{}, fmt.Errorf("parsing tag %q: %w", tags[0], err)
 	}
@@ -91,7 +138,7 @@ func PublishIndex(ctx context.Context, idx v1.ImageIndex, tags []string, remoteO
 	for _, tag := range toPublish {
 		log.Infof("publishing index tag %v", tag)
 
-		ref, err := name.ParseReference(tag)
+		ref, err := types.NormalizeReference(tag)
 		if err != nil {
 			return name.Digest{}, fmt.Errorf("unable to parse reference: %w", err)
 		}
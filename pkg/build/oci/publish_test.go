@@ -14,7 +14,33 @@
 
 package oci
 
-import "testing"
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/require"
+)
 
 func TestPublishImage(t *testing.T) {
 
@@ -43,3 +69,110 @@ func TestPublishImagesFromIndex(t *testing.T) {
 func TestCopy(t *testing.T) {
 
 }
+
+func TestPublishIndexMTLS(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	ca, caKey := newCert(t, nil, nil, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "test CA"},
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	})
+	server, serverKey := newCert(t, ca, caKey, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "registry"},
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	client, clientKey := newCert(t, ca, caKey, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "client"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+
+	caFile := writePEM(t, dir, "ca.pem", ca, nil)
+	certFile := writePEM(t, dir, "client.pem", client, nil)
+	keyFile := writePEM(t, dir, "client-key.pem", nil, clientKey)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	s := httptest.NewUnstartedServer(registry.New())
+	s.TLS = &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		Certificates: []tls.Certificate{{
+			Certificate: [][]byte{server.Raw},
+			PrivateKey:  serverKey,
+		}},
+		ClientCAs:  pool,
+		ClientAuth: tls.RequireAndVerifyClientCert,
+	}
+	s.StartTLS()
+	defer s.Close()
+
+	u, err := url.Parse(s.URL)
+	require.NoError(t, err)
+	repo, err := name.NewRepository(fmt.Sprintf("%s/test/mtls", u.Host))
+	require.NoError(t, err)
+	tag := repo.Tag("latest").String()
+
+	img, err := random.Image(1024, 1)
+	require.NoError(t, err)
+	idx := mutate.AppendManifests(empty.Index, mutate.IndexAddendum{Add: img})
+
+	// Without a client certificate, the registry rejects the push.
+	transport, err := TLSTransport(caFile, "", "")
+	require.NoError(t, err)
+	_, err = PublishIndex(ctx, idx, []string{tag}, remote.WithTransport(transport))
+	require.Error(t, err)
+
+	transport, err = TLSTransport(caFile, certFile, keyFile)
+	require.NoError(t, err)
+	_, err = PublishImagesFromIndex(ctx, idx, repo, remote.WithTransport(transport))
+	require.NoError(t, err)
+	digest, err := PublishIndex(ctx, idx, []string{tag}, remote.WithTransport(transport))
+	require.NoError(t, err)
+
+	want, err := idx.Digest()
+	require.NoError(t, err)
+	require.Equal(t, want.String(), digest.DigestStr())
+
+	_, err = TLSTransport(caFile, certFile, "")
+	require.Error(t, err)
+}
+
+func newCert(t *testing.T, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, tmpl *x509.Certificate) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl.SerialNumber = big.NewInt(time.Now().UnixNano())
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert, key
+}
+
+func writePEM(t *testing.T, dir, name string, cert *x509.Certificate, key *ecdsa.PrivateKey) string {
+	t.Helper()
+
+	var block *pem.Block
+	if cert != nil {
+		block = &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}
+	} else {
+		der, err := x509.MarshalECPrivateKey(key)
+		require.NoError(t, err)
+		block = &pem.Block{Type: "EC PRIVATE KEY", Bytes: der}
+	}
+
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(block), 0o600))
+	return path
+}
@@ -19,17 +19,26 @@ import (
 	sha2562 "crypto/sha256"
 	"encoding/base64"
 	"fmt"
+	"io/fs"
 	"maps"
 	"net/http"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"chainguard.dev/apko/pkg/apk/apk"
 	"chainguard.dev/apko/pkg/apk/auth"
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
 	"chainguard.dev/apko/pkg/build/types"
 	"chainguard.dev/apko/pkg/options"
 	"chainguard.dev/apko/pkg/sbom/generator"
+	soptions "chainguard.dev/apko/pkg/sbom/options"
 
 	"github.com/chainguard-dev/clog"
+	"github.com/google/go-containerregistry/pkg/name"
 )
 
 // Option is an option for the build context.
@@ -58,9 +67,20 @@ func WithConfig(configFile string, includePaths []string) Option {
 	}
 }
 
-// WithTags sets the tags for the build context.
+// WithTags sets the tags for the build context. Each tag must be a valid
+// image reference with a tag, so that malformed tags are reported before
+// building rather than when publishing.
 func WithTags(tags ...string) Option {
 	return func(bc *Context) error {
+		for _, tag := range tags {
+			ref, err := types.NormalizeReference(tag)
+			if err != nil {
+				return wrapError(ErrInvalidConfig, fmt.Errorf("invalid tag %q: %w", tag, err))
+			}
+			if _, ok := ref.(name.Tag); !ok {
+				return wrapError(ErrInvalidConfig, fmt.Errorf("invalid tag %q: expected a tag, not a digest", tag))
+			}
+		}
 		bc.o.Tags = tags
 		return nil
 	}
@@ -105,6 +125,20 @@ func WithSourceDateEpoch(t time.Time) Option {
 	}
 }
 
+// WithArchSourceDateEpoch sets the timestamp to use for the given
+// architecture, taking precedence over WithSourceDateEpoch and WithBuildDate.
+func WithArchSourceDateEpoch(arch types.Architecture, t time.Time) Option {
+	return func(bc *Context) error {
+		epochs := maps.Clone(bc.o.ArchSourceDateEpochs)
+		if epochs == nil {
+			epochs = make(map[types.Architecture]time.Time)
+		}
+		epochs[types.ParseArchitecture(arch.String())] = t
+		bc.o.ArchSourceDateEpochs = epochs
+		return nil
+	}
+}
+
 func WithSBOM(path string) Option {
 	return func(bc *Context) error {
 		bc.o.SBOMPath = path
@@ -130,6 +164,621 @@ func WithSBOMGenerators(generators ...generator.Generator) Option {
 	}
 }
 
+// WithSBOMExtraPackages adds components not tracked by apk, such as vendored
+// binaries, to the generated image SBOMs.
+func WithSBOMExtraPackages(pkgs ...soptions.ExtraPackage) Option {
+	return func(bc *Context) error {
+		bc.o.SBOMExtraPackages = append(bc.o.SBOMExtraPackages, pkgs...)
+		return nil
+	}
+}
+
+// MaxSBOMCommentLength is the maximum length, in bytes, of the comment set
+// with WithSBOMComment.
+const MaxSBOMCommentLength = 4096
+
+// WithSBOMComment sets a free-form comment, e.g. "nightly build", on the
+// generated SBOM documents. The comment must be valid UTF-8 and at most
+// MaxSBOMCommentLength bytes long.
+func WithSBOMComment(comment string) Option {
+	return func(bc *Context) error {
+		if !utf8.ValidString(comment) {
+			return wrapError(ErrInvalidConfig, fmt.Errorf("SBOM comment is not valid UTF-8"))
+		}
+		if len(comment) > MaxSBOMCommentLength {
+			return wrapError(ErrInvalidConfig, fmt.Errorf("SBOM comment is %d bytes long, the maximum is %d", len(comment), MaxSBOMCommentLength))
+		}
+		bc.o.SBOMComment = comment
+		return nil
+	}
+}
+
+// licenseListVersionRegex matches SPDX license list versions, e.g. "3.27".
+var licenseListVersionRegex = regexp.MustCompile(`^[0-9]+\.[0-9]+$`)
+
+// WithSBOMLicenseListVersion sets the version of the SPDX license list, in
+// "<major>.<minor>" form, which the SBOMs declare their license expressions
+// refer to. An empty version keeps the generator's default.
+func WithSBOMLicenseListVersion(version string) Option {
+	return func(bc *Context) error {
+		if version != "" && !licenseListVersionRegex.MatchString(version) {
+			return wrapError(ErrInvalidConfig, fmt.Errorf("invalid SPDX license list version %q, expected <major>.<minor>", version))
+		}
+		bc.o.SBOMLicenseListVersion = version
+		return nil
+	}
+}
+
+// WithSBOMNormalizeLicenses rewrites the license expressions in the SBOMs in
+// their canonical SPDX form, e.g. "mit" as "MIT" and "GPL-2.0+" as
+// "GPL-2.0-or-later", against the SPDX license list embedded in apko. The
+// SBOMs then declare the version of that license list, and generating them
+// fails if WithSBOMLicenseListVersion sets another one.
+func WithSBOMNormalizeLicenses(normalize bool) Option {
+	return func(bc *Context) error {
+		bc.o.SBOMNormalizeLicenses = normalize
+		return nil
+	}
+}
+
+// WithSBOMPackageNameTemplate sets the template of the names of the apk
+// packages in the SBOMs, e.g. "{name}-{arch}". The placeholders are {name},
+// {version}, {arch} and {distro}, the ID of the operating system of the
+// image. The SPDX identifiers of the packages are not affected.
+func WithSBOMPackageNameTemplate(tmpl string) Option {
+	return func(bc *Context) error {
+		if err := soptions.ValidatePackageNameTemplate(tmpl); err != nil {
+			return wrapError(ErrInvalidConfig, err)
+		}
+		bc.o.SBOMPackageNameTemplate = tmpl
+		return nil
+	}
+}
+
+// WithSBOMRelationshipComments comments the relationships from the image to
+// its packages in the SBOMs with why each package was installed: requested in
+// the image configuration, or pulled in transitively as a dependency of other
+// packages. The comments are left out by default to keep the SBOMs terse.
+func WithSBOMRelationshipComments(enable bool) Option {
+	return func(bc *Context) error {
+		bc.o.SBOMRelationshipComments = enable
+		return nil
+	}
+}
+
+// WithSBOMGeneratedFiles adds the files apko generates in the image, such as
+// /etc/apko.json, the supervision tree and the busybox links, to the SBOMs,
+// with a GENERATED_FROM relationship to a package describing apko. The
+// configuration files among them, /etc/apko.json, /etc/nsswitch.conf and the
+// profile snippets, are also related to the image as its configuration.
+func WithSBOMGeneratedFiles(enable bool) Option {
+	return func(bc *Context) error {
+		bc.o.SBOMGeneratedFiles = enable
+		return nil
+	}
+}
+
+// WithSBOMSplitVersions splits the versions of the apk packages in the SBOMs,
+// e.g. 1.2.3-r4, into their upstream version, epoch and release. The epoch
+// and release are added as qualifiers of the purls of the packages, and all
+// the parts in an annotation; the versions of the packages and of their
+// purls are still the full versions.
+func WithSBOMSplitVersions(enable bool) Option {
+	return func(bc *Context) error {
+		bc.o.SBOMSplitVersions = enable
+		return nil
+	}
+}
+
+// WithSBOMIndexDigests records the digests of the repository index archives
+// the packages were resolved from as annotations of the SBOM documents, to
+// prove which repository snapshot produced the package set.
+func WithSBOMIndexDigests(enable bool) Option {
+	return func(bc *Context) error {
+		bc.o.SBOMIndexDigests = enable
+		return nil
+	}
+}
+
+// WithSBOMDigestAnnotation sets the SBOMDigestAnnotation of the images in the
+// index generated by GenerateIndex.
+func WithSBOMDigestAnnotation(enable bool) Option {
+	return func(bc *Context) error {
+		bc.o.SBOMDigestAnnotation = enable
+		return nil
+	}
+}
+
+// WithNoScripts is the equivalent of apk --no-scripts for hardened builds:
+// nothing the packages would have their scriptlets or triggers do is done.
+// apko never runs scriptlets, but it records them in the apk database, and
+// does the work of some triggers itself: it links the busybox applets and
+// generates /etc/ld.so.cache. With this option, none of it is done, so the
+// image lacks e.g. the users, groups and caches packages create in their
+// scriptlets, as well as the busybox applets. The packages are still
+// installed and in the SBOMs.
+func WithNoScripts(enable bool) Option {
+	return func(bc *Context) error {
+		bc.o.NoScripts = enable
+		return nil
+	}
+}
+
+// WithCABundle installs the PEM CA certificates bundle at path in the image,
+// for images without a ca-certificates package: the bundle becomes
+// /etc/ssl/certs/ca-certificates.crt, and each of its certificates gets its
+// own file in /etc/ssl/certs with the subject hash symlinks OpenSSL looks
+// certificates up by, as c_rehash would create. When the packages already
+// installed a bundle there, it is kept and path is ignored.
+func WithCABundle(path string) Option {
+	return func(bc *Context) error {
+		bc.o.CABundle = path
+		return nil
+	}
+}
+
+// WithApkDBRoot puts the apk database of the image in root, relative to the
+// root of the image, rather than in /usr/lib/apk, e.g. in a separate state
+// directory of an image with a read-only root. apko reads the installed
+// packages from there for the busybox links, /etc/ld.so.cache, the layers
+// and the SBOMs, but tools reading the database from the default location,
+// e.g. scanners, will not find it.
+func WithApkDBRoot(root string) Option {
+	return func(bc *Context) error {
+		if root == "" {
+			bc.o.ApkDBRoot = ""
+			return nil
+		}
+		clean := path.Clean(strings.TrimPrefix(root, "/"))
+		if clean == "." || !fs.ValidPath(clean) {
+			return wrapError(ErrInvalidConfig, fmt.Errorf("invalid apk database root %q", root))
+		}
+		bc.o.ApkDBRoot = clean
+		return nil
+	}
+}
+
+// WithSBOMContentNamespace derives the namespace of each SBOM document from
+// the hash of the packages it describes, so that the same inputs always
+// yield the same namespace, which helps deduplicating and caching SBOMs.
+// Along with a fixed SOURCE_DATE_EPOCH, this makes the SBOMs of a rebuild
+// identical.
+func WithSBOMContentNamespace(enable bool) Option {
+	return func(bc *Context) error {
+		bc.o.SBOMContentNamespace = enable
+		return nil
+	}
+}
+
+// WithSBOMPackageVCS adds the commit each apk package was built from, as
+// recorded in its metadata, to its purls in the SBOMs as the commit
+// qualifier, and, when repository is set, as the vcs_url qualifier
+// "git+<repository>@<commit>". The packages without a commit are left as
+// they are.
+func WithSBOMPackageVCS(enable bool, repository string) Option {
+	return func(bc *Context) error {
+		bc.o.SBOMPackageVCS = enable
+		bc.o.SBOMPackageVCSURL = repository
+		return nil
+	}
+}
+
+// WithDistroless builds distroless-style images, which only have what the
+// packages need at runtime: paths, or DefaultDistrolessPaths if none, are
+// left out of the layers of the image, with their contents and the symlinks
+// to them, e.g. the apk tooling and database, and busybox with its shells
+// and applets. The packages are still installed in the filesystem of the
+// build, and so are all in the SBOMs. Paths are matched as they are, not
+// through symlinks, e.g. /lib/apk does not match /usr/lib/apk when /lib
+// links to /usr/lib.
+func WithDistroless(enable bool, paths []string) Option {
+	return func(bc *Context) error {
+		bc.o.Distroless = enable
+		bc.o.DistrolessPaths = paths
+		return nil
+	}
+}
+
+// WithSBOMPackageLabel restricts the apk packages listed in the SBOMs to
+// those with label in the package_labels of the image configuration, e.g.
+// for attestations about only the "security-critical" packages. The image,
+// its layers and the operating system are still described.
+func WithSBOMPackageLabel(label string) Option {
+	return func(bc *Context) error {
+		bc.o.SBOMPackageLabel = label
+		return nil
+	}
+}
+
+// WithSBOMPackagesOnly generates SBOMs describing only the apk packages of
+// the image, and the relationships among them, for consumers of the package
+// inventory. The packages are contained in a synthetic root package rather
+// than in packages describing the image and its layers.
+func WithSBOMPackagesOnly(enable bool) Option {
+	return func(bc *Context) error {
+		bc.o.SBOMPackagesOnly = enable
+		return nil
+	}
+}
+
+// WithSBOMSigningKey signs the SBOMs with the PEM encoded private key at
+// path, writing a detached signature of each next to it, which cosign
+// verify-blob checks against the public key. Keyless signing is not
+// supported.
+func WithSBOMSigningKey(path string) Option {
+	return func(bc *Context) error {
+		bc.o.SBOMSigningKey = path
+		return nil
+	}
+}
+
+// purlTypeRe matches the valid types of purls.
+var purlTypeRe = regexp.MustCompile(`^[a-z.+-][a-z0-9.+-]*$`)
+
+// WithSBOMImagePurl sets the type and namespace of the purls of the image,
+// its index and its layers in the SBOMs, e.g. for images published to
+// registries with their own conventions. An empty type is the default,
+// "oci".
+func WithSBOMImagePurl(typ, namespace string) Option {
+	return func(bc *Context) error {
+		if typ != "" && !purlTypeRe.MatchString(typ) {
+			return wrapError(ErrInvalidConfig, fmt.Errorf("invalid purl type %q", typ))
+		}
+		bc.o.SBOMImagePurlType = typ
+		bc.o.SBOMImagePurlNamespace = namespace
+		return nil
+	}
+}
+
+// WithSBOMLint checks the SBOMs before writing them for the violations of
+// the schema of their format that apko can make: missing required fields,
+// invalid enumeration values, malformed or duplicate identifiers and
+// relationships to unknown elements. It fails the build with the
+// violations found rather than leaving them for downstream validators to
+// reject, but it is not a full validation against the schema.
+func WithSBOMLint(enable bool) Option {
+	return func(bc *Context) error {
+		bc.o.SBOMLint = enable
+		return nil
+	}
+}
+
+// WithSBOMDuplicateVersions sets how packages installed with several
+// versions, which the SBOMs would otherwise list as unrelated entries, are
+// handled: with soptions.DuplicateVersionsAnnotate their entries are
+// annotated with the versions in conflict, with
+// soptions.DuplicateVersionsFail the generation of the SBOMs fails. An empty
+// mode lists them as is.
+func WithSBOMDuplicateVersions(mode string) Option {
+	return func(bc *Context) error {
+		switch mode {
+		case "", soptions.DuplicateVersionsAnnotate, soptions.DuplicateVersionsFail:
+		default:
+			return wrapError(ErrInvalidConfig, fmt.Errorf("invalid duplicate versions mode %q, expected %q or %q", mode, soptions.DuplicateVersionsAnnotate, soptions.DuplicateVersionsFail))
+		}
+		bc.o.SBOMDuplicateVersions = mode
+		return nil
+	}
+}
+
+// WithSBOMPackagePurposes sets the primaryPackagePurpose of the packages of
+// the SBOMs by their type when enabled: CONTAINER for the image,
+// OPERATING_SYSTEM for its layers, and APPLICATION for the apk packages
+// which provide commands or LIBRARY for the others, unless overrides, which
+// maps package names to purposes, sets another one.
+func WithSBOMPackagePurposes(enabled bool, overrides map[string]string) Option {
+	return func(bc *Context) error {
+		for name, purpose := range overrides {
+			if !slices.Contains(soptions.PackagePurposeValues, purpose) {
+				return wrapError(ErrInvalidConfig, fmt.Errorf("invalid purpose %q of package %s, expected one of %s", purpose, name, strings.Join(soptions.PackagePurposeValues, ", ")))
+			}
+		}
+		bc.o.SBOMPackagePurposes = enabled
+		bc.o.SBOMPackagePurposeOverrides = overrides
+		return nil
+	}
+}
+
+// WithSBOMAppPackages adds patterns, as matched by path.Match, of the names
+// of the apk packages of the application, to those in the app_packages of
+// the image configuration. The SBOMs relate the image to them with
+// relationship, by default an OTHER relationship commented
+// APPLICATION_PACKAGE, and to the packages of the operating system base
+// with CONTAINS, so that consumers can tell them apart.
+func WithSBOMAppPackages(patterns []string, relationship string) Option {
+	return func(bc *Context) error {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+				return wrapError(ErrInvalidConfig, fmt.Errorf("invalid application package pattern %q", pattern))
+			}
+		}
+		if relationship != "" && !slices.Contains(soptions.RelationshipTypeValues, relationship) {
+			return wrapError(ErrInvalidConfig, fmt.Errorf("invalid relationship type %q of the application packages, expected one of %s", relationship, strings.Join(soptions.RelationshipTypeValues, ", ")))
+		}
+		bc.o.SBOMAppPackages = patterns
+		bc.o.SBOMAppPackageRelationship = relationship
+		return nil
+	}
+}
+
+// WithSBOMTimestampFormat sets the Go time layout, e.g. time.RFC3339Nano, of
+// the timestamps of the SBOMs, which are always in UTC. An empty layout
+// keeps RFC 3339, e.g. 2023-01-02T03:04:05Z, which SPDX requires.
+func WithSBOMTimestampFormat(layout string) Option {
+	return func(bc *Context) error {
+		// A layout without any element of the time formats to itself.
+		if layout != "" && time.Unix(0, 0).UTC().Format(layout) == layout {
+			return wrapError(ErrInvalidConfig, fmt.Errorf("SBOM timestamp format %q has no time elements", layout))
+		}
+		bc.o.SBOMTimestampFormat = layout
+		return nil
+	}
+}
+
+// WithSBOMEmbedConfig records the image configuration the image is built
+// from, as YAML with its includes resolved, and its digest in an annotation
+// of the SBOMs, so that the build inputs can be recovered from them alone.
+// The credentials in the URLs of the repositories and keys are redacted, as
+// when the configuration is logged, but other secrets, e.g. in environment
+// variables, are not: the option is off by default.
+func WithSBOMEmbedConfig(enable bool) Option {
+	return func(bc *Context) error {
+		bc.o.SBOMEmbedConfig = enable
+		return nil
+	}
+}
+
+// WithSBOMOutputs sets the file names and priorities of the SBOMs, keyed by
+// the key of their generator, see options.SBOMOutput. The SBOMs are written
+// and listed by decreasing priority. The file names are relative to the SBOM
+// directory and must contain options.SBOMArchPlaceholder, so that the SBOMs
+// of the architectures and of the index do not overwrite each other. Two of
+// the SBOM generators in use cannot have the same file names, including the
+// default ones of the formats without a file name, so WithSBOMOutputs must
+// come after WithSBOMGenerators.
+func WithSBOMOutputs(outputs map[string]options.SBOMOutput) Option {
+	return func(bc *Context) error {
+		for key, out := range outputs {
+			if out.FileName == "" {
+				continue
+			}
+			if !strings.Contains(out.FileName, options.SBOMArchPlaceholder) {
+				return wrapError(ErrInvalidConfig, fmt.Errorf("%s SBOM file name %q does not contain %s", key, out.FileName, options.SBOMArchPlaceholder))
+			}
+			if strings.Contains(out.FileName, "/") {
+				return wrapError(ErrInvalidConfig, fmt.Errorf("%s SBOM file name %q is not a file name", key, out.FileName))
+			}
+		}
+
+		// The file names the SBOMs of the generators in use resolve to.
+		o := options.Options{SBOMOutputs: outputs}
+		names := map[string]string{}
+		for _, gen := range bc.o.SBOMGenerators {
+			names[gen.Key()] = o.SBOMFileName(gen, options.SBOMArchPlaceholder)
+		}
+		keys := map[string]string{}
+		for _, key := range slices.Sorted(maps.Keys(names)) {
+			if other, ok := keys[names[key]]; ok {
+				return wrapError(ErrInvalidConfig, fmt.Errorf("%s and %s SBOMs have the same file name %q", other, key, names[key]))
+			}
+			keys[names[key]] = key
+		}
+
+		bc.o.SBOMOutputs = outputs
+		return nil
+	}
+}
+
+// WithSBOMStreaming encodes the packages of the JSON SBOMs to their files one
+// at a time rather than encoding the whole documents in memory first. This
+// only saves the encoded copy of the documents: they are still built whole
+// in memory, so it does not bound the memory used by the generation. The
+// SBOMs are the same, but their content is then not kept, e.g. for
+// annotations.
+func WithSBOMStreaming(enable bool) Option {
+	return func(bc *Context) error {
+		bc.o.SBOMStreaming = enable
+		return nil
+	}
+}
+
+// WithSBOMIndexSignatures records, as an annotation on each apk package in
+// the SBOMs, whether the signature of the apk index the package was
+// resolved from was verified when the index was fetched. The packages
+// without an SBOM of their own are described from their metadata to be
+// annotated. Packages installed from a lockfile are not annotated.
+func WithSBOMIndexSignatures(enable bool) Option {
+	return func(bc *Context) error {
+		bc.o.SBOMIndexSignatures = enable
+		return nil
+	}
+}
+
+// WithPruneEmptyDirs removes the directories which are empty once the image
+// filesystem is built, except for those in DefaultPruneKeepDirs, the account
+// home directories and the directories listed in keep.
+func WithPruneEmptyDirs(enable bool, keep ...string) Option {
+	return func(bc *Context) error {
+		bc.o.PruneEmptyDirs = enable
+		bc.o.PruneKeepDirs = keep
+		return nil
+	}
+}
+
+// WithCanonicalApkDB sorts the entries of /lib/apk/db/installed by package
+// name as soon as the packages are installed, so that builds of the same
+// package set produce the same database regardless of install order.
+func WithCanonicalApkDB(enable bool) Option {
+	return func(bc *Context) error {
+		bc.o.CanonicalApkDB = enable
+		return nil
+	}
+}
+
+// WithFileCapabilities sets capabilities on files of the image, keyed by
+// absolute path, in the setcap(8) notation, e.g. "cap_net_bind_service+ep",
+// as an alternative to setuid binaries. The files must be regular files
+// installed by the packages.
+func WithFileCapabilities(capabilities map[string]string) Option {
+	return func(bc *Context) error {
+		for p, caps := range capabilities {
+			if !path.IsAbs(p) {
+				return wrapError(ErrInvalidConfig, fmt.Errorf("file capabilities path %q is not absolute", p))
+			}
+			if _, err := encodeCapabilities(caps); err != nil {
+				return wrapError(ErrInvalidConfig, err)
+			}
+		}
+		bc.o.FileCapabilities = capabilities
+		return nil
+	}
+}
+
+// WithStandardDirs creates the directories in dirs when the image lacks them
+// and sets their ownership and permissions, e.g. those of
+// DefaultStandardDirs, before the path mutations of the image configuration
+// are applied, so that a "permissions" path mutation of the same directory
+// overrides them. No directories are set up by default.
+func WithStandardDirs(dirs []types.PathMutation) Option {
+	return func(bc *Context) error {
+		for _, dir := range dirs {
+			if !path.IsAbs(dir.Path) {
+				return wrapError(ErrInvalidConfig, fmt.Errorf("standard directory %q is not an absolute path", dir.Path))
+			}
+		}
+		bc.o.StandardDirs = dirs
+		return nil
+	}
+}
+
+// WithVerifyDependencies enables checking, once the packages are installed
+// and those listed in remove_packages removed, that every runtime dependency
+// of the installed packages is satisfied by another installed package.
+// Resolution should guarantee it, but pinned packages can still yield a
+// broken set, which fails the build.
+func WithVerifyDependencies(enable bool) Option {
+	return func(bc *Context) error {
+		bc.o.VerifyDependencies = enable
+		return nil
+	}
+}
+
+// WithForceRemovePackages removes the packages listed in remove_packages even
+// if remaining packages depend on them, which otherwise fails the build.
+func WithForceRemovePackages(force bool) Option {
+	return func(bc *Context) error {
+		bc.o.ForceRemovePackages = force
+		return nil
+	}
+}
+
+// WithRequireLicenses fails the build, once the packages are resolved, if
+// any of them has an empty or NOASSERTION license, listing them all, with an
+// ErrPolicy error. The packages named in exceptions are known exceptions and
+// not checked.
+func WithRequireLicenses(enable bool, exceptions []string) Option {
+	return func(bc *Context) error {
+		bc.o.RequireLicenses = enable
+		bc.o.LicenseExceptions = exceptions
+		return nil
+	}
+}
+
+// WithPackageMtimes sets the mtime of each file in the layers to the build
+// date of the package owning it, taken from the installed database, which
+// is as reproducible as a single SourceDateEpoch but more meaningful. The
+// files no package owns, e.g. those apko generates, get the SourceDateEpoch.
+func WithPackageMtimes(enable bool) Option {
+	return func(bc *Context) error {
+		bc.o.PackageMtimes = enable
+		return nil
+	}
+}
+
+// WithBrokenSymlinks checks the image filesystem for symlinks whose target
+// does not exist in the image, which usually means that a package is
+// missing, or whose relative target climbs out of the image. With
+// BrokenSymlinksWarn they are logged, with BrokenSymlinksFail the build
+// fails. An empty mode disables the check.
+func WithBrokenSymlinks(mode string) Option {
+	return func(bc *Context) error {
+		switch mode {
+		case "", BrokenSymlinksWarn, BrokenSymlinksFail:
+		default:
+			return wrapError(ErrInvalidConfig, fmt.Errorf("invalid broken symlinks mode %q, expected %q or %q", mode, BrokenSymlinksWarn, BrokenSymlinksFail))
+		}
+		bc.o.BrokenSymlinks = mode
+		return nil
+	}
+}
+
+// WithBuildTimeout bounds the duration of the whole build, from the creation
+// of the Context: BuildImage, BuildLayer and BuildLayers fail with an error
+// wrapping context.DeadlineExceeded once it has elapsed. Callers writing or
+// publishing an index of the images afterwards can bound it too with
+// WithTimeout. Zero means no timeout.
+func WithBuildTimeout(timeout time.Duration) Option {
+	return func(bc *Context) error {
+		if timeout < 0 {
+			return wrapError(ErrInvalidConfig, fmt.Errorf("build timeout must not be negative, got %s", timeout))
+		}
+		bc.o.BuildTimeout = timeout
+		return nil
+	}
+}
+
+// WithSourceInfo records the repository URL and commit the image
+// configuration was built from in the image SBOMs.
+func WithSourceInfo(repository, commit string) Option {
+	return func(bc *Context) error {
+		bc.o.SourceRepository = repository
+		bc.o.SourceCommit = commit
+		return nil
+	}
+}
+
+// WithFileOwnershipCheck enables checking, before anything is installed,
+// whether more than one package provides the same file. Conflicts that apk
+// resolves, through replaces or because the packages share an origin, are
+// logged, any others fail the build.
+func WithFileOwnershipCheck(enable bool) Option {
+	return func(bc *Context) error {
+		bc.o.CheckFileOwnership = enable
+		return nil
+	}
+}
+
+// WithConfigHistory records the configuration-only settings of the image,
+// such as its environment and labels, as empty_layer history entries.
+func WithConfigHistory(enable bool) Option {
+	return func(bc *Context) error {
+		bc.o.ConfigHistory = enable
+		return nil
+	}
+}
+
+// WithReproducibilityManifest builds a manifest listing the inputs of the
+// build (repositories, installed packages, SOURCE_DATE_EPOCH, apko version
+// and configuration digest), returned by Context.ReproducibilityManifest.
+// The manifests of the architectures of an image are combined with Merge,
+// written with WriteFile, e.g. next to the SBOMs, and their digest recorded
+// in the index SBOM with WithReproducibilityManifestDigest.
+func WithReproducibilityManifest(enable bool) Option {
+	return func(bc *Context) error {
+		bc.o.ReproducibilityManifest = enable
+		return nil
+	}
+}
+
+// WithReproducibilityManifestDigest records the digest of the
+// reproducibility manifest in the index SBOM.
+func WithReproducibilityManifestDigest(digest string) Option {
+	return func(bc *Context) error {
+		bc.o.ReproducibilityManifestDigest = digest
+		return nil
+	}
+}
+
 func WithExtraKeys(keys []string) Option {
 	return func(bc *Context) error {
 		bc.o.ExtraKeyFiles = keys
@@ -219,6 +868,29 @@ func WithLockFile(lockFile string) Option {
 	}
 }
 
+// WithResolvedPackages installs exactly pkgs, in the given order, e.g. as
+// returned by BuildPackageList for a previous build, rather than resolving
+// the packages of the image configuration, so that a resolution can be
+// cached and built from several times. The set is checked for consistency
+// before anything is installed.
+func WithResolvedPackages(pkgs []*apk.RepositoryPackage) Option {
+	return func(bc *Context) error {
+		bc.o.ResolvedPackages = pkgs
+		return nil
+	}
+}
+
+// WithPermissionsSummary counts the setuid, setgid, world-writable and
+// executable files of the image once it is built, see PermissionsSummary.
+// Only the files that end up in the layers are counted, so paths left out
+// by WithDistroless are not.
+func WithPermissionsSummary(enable bool) Option {
+	return func(bc *Context) error {
+		bc.o.PermissionsSummary = enable
+		return nil
+	}
+}
+
 func WithTempDir(tmp string) Option {
 	return func(bc *Context) error {
 		bc.o.TempDirPath = tmp
@@ -226,6 +898,15 @@ func WithTempDir(tmp string) Option {
 	}
 }
 
+// WithKeepTempDir keeps the temporary and working directories of the build
+// for debugging, rather than have Cleanup or a failed build remove them.
+func WithKeepTempDir(keep bool) Option {
+	return func(bc *Context) error {
+		bc.o.KeepTempDir = keep
+		return nil
+	}
+}
+
 func WithAuthenticator(a auth.Authenticator) Option {
 	return func(bc *Context) error {
 		bc.o.Auth = a
@@ -259,6 +940,16 @@ func WithPackageGetter(pg apk.PackageGetter) Option {
 	}
 }
 
+// WithFilesystemFactory sets the function creating the filesystem the image
+// is built in, when New is given a nil filesystem and for each architecture
+// of NewMultiArch. By default, an in-memory tarfs is used.
+func WithFilesystemFactory(newFS func() apkfs.FullFS) Option {
+	return func(bc *Context) error {
+		bc.o.NewFilesystem = newFS
+		return nil
+	}
+}
+
 // WithSizeLimits sets the size limits for various operations.
 func WithSizeLimits(limits options.SizeLimits) Option {
 	return func(bc *Context) error {
@@ -266,3 +957,75 @@ func WithSizeLimits(limits options.SizeLimits) Option {
 		return nil
 	}
 }
+
+// WithCompressionConcurrency sets the maximum number of layers of a layered
+// image compressed at once. Zero, the default, picks a limit based on
+// GOMAXPROCS, as each layer is itself compressed with several goroutines.
+func WithCompressionConcurrency(n int) Option {
+	return func(bc *Context) error {
+		if n < 0 {
+			return wrapError(ErrInvalidConfig, fmt.Errorf("compression concurrency must not be negative, got %d", n))
+		}
+		bc.o.CompressionConcurrency = n
+		return nil
+	}
+}
+
+// WithStalePins enables checking, when the packages are resolved, for the
+// packages the image configuration pins to a version older than the newest
+// one available in the repositories. They are logged, and returned by
+// StalePins; the build does not fail.
+func WithStalePins(enable bool) Option {
+	return func(bc *Context) error {
+		bc.o.StalePins = enable
+		return nil
+	}
+}
+
+// WithMaxLayerSize fails the build with a LayerSizeError when the total
+// size, in bytes, of the layers of the image, compressed or not, is over
+// size. Zero, the default, sets no maximum.
+func WithMaxLayerSize(size int64, compressed bool) Option {
+	return func(bc *Context) error {
+		if size < 0 {
+			return wrapError(ErrInvalidConfig, fmt.Errorf("maximum layer size must not be negative, got %d", size))
+		}
+		bc.o.MaxLayerSize = size
+		bc.o.MaxLayerSizeCompressed = compressed
+		return nil
+	}
+}
+
+// WithSBOMConcurrency sets the maximum number of SBOMs of an image, one per
+// format, generated at once. Zero, the default, picks GOMAXPROCS.
+func WithSBOMConcurrency(n int) Option {
+	return func(bc *Context) error {
+		if n < 0 {
+			return wrapError(ErrInvalidConfig, fmt.Errorf("SBOM concurrency must not be negative, got %d", n))
+		}
+		bc.o.SBOMConcurrency = n
+		return nil
+	}
+}
+
+// WithDisableHTTP2 restricts the requests to the apk repositories to
+// HTTP/1.1, for proxies which mishandle HTTP/2. The transport, if one is set
+// with WithTransport, must then be an *http.Transport.
+func WithDisableHTTP2(disable bool) Option {
+	return func(bc *Context) error {
+		bc.o.DisableHTTP2 = disable
+		return nil
+	}
+}
+
+// WithFetchConcurrency sets the maximum number of packages fetched and
+// expanded at once. Zero, the default, uses GOMAXPROCS.
+func WithFetchConcurrency(n int) Option {
+	return func(bc *Context) error {
+		if n < 0 {
+			return wrapError(ErrInvalidConfig, fmt.Errorf("fetch concurrency must not be negative, got %d", n))
+		}
+		bc.o.FetchConcurrency = n
+		return nil
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/options"
+	"chainguard.dev/apko/pkg/sbom/generator/spdx"
+)
+
+func TestOptionValidation(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts []Option
+		// wantErr is a part of the expected ErrInvalidConfig error, or
+		// empty if the options are valid.
+		wantErr string
+		// check, if set, checks the options once applied.
+		check func(t *testing.T, o *options.Options)
+	}{{
+		name: "sbom comment",
+		opts: []Option{WithSBOMComment("nightly build ✓")},
+		check: func(t *testing.T, o *options.Options) {
+			require.Equal(t, "nightly build ✓", o.SBOMComment)
+		},
+	}, {
+		name:    "sbom comment invalid utf-8",
+		opts:    []Option{WithSBOMComment("nightly \xff build")},
+		wantErr: "not valid UTF-8",
+	}, {
+		name:    "sbom comment too long",
+		opts:    []Option{WithSBOMComment(strings.Repeat("a", MaxSBOMCommentLength+1))},
+		wantErr: "the maximum is 4096",
+	}, {
+		name: "license list version",
+		opts: []Option{WithSBOMLicenseListVersion("3.16")},
+		check: func(t *testing.T, o *options.Options) {
+			require.Equal(t, "3.16", o.SBOMLicenseListVersion)
+		},
+	}, {
+		name: "license list version default",
+		opts: []Option{WithSBOMLicenseListVersion("")},
+	}, {
+		name:    "license list version without minor",
+		opts:    []Option{WithSBOMLicenseListVersion("3")},
+		wantErr: `invalid SPDX license list version "3"`,
+	}, {
+		name:    "license list version with prefix",
+		opts:    []Option{WithSBOMLicenseListVersion("v3.27")},
+		wantErr: `invalid SPDX license list version "v3.27"`,
+	}, {
+		name:    "license list version with patch",
+		opts:    []Option{WithSBOMLicenseListVersion("3.27.0")},
+		wantErr: `invalid SPDX license list version "3.27.0"`,
+	}, {
+		name: "normalize licenses",
+		opts: []Option{WithSBOMNormalizeLicenses(true)},
+		check: func(t *testing.T, o *options.Options) {
+			require.True(t, o.SBOMNormalizeLicenses)
+		},
+	}, {
+		name:    "tag with uppercase repository",
+		opts:    []Option{WithTags("cgr.dev/chainguard/static:latest", "registry.example.com/Image:latest")},
+		wantErr: "registry.example.com/Image:latest",
+	}, {
+		name:    "tag with space",
+		opts:    []Option{WithTags("image:bad tag")},
+		wantErr: "image:bad tag",
+	}, {
+		name:    "tag too long",
+		opts:    []Option{WithTags("image:" + strings.Repeat("a", 129))},
+		wantErr: "image:" + strings.Repeat("a", 129),
+	}, {
+		name:    "digest",
+		opts:    []Option{WithTags("cgr.dev/chainguard/static@sha256:" + strings.Repeat("0123456789", 6) + "0123")},
+		wantErr: "expected a tag, not a digest",
+	}, {
+		name: "package name template",
+		opts: []Option{WithSBOMPackageNameTemplate("{name}-{arch}")},
+	}, {
+		name:    "package name template unknown placeholder",
+		opts:    []Option{WithSBOMPackageNameTemplate("{name}-{epoch}")},
+		wantErr: "{epoch}",
+	}, {
+		name: "package purposes",
+		opts: []Option{WithSBOMPackagePurposes(true, map[string]string{"busybox": "APPLICATION"})},
+		check: func(t *testing.T, o *options.Options) {
+			require.True(t, o.SBOMPackagePurposes)
+		},
+	}, {
+		name:    "package purposes lowercase",
+		opts:    []Option{WithSBOMPackagePurposes(true, map[string]string{"busybox": "application"})},
+		wantErr: `invalid purpose "application" of package busybox`,
+	}, {
+		name: "timestamp format",
+		opts: []Option{WithSBOMTimestampFormat(time.RFC3339Nano)},
+		check: func(t *testing.T, o *options.Options) {
+			require.Equal(t, time.RFC3339Nano, o.SBOMTimestampFormat)
+		},
+	}, {
+		name:    "timestamp format without time",
+		opts:    []Option{WithSBOMTimestampFormat("iso8601")},
+		wantErr: `SBOM timestamp format "iso8601" has no time elements`,
+	}, {
+		name:    "app packages pattern",
+		opts:    []Option{WithSBOMAppPackages([]string{"myapp-[*"}, "")},
+		wantErr: `invalid application package pattern "myapp-[*"`,
+	}, {
+		name:    "app packages relationship",
+		opts:    []Option{WithSBOMAppPackages([]string{"myapp-*"}, "USES")},
+		wantErr: `invalid relationship type "USES"`,
+	}, {
+		name:    "sbom concurrency",
+		opts:    []Option{WithSBOMConcurrency(-1)},
+		wantErr: "SBOM concurrency must not be negative",
+	}, {
+		name:    "sbom file name without arch",
+		opts:    []Option{WithSBOMOutputs(map[string]options.SBOMOutput{"spdx": {FileName: "sbom.spdx.json"}})},
+		wantErr: `spdx SBOM file name "sbom.spdx.json" does not contain {arch}`,
+	}, {
+		name:    "sbom file name with directory",
+		opts:    []Option{WithSBOMOutputs(map[string]options.SBOMOutput{"spdx": {FileName: "sboms/{arch}.spdx.json"}})},
+		wantErr: `spdx SBOM file name "sboms/{arch}.spdx.json" is not a file name`,
+	}, {
+		name: "sbom file names clash",
+		opts: []Option{
+			WithSBOMGenerators(spdx.New(), spdx.NewTagValue()),
+			WithSBOMOutputs(map[string]options.SBOMOutput{
+				"spdx":    {FileName: "{arch}.sbom"},
+				"spdx-tv": {FileName: "{arch}.sbom"},
+			}),
+		},
+		wantErr: `spdx and spdx-tv SBOMs have the same file name "{arch}.sbom"`,
+	}, {
+		name: "sbom file name clashes with a default one",
+		opts: []Option{
+			WithSBOMGenerators(spdx.New(), spdx.NewTagValue()),
+			WithSBOMOutputs(map[string]options.SBOMOutput{"spdx-tv": {FileName: "sbom-{arch}.spdx.json"}}),
+		},
+		wantErr: `spdx and spdx-tv SBOMs have the same file name "sbom-{arch}.spdx.json"`,
+	}, {
+		// Formats not in use don't clash.
+		name: "sbom file name clashes with a format not in use",
+		opts: []Option{
+			WithSBOMGenerators(spdx.NewTagValue()),
+			WithSBOMOutputs(map[string]options.SBOMOutput{"spdx-tv": {FileName: "sbom-{arch}.spdx.json"}}),
+		},
+	}, {
+		name:    "max layer size",
+		opts:    []Option{WithMaxLayerSize(-1, false)},
+		wantErr: "maximum layer size must not be negative",
+	}, {
+		name:    "broken symlinks mode",
+		opts:    []Option{WithBrokenSymlinks("ignore")},
+		wantErr: `invalid broken symlinks mode "ignore"`,
+	}, {
+		name:    "standard dirs",
+		opts:    []Option{WithStandardDirs([]types.PathMutation{{Path: "tmp", Type: "permissions"}})},
+		wantErr: `standard directory "tmp" is not an absolute path`,
+	}, {
+		name:    "apk database root",
+		opts:    []Option{WithApkDBRoot("/")},
+		wantErr: `invalid apk database root "/"`,
+	}, {
+		name:    "relative apk database root",
+		opts:    []Option{WithApkDBRoot("../state")},
+		wantErr: `invalid apk database root "../state"`,
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			o, _, err := NewOptions(tc.opts...)
+			if tc.wantErr != "" {
+				require.ErrorIs(t, err, ErrInvalidConfig)
+				require.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			if tc.check != nil {
+				tc.check(t, o)
+			}
+		})
+	}
+}
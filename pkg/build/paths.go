@@ -40,10 +40,27 @@ func mutatePermissions(fsys apkfs.FullFS, o *options.Options, mut types.PathMuta
 	return mutatePermissionsDirect(fsys, mut.Path, mut.Permissions, mut.UID, mut.GID)
 }
 
+// fileMode converts unix permission bits, as used in path mutations, to an
+// fs.FileMode, mapping the setuid, setgid and sticky bits to their fs.FileMode
+// counterparts.
+func fileMode(perms uint32) fs.FileMode {
+	mode := fs.FileMode(perms) & fs.ModePerm
+	if perms&0o4000 != 0 {
+		mode |= fs.ModeSetuid
+	}
+	if perms&0o2000 != 0 {
+		mode |= fs.ModeSetgid
+	}
+	if perms&0o1000 != 0 {
+		mode |= fs.ModeSticky
+	}
+	return mode
+}
+
 func mutatePermissionsDirect(fsys apkfs.FullFS, path string, perms, uid, gid uint32) error {
 	target := path
 
-	if err := fsys.Chmod(target, fs.FileMode(perms)); err != nil {
+	if err := fsys.Chmod(target, fileMode(perms)); err != nil {
 		return fmt.Errorf("chmod %q: %w", target, err)
 	}
 	if err := fsys.Chown(target, int(uid), int(gid)); err != nil {
@@ -53,7 +70,7 @@ func mutatePermissionsDirect(fsys apkfs.FullFS, path string, perms, uid, gid uin
 }
 
 func mutateDirectory(fsys apkfs.FullFS, o *options.Options, mut types.PathMutation) error {
-	perms := fs.FileMode(mut.Permissions)
+	perms := fileMode(mut.Permissions)
 
 	if err := fsys.MkdirAll(mut.Path, perms); err != nil {
 		return err
@@ -129,7 +146,9 @@ func mutateSymLink(fsys apkfs.FullFS, o *options.Options, mut types.PathMutation
 	return nil
 }
 
-func mutatePaths(fsys apkfs.FullFS, o *options.Options, ic *types.ImageConfiguration) error {
+// mutatePaths applies the path mutations of ic and records them in report,
+// which may be nil.
+func mutatePaths(fsys apkfs.FullFS, o *options.Options, ic *types.ImageConfiguration, report *MutationReport) error {
 	for _, mut := range ic.Paths {
 		pm, ok := pathMutators[mut.Type]
 		if !ok {
@@ -148,6 +167,8 @@ func mutatePaths(fsys apkfs.FullFS, o *options.Options, ic *types.ImageConfigura
 				return fmt.Errorf("%s mutation on %s: %w", mut.Type, mut.Path, err)
 			}
 		}
+
+		report.addPath(mut, MutationOriginPaths)
 	}
 
 	return nil
@@ -0,0 +1,76 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"fmt"
+	"io/fs"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+)
+
+// PermissionsSummary counts the regular files of the image filesystem by
+// permissions, to track the hardening of images over time. A file may be
+// counted in several categories.
+type PermissionsSummary struct {
+	// Files is the number of regular files.
+	Files int `json:"files"`
+	// Setuid and Setgid are the number of files with the setuid and setgid
+	// bits.
+	Setuid int `json:"setuid"`
+	Setgid int `json:"setgid"`
+	// WorldWritable is the number of files anyone can write to.
+	WorldWritable int `json:"worldWritable"`
+	// Executable is the number of files anyone, their owner or their group
+	// can execute.
+	Executable int `json:"executable"`
+}
+
+// summarizePermissions returns the PermissionsSummary of fsys, in a single
+// walk of it.
+func summarizePermissions(fsys apkfs.FullFS) (*PermissionsSummary, error) {
+	summary := &PermissionsSummary{}
+	err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		mode := info.Mode()
+		summary.Files++
+		if mode&fs.ModeSetuid != 0 {
+			summary.Setuid++
+		}
+		if mode&fs.ModeSetgid != 0 {
+			summary.Setgid++
+		}
+		if mode.Perm()&0o002 != 0 {
+			summary.WorldWritable++
+		}
+		if mode.Perm()&0o111 != 0 {
+			summary.Executable++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("summarizing permissions: %w", err)
+	}
+	return summary, nil
+}
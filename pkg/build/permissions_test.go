@@ -0,0 +1,78 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"io/fs"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+)
+
+func TestSummarizePermissions(t *testing.T) {
+	fsys := apkfs.NewMemFS()
+	require.NoError(t, fsys.MkdirAll("usr/bin", 0o755))
+	require.NoError(t, fsys.MkdirAll("tmp", 0o777|fs.ModeSticky))
+	for path, mode := range map[string]fs.FileMode{
+		"usr/bin/su":      0o755 | fs.ModeSetuid,
+		"usr/bin/wall":    0o755 | fs.ModeSetgid,
+		"usr/bin/sudo":    0o750 | fs.ModeSetuid | fs.ModeSetgid,
+		"usr/bin/app":     0o700,
+		"etc-shared":      0o666,
+		"etc-config":      0o644,
+		"tmp/world-exec":  0o777,
+		"tmp/not-exec-ww": 0o602,
+	} {
+		require.NoError(t, fsys.WriteFile(path, []byte(path), 0o644))
+		require.NoError(t, fsys.Chmod(path, mode))
+	}
+	// Links and directories are not counted, whatever their permissions.
+	require.NoError(t, fsys.Symlink("su", "usr/bin/link"))
+
+	summary, err := summarizePermissions(fsys)
+	require.NoError(t, err)
+	require.Equal(t, &PermissionsSummary{
+		Files:         8,
+		Setuid:        2,
+		Setgid:        2,
+		WorldWritable: 3,
+		Executable:    5,
+	}, summary)
+}
+
+func TestPermissionsSummary(t *testing.T) {
+	require.Nil(t, buildTestImage(t, nil).PermissionsSummary())
+
+	summary := buildTestImage(t, nil, WithPermissionsSummary(true)).PermissionsSummary()
+	require.NotNil(t, summary)
+	require.NotZero(t, summary.Files)
+	require.Zero(t, summary.Setuid)
+
+	// Files that distroless mode leaves out of the layers are not counted.
+	for _, distroless := range []bool{false, true} {
+		fsys := apkfs.NewMemFS()
+		require.NoError(t, fsys.MkdirAll("sbin", 0o755))
+		require.NoError(t, fsys.WriteFile("sbin/apk", []byte("apk"), 0o755))
+		require.NoError(t, fsys.Chmod("sbin/apk", 0o755|fs.ModeSetuid))
+		bc := buildTestImage(t, fsys, WithDistroless(distroless, nil), WithPermissionsSummary(true))
+		want := 1
+		if distroless {
+			want = 0
+		}
+		require.Equal(t, want, bc.PermissionsSummary().Setuid, "distroless=%t", distroless)
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+const profileDir = "etc/profile.d"
+
+// writeProfileSnippets writes each snippet to /etc/profile.d/<name>.sh,
+// replacing any file a package installed there. The snippets are sourced,
+// not executed, so they are not made executable.
+func writeProfileSnippets(fsys apkfs.FullFS, snippets []types.ProfileSnippet) error {
+	if len(snippets) == 0 {
+		return nil
+	}
+
+	if err := fsys.MkdirAll(profileDir, 0o755); err != nil {
+		return fmt.Errorf("creating /%s: %w", profileDir, err)
+	}
+
+	for _, snippet := range snippets {
+		p := path.Join(profileDir, snippet.Name+".sh")
+		content := snippet.Content
+		if content != "" && !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+		if err := fsys.WriteFile(p, []byte(content), 0o644); err != nil {
+			return fmt.Errorf("writing /%s: %w", p, err)
+		}
+		// WriteFile does not change the mode of an existing file.
+		if err := fsys.Chmod(p, 0o644); err != nil {
+			return fmt.Errorf("chmod /%s: %w", p, err)
+		}
+		if err := fsys.Chown(p, 0, 0); err != nil {
+			return fmt.Errorf("chowning /%s: %w", p, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"archive/tar"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func Test_writeProfileSnippets(t *testing.T) {
+	fsys := apkfs.NewMemFS()
+	// A package provided snippet, which is replaced.
+	require.NoError(t, fsys.MkdirAll("etc/profile.d", 0o755))
+	require.NoError(t, fsys.WriteFile("etc/profile.d/java.sh", []byte("export JAVA_HOME=/old\n"), 0o755))
+
+	require.NoError(t, writeProfileSnippets(fsys, []types.ProfileSnippet{
+		{Name: "java", Content: "export JAVA_HOME=/usr/lib/jvm/default-jvm"},
+		{Name: "editor", Content: "export EDITOR=vi\n"},
+	}))
+
+	for name, expected := range map[string]string{
+		"etc/profile.d/java.sh":   "export JAVA_HOME=/usr/lib/jvm/default-jvm\n",
+		"etc/profile.d/editor.sh": "export EDITOR=vi\n",
+	} {
+		b, err := fsys.ReadFile(name)
+		require.NoError(t, err)
+		require.Equal(t, expected, string(b))
+
+		fi, err := fsys.Stat(name)
+		require.NoError(t, err)
+		require.EqualValues(t, 0o644, fi.Mode().Perm(), name)
+		hdr, ok := fi.Sys().(*tar.Header)
+		require.True(t, ok)
+		require.Equal(t, 0, hdr.Uid)
+		require.Equal(t, 0, hdr.Gid)
+	}
+}
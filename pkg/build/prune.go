@@ -0,0 +1,107 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/passwd"
+)
+
+// DefaultPruneKeepDirs are the directories which are kept when pruning empty
+// directories, as they are expected to exist at runtime even when empty.
+var DefaultPruneKeepDirs = []string{
+	"/dev",
+	"/home",
+	"/mnt",
+	"/proc",
+	"/root",
+	"/run",
+	"/sys",
+	"/tmp",
+	"/var/empty",
+	"/var/run",
+	"/var/tmp",
+}
+
+// pruneEmptyDirs removes the directories in fsys which are empty, or only
+// contain directories which are pruned, and returns how many were removed.
+//
+// Besides keep, the home directories of the accounts in /etc/passwd and the
+// directories created by the image configuration are kept.
+func pruneEmptyDirs(fsys apkfs.FullFS, ic *types.ImageConfiguration, keep []string) (int, error) {
+	kept := sets.New[string]()
+	addKept := func(p string) {
+		kept.Insert(strings.TrimPrefix(path.Clean("/"+p), "/"))
+	}
+	for _, p := range keep {
+		addKept(p)
+	}
+	if uf, err := passwd.ReadUserFile(fsys, "etc/passwd"); err == nil {
+		for _, ue := range uf.Entries {
+			addKept(ue.HomeDir)
+		}
+	}
+	for _, mut := range ic.Paths {
+		if mut.Type == "directory" {
+			addKept(mut.Path)
+		}
+	}
+	if ic.WorkDir != "" {
+		addKept(ic.WorkDir)
+	}
+
+	var dirs []string
+	if err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && p != "." && !kept.Has(p) {
+			dirs = append(dirs, p)
+		}
+		return nil
+	}); err != nil {
+		return 0, fmt.Errorf("walking filesystem: %w", err)
+	}
+
+	// Visit children before their parents, so that directories which only
+	// contain empty directories are pruned too.
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+
+	pruned := 0
+	for _, dir := range dirs {
+		entries, err := fsys.ReadDir(dir)
+		if err != nil {
+			return pruned, fmt.Errorf("reading %s: %w", dir, err)
+		}
+		if len(entries) != 0 {
+			continue
+		}
+		if err := fsys.Remove(dir); err != nil {
+			return pruned, fmt.Errorf("removing %s: %w", dir, err)
+		}
+		pruned++
+	}
+
+	return pruned, nil
+}
@@ -0,0 +1,66 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func Test_pruneEmptyDirs(t *testing.T) {
+	fsys := apkfs.NewMemFS()
+	for _, dir := range []string{
+		"etc",
+		"tmp",
+		"usr/share/doc/foo",
+		"usr/share/man",
+		"usr/lib/foo/empty",
+		"home/nonroot",
+		"srv/data",
+		"app",
+		"keep/me",
+	} {
+		require.NoError(t, fsys.MkdirAll(dir, 0o755))
+	}
+	require.NoError(t, fsys.WriteFile("usr/lib/foo/lib.so", []byte("lib"), 0o644))
+	require.NoError(t, fsys.WriteFile("etc/passwd", []byte("nonroot:x:65532:65532::/home/nonroot:/bin/sh\n"), 0o644))
+
+	ic := &types.ImageConfiguration{
+		WorkDir: "/app",
+		Paths: []types.PathMutation{{
+			Path: "/srv/data",
+			Type: "directory",
+		}},
+	}
+
+	pruned, err := pruneEmptyDirs(fsys, ic, append(DefaultPruneKeepDirs, "/keep/me"))
+	require.NoError(t, err)
+	// usr/share/doc/foo, usr/share/doc, usr/share/man, usr/share and
+	// usr/lib/foo/empty.
+	require.Equal(t, 5, pruned)
+
+	for _, dir := range []string{"etc", "tmp", "usr/lib/foo", "home/nonroot", "srv/data", "app", "keep/me"} {
+		_, err := fsys.Stat(dir)
+		require.NoError(t, err, dir)
+	}
+	for _, dir := range []string{"usr/share", "usr/lib/foo/empty"} {
+		_, err := fsys.Stat(dir)
+		require.Error(t, err, dir)
+	}
+}
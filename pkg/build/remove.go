@@ -0,0 +1,210 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/chainguard-dev/clog"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+)
+
+// removeContents removes the packages and paths listed in the image
+// configuration once packages are installed, and drops them from the
+// installed database so that they are not listed in the SBOM. It returns
+// the names of the removed packages.
+//
+// The packages are removed with their scripts, triggers and world entries.
+// Removing a package which a remaining package depends on fails, unless
+// forced with WithForceRemovePackages.
+func (bc *Context) removeContents(ctx context.Context) (sets.Set[string], error) {
+	log := clog.FromContext(ctx)
+	removed := sets.New[string]()
+
+	if err := bc.checkRemovedDependencies(ctx); err != nil {
+		return nil, err
+	}
+
+	for _, name := range bc.ic.Contents.RemovePackages {
+		pkg, err := bc.apk.RemoveInstalledPackage(name)
+		if err != nil {
+			return nil, fmt.Errorf("removing package %s: %w", name, err)
+		}
+		if err := removePackageFiles(bc.fs, bc.apk, pkg); err != nil {
+			return nil, fmt.Errorf("removing files of package %s: %w", name, err)
+		}
+		log.Infof("removed package %s", name)
+		removed.Insert(name)
+	}
+
+	if len(removed) != 0 {
+		world, err := bc.apk.GetWorld()
+		if err != nil {
+			return nil, fmt.Errorf("getting world: %w", err)
+		}
+		world = slices.DeleteFunc(world, func(entry string) bool {
+			return removed.Has(apk.ResolvePackageNameVersionPin(entry).Name)
+		})
+		if err := bc.apk.SetWorld(ctx, world); err != nil {
+			return nil, fmt.Errorf("setting world: %w", err)
+		}
+	}
+
+	for _, p := range bc.ic.Contents.RemovePaths {
+		p = strings.TrimPrefix(path.Clean(p), "/")
+		if err := removeAll(bc.fs, p); err != nil {
+			return nil, fmt.Errorf("removing /%s: %w", p, err)
+		}
+		if err := bc.apk.RemoveInstalledFiles(func(name string) bool {
+			return name == p || strings.HasPrefix(name, p+"/")
+		}); err != nil {
+			return nil, fmt.Errorf("removing /%s from the installed database: %w", p, err)
+		}
+	}
+
+	return removed, nil
+}
+
+// checkRemovedDependencies fails if removing the packages listed in the
+// image configuration leaves a dependency of a remaining package
+// unsatisfied, unless the removal is forced, in which case it only warns.
+func (bc *Context) checkRemovedDependencies(ctx context.Context) error {
+	log := clog.FromContext(ctx)
+
+	installed, err := bc.apk.GetInstalled()
+	if err != nil {
+		return fmt.Errorf("getting installed packages: %w", err)
+	}
+	broken := removedDependencies(installed, bc.ic.Contents.RemovePackages)
+	if len(broken) == 0 {
+		return nil
+	}
+	if bc.o.ForceRemovePackages {
+		for _, u := range broken {
+			log.Warnf("removing packages breaks dependency: %s", u)
+		}
+		return nil
+	}
+	for _, u := range broken {
+		log.Errorf("removing packages breaks dependency: %s", u)
+	}
+	return fmt.Errorf("removing packages breaks %d dependencies of the remaining packages, first: %s", len(broken), broken[0])
+}
+
+// removedDependencies returns the dependencies of the installed packages not
+// named in remove which are satisfied with the packages of remove installed
+// but not without them.
+func removedDependencies(installed []*apk.InstalledPackage, remove []string) []unsatisfiedDependency {
+	before := sets.New[unsatisfiedDependency](findUnsatisfiedDependencies(installed)...)
+	kept := slices.DeleteFunc(slices.Clone(installed), func(pkg *apk.InstalledPackage) bool {
+		return slices.Contains(remove, pkg.Name)
+	})
+	return slices.DeleteFunc(findUnsatisfiedDependencies(kept), before.Has)
+}
+
+// removePackageFiles removes the files of pkg which no installed package
+// provides, then its directories which are left empty.
+func removePackageFiles(fsys apkfs.FullFS, a *apk.APK, pkg *apk.InstalledPackage) error {
+	installed, err := a.GetInstalled()
+	if err != nil {
+		return fmt.Errorf("getting installed packages: %w", err)
+	}
+	owned := sets.New[string]()
+	for _, other := range installed {
+		for _, f := range other.Files {
+			owned.Insert(strings.TrimSuffix(f.Name, "/"))
+		}
+	}
+
+	var dirs []string
+	for _, f := range pkg.Files {
+		name := strings.TrimSuffix(f.Name, "/")
+		if name == "" || owned.Has(name) {
+			continue
+		}
+		if f.Typeflag == tar.TypeDir {
+			dirs = append(dirs, name)
+			continue
+		}
+		if err := fsys.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("removing /%s: %w", name, err)
+		}
+	}
+
+	// Remove subdirectories before their parents.
+	sort.Sort(sort.Reverse(sort.StringSlice(dirs)))
+	for _, dir := range dirs {
+		entries, err := fsys.ReadDir(dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("reading /%s: %w", dir, err)
+		}
+		if len(entries) != 0 {
+			continue
+		}
+		if err := fsys.Remove(dir); err != nil {
+			return fmt.Errorf("removing /%s: %w", dir, err)
+		}
+	}
+
+	return nil
+}
+
+// removeAll removes p and, if it is a directory, its contents. It is not an
+// error for p not to exist.
+func removeAll(fsys apkfs.FullFS, p string) error {
+	fi, err := fsys.Lstat(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	paths := []string{p}
+	if fi.IsDir() {
+		if err := fs.WalkDir(fsys, p, func(name string, _ fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if name != p {
+				paths = append(paths, name)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+
+	// Remove the contents of directories before the directories.
+	slices.Reverse(paths)
+	for _, name := range paths {
+		if err := fsys.Remove(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/sbom/generator/spdx"
+)
+
+func TestRemoveContents(t *testing.T) {
+	ic := testConfig(t)
+	ic.Contents.Packages = append(ic.Contents.Packages, "pretend-baselayout")
+	ic.Contents.RemovePackages = []string{"pretend-baselayout"}
+
+	// replayout depends on pretend-baselayout.
+	fsys := apkfs.NewMemFS()
+	bc, img := buildSBOMImage(t, fsys,
+		WithImageConfiguration(ic),
+		WithForceRemovePackages(true),
+		WithSBOMGenerators(spdx.New()),
+	)
+
+	// The files of the package are gone, except those provided by
+	// replayout too.
+	_, err := fsys.Stat("var/lib/db/sbom/pretend-baselayout-1.0.0-r0.spdx.json")
+	require.ErrorIs(t, err, os.ErrNotExist)
+	_, err = fsys.Stat("etc/os-release")
+	require.NoError(t, err)
+
+	installed, err := bc.InstalledPackages()
+	require.NoError(t, err)
+	require.Len(t, installed, 1)
+	require.Equal(t, "replayout", installed[0].Name)
+
+	// The package is no longer in the world.
+	world, err := fsys.ReadFile("etc/apk/world")
+	require.NoError(t, err)
+	require.Equal(t, "replayout\n", string(world))
+
+	names := sbomPackageNames(imageSBOM(t, bc, img))
+	require.Contains(t, names, "replayout")
+	require.NotContains(t, names, "pretend-baselayout")
+}
+
+func TestRemovePaths(t *testing.T) {
+	ic := testConfig(t)
+	ic.Contents.RemovePaths = []string{"/var/lib/db"}
+
+	fsys := apkfs.NewMemFS()
+	bc := buildTestImage(t, fsys, WithImageConfiguration(ic))
+
+	_, err := fsys.Stat("var/lib/db")
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	installed, err := bc.InstalledPackages()
+	require.NoError(t, err)
+	require.Len(t, installed, 2)
+	for _, pkg := range installed {
+		for _, f := range pkg.Files {
+			require.False(t, strings.HasPrefix(f.Name, "var/lib/db"), "%s still lists %s", pkg.Name, f.Name)
+		}
+	}
+}
+
+func TestVerifyDependenciesRemovePackages(t *testing.T) {
+	dir := t.TempDir()
+	foo := writeTestAPK(t, dir, &apk.Package{Name: "foo", Origin: "foo", Dependencies: []string{"bar"}}, map[string]string{"usr/share/foo": "foo"})
+	bar := writeTestAPK(t, dir, &apk.Package{Name: "bar", Origin: "bar"}, map[string]string{"usr/share/bar": "bar"})
+	baz := writeTestAPK(t, dir, &apk.Package{Name: "baz", Origin: "baz"}, map[string]string{"usr/share/baz": "baz"})
+
+	buildImage := func(force bool, remove ...string) error {
+		ic := repoConfig(dir)
+		ic.Contents.RemovePackages = remove
+		bc := newRepoContext(t, ic, []*apk.RepositoryPackage{foo, bar, baz},
+			WithVerifyDependencies(true),
+			WithForceRemovePackages(force),
+		)
+		return bc.BuildImage(t.Context())
+	}
+
+	require.NoError(t, buildImage(false))
+	require.NoError(t, buildImage(false, "baz"))
+	require.NoError(t, buildImage(false, "foo", "bar"))
+
+	// Removing a package that a remaining one depends on fails...
+	err := buildImage(false, "bar")
+	require.ErrorIs(t, err, ErrInstall)
+	require.ErrorContains(t, err, "removing packages breaks 1 dependencies of the remaining packages, first: foo depends on bar")
+
+	// ... and when forced, the broken dependency is still reported by the
+	// dependency check.
+	err = buildImage(true, "bar")
+	require.ErrorIs(t, err, ErrInstall)
+	require.ErrorContains(t, err, "1 unsatisfied dependencies, first: foo depends on bar")
+}
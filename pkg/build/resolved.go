@@ -0,0 +1,145 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/chainguard-dev/clog"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+)
+
+// validateResolvedPackages checks that pkgs, a pre-resolved package set, is
+// consistent on its own for arch, the apk architecture of the build: each
+// package is for arch, or noarch, and is there once, its dependencies are
+// satisfied by the set, and none of the packages it conflicts with is in it.
+func validateResolvedPackages(pkgs []*apk.RepositoryPackage, arch string) error {
+	versions := make(map[string][]string, len(pkgs))
+	installed := make([]*apk.InstalledPackage, 0, len(pkgs))
+	for _, pkg := range pkgs {
+		if pkg == nil || pkg.Package == nil || pkg.Name == "" {
+			return fmt.Errorf("resolved package has no name")
+		}
+		if _, ok := versions[pkg.Name]; ok {
+			return fmt.Errorf("resolved package %s is listed more than once", pkg.Name)
+		}
+		versions[pkg.Name] = []string{pkg.Version}
+		if pkg.Arch != arch && pkg.Arch != "noarch" {
+			return fmt.Errorf("resolved package %s-%s is for %s, not %s", pkg.Name, pkg.Version, pkg.Arch, arch)
+		}
+		installed = append(installed, &apk.InstalledPackage{Package: *pkg.Package})
+	}
+
+	for _, pkg := range pkgs {
+		for _, dep := range pkg.Dependencies {
+			conflict, ok := strings.CutPrefix(dep, "!")
+			if !ok {
+				continue
+			}
+			if dependencySatisfied(apk.ResolvePackageNameVersionPin(conflict), versions) {
+				return fmt.Errorf("resolved package %s conflicts with %s", pkg.Name, conflict)
+			}
+		}
+	}
+
+	if unsatisfied := findUnsatisfiedDependencies(installed); len(unsatisfied) != 0 {
+		return fmt.Errorf("%d unsatisfied dependencies in the resolved packages, first: %s", len(unsatisfied), unsatisfied[0])
+	}
+	return nil
+}
+
+// installable returns pkgs as packages to install.
+func installable(pkgs []*apk.RepositoryPackage) []apk.InstallablePackage {
+	installable := make([]apk.InstallablePackage, len(pkgs))
+	for i, pkg := range pkgs {
+		installable[i] = pkg
+	}
+	return installable
+}
+
+// checkResolvedPackages runs the checks of the build on pkgs, the packages
+// it installs, whether resolved from the repositories, pre-resolved or
+// from a lockfile, before they are installed from toInstall, and records
+// what the SBOMs report of the indexes they come from. Packages from a
+// lockfile, locked, only have a name, version and architecture: their
+// licenses are checked once installed, and the signatures and digests of
+// their indexes are not known.
+func (bc *Context) checkResolvedPackages(ctx context.Context, pkgs []*apk.RepositoryPackage, toInstall []apk.InstallablePackage, locked bool) error {
+	log := clog.FromContext(ctx)
+
+	if bc.o.StalePins {
+		if err := bc.checkStalePins(ctx, pkgs); err != nil {
+			return wrapError(ErrResolution, err)
+		}
+	}
+
+	if bc.o.RequireLicenses && !locked {
+		resolved := make([]*apk.Package, len(pkgs))
+		for i, pkg := range pkgs {
+			resolved[i] = pkg.Package
+		}
+		if err := checkLicenses(resolved, bc.o.LicenseExceptions); err != nil {
+			return err
+		}
+	}
+
+	if bc.o.CheckFileOwnership {
+		if err := bc.checkFileOwnership(ctx, toInstall); err != nil {
+			return err
+		}
+	}
+
+	if bc.o.SBOMIndexSignatures && bc.WantSBOM() && locked {
+		log.Warnf("the lockfile does not record the indexes of the packages, not recording their signature status")
+	} else if bc.o.SBOMIndexSignatures && bc.WantSBOM() {
+		bc.indexSignatures = make(map[string]bool, len(pkgs))
+		for _, pkg := range pkgs {
+			if pkg.Repository() == nil {
+				log.Warnf("the index of package %s is not known, not recording its signature status", pkg.Name)
+				continue
+			}
+			bc.indexSignatures[pkg.Name] = bc.apk.IndexSignatureVerified(pkg)
+		}
+	}
+
+	// The packages resolved from the repositories record the digests of
+	// all the indexes they are resolved from; the others, of those they
+	// come from.
+	if bc.indexDigests == nil && !locked {
+		bc.indexDigests = packageIndexDigests(pkgs)
+	}
+	if bc.o.SBOMIndexDigests && bc.WantSBOM() && len(bc.indexDigests) == 0 {
+		log.Warnf("the indexes of the packages are not known, not recording their digests")
+	}
+	return nil
+}
+
+// packageIndexDigests returns the digests of the indexes of the
+// repositories pkgs come from, keyed by the URI of the index as returned by
+// apk.IndexDigests. The indexes whose digest is not known are left out.
+func packageIndexDigests(pkgs []*apk.RepositoryPackage) map[string]string {
+	digests := make(map[string]string)
+	for _, pkg := range pkgs {
+		repo := pkg.Repository()
+		if repo == nil || repo.Repository == nil || repo.IndexDigest() == "" {
+			continue
+		}
+		digests[repo.IndexURI()] = repo.IndexDigest()
+	}
+	return digests
+}
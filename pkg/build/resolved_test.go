@@ -0,0 +1,141 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+)
+
+func TestValidateResolvedPackages(t *testing.T) {
+	pkg := func(name, version, arch string, deps ...string) *apk.RepositoryPackage {
+		return apk.NewRepositoryPackage(&apk.Package{Name: name, Version: version, Arch: arch, Dependencies: deps}, nil)
+	}
+	for _, tc := range []struct {
+		name    string
+		pkgs    []*apk.RepositoryPackage
+		wantErr string
+	}{{
+		name: "consistent",
+		pkgs: []*apk.RepositoryPackage{
+			pkg("musl", "1.2-r0", "x86_64"),
+			pkg("ca-certificates-bundle", "1-r0", "noarch"),
+			pkg("app", "1.0-r0", "x86_64", "musl>=1.2", "!busybox"),
+		},
+	}, {
+		name:    "unnamed",
+		pkgs:    []*apk.RepositoryPackage{pkg("", "1.0-r0", "x86_64")},
+		wantErr: "resolved package has no name",
+	}, {
+		name:    "duplicate",
+		pkgs:    []*apk.RepositoryPackage{pkg("musl", "1.2-r0", "x86_64"), pkg("musl", "1.3-r0", "x86_64")},
+		wantErr: "resolved package musl is listed more than once",
+	}, {
+		name:    "other arch",
+		pkgs:    []*apk.RepositoryPackage{pkg("musl", "1.2-r0", "aarch64")},
+		wantErr: "resolved package musl-1.2-r0 is for aarch64, not x86_64",
+	}, {
+		name:    "unsatisfied",
+		pkgs:    []*apk.RepositoryPackage{pkg("musl", "1.1-r0", "x86_64"), pkg("app", "1.0-r0", "x86_64", "musl>=1.2")},
+		wantErr: "1 unsatisfied dependencies in the resolved packages, first: app depends on musl>=1.2",
+	}, {
+		name:    "conflict",
+		pkgs:    []*apk.RepositoryPackage{pkg("busybox", "1.36-r0", "x86_64"), pkg("app", "1.0-r0", "x86_64", "!busybox")},
+		wantErr: "resolved package app conflicts with busybox",
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateResolvedPackages(tc.pkgs, "x86_64")
+			if tc.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.EqualError(t, err, tc.wantErr)
+		})
+	}
+}
+
+func TestBuildImageFromResolvedPackages(t *testing.T) {
+	ctx := t.Context()
+
+	resolved, _, err := newTestContext(t, nil).BuildPackageList(ctx)
+	require.NoError(t, err)
+
+	// The same resolution builds the same packages, any number of times.
+	for range 2 {
+		bc := buildTestImage(t, nil, WithResolvedPackages(resolved))
+
+		installed, err := bc.InstalledPackages()
+		require.NoError(t, err)
+		require.Len(t, installed, 2)
+		require.Equal(t, "pretend-baselayout", installed[0].Name)
+		require.Equal(t, "replayout", installed[1].Name)
+
+		// The digests of the indexes are those the packages come from.
+		require.Len(t, bc.IndexDigests(), 1)
+	}
+
+	// A set missing a dependency is rejected before installing anything.
+	bc := newTestContext(t, nil, WithResolvedPackages(resolved[1:]))
+	require.ErrorIs(t, bc.BuildImage(ctx), ErrInvalidConfig)
+}
+
+func TestFileOwnershipCheck(t *testing.T) {
+	ctx := t.Context()
+	bc := newTestContext(t, nil, WithFileOwnershipCheck(true))
+
+	// replayout and pretend-baselayout both provide /etc/os-release, but
+	// replayout replaces pretend-baselayout.
+	toInstall, _, err := bc.BuildPackageList(ctx)
+	require.NoError(t, err)
+	pkgs := make([]apk.InstallablePackage, len(toInstall))
+	for i, pkg := range toInstall {
+		pkgs[i] = pkg
+	}
+	conflicts, err := bc.APK().FindOwnershipConflicts(ctx, pkgs)
+	require.NoError(t, err)
+	require.Equal(t, []apk.OwnershipConflict{{
+		Path: "etc/os-release",
+		Origins: map[string]string{
+			"pretend-baselayout": "pretend-baselayout",
+			"replayout":          "replayout",
+		},
+		Replaced: true,
+	}}, conflicts)
+
+	// Conflicts resolved through replaces don't fail the build.
+	require.NoError(t, bc.BuildImage(ctx))
+}
+
+func TestFileOwnershipCheckOrigins(t *testing.T) {
+	dir := t.TempDir()
+	foo := writeTestAPK(t, dir, &apk.Package{Name: "foo", Origin: "foo"}, map[string]string{"usr/share/foo": "foo"})
+	fooCompat := writeTestAPK(t, dir, &apk.Package{Name: "foo-compat", Origin: "foo"}, map[string]string{"usr/share/foo": "compat"})
+	bar := writeTestAPK(t, dir, &apk.Package{Name: "bar", Origin: "bar"}, map[string]string{"usr/share/foo": "bar"})
+
+	buildImage := func(pkgs ...*apk.RepositoryPackage) error {
+		bc := newRepoContext(t, repoConfig(dir), pkgs, WithFileOwnershipCheck(true))
+		return bc.BuildImage(t.Context())
+	}
+
+	// apk lets packages built from the same origin overwrite each other.
+	require.NoError(t, buildImage(foo, fooCompat))
+
+	err := buildImage(foo, bar)
+	require.ErrorIs(t, err, ErrPackageConflict)
+	require.ErrorIs(t, err, apk.FileConflictError{})
+}
@@ -21,7 +21,10 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
+	"maps"
 	"path/filepath"
+	"runtime"
+	"slices"
 	"sort"
 	"strings"
 	"time"
@@ -30,14 +33,20 @@ import (
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	ggcrtypes "github.com/google/go-containerregistry/pkg/v1/types"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/errgroup"
+	"gopkg.in/yaml.v3"
 	khash "sigs.k8s.io/release-utils/hash"
 
 	"github.com/chainguard-dev/clog"
 
+	"chainguard.dev/apko/pkg/apk/apk"
 	apkfs "chainguard.dev/apko/pkg/apk/fs"
 	"chainguard.dev/apko/pkg/build/types"
 	"chainguard.dev/apko/pkg/options"
 	"chainguard.dev/apko/pkg/sbom"
+	"chainguard.dev/apko/pkg/sbom/generator"
 	soptions "chainguard.dev/apko/pkg/sbom/options"
 )
 
@@ -45,14 +54,15 @@ func newSBOM(ctx context.Context, fsys apkfs.FullFS, o options.Options, ic types
 	log := clog.FromContext(ctx)
 	sopt := sbom.DefaultOptions
 	sopt.FS = fsys
-	sopt.FileName = fmt.Sprintf("sbom-%s", o.Arch.ToAPK())
 
 	// Parse the image reference
 	if len(o.Tags) > 0 {
-		tag, err := name.NewTag(o.Tags[0])
+		ref, err := types.NormalizeReference(o.Tags[0])
 		if err == nil {
-			sopt.ImageInfo.Tag = tag.TagStr()
-			sopt.ImageInfo.Name = tag.String()
+			if tag, ok := ref.(name.Tag); ok {
+				sopt.ImageInfo.Tag = tag.TagStr()
+			}
+			sopt.ImageInfo.Name = ref.Name()
 		} else {
 			log.Errorf("%s parsing tag %s, ignoring", o.Tags[0], err)
 		}
@@ -60,7 +70,32 @@ func newSBOM(ctx context.Context, fsys apkfs.FullFS, o options.Options, ic types
 
 	sopt.ImageInfo.SourceDateEpoch = bde
 	sopt.ImageInfo.VCSUrl = ic.VCSUrl
+	sopt.ImageInfo.SourceRepository = o.SourceRepository
+	sopt.ImageInfo.SourceCommit = o.SourceCommit
+	sopt.ImageInfo.ReproducibilityManifestDigest = o.ReproducibilityManifestDigest
 	sopt.ImageInfo.ImageMediaType = ggcrtypes.OCIManifestSchema1
+	sopt.ExtraPackages = o.SBOMExtraPackages
+	sopt.Comment = o.SBOMComment
+	sopt.LicenseListVersion = o.SBOMLicenseListVersion
+	sopt.NormalizeLicenses = o.SBOMNormalizeLicenses
+	sopt.PackageNameTemplate = o.SBOMPackageNameTemplate
+	sopt.SplitPackageVersions = o.SBOMSplitVersions
+	sopt.StreamPackages = o.SBOMStreaming
+	sopt.ContentNamespace = o.SBOMContentNamespace
+	sopt.PackageVCS = o.SBOMPackageVCS
+	sopt.PackageVCSURL = o.SBOMPackageVCSURL
+	sopt.PackageLabel = o.SBOMPackageLabel
+	sopt.PackageLabels = ic.Contents.PackageLabels
+	sopt.PackagesOnly = o.SBOMPackagesOnly
+	sopt.ImagePurlType = o.SBOMImagePurlType
+	sopt.ImagePurlNamespace = o.SBOMImagePurlNamespace
+	sopt.Lint = o.SBOMLint
+	sopt.DuplicateVersions = o.SBOMDuplicateVersions
+	sopt.PackagePurposes = o.SBOMPackagePurposes
+	sopt.PackagePurposeOverrides = o.SBOMPackagePurposeOverrides
+	sopt.AppPackages = slices.Concat(ic.Contents.AppPackages, o.SBOMAppPackages)
+	sopt.AppPackageRelationship = o.SBOMAppPackageRelationship
+	sopt.TimestampFormat = o.SBOMTimestampFormat
 
 	sopt.OutputDir = o.TempDir()
 	if o.SBOMPath != "" {
@@ -70,7 +105,9 @@ func newSBOM(ctx context.Context, fsys apkfs.FullFS, o options.Options, ic types
 	return sopt
 }
 
-func (bc *Context) GenerateImageSBOM(ctx context.Context, arch types.Architecture, img v1.Image) ([]types.SBOM, error) {
+func (bc *Context) GenerateImageSBOM(ctx context.Context, arch types.Architecture, img v1.Image) (_ []types.SBOM, err error) {
+	defer func() { err = wrapError(ErrSBOM, err) }()
+
 	log := clog.FromContext(ctx).With("arch", arch.ToAPK())
 	ctx = clog.WithLogger(ctx, log)
 
@@ -94,6 +131,11 @@ func (bc *Context) GenerateImageSBOM(ctx context.Context, arch types.Architectur
 
 	s := newSBOM(ctx, bc.fs, bc.o, bc.ic, bde)
 	log.Debug("Generating image SBOM")
+	if bc.o.SBOMEmbedConfig {
+		if s.Config, err = yaml.Marshal(bc.ic); err != nil {
+			return nil, fmt.Errorf("encoding image configuration: %w", err)
+		}
+	}
 
 	s.ImageInfo.Layers = m.Layers
 
@@ -112,6 +154,18 @@ func (bc *Context) GenerateImageSBOM(ctx context.Context, arch types.Architectur
 	}
 
 	s.Packages = pkgs
+	s.IndexSignatures = bc.indexSignatures
+	s.BusyboxApplets = bc.busyboxApplets
+	if bc.o.SBOMIndexDigests {
+		s.IndexDigests = bc.indexDigests
+	}
+	if bc.o.SBOMRelationshipComments {
+		s.RelationshipComments = packageProvenance(bc.ic.Contents.Packages, pkgs)
+	}
+	if bc.o.SBOMGeneratedFiles {
+		s.GeneratedFiles = bc.generatedFiles
+		s.ConfigFiles = bc.configFiles
+	}
 
 	// Get the image digest
 	h, err := img.Digest()
@@ -120,25 +174,175 @@ func (bc *Context) GenerateImageSBOM(ctx context.Context, arch types.Architectur
 	}
 
 	s.ImageInfo.ImageDigest = h.String()
+
+	ch, err := img.ConfigName()
+	if err != nil {
+		return nil, fmt.Errorf("getting %s image config digest: %w", arch, err)
+	}
+	s.ImageInfo.ConfigDigest = ch.String()
 	s.ImageInfo.Arch = arch
 
-	var sboms = make([]types.SBOM, 0)
-	for _, gen := range bc.o.SBOMGenerators {
-		filename := filepath.Join(s.OutputDir, s.FileName+"."+gen.Ext())
-		if err := gen.Generate(ctx, &s, filename); err != nil {
-			return nil, fmt.Errorf("generating %s sbom: %w", gen.Key(), err)
-		}
-		sboms = append(sboms, types.SBOM{
-			Path:          filename,
-			Format:        gen.Key(),
-			PredicateType: gen.PredicateType(),
-			Arch:          arch.String(),
-			Digest:        h,
+	return generateImageSBOMs(ctx, bc.o, s, arch, h)
+}
+
+// generateImageSBOMs writes the SBOMs of an image, or of a layer, with digest
+// h, described by s, in each of the formats of the SBOM generators of o, and
+// signs them if o has a signing key.
+func generateImageSBOMs(ctx context.Context, o options.Options, s soptions.Options, arch types.Architecture, h v1.Hash) ([]types.SBOM, error) {
+	// The formats are generated concurrently, each from its own copy of the
+	// options, which share the packages, and the results are kept in the
+	// order of the generators, by priority.
+	sboms := make([]types.SBOM, len(o.SBOMGenerators))
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(sbomConcurrency(o.SBOMConcurrency))
+	for i, gen := range o.SortedSBOMGenerators() {
+		s := s
+		var metrics *types.SBOMMetrics
+		s.OnMetrics = func(m types.SBOMMetrics) { metrics = &m }
+		g.Go(func() error {
+			// The generators record the metrics of the SBOMs as attributes
+			// of this span.
+			gctx, span := otel.Tracer("apko").Start(gctx, "GenerateSBOM",
+				trace.WithAttributes(attribute.String("format", gen.Key()), attribute.String("arch", arch.ToAPK())))
+			defer span.End()
+
+			filename := filepath.Join(s.OutputDir, o.SBOMFileName(gen, arch.ToAPK()))
+			var content []byte
+			var err error
+			if cg, ok := gen.(generator.ContentGenerator); ok {
+				content, err = cg.GenerateContent(gctx, &s, filename)
+			} else {
+				err = gen.Generate(gctx, &s, filename)
+			}
+			if err != nil {
+				return fmt.Errorf("generating %s sbom: %w", gen.Key(), err)
+			}
+			sboms[i] = types.SBOM{
+				Path:          filename,
+				Format:        gen.Key(),
+				PredicateType: gen.PredicateType(),
+				Arch:          arch.String(),
+				Digest:        h,
+				Content:       content,
+				Metrics:       metrics,
+			}
+			return nil
 		})
 	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	if o.SBOMSigningKey != "" {
+		key, err := loadSigningKey(o.SBOMSigningKey)
+		if err != nil {
+			return nil, err
+		}
+		if err := signSBOMs(sboms, key); err != nil {
+			return nil, err
+		}
+	}
 	return sboms, nil
 }
 
+// sbomConcurrency returns the number of SBOMs generated at once for the
+// SBOMConcurrency option n.
+func sbomConcurrency(n int) int {
+	if n <= 0 {
+		return runtime.GOMAXPROCS(0)
+	}
+	return n
+}
+
+// SBOMDigestAnnotation is the annotation, on the descriptor of an image in
+// the index, of the digest of the primary SBOM of the image, the first one
+// written, for tracing an image to its SBOM. It is not a label of the image
+// config, nor an annotation of the image, since the SBOM records the digest
+// of the image, and hence of its config and annotations.
+const SBOMDigestAnnotation = "dev.sbom.digest"
+
+// SBOMDigestAnnotations returns the SBOMDigestAnnotation of an image's SBOMs.
+func SBOMDigestAnnotations(sboms []types.SBOM) (map[string]string, error) {
+	if len(sboms) == 0 {
+		return nil, nil
+	}
+	h, err := khash.SHA256ForFile(sboms[0].Path)
+	if err != nil {
+		return nil, fmt.Errorf("checksumming %s SBOM: %w", sboms[0].Arch, err)
+	}
+	return map[string]string{SBOMDigestAnnotation: "sha256:" + h}, nil
+}
+
+// packageProvenance returns, for each installed package, a comment on why it
+// was installed: because it, or a package it provides, is in requested, or
+// as a dependency of other installed packages. Requests and dependencies
+// matched by a virtual package the package provides, e.g. so:libc.so.1,
+// rather than by its name, note the virtual package.
+func packageProvenance(requested []string, pkgs []*apk.InstalledPackage) map[string]string {
+	providers := map[string][]string{}
+	for _, pkg := range pkgs {
+		providers[pkg.Name] = append(providers[pkg.Name], pkg.Name)
+		for _, prov := range pkg.Provides {
+			name := apk.ResolvePackageNameVersionPin(prov).Name
+			providers[name] = append(providers[name], pkg.Name)
+		}
+	}
+
+	comments := make(map[string]string, len(pkgs))
+	for _, r := range requested {
+		name := apk.ResolvePackageNameVersionPin(r).Name
+		for _, provider := range providers[name] {
+			if _, ok := comments[provider]; ok && provider != name {
+				continue
+			}
+			comments[provider] = "requested in the image configuration" + via(provider, name)
+		}
+	}
+
+	// dependents maps each package to the packages depending on it, and
+	// those to the virtual package they depend on it through, if any.
+	dependents := map[string]map[string]string{}
+	for _, pkg := range pkgs {
+		for _, dep := range pkg.Dependencies {
+			if strings.HasPrefix(dep, "!") {
+				continue
+			}
+			name := apk.ResolvePackageNameVersionPin(dep).Name
+			for _, provider := range providers[name] {
+				if provider == pkg.Name {
+					continue
+				}
+				if dependents[provider] == nil {
+					dependents[provider] = map[string]string{}
+				}
+				if v, ok := dependents[provider][pkg.Name]; !ok || v != "" {
+					dependents[provider][pkg.Name] = via(provider, name)
+				}
+			}
+		}
+	}
+	for name, deps := range dependents {
+		if _, ok := comments[name]; ok {
+			continue
+		}
+		entries := make([]string, 0, len(deps))
+		for _, dependent := range slices.Sorted(maps.Keys(deps)) {
+			entries = append(entries, dependent+deps[dependent])
+		}
+		comments[name] = "pulled in transitively as a dependency of " + strings.Join(entries, ", ")
+	}
+	return comments
+}
+
+// via returns the note of packageProvenance on the package named provider
+// being matched by name: nothing when it is the package itself, or the
+// virtual package it provides.
+func via(provider, name string) string {
+	if provider == name {
+		return ""
+	}
+	return " (via " + name + ")"
+}
+
 type ReleaseData struct {
 	ID         string
 	Name       string
@@ -200,9 +404,11 @@ func ParseReleaseData(osRelease io.Reader) (*ReleaseData, error) {
 	}, nil
 }
 
-func GenerateIndexSBOM(ctx context.Context, o options.Options, ic types.ImageConfiguration, indexDigest name.Digest, imgs map[types.Architecture]v1.Image) ([]types.SBOM, error) {
+func GenerateIndexSBOM(ctx context.Context, o options.Options, ic types.ImageConfiguration, indexDigest name.Digest, imgs map[types.Architecture]v1.Image) (_ []types.SBOM, err error) {
+	defer func() { err = wrapError(ErrSBOM, err) }()
+
 	log := clog.FromContext(ctx)
-	_, span := otel.Tracer("apko").Start(ctx, "GenerateIndexSBOM")
+	ctx, span := otel.Tracer("apko").Start(ctx, "GenerateIndexSBOM")
 	defer span.End()
 
 	if len(o.SBOMGenerators) == 0 {
@@ -212,6 +418,11 @@ func GenerateIndexSBOM(ctx context.Context, o options.Options, ic types.ImageCon
 
 	s := newSBOM(ctx, nil, o, ic, o.SourceDateEpoch)
 	log.Debug("Generating index SBOM")
+	if o.SBOMEmbedConfig {
+		if s.Config, err = yaml.Marshal(ic); err != nil {
+			return nil, fmt.Errorf("encoding image configuration: %w", err)
+		}
+	}
 
 	// Add the image digest
 	h, err := v1.NewHash(indexDigest.DigestStr())
@@ -231,40 +442,72 @@ func GenerateIndexSBOM(ctx context.Context, o options.Options, ic types.ImageCon
 		return archs[i].String() < archs[j].String()
 	})
 
-	var sboms = make([]types.SBOM, 0, len(o.SBOMGenerators))
-	for _, gen := range o.SBOMGenerators {
-		archImageInfos := make([]soptions.ArchImageInfo, 0, len(archs))
-		for _, arch := range archs {
-			i := imgs[arch]
-			sbomHash, err := khash.SHA256ForFile(filepath.Join(s.OutputDir, fmt.Sprintf("sbom-%s.%s", arch.ToAPK(), gen.Ext())))
-			if err != nil {
-				return nil, fmt.Errorf("checksumming %s SBOM: %w", arch, err)
+	sboms := make([]types.SBOM, len(o.SBOMGenerators))
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(sbomConcurrency(o.SBOMConcurrency))
+	for i, gen := range o.SortedSBOMGenerators() {
+		s := s
+		var metrics *types.SBOMMetrics
+		s.OnMetrics = func(m types.SBOMMetrics) { metrics = &m }
+		g.Go(func() error {
+			// As for the images, the generators record the metrics of the
+			// SBOMs as attributes of this span.
+			gctx, span := otel.Tracer("apko").Start(gctx, "GenerateSBOM",
+				trace.WithAttributes(attribute.String("format", gen.Key()), attribute.String("arch", "index")))
+			defer span.End()
+
+			archImageInfos := make([]soptions.ArchImageInfo, 0, len(archs))
+			for _, arch := range archs {
+				sbomHash, err := khash.SHA256ForFile(filepath.Join(s.OutputDir, o.SBOMFileName(gen, arch.ToAPK())))
+				if err != nil {
+					return fmt.Errorf("checksumming %s SBOM: %w", arch, err)
+				}
+
+				d, err := imgs[arch].Digest()
+				if err != nil {
+					return fmt.Errorf("getting arch image digest: %w", err)
+				}
+
+				info := soptions.ArchImageInfo{
+					Digest:     d,
+					Arch:       arch,
+					SBOMDigest: sbomHash,
+				}
+				archImageInfos = append(archImageInfos, info)
+			}
+			s.ImageInfo.Images = archImageInfos
+
+			filename := filepath.Join(s.OutputDir, o.SBOMFileName(gen, "index"))
+			var err error
+			if cg, ok := gen.(generator.IndexContextGenerator); ok {
+				err = cg.GenerateIndexContext(gctx, &s, filename)
+			} else {
+				err = gen.GenerateIndex(&s, filename)
 			}
-
-			d, err := i.Digest()
 			if err != nil {
-				return nil, fmt.Errorf("getting arch image digest: %w", err)
+				return fmt.Errorf("generating %s sbom: %w", gen.Key(), err)
 			}
-
-			info := soptions.ArchImageInfo{
-				Digest:     d,
-				Arch:       arch,
-				SBOMDigest: sbomHash,
+			sboms[i] = types.SBOM{
+				Path:          filename,
+				Format:        gen.Key(),
+				PredicateType: gen.PredicateType(),
+				Digest:        h,
+				Metrics:       metrics,
 			}
-			archImageInfos = append(archImageInfos, info)
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	if o.SBOMSigningKey != "" {
+		key, err := loadSigningKey(o.SBOMSigningKey)
+		if err != nil {
+			return nil, err
 		}
-		s.ImageInfo.Images = archImageInfos
-
-		filename := filepath.Join(s.OutputDir, "sbom-index."+gen.Ext())
-		if err := gen.GenerateIndex(&s, filename); err != nil {
-			return nil, fmt.Errorf("generating %s sbom: %w", gen.Key(), err)
+		if err := signSBOMs(sboms, key); err != nil {
+			return nil, err
 		}
-		sboms = append(sboms, types.SBOM{
-			Path:          filename,
-			Format:        gen.Key(),
-			PredicateType: gen.PredicateType(),
-			Digest:        h,
-		})
 	}
 
 	return sboms, nil
@@ -15,13 +15,24 @@
 package build
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
 	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
 
+	"chainguard.dev/apko/pkg/apk/apk"
 	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/options"
+	"chainguard.dev/apko/pkg/sbom/generator/spdx"
 )
 
 func TestFetchFSReleaseData(t *testing.T) {
@@ -63,3 +74,286 @@ func TestBadFSReleaseData(t *testing.T) {
 	_, err := fetchFSReleaseData(fsys)
 	require.Error(t, err)
 }
+
+func TestPackageProvenance(t *testing.T) {
+	pkgs := []*apk.InstalledPackage{
+		{Package: apk.Package{Name: "app", Dependencies: []string{"so:libc.so.1", "busybox", "!conflict"}}},
+		{Package: apk.Package{Name: "musl", Provides: []string{"so:libc.so.1=1"}}},
+		{Package: apk.Package{Name: "busybox", Dependencies: []string{"so:libc.so.1"}, Provides: []string{"cmd:sh=1.36"}}},
+		{Package: apk.Package{Name: "ca-certificates"}},
+		{Package: apk.Package{Name: "conflict"}},
+	}
+	got := packageProvenance([]string{"app=1.0", "cmd:sh", "ca-certificates"}, pkgs)
+	require.Equal(t, map[string]string{
+		"app":             "requested in the image configuration",
+		"busybox":         "requested in the image configuration (via cmd:sh)",
+		"ca-certificates": "requested in the image configuration",
+		"musl":            "pulled in transitively as a dependency of app (via so:libc.so.1), busybox (via so:libc.so.1)",
+	}, got)
+
+	// Packages are matched by name in preference to the virtual packages
+	// they provide.
+	pkgs = []*apk.InstalledPackage{
+		{Package: apk.Package{Name: "app", Dependencies: []string{"sh", "busybox"}}},
+		{Package: apk.Package{Name: "busybox", Provides: []string{"sh"}}},
+	}
+	got = packageProvenance([]string{"sh", "app"}, pkgs)
+	require.Equal(t, map[string]string{
+		"app":     "requested in the image configuration",
+		"busybox": "requested in the image configuration (via sh)",
+	}, got)
+	got = packageProvenance([]string{"app"}, pkgs)
+	require.Equal(t, "pulled in transitively as a dependency of app", got["busybox"])
+}
+
+func TestGenerateIndexSBOMDigestAnnotation(t *testing.T) {
+	ctx := t.Context()
+	dir := t.TempDir()
+
+	archs := types.ParseArchitectures([]string{"amd64", "arm64"})
+	imgs := map[types.Architecture]v1.Image{}
+	sboms := map[types.Architecture][]types.SBOM{}
+	want := map[string]string{}
+	for _, arch := range archs {
+		img, err := random.Image(64, 1)
+		require.NoError(t, err)
+		imgs[arch] = img
+
+		// The annotation is the digest of the first SBOM of each image.
+		var files []types.SBOM
+		for _, format := range []string{"spdx", "spdx-tv"} {
+			path := filepath.Join(dir, format+"-"+arch.ToAPK())
+			require.NoError(t, os.WriteFile(path, []byte(path), 0o644))
+			files = append(files, types.SBOM{Path: path, Format: format, Arch: arch.String()})
+		}
+		sboms[arch] = files
+		h, _, err := v1.SHA256(strings.NewReader(files[0].Path))
+		require.NoError(t, err)
+		want[arch.String()] = h.String()
+	}
+
+	for _, enable := range []bool{true, false} {
+		o := &options.Options{SBOMDigestAnnotation: enable}
+		_, idx, err := GenerateIndex(ctx, o, types.ImageConfiguration{}, imgs, sboms, time.Unix(0, 0))
+		require.NoError(t, err)
+		m, err := idx.IndexManifest()
+		require.NoError(t, err)
+		require.Len(t, m.Manifests, 2)
+		for _, desc := range m.Manifests {
+			if !enable {
+				require.Empty(t, desc.Annotations[SBOMDigestAnnotation])
+				continue
+			}
+			require.Equal(t, want[types.ParseArchitecture(desc.Platform.Architecture).String()], desc.Annotations[SBOMDigestAnnotation])
+		}
+	}
+}
+
+func TestImageSBOM(t *testing.T) {
+	file := func(t *testing.T, doc *spdx.Document, name string) *spdx.File {
+		for i := range doc.Files {
+			if doc.Files[i].Name == name {
+				return &doc.Files[i]
+			}
+		}
+		t.Fatalf("%s is not in the SBOM", name)
+		return nil
+	}
+
+	for _, tc := range []struct {
+		name string
+		// configure, if set, adjusts the configuration of the test image.
+		configure func(ic *types.ImageConfiguration)
+		opts      []Option
+		check     func(t *testing.T, bc *Context, doc *spdx.Document)
+	}{{
+		name: "embedded config",
+		opts: []Option{WithSBOMEmbedConfig(true)},
+		check: func(t *testing.T, bc *Context, doc *spdx.Document) {
+			config, err := spdx.EmbeddedConfig(doc)
+			require.NoError(t, err)
+			var ic types.ImageConfiguration
+			require.NoError(t, yaml.Unmarshal(config, &ic))
+			require.Equal(t, bc.ImageConfiguration().Contents.Packages, ic.Contents.Packages)
+		},
+	}, {
+		name: "generated files",
+		configure: func(ic *types.ImageConfiguration) {
+			ic.Entrypoint.Services = map[string]string{"web": "/bin/web"}
+		},
+		opts: []Option{WithSBOMGeneratedFiles(true), WithSBOMLint(true)},
+		check: func(t *testing.T, _ *Context, doc *spdx.Document) {
+			var names []string
+			for _, f := range doc.Files {
+				names = append(names, f.Name)
+			}
+			require.Equal(t, []string{"/etc/apko.json", "/sv/web/run"}, names)
+			require.Contains(t, doc.Relationships, spdx.Relationship{
+				Element: doc.Files[0].ID,
+				Type:    "GENERATED_FROM",
+				Related: "SPDXRef-Tool-apko",
+			})
+		},
+	}, {
+		name: "config files",
+		configure: func(ic *types.ImageConfiguration) {
+			ic.Profile = []types.ProfileSnippet{{Name: "editor", Content: "export EDITOR=vi"}}
+		},
+		opts: []Option{WithSBOMGeneratedFiles(true)},
+		check: func(t *testing.T, _ *Context, doc *spdx.Document) {
+			snippet := file(t, doc, "/etc/profile.d/editor.sh")
+			require.Contains(t, doc.Relationships, spdx.Relationship{
+				Element: doc.DocumentDescribes[0],
+				Type:    "CONTAINS",
+				Related: snippet.ID,
+			})
+			require.Contains(t, doc.Relationships, spdx.Relationship{
+				Element: snippet.ID,
+				Type:    "OTHER",
+				Related: doc.DocumentDescribes[0],
+				Comment: "CONFIG_OF",
+			})
+		},
+	}, {
+		name: "app packages",
+		configure: func(ic *types.ImageConfiguration) {
+			ic.Contents.AppPackages = []string{"replay*"}
+		},
+		opts: []Option{WithSBOMAppPackages(nil, "DEPENDS_ON")},
+		check: func(t *testing.T, _ *Context, doc *spdx.Document) {
+			var app *spdx.Package
+			for i := range doc.Packages {
+				if doc.Packages[i].Name == "replayout" {
+					app = &doc.Packages[i]
+				}
+			}
+			require.NotNil(t, app)
+			root := doc.DocumentDescribes[0]
+			require.Contains(t, doc.Relationships, spdx.Relationship{Element: root, Type: "DEPENDS_ON", Related: app.ID})
+			require.NotContains(t, doc.Relationships, spdx.Relationship{Element: root, Type: "CONTAINS", Related: app.ID})
+		},
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			ic := testConfig(t)
+			if tc.configure != nil {
+				tc.configure(&ic)
+			}
+			bc, img := buildSBOMImage(t, nil, append([]Option{
+				WithImageConfiguration(ic),
+				WithSBOMGenerators(spdx.New()),
+			}, tc.opts...)...)
+			tc.check(t, bc, imageSBOM(t, bc, img))
+		})
+	}
+}
+
+func TestSBOMConcurrency(t *testing.T) {
+	var contents [][]byte
+	for _, concurrency := range []int{1, 2} {
+		bc, img := buildSBOMImage(t, nil,
+			WithSBOMGenerators(spdx.New(), spdx.NewTagValue()),
+			WithSBOMConcurrency(concurrency),
+		)
+		sboms, err := bc.GenerateImageSBOM(t.Context(), testArch, img)
+		require.NoError(t, err)
+
+		// The SBOMs are listed in the order of the generators, and no
+		// temporary file is left next to them.
+		require.Len(t, sboms, 2)
+		require.Equal(t, "spdx", sboms[0].Format)
+		require.Equal(t, "spdx-tv", sboms[1].Format)
+		entries, err := os.ReadDir(filepath.Dir(sboms[0].Path))
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+
+		for _, s := range sboms {
+			b, err := os.ReadFile(s.Path)
+			require.NoError(t, err)
+			require.Equal(t, s.Content, b)
+		}
+		contents = append(contents, sboms[0].Content)
+	}
+	require.Equal(t, contents[0], contents[1])
+}
+
+func TestSBOMOutputs(t *testing.T) {
+	bc, img := buildSBOMImage(t, nil,
+		WithSBOMGenerators(spdx.New(), spdx.NewTagValue()),
+		WithSBOMOutputs(map[string]options.SBOMOutput{
+			"spdx":    {FileName: "image-{arch}.spdx.json"},
+			"spdx-tv": {FileName: "{arch}.spdx", Priority: 10},
+		}),
+	)
+	sboms, err := bc.GenerateImageSBOM(t.Context(), testArch, img)
+	require.NoError(t, err)
+
+	// The SBOMs are listed by priority, then in the order of the generators.
+	require.Len(t, sboms, 2)
+	require.Equal(t, "spdx-tv", sboms[0].Format)
+	require.Equal(t, "x86_64.spdx", filepath.Base(sboms[0].Path))
+	require.Equal(t, "spdx", sboms[1].Format)
+	require.Equal(t, "image-x86_64.spdx.json", filepath.Base(sboms[1].Path))
+	for _, s := range sboms {
+		require.FileExists(t, s.Path)
+	}
+}
+
+func TestSBOMMetrics(t *testing.T) {
+	bc, img := buildSBOMImage(t, nil, WithSBOMGenerators(spdx.New(), spdx.NewTagValue()))
+	sboms, err := bc.GenerateImageSBOM(t.Context(), testArch, img)
+	require.NoError(t, err)
+
+	// Each SBOM has its own metrics; those of the SPDX formats are the same.
+	require.Len(t, sboms, 2)
+	for _, s := range sboms {
+		require.NotNil(t, s.Metrics, s.Format)
+		require.NotZero(t, s.Metrics.Packages, s.Format)
+		require.NotZero(t, s.Metrics.Relationships, s.Format)
+	}
+	require.NotSame(t, sboms[0].Metrics, sboms[1].Metrics)
+	require.Equal(t, *sboms[0].Metrics, *sboms[1].Metrics)
+}
+
+func TestIndexSBOMMetrics(t *testing.T) {
+	ctx := t.Context()
+	dir := t.TempDir()
+
+	bc, img := buildSBOMImage(t, nil, WithSBOM(dir), WithSBOMGenerators(spdx.New()))
+	_, err := bc.GenerateImageSBOM(ctx, testArch, img)
+	require.NoError(t, err)
+
+	o, ic, err := NewOptions(
+		WithConfig("apko.yaml", []string{"testdata"}),
+		WithSBOM(dir),
+		WithSBOMGenerators(spdx.New()),
+	)
+	require.NoError(t, err)
+	digest, err := name.NewDigest("example.com/image@sha256:" + strings.Repeat("0", 64))
+	require.NoError(t, err)
+	sboms, err := GenerateIndexSBOM(ctx, *o, *ic, digest, map[types.Architecture]v1.Image{testArch: img})
+	require.NoError(t, err)
+
+	// The index and its image.
+	require.Len(t, sboms, 1)
+	require.NotNil(t, sboms[0].Metrics)
+	require.Equal(t, 2, sboms[0].Metrics.Packages)
+	require.Equal(t, 1, sboms[0].Metrics.Relationships)
+}
+
+func BenchmarkGenerateImageSBOM(b *testing.B) {
+	for _, concurrency := range []int{1, 2} {
+		b.Run(fmt.Sprintf("concurrency=%d", concurrency), func(b *testing.B) {
+			bc, img := buildSBOMImage(b, nil,
+				WithSBOMGenerators(spdx.New(), spdx.NewTagValue()),
+				WithSBOMConcurrency(concurrency),
+				WithSBOMGeneratedFiles(true),
+			)
+			b.ResetTimer()
+			for range b.N {
+				if _, err := bc.GenerateImageSBOM(b.Context(), testArch, img); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"os"
+
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+// SBOMSignatureExt is the extension of the detached signatures of the SBOMs,
+// written next to them.
+const SBOMSignatureExt = ".sig"
+
+// loadSigningKey reads the PEM encoded private key at path, a PKCS #8, SEC 1
+// EC or PKCS #1 RSA key. Encrypted keys are not supported.
+func loadSigningKey(path string) (crypto.Signer, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading signing key: %w", err)
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("signing key %s is not PEM encoded", path)
+	}
+
+	var key any
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("signing key %s is a %q, not a private key", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing signing key %s: %w", path, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("signing key %s cannot sign", path)
+	}
+	return signer, nil
+}
+
+// signSBOMs signs each of the SBOMs with key, see signSBOM, and sets their
+// SignaturePath.
+func signSBOMs(sboms []types.SBOM, key crypto.Signer) error {
+	for i := range sboms {
+		sig, err := signSBOM(sboms[i].Path, key)
+		if err != nil {
+			return err
+		}
+		sboms[i].SignaturePath = sig
+	}
+	return nil
+}
+
+// signSBOM writes the detached signature of the exact bytes of the SBOM at
+// path to path + SBOMSignatureExt, and returns the path of the signature.
+// It is in the format of cosign sign-blob, i.e. the base64 encoded signature
+// of the SHA-256 digest of the bytes, or of the bytes themselves for Ed25519
+// keys, so that it can be checked with cosign verify-blob --key.
+func signSBOM(path string, key crypto.Signer) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("reading SBOM: %w", err)
+	}
+
+	var sig []byte
+	if _, ok := key.(ed25519.PrivateKey); ok {
+		sig, err = key.Sign(rand.Reader, content, crypto.Hash(0))
+	} else {
+		digest := sha256.Sum256(content)
+		sig, err = key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	if err != nil {
+		return "", fmt.Errorf("signing %s: %w", path, err)
+	}
+
+	sigPath := path + SBOMSignatureExt
+	if err := os.WriteFile(sigPath, []byte(base64.StdEncoding.EncodeToString(sig)), 0o644); err != nil {
+		return "", fmt.Errorf("writing signature of %s: %w", path, err)
+	}
+	return sigPath, nil
+}
@@ -0,0 +1,125 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func TestSignSBOMs(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	pkcs8 := func(key any) []byte {
+		b, err := x509.MarshalPKCS8PrivateKey(key)
+		require.NoError(t, err)
+		return b
+	}
+	ecDER, err := x509.MarshalECPrivateKey(ecKey)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name   string
+		block  *pem.Block
+		verify func(content, sig []byte) bool
+	}{{
+		name:  "pkcs8 ecdsa",
+		block: &pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8(ecKey)},
+		verify: func(content, sig []byte) bool {
+			digest := sha256.Sum256(content)
+			return ecdsa.VerifyASN1(&ecKey.PublicKey, digest[:], sig)
+		},
+	}, {
+		name:  "sec1 ecdsa",
+		block: &pem.Block{Type: "EC PRIVATE KEY", Bytes: ecDER},
+		verify: func(content, sig []byte) bool {
+			digest := sha256.Sum256(content)
+			return ecdsa.VerifyASN1(&ecKey.PublicKey, digest[:], sig)
+		},
+	}, {
+		name:  "pkcs1 rsa",
+		block: &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)},
+		verify: func(content, sig []byte) bool {
+			digest := sha256.Sum256(content)
+			return rsa.VerifyPKCS1v15(&rsaKey.PublicKey, crypto.SHA256, digest[:], sig) == nil
+		},
+	}, {
+		name:  "pkcs8 ed25519",
+		block: &pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8(edKey)},
+		verify: func(content, sig []byte) bool {
+			return ed25519.Verify(edKey.Public().(ed25519.PublicKey), content, sig)
+		},
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			keyPath := filepath.Join(dir, "key.pem")
+			require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(tc.block), 0o600))
+			content := []byte(`{"spdxVersion":"SPDX-2.3"}`)
+			sbomPath := filepath.Join(dir, "sbom.spdx.json")
+			require.NoError(t, os.WriteFile(sbomPath, content, 0o644))
+
+			key, err := loadSigningKey(keyPath)
+			require.NoError(t, err)
+			sboms := []types.SBOM{{Path: sbomPath}}
+			require.NoError(t, signSBOMs(sboms, key))
+			require.Equal(t, sbomPath+SBOMSignatureExt, sboms[0].SignaturePath)
+
+			encoded, err := os.ReadFile(sboms[0].SignaturePath)
+			require.NoError(t, err)
+			sig, err := base64.StdEncoding.DecodeString(string(encoded))
+			require.NoError(t, err)
+			require.True(t, tc.verify(content, sig), "signature does not validate against the SBOM")
+			require.False(t, tc.verify(append(content, '\n'), sig), "signature validates against another SBOM")
+		})
+	}
+}
+
+func TestLoadSigningKeyErrors(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, b []byte) string {
+		p := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(p, b, 0o600))
+		return p
+	}
+
+	_, err := loadSigningKey(filepath.Join(dir, "missing.pem"))
+	require.ErrorContains(t, err, "reading signing key")
+	_, err = loadSigningKey(write("garbage.pem", []byte("not a key")))
+	require.ErrorContains(t, err, "is not PEM encoded")
+	_, err = loadSigningKey(write("public.pem", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: []byte{0}})))
+	require.ErrorContains(t, err, `is a "PUBLIC KEY", not a private key`)
+	_, err = loadSigningKey(write("corrupt.pem", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte{0}})))
+	require.ErrorContains(t, err, "parsing signing key")
+}
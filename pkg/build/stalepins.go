@@ -0,0 +1,118 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/chainguard-dev/clog"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+)
+
+// StalePin is a package pinned to a version in the image configuration
+// which resolved to an older version than the newest one available in the
+// repositories. apko cannot tell whether the newer versions fix anything;
+// the pins are reported so that reviewers notice packages held back.
+type StalePin struct {
+	// Constraint is the package as requested, e.g. "busybox=1.36.0-r0".
+	Constraint string
+	// Name is the name of the package.
+	Name string
+	// Version is the version the package resolved to.
+	Version string
+	// Latest is the newest version of the package available.
+	Latest string
+}
+
+func (p StalePin) String() string {
+	return fmt.Sprintf("%s resolved to %s-%s, %s is available", p.Constraint, p.Name, p.Version, p.Latest)
+}
+
+// checkStalePins sets the stale pins of the build, see StalePins, from the
+// packages toInstall resolved to, and logs them.
+func (bc *Context) checkStalePins(ctx context.Context, toInstall []*apk.RepositoryPackage) error {
+	log := clog.FromContext(ctx)
+
+	indexes, err := bc.apk.GetRepositoryIndexes(ctx, bc.o.IgnoreSignatures)
+	if err != nil {
+		return fmt.Errorf("getting repository indexes: %w", err)
+	}
+	var available []*apk.RepositoryPackage
+	for _, idx := range indexes {
+		available = append(available, idx.Packages()...)
+	}
+
+	bc.stalePins = findStalePins(bc.ic.Contents.Packages, toInstall, available)
+	for _, p := range bc.stalePins {
+		log.Warnf("stale pin: %s", p)
+	}
+	return nil
+}
+
+// findStalePins returns the packages of requested constrained to a version,
+// e.g. "busybox=1.36.0-r0" or "busybox<1.37", whose version in resolved is
+// older than the newest one in available, in the order they are requested.
+// Pins to a tagged repository only, e.g. "busybox@local", are not stale.
+func findStalePins(requested []string, resolved, available []*apk.RepositoryPackage) []StalePin {
+	versions := make(map[string]string, len(resolved))
+	for _, pkg := range resolved {
+		versions[pkg.Name] = pkg.Version
+	}
+
+	var stale []StalePin
+	for _, r := range requested {
+		if strings.HasPrefix(r, "!") {
+			continue
+		}
+		constraint := apk.ResolvePackageNameVersionPin(r)
+		if constraint.Version == "" {
+			continue
+		}
+		version, ok := versions[constraint.Name]
+		if !ok {
+			continue
+		}
+		current, err := apk.ParseVersion(version)
+		if err != nil {
+			continue
+		}
+
+		latest, newest := "", current
+		for _, pkg := range available {
+			if pkg.Name != constraint.Name {
+				continue
+			}
+			v, err := apk.ParseVersion(pkg.Version)
+			if err != nil {
+				continue
+			}
+			if apk.CompareVersions(v, newest) > 0 {
+				latest, newest = pkg.Version, v
+			}
+		}
+		if latest != "" {
+			stale = append(stale, StalePin{
+				Constraint: r,
+				Name:       constraint.Name,
+				Version:    version,
+				Latest:     latest,
+			})
+		}
+	}
+	return stale
+}
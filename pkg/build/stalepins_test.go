@@ -0,0 +1,117 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func TestFindStalePins(t *testing.T) {
+	pkg := func(name, version string) *apk.RepositoryPackage {
+		return apk.NewRepositoryPackage(&apk.Package{Name: name, Version: version, Arch: "x86_64"}, nil)
+	}
+	available := []*apk.RepositoryPackage{
+		pkg("busybox", "1.36.0-r0"),
+		pkg("busybox", "1.37.0-r1"),
+		pkg("busybox", "1.37.0-r0"),
+		pkg("musl", "1.2.5-r0"),
+		pkg("openssl", "3.3.0-r0"),
+		pkg("openssl", "3.4.0-r0"),
+		pkg("zlib", "1.3-r0"),
+		pkg("zlib", "1.3.1-r0"),
+	}
+	resolved := []*apk.RepositoryPackage{
+		pkg("busybox", "1.36.0-r0"),
+		pkg("musl", "1.2.5-r0"),
+		pkg("openssl", "3.3.0-r0"),
+		pkg("zlib", "1.3.1-r0"),
+	}
+
+	stale := findStalePins([]string{
+		"busybox=1.36.0-r0",
+		"musl=1.2.5-r0", // the newest version
+		"openssl<3.4",
+		"zlib",       // not pinned
+		"!curl",      // a conflict
+		"zlib@local", // pinned to a repository only
+	}, resolved, available)
+	require.Equal(t, []StalePin{{
+		Constraint: "busybox=1.36.0-r0",
+		Name:       "busybox",
+		Version:    "1.36.0-r0",
+		Latest:     "1.37.0-r1",
+	}, {
+		Constraint: "openssl<3.4",
+		Name:       "openssl",
+		Version:    "3.3.0-r0",
+		Latest:     "3.4.0-r0",
+	}}, stale)
+	require.Equal(t, "busybox=1.36.0-r0 resolved to busybox-1.36.0-r0, 1.37.0-r1 is available", stale[0].String())
+
+	require.Empty(t, findStalePins(nil, resolved, available))
+}
+
+func TestStalePins(t *testing.T) {
+	// A repository with two versions of foo.
+	dir := t.TempDir()
+	archDir := filepath.Join(dir, "x86_64")
+	require.NoError(t, os.MkdirAll(archDir, 0o755))
+	var pkgs []*apk.Package
+	var resolved []*apk.RepositoryPackage
+	for _, version := range []string{"1.0.0-r0", "1.1.0-r0"} {
+		pkg := &apk.Package{Name: "foo", Version: version, Origin: "foo"}
+		resolved = append(resolved, writeTestAPK(t, archDir, pkg, map[string]string{"usr/share/foo": version}))
+		pkgs = append(pkgs, pkg)
+	}
+	archive, err := apk.ArchiveFromIndex(&apk.APKIndex{Packages: pkgs})
+	require.NoError(t, err)
+	b, err := io.ReadAll(archive)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(archDir, "APKINDEX.tar.gz"), b, 0o644))
+
+	config := func(pin string) types.ImageConfiguration {
+		ic := repoConfig(dir)
+		ic.Contents.Packages = []string{pin}
+		return ic
+	}
+	stalePins := func(enable bool, pin string) []StalePin {
+		bc := newRepoContext(t, config(pin), nil, WithIgnoreSignatures(true), WithStalePins(enable))
+		_, _, err := bc.BuildPackageList(t.Context())
+		require.NoError(t, err)
+		return bc.StalePins()
+	}
+
+	require.Equal(t, []StalePin{{
+		Constraint: "foo=1.0.0-r0", Name: "foo", Version: "1.0.0-r0", Latest: "1.1.0-r0",
+	}}, stalePins(true, "foo=1.0.0-r0"))
+	require.Empty(t, stalePins(false, "foo=1.0.0-r0"))
+	require.Empty(t, stalePins(true, "foo=1.1.0-r0"))
+	require.Empty(t, stalePins(true, "foo"))
+
+	// Pre-resolved packages are checked too.
+	bc := newRepoContext(t, config("foo=1.0.0-r0"), resolved[:1], WithIgnoreSignatures(true), WithStalePins(true))
+	require.NoError(t, bc.BuildImage(t.Context()))
+	require.Equal(t, []StalePin{{
+		Constraint: "foo=1.0.0-r0", Name: "foo", Version: "1.0.0-r0", Latest: "1.1.0-r0",
+	}}, bc.StalePins())
+}
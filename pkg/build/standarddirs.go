@@ -0,0 +1,58 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+// DefaultStandardDirs are the ownership and permissions of the standard
+// directories of an image, to be given with WithStandardDirs.
+var DefaultStandardDirs = []types.PathMutation{
+	{Path: "/tmp", Type: "permissions", Permissions: 0o1777},
+	{Path: "/var/tmp", Type: "permissions", Permissions: 0o1777},
+	{Path: "/var/log", Type: "permissions", Permissions: 0o755},
+}
+
+// applyStandardDirs creates the directories in dirs which are missing from
+// fsys, sets their ownership and permissions and records them in report,
+// which may be nil. Paths which are not directories, e.g. because a package
+// replaced them with a symlink, are left alone.
+func applyStandardDirs(fsys apkfs.FullFS, dirs []types.PathMutation, report *MutationReport) error {
+	for _, dir := range dirs {
+		p := strings.TrimPrefix(dir.Path, "/")
+		fi, err := fsys.Lstat(p)
+		if errors.Is(err, fs.ErrNotExist) {
+			if err := fsys.MkdirAll(p, 0o755); err != nil {
+				return fmt.Errorf("creating %s: %w", dir.Path, err)
+			}
+		} else if err != nil {
+			return fmt.Errorf("checking %s: %w", dir.Path, err)
+		} else if !fi.IsDir() {
+			continue
+		}
+		if err := mutatePermissionsDirect(fsys, p, dir.Permissions, dir.UID, dir.GID); err != nil {
+			return err
+		}
+		report.addPath(dir, MutationOriginDefaults)
+	}
+	return nil
+}
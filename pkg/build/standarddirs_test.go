@@ -0,0 +1,98 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build/types"
+)
+
+func TestStandardDirs(t *testing.T) {
+	ic := testConfig(t)
+	ic.Paths = []types.PathMutation{{
+		Path:        "/srv/shared",
+		Type:        "directory",
+		Permissions: 0o1777,
+	}}
+
+	fsys := apkfs.NewMemFS()
+	bc := newTestContext(t, fsys, WithImageConfiguration(ic), WithStandardDirs(DefaultStandardDirs))
+	_, layer, err := bc.BuildLayer(t.Context())
+	require.NoError(t, err)
+
+	for _, dir := range []string{"tmp", "srv/shared"} {
+		fi, err := fsys.Stat(dir)
+		require.NoError(t, err)
+		require.Equal(t, os.ModeDir|os.ModeSticky|0o777, fi.Mode(), dir)
+	}
+
+	// The sticky bit makes it to the layer.
+	hdrs := layerHeaders(t, layer)
+	require.EqualValues(t, 0o1777, hdrs["tmp"].Mode)
+	require.EqualValues(t, 0o1777, hdrs["srv/shared"].Mode)
+}
+
+func TestStandardDirsCreated(t *testing.T) {
+	dir := t.TempDir()
+	foo := writeTestAPK(t, dir, &apk.Package{Name: "foo", Origin: "foo"}, map[string]string{"usr/share/foo": "foo"})
+
+	// /tmp is one of the base directories of apk, so it is removed to be
+	// missing.
+	ic := repoConfig(dir)
+	ic.Contents.RemovePaths = []string{"/tmp"}
+	buildImage := func(opts ...Option) apkfs.FullFS {
+		bc := newRepoContext(t, ic, []*apk.RepositoryPackage{foo}, opts...)
+		require.NoError(t, bc.BuildImage(t.Context()))
+		return bc.fs
+	}
+
+	// The standard directories are only set up on request.
+	_, err := buildImage().Stat("tmp")
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	fsys := buildImage(WithStandardDirs(DefaultStandardDirs))
+	for dir, mode := range map[string]os.FileMode{
+		"tmp":     os.ModeDir | os.ModeSticky | 0o777,
+		"var/tmp": os.ModeDir | os.ModeSticky | 0o777,
+		"var/log": os.ModeDir | 0o755,
+	} {
+		fi, err := fsys.Stat(dir)
+		require.NoError(t, err)
+		require.Equal(t, mode, fi.Mode(), dir)
+	}
+}
+
+func TestStandardDirsOverride(t *testing.T) {
+	ic := testConfig(t)
+	ic.Paths = []types.PathMutation{{
+		Path:        "/tmp",
+		Type:        "permissions",
+		Permissions: 0o700,
+		UID:         65532,
+	}}
+
+	fsys := apkfs.NewMemFS()
+	buildTestImage(t, fsys, WithImageConfiguration(ic), WithStandardDirs(DefaultStandardDirs))
+
+	fi, err := fsys.Stat("tmp")
+	require.NoError(t, err)
+	require.Equal(t, os.ModeDir|0o700, fi.Mode())
+}
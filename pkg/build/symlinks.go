@@ -0,0 +1,159 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+)
+
+// Modes of the broken symlink check.
+const (
+	// BrokenSymlinksWarn logs the broken symlinks found in the image.
+	BrokenSymlinksWarn = "warn"
+	// BrokenSymlinksFail fails the build if the image has broken symlinks.
+	BrokenSymlinksFail = "fail"
+)
+
+// runtimeMounts are the directories which are only populated at runtime, so
+// that symlinks into them, e.g. /etc/mtab, are not reported as broken.
+var runtimeMounts = []string{"dev", "proc", "sys"}
+
+// maxSymlinks is the number of symlinks followed when resolving a path
+// before giving up, as for Linux' ELOOP.
+const maxSymlinks = 40
+
+// brokenSymlink is a symlink of the image whose target does not exist in the
+// image, or is outside of it.
+type brokenSymlink struct {
+	// Path is the absolute path of the symlink.
+	Path string
+	// Target is the target of the symlink, as stored in the image.
+	Target string
+	// Reason is why the symlink is broken, e.g. "dangling".
+	Reason string
+}
+
+func (b brokenSymlink) String() string {
+	return fmt.Sprintf("%s -> %s (%s)", b.Path, b.Target, b.Reason)
+}
+
+var (
+	errSymlinkLoop   = errors.New("too many levels of symbolic links")
+	errSymlinkEscape = errors.New("symbolic link escapes the image")
+)
+
+// findBrokenSymlinks returns the symlinks of fsys whose target, resolved
+// within fsys, does not exist, cannot be resolved, or is a relative path
+// climbing above the root of the image. Dangling symlinks into
+// runtimeMounts are ignored.
+func findBrokenSymlinks(fsys apkfs.FullFS) ([]brokenSymlink, error) {
+	var broken []brokenSymlink
+	if err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type()&fs.ModeSymlink == 0 {
+			return nil
+		}
+		target, err := fsys.Readlink(p)
+		if err != nil {
+			return fmt.Errorf("reading symlink %s: %w", p, err)
+		}
+		missing, err := resolveInImage(fsys, p)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			if underRuntimeMount(missing) {
+				return nil
+			}
+			broken = append(broken, brokenSymlink{Path: "/" + p, Target: target, Reason: "dangling"})
+		case errors.Is(err, errSymlinkLoop):
+			broken = append(broken, brokenSymlink{Path: "/" + p, Target: target, Reason: "loop"})
+		case errors.Is(err, errSymlinkEscape):
+			broken = append(broken, brokenSymlink{Path: "/" + p, Target: target, Reason: "escapes the image"})
+		case err != nil:
+			return fmt.Errorf("resolving symlink %s: %w", p, err)
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("walking filesystem: %w", err)
+	}
+	return broken, nil
+}
+
+// resolveInImage resolves the relative path p, following symlinks with the
+// root of fsys as the root directory. On failure, it returns the path at
+// which the resolution failed. A symlink whose target climbs above the root
+// is reported with errSymlinkEscape: while the kernel resolves it to the
+// root, it was usually meant to point outside of the image.
+func resolveInImage(fsys apkfs.FullFS, p string) (string, error) {
+	resolved := ""
+	rest := p
+	links := 0
+	for rest != "" {
+		var comp string
+		comp, rest, _ = strings.Cut(rest, "/")
+		switch comp {
+		case "", ".":
+			continue
+		case "..":
+			if resolved == "" {
+				return "", errSymlinkEscape
+			}
+			resolved = strings.TrimPrefix(path.Dir(resolved), ".")
+			continue
+		}
+
+		// Not every FullFS implements Lstat without following symlinks,
+		// so symlinks are detected with Readlink.
+		next := path.Join(resolved, comp)
+		target, err := fsys.Readlink(next)
+		if err != nil {
+			fi, err := fsys.Lstat(next)
+			if err != nil {
+				return next, err
+			}
+			if rest != "" && !fi.IsDir() {
+				return next, fs.ErrNotExist
+			}
+			resolved = next
+			continue
+		}
+
+		links++
+		if links > maxSymlinks {
+			return next, errSymlinkLoop
+		}
+		if path.IsAbs(target) {
+			resolved = ""
+		}
+		rest = strings.TrimPrefix(target, "/") + "/" + rest
+	}
+	return resolved, nil
+}
+
+func underRuntimeMount(p string) bool {
+	for _, m := range runtimeMounts {
+		if p == m || strings.HasPrefix(p, m+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+)
+
+func Test_findBrokenSymlinks(t *testing.T) {
+	fsys := apkfs.NewMemFS()
+	for _, dir := range []string{"etc", "usr/bin", "usr/lib", "lib"} {
+		require.NoError(t, fsys.MkdirAll(dir, 0o755))
+	}
+	require.NoError(t, fsys.WriteFile("usr/bin/busybox", []byte("bb"), 0o755))
+	require.NoError(t, fsys.WriteFile("usr/lib/libfoo.so.1", []byte("lib"), 0o644))
+
+	for link, target := range map[string]string{
+		// Resolvable, relative, absolute and through a symlinked directory.
+		"usr/bin/sh":        "busybox",
+		"usr/bin/ash":       "/usr/bin/busybox",
+		"lib/libfoo.so":     "../usr/lib/libfoo.so.1",
+		"etc/libdir":        "/usr/lib",
+		"etc/libfoo.so":     "libdir/libfoo.so.1",
+		"usr/bin/chain":     "sh",
+		"etc/mtab":          "/proc/mounts",
+		"usr/bin/stdin":     "/dev/stdin",
+		"usr/bin/bash":      "/bin/bash",
+		"lib/libbar.so":     "../usr/lib/libbar.so.1",
+		"etc/missing.so":    "libdir/missing.so",
+		"usr/bin/not-a-dir": "busybox/foo",
+		"usr/bin/loop-a":    "loop-b",
+		"usr/bin/loop-b":    "loop-a",
+		"usr/lib/escape":    "../../../host/lib",
+		"etc/escape-back":   "../../etc/libdir",
+	} {
+		require.NoError(t, fsys.Symlink(target, link))
+	}
+
+	broken, err := findBrokenSymlinks(fsys)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []brokenSymlink{
+		{Path: "/usr/bin/bash", Target: "/bin/bash", Reason: "dangling"},
+		{Path: "/lib/libbar.so", Target: "../usr/lib/libbar.so.1", Reason: "dangling"},
+		{Path: "/etc/missing.so", Target: "libdir/missing.so", Reason: "dangling"},
+		{Path: "/usr/bin/not-a-dir", Target: "busybox/foo", Reason: "dangling"},
+		{Path: "/usr/bin/loop-a", Target: "loop-b", Reason: "loop"},
+		{Path: "/usr/bin/loop-b", Target: "loop-a", Reason: "loop"},
+		// Even if it resolves to a directory of the image, as the kernel
+		// stops at the root.
+		{Path: "/etc/escape-back", Target: "../../etc/libdir", Reason: "escapes the image"},
+		{Path: "/usr/lib/escape", Target: "../../../host/lib", Reason: "escapes the image"},
+	}, broken)
+}
+
+func TestBrokenSymlinks(t *testing.T) {
+	buildWithLink := func(mode, target string) error {
+		fsys := apkfs.NewMemFS()
+		require.NoError(t, fsys.MkdirAll("opt", 0o755))
+		require.NoError(t, fsys.Symlink(target, "opt/tool"))
+
+		bc := newTestContext(t, fsys, WithBrokenSymlinks(mode))
+		return bc.BuildImage(t.Context())
+	}
+
+	require.NoError(t, buildWithLink(BrokenSymlinksFail, "/etc"))
+	require.NoError(t, buildWithLink(BrokenSymlinksWarn, "/missing"))
+	err := buildWithLink(BrokenSymlinksFail, "/missing")
+	require.ErrorContains(t, err, "/opt/tool -> /missing (dangling)")
+	err = buildWithLink(BrokenSymlinksFail, "../../host/etc")
+	require.ErrorContains(t, err, "/opt/tool -> ../../host/etc (escapes the image)")
+}
@@ -22,6 +22,8 @@ import (
 	"io/fs"
 	"iter"
 	"os"
+	"slices"
+	"strings"
 
 	"go.opentelemetry.io/otel"
 	"golang.org/x/sys/unix"
@@ -34,13 +36,13 @@ const xattrTarPAXRecordsPrefix = "SCHILY.xattr."
 
 // writeTar writes a tarball to the provided io.Writer from the provided fs.FS.
 // The etc/passwd and etc/group file provide username and group name mappings for the tar.
-func writeTar(ctx context.Context, tw *tar.Writer, fsys apkfs.FullFS) error { //nolint:gocyclo
+func writeTar(ctx context.Context, tw *tar.Writer, fsys apkfs.FullFS, mtime mtimeFunc) error { //nolint:gocyclo
 	ctx, span := otel.Tracer("go-apk").Start(ctx, "writeTar")
 	defer span.End()
 
 	buf := make([]byte, 1<<20)
 
-	for f, err := range walkFS(ctx, fsys) {
+	for f, err := range walkFS(ctx, fsys, mtime) {
 		if err != nil {
 			return err
 		}
@@ -78,7 +80,25 @@ type file struct {
 	header *tar.Header
 }
 
-func walkFS(ctx context.Context, fsys apkfs.FullFS) iter.Seq2[*file, error] {
+// sortedDirFS sorts the entries returned by ReadDir by name, as fs.ReadDirFS
+// requires but not every backend does, so that fs.WalkDir yields the same
+// order whatever the backend.
+type sortedDirFS struct {
+	apkfs.FullFS
+}
+
+func (s sortedDirFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := s.FullFS.ReadDir(name)
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+	return entries, err
+}
+
+// walkFS yields the files of fsys in a deterministic order: depth first,
+// each directory before its contents, and the entries of a directory sorted
+// by name. The mtimes of the files are set by mtime, if not nil.
+func walkFS(ctx context.Context, fsys apkfs.FullFS, mtime mtimeFunc) iter.Seq2[*file, error] {
 	return func(yield func(*file, error) bool) {
 		usersFile, _ := passwd.ReadUserFile(fsys, "etc/passwd")
 		groupsFile, _ := passwd.ReadGroupFile(fsys, "etc/group")
@@ -91,7 +111,7 @@ func walkFS(ctx context.Context, fsys apkfs.FullFS) iter.Seq2[*file, error] {
 			groups[int(g.GID)] = g.GroupName
 		}
 
-		if err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err := fs.WalkDir(sortedDirFS{fsys}, ".", func(path string, d fs.DirEntry, err error) error {
 			if err := ctx.Err(); err != nil {
 				return err
 			}
@@ -143,6 +163,9 @@ func walkFS(ctx context.Context, fsys apkfs.FullFS) iter.Seq2[*file, error] {
 			header.Name = path
 
 			header.ModTime = info.ModTime()
+			if mtime != nil {
+				header.ModTime = mtime(path)
+			}
 
 			if name, ok := users[header.Uid]; ok {
 				header.Uname = name
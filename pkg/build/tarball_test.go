@@ -3,8 +3,14 @@ package build
 import (
 	"archive/tar"
 	"bytes"
+	"compress/gzip"
 	"context"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
@@ -29,7 +35,7 @@ func TestWriteTar(t *testing.T) {
 	err = m.SetXattr(file, "user.file", []byte("bar"))
 	require.NoError(t, err, "error setting xattr on %s", file)
 	tw := tar.NewWriter(&buf)
-	err = writeTar(context.Background(), tw, m)
+	err = writeTar(context.Background(), tw, m, nil)
 	require.NoError(t, err, "error writing tar")
 	err = tw.Close()
 	require.NoError(t, err, "error closing tar writer")
@@ -46,3 +52,73 @@ func TestWriteTar(t *testing.T) {
 	require.Equal(t, file, hdr.Name, "tar file header name mismatch")
 	require.Equal(t, "bar", hdr.PAXRecords[xattrTarPAXRecordsPrefix+"user.file"], "tar header for file xattr mismatch")
 }
+
+// reversedDirFS lists directories in reverse order, as a backend whose
+// natural order differs from the one of the memfs.
+type reversedDirFS struct {
+	fs.FullFS
+}
+
+func (r reversedDirFS) ReadDir(name string) ([]iofs.DirEntry, error) {
+	entries, err := r.FullFS.ReadDir(name)
+	slices.Reverse(entries)
+	return entries, err
+}
+
+func TestWriteTarOrder(t *testing.T) {
+	m := fs.NewMemFS()
+	for _, dir := range []string{"etc/apk", "usr/bin", "usr/lib", "a-b"} {
+		require.NoError(t, m.MkdirAll(dir, 0o755))
+	}
+	for _, file := range []string{"etc/os-release", "etc/apk/world", "usr/bin/sh", "usr/lib/libc.so", "a-b/c"} {
+		require.NoError(t, m.WriteFile(file, []byte(file), 0o644))
+	}
+	require.NoError(t, m.Symlink("usr/bin", "bin"))
+	for _, p := range []string{"a-b", "a-b/c", "bin", "etc", "etc/apk", "etc/apk/world", "etc/os-release", "usr", "usr/bin", "usr/bin/sh", "usr/lib", "usr/lib/libc.so"} {
+		require.NoError(t, m.Chtimes(p, time.Unix(0, 0), time.Unix(0, 0)))
+	}
+
+	write := func(fsys fs.FullFS) []byte {
+		var buf bytes.Buffer
+		require.NoError(t, writeTar(context.Background(), tar.NewWriter(&buf), fsys, nil))
+		return buf.Bytes()
+	}
+	want := write(m)
+	require.Equal(t, want, write(reversedDirFS{m}))
+
+	var names []string
+	tr := tar.NewReader(bytes.NewReader(want))
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			break
+		}
+		names = append(names, hdr.Name)
+	}
+	require.Equal(t, []string{
+		"a-b", "a-b/c", "bin", "etc", "etc/apk", "etc/apk/world", "etc/os-release",
+		"usr", "usr/bin", "usr/bin/sh", "usr/lib", "usr/lib/libc.so",
+	}, names)
+}
+
+func TestTarballFileName(t *testing.T) {
+	bc := newTestContext(t, nil, WithTempDir(t.TempDir()))
+
+	path, layer, err := bc.BuildLayer(t.Context())
+	require.NoError(t, err)
+	require.Equal(t, "apko-x86_64.tar", filepath.Base(path))
+
+	// The file named by the tarball path is an uncompressed tar.
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	_, err = tar.NewReader(f).Next()
+	require.NoError(t, err)
+
+	// The compressed layer is gzipped.
+	rc, err := layer.Compressed()
+	require.NoError(t, err)
+	defer rc.Close()
+	_, err = gzip.NewReader(rc)
+	require.NoError(t, err)
+}
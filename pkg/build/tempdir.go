@@ -0,0 +1,56 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"context"
+	"os"
+
+	"github.com/chainguard-dev/clog"
+)
+
+// RemoveTempDir removes dir, a temporary directory of a build, unless keep
+// is set (see WithKeepTempDir), in which case it is only logged.
+func RemoveTempDir(ctx context.Context, dir string, keep bool) {
+	log := clog.FromContext(ctx)
+	if keep {
+		log.Infof("keeping temporary directory %s", dir)
+		return
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		log.Warnf("removing temporary directory %s: %v", dir, err)
+	}
+}
+
+// Cleanup removes the temporary directory of the build, which holds the
+// layers and the SBOMs, unless WithKeepTempDir was set. It is to be called
+// once they are no longer needed.
+func (bc *Context) Cleanup(ctx context.Context) {
+	if bc.o.TempDirPath == "" {
+		return
+	}
+	RemoveTempDir(ctx, bc.o.TempDirPath, bc.o.KeepTempDir)
+	if !bc.o.KeepTempDir {
+		bc.o.TempDirPath = ""
+	}
+}
+
+// cleanupOnError removes the temporary directory of a failed build when the
+// Context created it itself, rather than it being given with WithTempDir.
+func (bc *Context) cleanupOnError(ctx context.Context, err error) {
+	if err != nil && bc.ownsTempDir {
+		bc.Cleanup(ctx)
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+)
+
+func TestCleanup(t *testing.T) {
+	dir := t.TempDir()
+	foo := writeTestAPK(t, dir, &apk.Package{Name: "foo", Origin: "foo"}, map[string]string{"usr/share/foo": "foo"})
+
+	for _, keep := range []bool{false, true} {
+		t.Run(fmt.Sprintf("keep=%t", keep), func(t *testing.T) {
+			ctx := t.Context()
+
+			// Without WithTempDir, the build creates its temporary directory
+			// in TMPDIR.
+			tmpdir := t.TempDir()
+			t.Setenv("TMPDIR", tmpdir)
+
+			bc := newRepoContext(t, repoConfig(dir), []*apk.RepositoryPackage{foo}, WithKeepTempDir(keep))
+			layer, _, err := bc.BuildLayer(ctx)
+			require.NoError(t, err)
+			require.FileExists(t, layer)
+
+			bc.Cleanup(ctx)
+			entries, err := os.ReadDir(tmpdir)
+			require.NoError(t, err)
+			if keep {
+				require.Len(t, entries, 1)
+				require.FileExists(t, layer)
+			} else {
+				require.Empty(t, entries)
+			}
+		})
+	}
+}
+
+func TestCleanupOnError(t *testing.T) {
+	dir := t.TempDir()
+	foo := writeTestAPK(t, dir, &apk.Package{Name: "foo", Origin: "foo"}, map[string]string{"usr/share/foo": "foo"})
+	bar := writeTestAPK(t, dir, &apk.Package{Name: "bar", Origin: "bar"}, map[string]string{"usr/share/foo": "bar"})
+
+	// A temporary directory given with WithTempDir is left to the caller.
+	tmp := t.TempDir()
+	bc := newRepoContext(t, repoConfig(dir), []*apk.RepositoryPackage{foo, bar},
+		WithFileOwnershipCheck(true),
+		WithTempDir(tmp),
+	)
+	_, _, err := bc.BuildLayer(t.Context())
+	require.ErrorIs(t, err, ErrPackageConflict)
+	require.DirExists(t, tmp)
+}
@@ -0,0 +1,72 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// timeoutError is the error of a build which did not finish within the
+// timeout set with WithBuildTimeout. It wraps context.DeadlineExceeded and
+// the error the build failed with.
+type timeoutError struct {
+	timeout time.Duration
+	err     error
+}
+
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("build did not finish within %s: %v", e.timeout, e.err)
+}
+
+func (e *timeoutError) Unwrap() []error {
+	return []error{context.DeadlineExceeded, e.err}
+}
+
+// WithTimeout returns ctx bounded by timeout, e.g. the one set with
+// WithBuildTimeout, unless it is zero, for callers running builds and the
+// steps that follow them, such as writing or publishing their index, under
+// a single deadline. The returned function, to be called once they are
+// done, cancels the context and returns err, their error, wrapped to tell
+// that they timed out if they did.
+func WithTimeout(ctx context.Context, timeout time.Duration) (context.Context, func(err error) error) {
+	if timeout <= 0 {
+		return ctx, func(err error) error { return err }
+	}
+	return withDeadline(ctx, time.Now().Add(timeout), timeout)
+}
+
+// withTimeout is WithTimeout for the steps of a build, which share the
+// deadline set when the Context was created.
+func (bc *Context) withTimeout(ctx context.Context) (context.Context, func(err error) error) {
+	if bc.deadline.IsZero() {
+		return ctx, func(err error) error { return err }
+	}
+	return withDeadline(ctx, bc.deadline, bc.o.BuildTimeout)
+}
+
+func withDeadline(ctx context.Context, deadline time.Time, timeout time.Duration) (context.Context, func(err error) error) {
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	return ctx, func(err error) error {
+		defer cancel()
+		var te *timeoutError
+		if err == nil || errors.As(err, &te) || !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return err
+		}
+		return &timeoutError{timeout: timeout, err: err}
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"hash"
 	"maps"
 	"os"
+	"path"
 	"reflect"
 	"regexp"
 	"slices"
@@ -38,6 +39,9 @@ import (
 // as a filename, we restrict it to a safe subset of characters.
 var certNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
 
+// Regex for valid profile snippet names, which are also used as filenames.
+var profileNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
 // Attempt to probe an upstream VCS URL if known.
 func (ic *ImageConfiguration) ProbeVCSUrl(ctx context.Context, imageConfigPath string) {
 	log := clog.FromContext(ctx)
@@ -123,12 +127,21 @@ func (ic *ImageConfiguration) MergeInto(target *ImageConfiguration) error {
 	if target.WorkDir == "" {
 		target.WorkDir = ic.WorkDir
 	}
+	if target.Author == "" {
+		target.Author = ic.Author
+	}
+	if target.Comment == "" {
+		target.Comment = ic.Comment
+	}
 	if target.Layering == nil {
 		target.Layering = ic.Layering
 	}
 	if target.Certificates == nil {
 		target.Certificates = ic.Certificates
 	}
+	if target.NSSwitch == nil {
+		target.NSSwitch = ic.NSSwitch
+	}
 	if len(target.Archs) == 0 {
 		target.Archs = ic.Archs
 	}
@@ -156,6 +169,11 @@ func (ic *ImageConfiguration) MergeInto(target *ImageConfiguration) error {
 	}
 
 	target.Volumes = slices.Concat(ic.Volumes, target.Volumes)
+	// Snippets in the target replace those with the same name.
+	profile := slices.DeleteFunc(slices.Clone(ic.Profile), func(p ProfileSnippet) bool {
+		return slices.ContainsFunc(target.Profile, func(t ProfileSnippet) bool { return t.Name == p.Name })
+	})
+	target.Profile = slices.Concat(profile, target.Profile)
 
 	// Update the contents.
 	return ic.Contents.MergeInto(&target.Contents)
@@ -165,6 +183,7 @@ func (a *ImageAccounts) MergeInto(target *ImageAccounts) error {
 	if target.RunAs == "" {
 		target.RunAs = a.RunAs
 	}
+	target.Shadow = target.Shadow || a.Shadow
 	target.Users = slices.Concat(a.Users, target.Users)
 	target.Groups = slices.Concat(a.Groups, target.Groups)
 	return nil
@@ -176,6 +195,19 @@ func (i *ImageContents) MergeInto(target *ImageContents) error {
 	target.RuntimeOnlyRepositories = slices.Concat(i.RuntimeOnlyRepositories, target.RuntimeOnlyRepositories)
 	target.Repositories = slices.Concat(i.Repositories, target.Repositories)
 	target.Packages = slices.Concat(i.Packages, target.Packages)
+	target.RemovePackages = slices.Concat(i.RemovePackages, target.RemovePackages)
+	target.RemovePaths = slices.Concat(i.RemovePaths, target.RemovePaths)
+	if len(i.PackageLabels) != 0 {
+		labels := make(map[string][]string, len(i.PackageLabels)+len(target.PackageLabels))
+		for name, l := range i.PackageLabels {
+			labels[name] = slices.Clone(l)
+		}
+		for name, l := range target.PackageLabels {
+			labels[name] = slices.Concat(labels[name], l)
+		}
+		target.PackageLabels = labels
+	}
+	target.AppPackages = slices.Concat(i.AppPackages, target.AppPackages)
 	if target.BaseImage == nil {
 		target.BaseImage = i.BaseImage
 	}
@@ -224,6 +256,10 @@ func (ic *ImageConfiguration) Validate() error {
 		if u.HomeDir == "" {
 			ic.Accounts.Users[i].HomeDir = "/home/" + u.UserName
 		}
+
+		if strings.ContainsAny(u.PasswordHash, ":\n") {
+			return fmt.Errorf("configured user %s has a password hash containing ':' or a newline", u.UserName)
+		}
 	}
 
 	for _, g := range ic.Accounts.Groups {
@@ -242,6 +278,49 @@ func (ic *ImageConfiguration) Validate() error {
 			}
 		}
 	}
+
+	for _, p := range ic.Contents.RemovePaths {
+		if !path.IsAbs(p) || path.Clean(p) == "/" {
+			return fmt.Errorf("configured path to remove %q must be absolute and not /", p)
+		}
+	}
+
+	for name, labels := range ic.Contents.PackageLabels {
+		if name == "" {
+			return fmt.Errorf("configured package labels have no package name")
+		}
+		if slices.Contains(labels, "") {
+			return fmt.Errorf("configured labels of package %s contain an empty label", name)
+		}
+	}
+
+	for _, pattern := range ic.Contents.AppPackages {
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+			return fmt.Errorf("configured application package pattern %q is invalid", pattern)
+		}
+	}
+
+	profileNames := map[string]struct{}{}
+	for _, snippet := range ic.Profile {
+		if !profileNameRegex.MatchString(snippet.Name) {
+			return fmt.Errorf("configured profile snippet %q has an invalid name, it must match %s", snippet.Name, profileNameRegex.String())
+		}
+		if _, ok := profileNames[snippet.Name]; ok {
+			return fmt.Errorf("configured profile snippet %q is set more than once", snippet.Name)
+		}
+		profileNames[snippet.Name] = struct{}{}
+	}
+
+	if ic.NSSwitch != nil {
+		for db, sources := range ic.NSSwitch.Databases {
+			if db == "" || strings.ContainsAny(db, ": \t\n") {
+				return fmt.Errorf("configured nsswitch database %q has an invalid name", db)
+			}
+			if strings.Contains(sources, "\n") {
+				return fmt.Errorf("configured nsswitch database %s has sources containing a newline", db)
+			}
+		}
+	}
 	return nil
 }
 
@@ -280,6 +359,9 @@ func (ic *ImageConfiguration) Summarize(ctx context.Context) {
 	if ic.StopSignal != "" {
 		log.Infof("  stop signal: %s", ic.StopSignal)
 	}
+	if ic.Author != "" {
+		log.Infof("  author: %s", ic.Author)
+	}
 
 	if ic.Accounts.RunAs != "" || len(ic.Accounts.Users) != 0 || len(ic.Accounts.Groups) != 0 {
 		log.Infof("  accounts:")
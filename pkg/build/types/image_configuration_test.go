@@ -188,6 +188,10 @@ func TestMergeInto(t *testing.T) {
 				"org.extra": "foo",
 				"org.blah":  "foo",
 			},
+			Profile: []types.ProfileSnippet{
+				{Name: "extra", Content: "export EXTRA=foo"},
+				{Name: "var", Content: "export VAR=foo"},
+			},
 		},
 		target: types.ImageConfiguration{
 			Cmd:        "bar",
@@ -208,6 +212,9 @@ func TestMergeInto(t *testing.T) {
 			Annotations: map[string]string{
 				"org.blah": "bar",
 			},
+			Profile: []types.ProfileSnippet{
+				{Name: "var", Content: "export VAR=bar"},
+			},
 		},
 		expected: types.ImageConfiguration{
 			Contents: types.ImageContents{
@@ -241,6 +248,48 @@ func TestMergeInto(t *testing.T) {
 				"org.extra": "foo",
 				"org.blah":  "bar",
 			},
+			Profile: []types.ProfileSnippet{
+				{Name: "extra", Content: "export EXTRA=foo"},
+				{Name: "var", Content: "export VAR=bar"},
+			},
+		},
+	}, {
+		name: "package labels",
+		source: types.ImageConfiguration{
+			Contents: types.ImageContents{
+				PackageLabels: map[string][]string{
+					"glibc": {"os"},
+					"zlib":  {"os"},
+				},
+			},
+		},
+		target: types.ImageConfiguration{
+			Contents: types.ImageContents{
+				PackageLabels: map[string][]string{
+					"zlib":   {"compression"},
+					"python": {"runtime"},
+				},
+			},
+		},
+		expected: types.ImageConfiguration{
+			Contents: types.ImageContents{
+				PackageLabels: map[string][]string{
+					"glibc":  {"os"},
+					"zlib":   {"os", "compression"},
+					"python": {"runtime"},
+				},
+			},
+		},
+	}, {
+		name: "app packages",
+		source: types.ImageConfiguration{
+			Contents: types.ImageContents{AppPackages: []string{"myapp-*"}},
+		},
+		target: types.ImageConfiguration{
+			Contents: types.ImageContents{AppPackages: []string{"python-3.*"}},
+		},
+		expected: types.ImageConfiguration{
+			Contents: types.ImageContents{AppPackages: []string{"myapp-*", "python-3.*"}},
 		},
 	}}
 
@@ -291,6 +340,48 @@ func TestValidate(t *testing.T) {
 			},
 		},
 		expectError: `configured additional certificate "my-cert@123!" has an invalid name, it must match ^[a-zA-Z0-9_-]+$`,
+	}, {
+		name: "path walking profile snippet name",
+		configuration: types.ImageConfiguration{
+			Profile: []types.ProfileSnippet{{Name: "../bashrc"}},
+		},
+		expectError: `configured profile snippet "../bashrc" has an invalid name, it must match ^[a-zA-Z0-9_-]+$`,
+	}, {
+		name: "duplicate profile snippet name",
+		configuration: types.ImageConfiguration{
+			Profile: []types.ProfileSnippet{{Name: "java"}, {Name: "java"}},
+		},
+		expectError: `configured profile snippet "java" is set more than once`,
+	}, {
+		name: "nsswitch database with colon",
+		configuration: types.ImageConfiguration{
+			NSSwitch: &types.ImageNSSwitch{
+				Databases: map[string]string{"hosts:": "files"},
+			},
+		},
+		expectError: `configured nsswitch database "hosts:" has an invalid name`,
+	}, {
+		name: "nsswitch sources with newline",
+		configuration: types.ImageConfiguration{
+			NSSwitch: &types.ImageNSSwitch{
+				Databases: map[string]string{"hosts": "files\npasswd: ldap"},
+			},
+		},
+		expectError: `configured nsswitch database hosts has sources containing a newline`,
+	}, {
+		name: "empty package label",
+		configuration: types.ImageConfiguration{
+			Contents: types.ImageContents{
+				PackageLabels: map[string][]string{"zlib": {"os", ""}},
+			},
+		},
+		expectError: `configured labels of package zlib contain an empty label`,
+	}, {
+		name: "invalid app package pattern",
+		configuration: types.ImageConfiguration{
+			Contents: types.ImageContents{AppPackages: []string{"myapp-[*"}},
+		},
+		expectError: `configured application package pattern "myapp-[*" is invalid`,
 	}}
 
 	for _, tt := range tests {
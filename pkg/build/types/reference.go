@@ -0,0 +1,53 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+// NormalizeReference parses an image reference and fills in the parts left
+// implicit, following the Docker rules:
+//
+//   - references without a registry are on Docker Hub (index.docker.io),
+//     and single-component repositories there are under library/;
+//   - the first component is a registry if it contains a "." or a ":"
+//     (e.g. a port, "localhost:5000" or "[::1]:5000") or is "localhost";
+//   - references without a tag or digest are tagged "latest".
+//
+// The fully qualified reference is available from Name() on the result.
+func NormalizeReference(ref string) (name.Reference, error) {
+	if ref == "" {
+		return nil, errors.New("empty image reference")
+	}
+
+	s, opts := ref, []name.Option{}
+	if rest, ok := strings.CutPrefix(ref, "localhost/"); ok {
+		// go-containerregistry only recognises localhost as a registry when
+		// it has a port.
+		s = rest
+		opts = append(opts, name.WithDefaultRegistry("localhost"))
+	}
+
+	parsed, err := name.ParseReference(s, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("parsing image reference %q: %w", ref, err)
+	}
+	return parsed, nil
+}
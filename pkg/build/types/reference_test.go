@@ -0,0 +1,57 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeReference(t *testing.T) {
+	const digest = "sha256:0123456789012345678901234567890123456789012345678901234567890123"
+
+	for _, tc := range []struct {
+		ref      string
+		expected string
+		registry string
+		wantErr  bool
+	}{
+		{ref: "alpine", expected: "index.docker.io/library/alpine:latest", registry: "index.docker.io"},
+		{ref: "alpine:3.20", expected: "index.docker.io/library/alpine:3.20", registry: "index.docker.io"},
+		{ref: "docker.io/alpine", expected: "index.docker.io/library/alpine:latest", registry: "index.docker.io"},
+		{ref: "chainguard/static", expected: "index.docker.io/chainguard/static:latest", registry: "index.docker.io"},
+		{ref: "cgr.dev/chainguard/static:latest", expected: "cgr.dev/chainguard/static:latest", registry: "cgr.dev"},
+		{ref: "cgr.dev/chainguard/static@" + digest, expected: "cgr.dev/chainguard/static@" + digest, registry: "cgr.dev"},
+		{ref: "localhost:5000/foo", expected: "localhost:5000/foo:latest", registry: "localhost:5000"},
+		{ref: "registry.example.com:8443/a/b:v1", expected: "registry.example.com:8443/a/b:v1", registry: "registry.example.com:8443"},
+		{ref: "[::1]:5000/foo:v1", expected: "[::1]:5000/foo:v1", registry: "[::1]:5000"},
+		{ref: "localhost/foo", expected: "localhost/foo:latest", registry: "localhost"},
+		{ref: "", wantErr: true},
+		{ref: "Alpine", wantErr: true},
+		{ref: "alpine:bad:tag", wantErr: true},
+	} {
+		t.Run(tc.ref, func(t *testing.T) {
+			ref, err := NormalizeReference(tc.ref)
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, ref.Name())
+			require.Equal(t, tc.registry, ref.Context().RegistryStr())
+		})
+	}
+}
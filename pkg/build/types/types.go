@@ -15,6 +15,7 @@
 package types
 
 import (
+	"encoding/base64"
 	"fmt"
 	"net/url"
 	"runtime"
@@ -64,6 +65,9 @@ type User struct {
 	Shell string `json:"shell,omitempty"`
 	// Optional: The user's home directory
 	HomeDir string `json:"homedir,omitempty"`
+	// Optional: The user's hashed password, as it appears in /etc/shadow.
+	// Only used when shadow is enabled, users without one are locked.
+	PasswordHash string `json:"password-hash,omitempty" yaml:"password-hash,omitempty"`
 }
 
 type GID *uint32
@@ -122,6 +126,18 @@ type ImageContents struct {
 	Packages []string `json:"packages,omitempty" yaml:"packages,omitempty"`
 	// Optional: Base image to build on top of. Warning: Experimental.
 	BaseImage *BaseImageDescriptor `json:"baseimage,omitempty" yaml:"baseimage,omitempty" apko:"experimental"`
+	// Optional: A list of installed packages to remove, with their files,
+	// e.g. documentation pulled in by a metapackage
+	RemovePackages []string `json:"remove_packages,omitempty" yaml:"remove_packages,omitempty"`
+	// Optional: A list of absolute paths to remove once packages are
+	// installed. Directories are removed with their contents.
+	RemovePaths []string `json:"remove_paths,omitempty" yaml:"remove_paths,omitempty"`
+	// Optional: Labels of the installed packages, keyed by package name,
+	// e.g. to generate SBOMs of only the packages with a given label
+	PackageLabels map[string][]string `json:"package_labels,omitempty" yaml:"package_labels,omitempty"`
+	// Optional: Patterns of the names of the packages of the application,
+	// e.g. "myapp-*", to tell them from the operating system in the SBOMs
+	AppPackages []string `json:"app_packages,omitempty" yaml:"app_packages,omitempty"`
 }
 
 // MarshalYAML implements yaml.Marshaler for ImageContents, redacting URLs in
@@ -168,6 +184,10 @@ type ImageAccounts struct {
 	Users []User `json:"users,omitempty" yaml:"users"`
 	// Required: List of groups to populate the image with
 	Groups []Group `json:"groups,omitempty" yaml:"groups"`
+	// Optional: Write /etc/shadow, with an entry for every account in
+	// /etc/passwd. Accounts are locked unless they have a password hash
+	// configured.
+	Shadow bool `json:"shadow,omitempty" yaml:"shadow,omitempty"`
 }
 
 type ImageConfiguration struct {
@@ -187,6 +207,12 @@ type ImageConfiguration struct {
 	StopSignal string `json:"stop-signal,omitempty" yaml:"stop-signal,omitempty"`
 	// Optional: The working directory of the container
 	WorkDir string `json:"work-dir,omitempty" yaml:"work-dir,omitempty"`
+	// Optional: The author of the image, e.g. its maintainer, recorded in
+	// the image configuration. Defaults to apko.
+	Author string `json:"author,omitempty" yaml:"author,omitempty"`
+	// Optional: A comment describing the image, recorded in the history
+	// entries of its layers
+	Comment string `json:"comment,omitempty" yaml:"comment,omitempty"`
 	// Optional: Account configuration for the container image
 	Accounts ImageAccounts `json:"accounts,omitempty" yaml:"accounts,omitempty"`
 	// Optional: List of CPU architectures to build the container image for
@@ -222,6 +248,13 @@ type ImageConfiguration struct {
 
 	// Optional: Certificates to install in the container image
 	Certificates *ImageCertificates `json:"certificates,omitempty" yaml:"certificates,omitempty"`
+
+	// Optional: Write /etc/nsswitch.conf, unless a package provides one
+	NSSwitch *ImageNSSwitch `json:"nsswitch,omitempty" yaml:"nsswitch,omitempty"`
+
+	// Optional: Shell snippets to write to /etc/profile.d, which login
+	// shells source on startup
+	Profile []ProfileSnippet `json:"profile,omitempty" yaml:"profile,omitempty"`
 }
 
 // Architecture represents a CPU architecture for the container image.
@@ -434,6 +467,36 @@ type SBOM struct {
 	Format        string
 	PredicateType string
 	Digest        v1.Hash
+	// Content is the SBOM written to Path, when the generator returns it.
+	Content []byte
+	// SignaturePath is the detached signature of the SBOM at Path, when it
+	// is signed.
+	SignaturePath string
+	// Metrics are the counts of the elements of the SBOM, when the generator
+	// reports them.
+	Metrics *SBOMMetrics
+}
+
+// SBOMMetrics are the counts of the elements of an SBOM, e.g. to monitor the
+// size of the SBOMs across builds without parsing them.
+type SBOMMetrics struct {
+	Packages      int
+	Relationships int
+	// Files is the number of files, which are only listed when requested,
+	// e.g. the files generated by apko.
+	Files int
+	// LicenseRefs is the number of licenses which are not on the SPDX
+	// license list, declared with LicenseRef- identifiers.
+	LicenseRefs int
+}
+
+// AnnotationValue returns the SBOM base64 encoded, for use as the value of
+// an OCI annotation. It is empty if the SBOM content is not known.
+func (s SBOM) AnnotationValue() string {
+	if len(s.Content) == 0 {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(s.Content)
 }
 
 type Layering struct {
@@ -456,3 +519,20 @@ type ImageCertificates struct {
 	// Additional certificates to install in the image
 	Additional []AdditionalCertificateEntry `json:"additional,omitempty" yaml:"additional,omitempty"`
 }
+
+type ProfileSnippet struct {
+	// Required: The name of the snippet, written to /etc/profile.d/<name>.sh
+	//
+	// Must only contain letters, digits, '_' and '-'.
+	Name string `json:"name" yaml:"name"`
+	// Required: The shell commands, e.g. "export EDITOR=vi"
+	Content string `json:"content" yaml:"content"`
+}
+
+type ImageNSSwitch struct {
+	// Optional: The sources to look each database up in, e.g. "hosts: files dns"
+	//
+	// These are added to, or replace, the defaults, which look accounts up in
+	// files and hosts in files and then DNS.
+	Databases map[string]string `json:"databases,omitempty" yaml:"databases,omitempty"`
+}
@@ -15,17 +15,23 @@
 package options
 
 import (
+	"cmp"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"path"
 	"runtime"
+	"slices"
+	"strings"
 	"time"
 
 	"chainguard.dev/apko/pkg/apk/apk"
 	"chainguard.dev/apko/pkg/apk/auth"
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
 	"chainguard.dev/apko/pkg/build/types"
 	"chainguard.dev/apko/pkg/sbom/generator"
+	soptions "chainguard.dev/apko/pkg/sbom/options"
 )
 
 // SizeLimits configures maximum sizes for various operations to prevent unbounded reads.
@@ -53,6 +59,21 @@ func DefaultSizeLimits() SizeLimits {
 	}
 }
 
+// SBOMArchPlaceholder is the placeholder of SBOMOutput.FileName replaced
+// with the apk architecture of the image, or "index" for the index SBOM.
+const SBOMArchPlaceholder = "{arch}"
+
+// SBOMOutput is how the SBOMs of a format are named and ordered.
+type SBOMOutput struct {
+	// FileName is the template of the file names of the SBOMs, in the SBOM
+	// directory, e.g. "{arch}.spdx.json", or empty for sbom-{arch}.<ext>. It
+	// must contain SBOMArchPlaceholder.
+	FileName string `json:"fileName,omitempty"`
+	// Priority orders the formats, the highest first. The SBOMs of the first
+	// format are the primary ones, e.g. those of the SBOM digest annotation.
+	Priority int `json:"priority,omitempty"`
+}
+
 type Options struct {
 	WithVCS bool `json:"withVCS,omitempty"`
 	// ImageConfigFile might, but does not have to be a filename. It might be any abstract configuration identifier.
@@ -85,6 +106,195 @@ type Options struct {
 	Transport               http.RoundTripper     `json:"-"`
 	PackageGetter           apk.PackageGetter     `json:"-"`
 	SizeLimits              SizeLimits            `json:"sizeLimits,omitempty"`
+
+	// ArchSourceDateEpochs overrides SourceDateEpoch for specific
+	// architectures in multi-arch builds.
+	ArchSourceDateEpochs map[types.Architecture]time.Time `json:"archSourceDateEpochs,omitempty"`
+	// SBOMExtraPackages are components not tracked by apk to merge into
+	// the image SBOMs.
+	SBOMExtraPackages []soptions.ExtraPackage `json:"-"`
+	// SourceRepository and SourceCommit identify the source the image
+	// configuration was built from, for recording in the SBOMs.
+	SourceRepository string `json:"sourceRepository,omitempty"`
+	SourceCommit     string `json:"sourceCommit,omitempty"`
+	// CheckFileOwnership checks the package file lists for files provided
+	// by more than one package before installing anything.
+	CheckFileOwnership bool `json:"checkFileOwnership,omitempty"`
+	// ConfigHistory adds empty_layer history entries to the image for the
+	// configuration-only settings.
+	ConfigHistory bool `json:"configHistory,omitempty"`
+	// ReproducibilityManifest builds a manifest of the build inputs.
+	ReproducibilityManifest bool `json:"reproducibilityManifest,omitempty"`
+	// ReproducibilityManifestDigest is recorded in the creation comment of
+	// the index SBOM when set.
+	ReproducibilityManifestDigest string `json:"-"`
+	// SBOMComment is set as the comment of the generated SBOM documents.
+	SBOMComment string `json:"sbomComment,omitempty"`
+	// SBOMIndexSignatures records, on each package in the SBOMs, whether
+	// the signature of the index it was resolved from was verified.
+	SBOMIndexSignatures bool `json:"sbomIndexSignatures,omitempty"`
+	// PruneEmptyDirs removes empty directories from the image filesystem,
+	// except PruneKeepDirs and the directories kept by default.
+	PruneEmptyDirs bool     `json:"pruneEmptyDirs,omitempty"`
+	PruneKeepDirs  []string `json:"pruneKeepDirs,omitempty"`
+	// FetchConcurrency is the maximum number of packages fetched at once,
+	// or zero to use GOMAXPROCS.
+	FetchConcurrency int `json:"fetchConcurrency,omitempty"`
+	// CanonicalApkDB sorts the entries of the installed apk database by
+	// package name once the packages are installed.
+	CanonicalApkDB bool `json:"canonicalApkDB,omitempty"`
+	// SBOMLicenseListVersion is the SPDX license list version declared in
+	// the SBOMs, or empty for the generator's default.
+	SBOMLicenseListVersion string `json:"sbomLicenseListVersion,omitempty"`
+	// SBOMNormalizeLicenses normalizes the license expressions in the
+	// SBOMs against the embedded SPDX license list.
+	SBOMNormalizeLicenses bool `json:"sbomNormalizeLicenses,omitempty"`
+	// BuildTimeout bounds the duration of the whole build, or zero for no
+	// timeout.
+	BuildTimeout time.Duration `json:"buildTimeout,omitempty"`
+	// BrokenSymlinks is how symlinks whose target is missing from the image,
+	// or outside of it, are handled: "warn", "fail", or empty to not check them.
+	BrokenSymlinks string `json:"brokenSymlinks,omitempty"`
+	// CompressionConcurrency is the maximum number of layers of a layered
+	// image compressed at once, or zero for a default based on GOMAXPROCS.
+	CompressionConcurrency int `json:"compressionConcurrency,omitempty"`
+	// StalePins reports the packages pinned to a version older than the
+	// newest one available in the repositories, see build.StalePin.
+	StalePins bool `json:"stalePins,omitempty"`
+	// MaxLayerSize is the maximum total size, in bytes, of the layers of the
+	// image, compressed if MaxLayerSizeCompressed, or zero for no maximum.
+	MaxLayerSize           int64 `json:"maxLayerSize,omitempty"`
+	MaxLayerSizeCompressed bool  `json:"maxLayerSizeCompressed,omitempty"`
+	// SBOMPackageNameTemplate is the template of the names of the apk
+	// packages in the SBOMs, see the PackageName method of the SBOM
+	// options, or empty to use the package names.
+	SBOMPackageNameTemplate string `json:"sbomPackageNameTemplate,omitempty"`
+	// SBOMRelationshipComments comments the relationships from the image to
+	// its packages in the SBOMs with why the packages were installed.
+	SBOMRelationshipComments bool `json:"sbomRelationshipComments,omitempty"`
+	// SBOMGeneratedFiles adds the files generated by apko, rather than
+	// installed from packages, to the SBOMs as generated from apko, and
+	// the configuration files among them as configuration of the image.
+	SBOMGeneratedFiles bool `json:"sbomGeneratedFiles,omitempty"`
+	// KeepTempDir keeps the temporary and working directories of the build
+	// once it is done, e.g. for debugging, rather than removing them.
+	KeepTempDir bool `json:"keepTempDir,omitempty"`
+	// DisableHTTP2 restricts the requests to the repositories to HTTP/1.1.
+	DisableHTTP2 bool `json:"disableHTTP2,omitempty"`
+	// SBOMSplitVersions records the upstream version, epoch and release of
+	// the apk packages in the SBOMs separately, in addition to their full
+	// versions.
+	SBOMSplitVersions bool `json:"sbomSplitVersions,omitempty"`
+	// FileCapabilities are the capabilities set on files of the image, keyed
+	// by absolute path, in the setcap(8) notation, e.g.
+	// "cap_net_bind_service+ep". They are recorded in the layers as the
+	// security.capability xattr.
+	FileCapabilities map[string]string `json:"fileCapabilities,omitempty"`
+	// StandardDirs are directories created if missing and given their
+	// ownership and permissions before the path mutations of the image
+	// configuration are applied, e.g. build.DefaultStandardDirs.
+	StandardDirs []types.PathMutation `json:"standardDirs,omitempty"`
+	// VerifyDependencies checks, once the packages are installed and those
+	// to remove removed, that the runtime dependencies of every installed
+	// package are satisfied.
+	VerifyDependencies bool `json:"verifyDependencies,omitempty"`
+	// ForceRemovePackages removes the packages listed in remove_packages
+	// even if remaining packages depend on them.
+	ForceRemovePackages bool `json:"forceRemovePackages,omitempty"`
+	// PackageMtimes sets the mtime of each file in the layers to the build
+	// date of the package owning it rather than to the mtime of the file,
+	// falling back to SourceDateEpoch for the files no package owns.
+	PackageMtimes bool `json:"packageMtimes,omitempty"`
+	// SBOMIndexDigests records, as annotations of the SBOM documents, the
+	// digests of the repository indexes the packages were resolved from.
+	SBOMIndexDigests bool `json:"sbomIndexDigests,omitempty"`
+	// RequireLicenses fails the build, after resolution, if any package has
+	// an empty or NOASSERTION license, unless it is in LicenseExceptions.
+	RequireLicenses bool `json:"requireLicenses,omitempty"`
+	// LicenseExceptions are the names of the packages allowed to have no
+	// license when RequireLicenses is set.
+	LicenseExceptions []string `json:"licenseExceptions,omitempty"`
+	// SBOMDigestAnnotation annotates the descriptor of each image in the
+	// index with the digest of its SBOM.
+	SBOMDigestAnnotation bool `json:"sbomDigestAnnotation,omitempty"`
+	// SBOMStreaming encodes the packages of the JSON SBOMs to their files one
+	// at a time rather than the whole documents in memory first.
+	SBOMStreaming bool `json:"sbomStreaming,omitempty"`
+	// NoScripts neither records the scriptlets and triggers of the packages
+	// nor does what apko does in place of running them, e.g. the busybox
+	// links and /etc/ld.so.cache.
+	NoScripts bool `json:"noScripts,omitempty"`
+	// CABundle is the path of a PEM CA certificates bundle to install in
+	// /etc/ssl/certs unless a package already installed one.
+	CABundle string `json:"caBundle,omitempty"`
+	// ApkDBRoot is the directory of the apk database, relative to the root
+	// of the image, when not the default /usr/lib/apk.
+	ApkDBRoot string `json:"apkDBRoot,omitempty"`
+	// SBOMContentNamespace derives the namespace of the SBOM documents from
+	// the hash of the packages they describe.
+	SBOMContentNamespace bool `json:"sbomContentNamespace,omitempty"`
+	// SBOMPackageVCS adds the commits the packages were built from to their
+	// purls in the SBOMs, along with the SBOMPackageVCSURL repository.
+	SBOMPackageVCS    bool   `json:"sbomPackageVCS,omitempty"`
+	SBOMPackageVCSURL string `json:"sbomPackageVCSURL,omitempty"`
+	// Distroless leaves DistrolessPaths, or the default ones, out of the
+	// layers of the image.
+	Distroless      bool     `json:"distroless,omitempty"`
+	DistrolessPaths []string `json:"distrolessPaths,omitempty"`
+	// SBOMPackageLabel restricts the packages of the SBOMs to those with
+	// the label in the package labels of the image configuration.
+	SBOMPackageLabel string `json:"sbomPackageLabel,omitempty"`
+	// SBOMPackagesOnly describes only the packages in the SBOMs, rather
+	// than the image and its layers.
+	SBOMPackagesOnly bool `json:"sbomPackagesOnly,omitempty"`
+	// ResolvedPackages, when set, are installed as is rather than resolving
+	// the packages of the image configuration.
+	ResolvedPackages []*apk.RepositoryPackage `json:"-"`
+	// SBOMSigningKey is the path of the private key to sign the SBOMs
+	// with, if any.
+	SBOMSigningKey string `json:"sbomSigningKey,omitempty"`
+	// SBOMImagePurlType and SBOMImagePurlNamespace are the type and
+	// namespace of the purls of the image and its layers in the SBOMs, by
+	// default "oci" and none.
+	SBOMImagePurlType      string `json:"sbomImagePurlType,omitempty"`
+	SBOMImagePurlNamespace string `json:"sbomImagePurlNamespace,omitempty"`
+	// PermissionsSummary summarizes the permissions of the files of the
+	// image once it is built.
+	PermissionsSummary bool `json:"permissionsSummary,omitempty"`
+	// SBOMLint checks the SBOMs for the schema violations apko can make
+	// before writing them, see build.WithSBOMLint.
+	SBOMLint bool `json:"sbomLint,omitempty"`
+	// SBOMDuplicateVersions is how packages installed with several versions
+	// are handled in the SBOMs, see soptions.DuplicateVersions.
+	SBOMDuplicateVersions string `json:"sbomDuplicateVersions,omitempty"`
+	// SBOMPackagePurposes sets the primaryPackagePurpose of the packages
+	// of the SBOMs by their type, see soptions.PackagePurposes, with those
+	// of the apk packages in SBOMPackagePurposeOverrides taking precedence.
+	SBOMPackagePurposes         bool              `json:"sbomPackagePurposes,omitempty"`
+	SBOMPackagePurposeOverrides map[string]string `json:"sbomPackagePurposeOverrides,omitempty"`
+	// SBOMAppPackages are patterns of the names of the application
+	// packages, on top of the app_packages of the image configuration, see
+	// soptions.AppPackages, which the SBOMs relate the image to with
+	// SBOMAppPackageRelationship.
+	SBOMAppPackages            []string `json:"sbomAppPackages,omitempty"`
+	SBOMAppPackageRelationship string   `json:"sbomAppPackageRelationship,omitempty"`
+	// SBOMTimestampFormat is the Go time layout of the timestamps of the
+	// SBOMs, always in UTC, or empty for RFC 3339.
+	SBOMTimestampFormat string `json:"sbomTimestampFormat,omitempty"`
+	// SBOMEmbedConfig records the image configuration, as YAML, in the
+	// SBOMs.
+	SBOMEmbedConfig bool `json:"sbomEmbedConfig,omitempty"`
+	// SBOMConcurrency is the maximum number of SBOMs of an image, one per
+	// format, generated at once, or zero for a default based on GOMAXPROCS.
+	SBOMConcurrency int `json:"sbomConcurrency,omitempty"`
+	// SBOMOutputs are the names and priorities of the SBOMs, keyed by the
+	// key of their generator. Formats missing from the map get the default
+	// name and a priority of zero.
+	SBOMOutputs map[string]SBOMOutput `json:"sbomOutputs,omitempty"`
+	// NewFilesystem creates the filesystem the image is built in when none
+	// is given to the build context, e.g. for each architecture of a
+	// multi-architecture build.
+	NewFilesystem func() apkfs.FullFS `json:"-"`
 }
 
 type Auth struct{ User, Pass string }
@@ -112,11 +322,41 @@ func (o *Options) TempDir() string {
 	return o.TempDirPath
 }
 
-// TarballFileName returns a deterministic filename for the layer taball
+// InstalledDBPath returns the path of the installed apk database of the
+// image, relative to its root, under ApkDBRoot.
+func (o *Options) InstalledDBPath() string {
+	return path.Join(cmp.Or(o.ApkDBRoot, apk.DefaultDBRoot), "db", "installed")
+}
+
+// TarballFileName returns a deterministic filename for the layer taball.
+// The layer tarball is written uncompressed, so the name ends in .tar; the
+// compressed copy made when the layer is pushed or saved gets the
+// extension of its compression appended (e.g. .tar.gz).
 func (o Options) TarballFileName() string {
-	tarName := "apko.tar.gz"
+	tarName := "apko.tar"
 	if o.Arch.String() != "" {
-		tarName = fmt.Sprintf("apko-%s.tar.gz", o.Arch.ToAPK())
+		tarName = fmt.Sprintf("apko-%s.tar", o.Arch.ToAPK())
 	}
 	return tarName
 }
+
+// SortedSBOMGenerators returns the SBOM generators in the order their SBOMs
+// are written and listed: by decreasing priority in SBOMOutputs, then in
+// the order of SBOMGenerators.
+func (o Options) SortedSBOMGenerators() []generator.Generator {
+	gens := slices.Clone(o.SBOMGenerators)
+	slices.SortStableFunc(gens, func(a, b generator.Generator) int {
+		return cmp.Compare(o.SBOMOutputs[b.Key()].Priority, o.SBOMOutputs[a.Key()].Priority)
+	})
+	return gens
+}
+
+// SBOMFileName returns the file name of the SBOM written by gen for arch, the
+// apk architecture of an image, or "index" for the index SBOM.
+func (o Options) SBOMFileName(gen generator.Generator, arch string) string {
+	name := o.SBOMOutputs[gen.Key()].FileName
+	if name == "" {
+		name = "sbom-" + SBOMArchPlaceholder + "." + gen.Ext()
+	}
+	return strings.ReplaceAll(name, SBOMArchPlaceholder, arch)
+}
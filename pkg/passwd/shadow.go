@@ -0,0 +1,156 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package passwd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+)
+
+// LockedPassword is the password field of a shadow entry for an account
+// which cannot be logged into with a password.
+const LockedPassword = "!"
+
+// ShadowEntry contains the parsed data from an /etc/shadow entry.
+//
+// The aging fields are kept as they appear in the file, as they are
+// commonly left empty.
+type ShadowEntry struct {
+	UserName         string
+	Password         string
+	LastChange       string
+	MinAge           string
+	MaxAge           string
+	WarnPeriod       string
+	InactivityPeriod string
+	ExpirationDate   string
+	Reserved         string
+}
+
+// ShadowFile contains the entries from an /etc/shadow file.
+type ShadowFile struct {
+	Entries []ShadowEntry
+	fsys    apkfs.FullFS
+}
+
+// ReadOrCreateShadowFile parses an /etc/shadow file into a ShadowFile.
+// An empty file is created if /etc/shadow is missing.
+func ReadOrCreateShadowFile(fsys apkfs.FullFS, filePath string) (ShadowFile, error) {
+	sf := ShadowFile{fsys: fsys}
+
+	file, err := fsys.OpenFile(filePath, os.O_RDONLY|os.O_CREATE, 0o600)
+	if err != nil {
+		return sf, fmt.Errorf("failed to open %s: %w", filePath, err)
+	}
+	defer file.Close()
+
+	if err := sf.Load(file); err != nil {
+		return sf, err
+	}
+
+	return sf, nil
+}
+
+// Load loads an /etc/shadow file into a ShadowFile from an io.Reader.
+func (sf *ShadowFile) Load(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		se := ShadowEntry{}
+		if err := se.Parse(scanner.Text()); err != nil {
+			return fmt.Errorf("unable to parse: %w", err)
+		}
+
+		sf.Entries = append(sf.Entries, se)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("unable to parse: %w", err)
+	}
+
+	return nil
+}
+
+// WriteFile writes an /etc/shadow file from a ShadowFile. The file is only
+// readable by root.
+func (sf *ShadowFile) WriteFile(filePath string) error {
+	file, err := sf.fsys.Create(filePath)
+	if err != nil {
+		return fmt.Errorf("unable to open %s for writing: %w", filePath, err)
+	}
+	defer file.Close()
+
+	if err := sf.Write(file); err != nil {
+		return err
+	}
+
+	if err := sf.fsys.Chmod(filePath, 0o600); err != nil {
+		return fmt.Errorf("unable to set mode of %s: %w", filePath, err)
+	}
+	if err := sf.fsys.Chown(filePath, 0, 0); err != nil {
+		return fmt.Errorf("unable to set owner of %s: %w", filePath, err)
+	}
+
+	return nil
+}
+
+// Write writes an /etc/shadow file into an io.Writer.
+func (sf *ShadowFile) Write(w io.Writer) error {
+	for _, se := range sf.Entries {
+		if err := se.Write(w); err != nil {
+			return fmt.Errorf("unable to write shadow entry: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Parse parses an /etc/shadow line into a ShadowEntry.
+func (se *ShadowEntry) Parse(line string) error {
+	line = strings.TrimSpace(line)
+
+	parts := strings.Split(line, ":")
+	if len(parts) != 9 {
+		return fmt.Errorf("malformed line, contains %d parts, expecting 9", len(parts))
+	}
+
+	se.UserName = parts[0]
+	se.Password = parts[1]
+	se.LastChange = parts[2]
+	se.MinAge = parts[3]
+	se.MaxAge = parts[4]
+	se.WarnPeriod = parts[5]
+	se.InactivityPeriod = parts[6]
+	se.ExpirationDate = parts[7]
+	se.Reserved = parts[8]
+
+	return nil
+}
+
+// Write writes an /etc/shadow line into an io.Writer.
+func (se *ShadowEntry) Write(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "%s:%s:%s:%s:%s:%s:%s:%s:%s\n",
+		se.UserName, se.Password, se.LastChange, se.MinAge, se.MaxAge,
+		se.WarnPeriod, se.InactivityPeriod, se.ExpirationDate, se.Reserved)
+	return err
+}
@@ -0,0 +1,51 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package passwd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	apkfs "chainguard.dev/apko/pkg/apk/fs"
+)
+
+func TestShadow(t *testing.T) {
+	const shadow = "root:*:19000:0:::::\nnobody:!:::::::\n"
+
+	fsys := apkfs.NewMemFS()
+	require.NoError(t, fsys.MkdirAll("etc", 0o755))
+	require.NoError(t, fsys.WriteFile("etc/shadow", []byte(shadow), 0o644))
+
+	sf, err := ReadOrCreateShadowFile(fsys, "etc/shadow")
+	require.NoError(t, err)
+	require.Equal(t, []ShadowEntry{
+		{UserName: "root", Password: "*", LastChange: "19000", MinAge: "0"},
+		{UserName: "nobody", Password: LockedPassword},
+	}, sf.Entries)
+
+	w := &bytes.Buffer{}
+	require.NoError(t, sf.Write(w))
+	require.Equal(t, shadow, w.String())
+
+	require.NoError(t, sf.WriteFile("etc/shadow"))
+	fi, err := fsys.Stat("etc/shadow")
+	require.NoError(t, err)
+	require.Equal(t, "-rw-------", fi.Mode().Perm().String())
+
+	se := ShadowEntry{}
+	require.Error(t, se.Parse("root:*:19000"))
+}
@@ -0,0 +1,191 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sbom
+
+import (
+	"sort"
+
+	purl "github.com/package-url/packageurl-go"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+)
+
+// Component is a package as seen when comparing two package sets.
+type Component struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+
+	// Purl is the package URL of the component, if known. When set, it is
+	// used instead of the name to match components across package sets.
+	Purl string `json:"purl,omitempty"`
+}
+
+// VersionChange records a component present in both package sets with a
+// different version in each.
+type VersionChange struct {
+	Name        string `json:"name"`
+	Purl        string `json:"purl,omitempty"`
+	FromVersion string `json:"fromVersion"`
+	ToVersion   string `json:"toVersion"`
+}
+
+// Diff is the difference between two package sets.
+type Diff struct {
+	Added   []Component     `json:"added"`
+	Removed []Component     `json:"removed"`
+	Changed []VersionChange `json:"changed"`
+}
+
+// Empty returns true if the two package sets were identical.
+func (d *Diff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// PackageComponents returns the components for a resolved package list, as
+// returned by build.Context.BuildPackageList.
+func PackageComponents(pkgs []*apk.RepositoryPackage) []Component {
+	components := make([]Component, 0, len(pkgs))
+	for _, pkg := range pkgs {
+		components = append(components, Component{
+			Name:    pkg.Name,
+			Version: pkg.Version,
+		})
+	}
+	return components
+}
+
+// InstalledComponents returns the components for the packages of an
+// installed apk database.
+func InstalledComponents(pkgs []*apk.InstalledPackage) []Component {
+	components := make([]Component, 0, len(pkgs))
+	for _, pkg := range pkgs {
+		components = append(components, Component{
+			Name:    pkg.Name,
+			Version: pkg.Version,
+		})
+	}
+	return components
+}
+
+// Compare returns the components added, removed and changed going from the
+// old package set to the new one.
+//
+// Components are matched on their purl, ignoring the version and all
+// qualifiers but the architecture, or on their name when they have no purl.
+// Components should therefore come from the same kind of source (two
+// package lists, or two SBOMs) to be matched reliably.
+func Compare(old, new []Component) *Diff {
+	type versions struct {
+		old, new []Component
+	}
+	byID := map[string]*versions{}
+	get := func(c Component) *versions {
+		id := identity(c)
+		v, ok := byID[id]
+		if !ok {
+			v = &versions{}
+			byID[id] = v
+		}
+		return v
+	}
+	for _, c := range old {
+		get(c).old = append(get(c).old, c)
+	}
+	for _, c := range new {
+		get(c).new = append(get(c).new, c)
+	}
+
+	diff := &Diff{
+		Added:   []Component{},
+		Removed: []Component{},
+		Changed: []VersionChange{},
+	}
+	for _, v := range byID {
+		removed := withoutVersions(v.old, v.new)
+		added := withoutVersions(v.new, v.old)
+
+		// Pair up the versions that went away with the ones that replaced
+		// them, anything left over was added or removed outright.
+		for len(removed) > 0 && len(added) > 0 {
+			diff.Changed = append(diff.Changed, VersionChange{
+				Name:        added[0].Name,
+				Purl:        added[0].Purl,
+				FromVersion: removed[0].Version,
+				ToVersion:   added[0].Version,
+			})
+			removed, added = removed[1:], added[1:]
+		}
+		diff.Removed = append(diff.Removed, removed...)
+		diff.Added = append(diff.Added, added...)
+	}
+
+	sortComponents(diff.Added)
+	sortComponents(diff.Removed)
+	sort.Slice(diff.Changed, func(i, j int) bool {
+		if diff.Changed[i].Name != diff.Changed[j].Name {
+			return diff.Changed[i].Name < diff.Changed[j].Name
+		}
+		return diff.Changed[i].Purl < diff.Changed[j].Purl
+	})
+
+	return diff
+}
+
+// identity returns the key used to match a component across package sets.
+func identity(c Component) string {
+	if c.Purl == "" {
+		return c.Name
+	}
+	p, err := purl.FromString(c.Purl)
+	if err != nil {
+		return c.Purl
+	}
+
+	var qualifiers purl.Qualifiers
+	if arch, ok := p.Qualifiers.Map()["arch"]; ok {
+		qualifiers = purl.QualifiersFromMap(map[string]string{"arch": arch})
+	}
+	return purl.NewPackageURL(p.Type, p.Namespace, p.Name, "", qualifiers, "").ToString()
+}
+
+// withoutVersions returns the components in cs whose version does not
+// appear in others, sorted by version.
+func withoutVersions(cs, others []Component) []Component {
+	seen := make(map[string]struct{}, len(others))
+	for _, c := range others {
+		seen[c.Version] = struct{}{}
+	}
+
+	var out []Component
+	for _, c := range cs {
+		if _, ok := seen[c.Version]; !ok {
+			out = append(out, c)
+		}
+	}
+	sortComponents(out)
+	return out
+}
+
+func sortComponents(cs []Component) {
+	sort.Slice(cs, func(i, j int) bool {
+		if cs[i].Name != cs[j].Name {
+			return cs[i].Name < cs[j].Name
+		}
+		if cs[i].Version != cs[j].Version {
+			return cs[i].Version < cs[j].Version
+		}
+		return cs[i].Purl < cs[j].Purl
+	})
+}
@@ -0,0 +1,118 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sbom
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+)
+
+func TestCompare(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		old, new []Component
+		want     *Diff
+	}{{
+		name: "identical",
+		old:  []Component{{Name: "foo", Version: "1.0-r0"}},
+		new:  []Component{{Name: "foo", Version: "1.0-r0"}},
+		want: &Diff{Added: []Component{}, Removed: []Component{}, Changed: []VersionChange{}},
+	}, {
+		name: "added",
+		old:  []Component{{Name: "foo", Version: "1.0-r0"}},
+		new:  []Component{{Name: "foo", Version: "1.0-r0"}, {Name: "bar", Version: "2.0-r0"}},
+		want: &Diff{
+			Added:   []Component{{Name: "bar", Version: "2.0-r0"}},
+			Removed: []Component{},
+			Changed: []VersionChange{},
+		},
+	}, {
+		name: "removed",
+		old:  []Component{{Name: "foo", Version: "1.0-r0"}, {Name: "bar", Version: "2.0-r0"}},
+		new:  []Component{{Name: "foo", Version: "1.0-r0"}},
+		want: &Diff{
+			Added:   []Component{},
+			Removed: []Component{{Name: "bar", Version: "2.0-r0"}},
+			Changed: []VersionChange{},
+		},
+	}, {
+		name: "version bump",
+		old:  []Component{{Name: "foo", Version: "1.0-r0"}},
+		new:  []Component{{Name: "foo", Version: "1.0-r1"}},
+		want: &Diff{
+			Added:   []Component{},
+			Removed: []Component{},
+			Changed: []VersionChange{{Name: "foo", FromVersion: "1.0-r0", ToVersion: "1.0-r1"}},
+		},
+	}, {
+		name: "purl ignores version and distro qualifier",
+		old:  []Component{{Name: "foo", Version: "1.0-r0", Purl: "pkg:apk/wolfi/foo@1.0-r0?arch=x86_64&distro=a"}},
+		new:  []Component{{Name: "foo", Version: "1.1-r0", Purl: "pkg:apk/wolfi/foo@1.1-r0?arch=x86_64&distro=b"}},
+		want: &Diff{
+			Added:   []Component{},
+			Removed: []Component{},
+			Changed: []VersionChange{{
+				Name:        "foo",
+				Purl:        "pkg:apk/wolfi/foo@1.1-r0?arch=x86_64&distro=b",
+				FromVersion: "1.0-r0",
+				ToVersion:   "1.1-r0",
+			}},
+		},
+	}, {
+		name: "purl arch is part of the identity",
+		old:  []Component{{Name: "foo", Version: "1.0-r0", Purl: "pkg:apk/wolfi/foo@1.0-r0?arch=x86_64"}},
+		new:  []Component{{Name: "foo", Version: "1.0-r0", Purl: "pkg:apk/wolfi/foo@1.0-r0?arch=aarch64"}},
+		want: &Diff{
+			Added:   []Component{{Name: "foo", Version: "1.0-r0", Purl: "pkg:apk/wolfi/foo@1.0-r0?arch=aarch64"}},
+			Removed: []Component{{Name: "foo", Version: "1.0-r0", Purl: "pkg:apk/wolfi/foo@1.0-r0?arch=x86_64"}},
+			Changed: []VersionChange{},
+		},
+	}, {
+		name: "multiple versions",
+		old:  []Component{{Name: "foo", Version: "1.0-r0"}, {Name: "foo", Version: "2.0-r0"}},
+		new:  []Component{{Name: "foo", Version: "2.0-r0"}, {Name: "foo", Version: "3.0-r0"}, {Name: "foo", Version: "4.0-r0"}},
+		want: &Diff{
+			Added:   []Component{{Name: "foo", Version: "4.0-r0"}},
+			Removed: []Component{},
+			Changed: []VersionChange{{Name: "foo", FromVersion: "1.0-r0", ToVersion: "3.0-r0"}},
+		},
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := Compare(tc.old, tc.new)
+			require.Equal(t, tc.want, got)
+			require.Equal(t, tc.name == "identical", got.Empty())
+		})
+	}
+}
+
+func TestPackageComponents(t *testing.T) {
+	old := []*apk.RepositoryPackage{
+		{Package: &apk.Package{Name: "foo", Version: "1.0-r0"}},
+		{Package: &apk.Package{Name: "bar", Version: "1.0-r0"}},
+	}
+	new := []*apk.RepositoryPackage{
+		{Package: &apk.Package{Name: "foo", Version: "1.0-r1"}},
+		{Package: &apk.Package{Name: "baz", Version: "1.0-r0"}},
+	}
+
+	require.Equal(t, &Diff{
+		Added:   []Component{{Name: "baz", Version: "1.0-r0"}},
+		Removed: []Component{{Name: "bar", Version: "1.0-r0"}},
+		Changed: []VersionChange{{Name: "foo", FromVersion: "1.0-r0", ToVersion: "1.0-r1"}},
+	}, Compare(PackageComponents(old), PackageComponents(new)))
+}
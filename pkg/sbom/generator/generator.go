@@ -16,6 +16,8 @@ package generator
 
 import (
 	"context"
+	"maps"
+	"slices"
 	"sync"
 
 	"chainguard.dev/apko/pkg/sbom/options"
@@ -30,6 +32,22 @@ type Generator interface {
 	GenerateIndex(*options.Options, string) error
 }
 
+// ContentGenerator is implemented by generators which can also return the
+// SBOM they write, so that callers can embed it, e.g. in an annotation of
+// the image, without reading the file back.
+type ContentGenerator interface {
+	Generator
+	GenerateContent(context.Context, *options.Options, string) ([]byte, error)
+}
+
+// IndexContextGenerator is implemented by generators which generate the
+// index SBOM within a context, e.g. to record its metrics on the span of
+// the generation. GenerateIndex is used for the others.
+type IndexContextGenerator interface {
+	Generator
+	GenerateIndexContext(context.Context, *options.Options, string) error
+}
+
 // GeneratorFactory is a function that creates a Generator.
 type GeneratorFactory func() Generator
 
@@ -47,25 +65,27 @@ func RegisterGenerator(key string, factory GeneratorFactory) {
 	registry[key] = factory
 }
 
-// Generators returns a map of registered generators.
-// If names are provided, only generators with those keys will be returned.
+// Generators returns the registered generators with the given keys, in the
+// order of names, or all of them, by key, if no names are provided. Unknown
+// and repeated names are skipped.
 func Generators(names ...string) []Generator {
 	generators := []Generator{}
 
-	nameIdx := map[string]bool{}
-	for _, n := range names {
-		nameIdx[n] = true
-	}
-	// If no names are provided, return all generators.
-	all := len(nameIdx) == 0
-
 	registryMu.RLock()
 	defer registryMu.RUnlock()
 
-	for key, factory := range registry {
-		if all || nameIdx[key] {
-			generators = append(generators, factory())
+	// If no names are provided, return all generators.
+	if len(names) == 0 {
+		names = slices.Sorted(maps.Keys(registry))
+	}
+	seen := map[string]bool{}
+	for _, key := range names {
+		factory, ok := registry[key]
+		if !ok || seen[key] {
+			continue
 		}
+		seen[key] = true
+		generators = append(generators, factory())
 	}
 
 	return generators
@@ -0,0 +1,81 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spdx
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	purl "github.com/package-url/packageurl-go"
+
+	"chainguard.dev/apko/pkg/sbom"
+)
+
+// ReadDocument reads an SPDX JSON document from disk.
+func ReadDocument(path string) (*Document, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading sbom file %s: %w", path, err)
+	}
+
+	doc := &Document{}
+	if err := json.Unmarshal(data, doc); err != nil {
+		return nil, fmt.Errorf("parsing sbom file %s: %w", path, err)
+	}
+	return doc, nil
+}
+
+// Components returns the packages described by the document, for use with
+// sbom.Compare. The image, layer and index packages are left out as their
+// versions are digests which change with every build.
+func (doc *Document) Components() []sbom.Component {
+	components := make([]sbom.Component, 0, len(doc.Packages))
+	for _, p := range doc.Packages {
+		c := sbom.Component{
+			Name:    p.Name,
+			Version: p.Version,
+		}
+		for _, ref := range p.ExternalRefs {
+			if ref.Type == ExtRefTypePurl {
+				c.Purl = ref.Locator
+				break
+			}
+		}
+		if p.PrimaryPurpose == "CONTAINER" || strings.HasPrefix(p.ID, layerPackageIDPrefix) {
+			continue
+		}
+		if pu, err := purl.FromString(c.Purl); err == nil && pu.Type == purl.TypeOCI {
+			continue
+		}
+		components = append(components, c)
+	}
+	return components
+}
+
+// Diff returns the components added, removed and changed between the SBOMs
+// at oldPath and newPath.
+func Diff(oldPath, newPath string) (*sbom.Diff, error) {
+	oldDoc, err := ReadDocument(oldPath)
+	if err != nil {
+		return nil, err
+	}
+	newDoc, err := ReadDocument(newPath)
+	if err != nil {
+		return nil, err
+	}
+	return sbom.Compare(oldDoc.Components(), newDoc.Components()), nil
+}
@@ -0,0 +1,199 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spdx
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"strings"
+
+	purl "github.com/package-url/packageurl-go"
+
+	"chainguard.dev/apko/pkg/sbom"
+	"chainguard.dev/apko/pkg/sbom/options"
+)
+
+// Update writes the image SBOM for opts to path, and returns it, as
+// GenerateContent does, but takes the elements of the apk packages from
+// prev, the document GenerateContent generated with the same options for a
+// previous package set, rather than from the SBOMs of the packages, which
+// saves reading and parsing them again.
+//
+// The packages added or changed in diff, going from the previous package
+// set to opts.Packages, are read from their SBOMs, as are those whose
+// elements cannot be told apart in prev: those whose SBOM does not describe
+// the package itself, with its apk purl, as the SBOMs melange generates do,
+// and those sharing elements or licensing infos with another package. The
+// result is then the same as that of GenerateContent.
+func (sx *SPDX) Update(ctx context.Context, prev *Document, diff *sbom.Diff, opts *options.Options, path string) ([]byte, error) {
+	doc, err := sx.document(ctx, opts, prevFragments(prev, changedPackages(diff)))
+	if err != nil {
+		return nil, err
+	}
+	return sx.write(ctx, doc, opts, path)
+}
+
+// changedPackages returns the names of the packages added or changed in
+// diff.
+func changedPackages(diff *sbom.Diff) map[string]struct{} {
+	changed := map[string]struct{}{}
+	if diff == nil {
+		return changed
+	}
+	name := func(name, p string) string {
+		if pu, err := purl.FromString(p); err == nil {
+			return pu.Name
+		}
+		return name
+	}
+	for _, c := range diff.Added {
+		changed[name(c.Name, c.Purl)] = struct{}{}
+	}
+	for _, c := range diff.Changed {
+		changed[name(c.Name, c.Purl)] = struct{}{}
+	}
+	return changed
+}
+
+// licenseRefRe matches the references to extracted licensing infos in the
+// license expressions of packages.
+var licenseRefRe = regexp.MustCompile(`LicenseRef-[A-Za-z0-9.-]+`)
+
+// prevFragments returns the fragments of the apk packages of prev, the
+// image SBOM of a previous build, keyed by fragmentKey, but for those of
+// the packages in changed and those whose elements cannot be attributed to
+// them alone, see Update.
+func prevFragments(prev *Document, changed map[string]struct{}) map[string]*apkFragment {
+	if prev == nil || len(prev.DocumentDescribes) == 0 {
+		return nil
+	}
+	root := prev.DocumentDescribes[0]
+	packages := make(map[string]*Package, len(prev.Packages))
+	for i := range prev.Packages {
+		packages[prev.Packages[i].ID] = &prev.Packages[i]
+	}
+
+	// The elements the SBOM of an apk package describes are related to the
+	// root, contained by it unless they are of an application package, and
+	// have the apk purl of the package.
+	type candidate struct {
+		name     string
+		roots    []string
+		ids      map[string]struct{}
+		licenses map[string]struct{}
+	}
+	candidates := map[string]*candidate{}
+	for _, r := range prev.Relationships {
+		if r.Element != root || packages[r.Related] == nil {
+			continue
+		}
+		for _, ref := range packages[r.Related].ExternalRefs {
+			if ref.Type != ExtRefTypePurl {
+				continue
+			}
+			if pu, err := purl.FromString(ref.Locator); err == nil && pu.Type == purl.TypeApk {
+				key := fragmentKey(pu.Name, pu.Version)
+				if candidates[key] == nil {
+					candidates[key] = &candidate{name: pu.Name}
+				}
+				candidates[key].roots = append(candidates[key].roots, r.Related)
+			}
+			break
+		}
+	}
+
+	// Walk the graph from the roots as copySBOMElements does, counting the
+	// packages each element and licensing info is attributed to.
+	owners := map[string]int{}
+	licenseOwners := map[string]int{}
+	for _, c := range candidates {
+		c.ids = make(map[string]struct{}, len(c.roots))
+		for _, id := range c.roots {
+			c.ids[id] = struct{}{}
+		}
+		for prevLen, nextLen := 0, len(c.ids); nextLen != prevLen; prevLen, nextLen = nextLen, len(c.ids) {
+			for _, r := range prev.Relationships {
+				if strings.HasPrefix(r.Related, "SPDXRef-File-") {
+					continue
+				}
+				if _, ok := c.ids[r.Element]; ok {
+					c.ids[r.Related] = struct{}{}
+				}
+			}
+		}
+		c.licenses = map[string]struct{}{}
+		for id := range c.ids {
+			owners[id]++
+			if p := packages[id]; p != nil {
+				for _, ref := range licenseRefRe.FindAllString(p.LicenseDeclared+" "+p.LicenseConcluded, -1) {
+					c.licenses[ref] = struct{}{}
+				}
+			}
+		}
+		for ref := range c.licenses {
+			licenseOwners[ref]++
+		}
+	}
+
+	// The licensing infos no package refers to could come from any of them.
+	for _, l := range prev.LicensingInfos {
+		if licenseOwners[l.LicenseID] == 0 {
+			return nil
+		}
+	}
+
+	fragments := make(map[string]*apkFragment, len(candidates))
+candidates:
+	for key, c := range candidates {
+		if _, ok := changed[c.name]; ok {
+			continue
+		}
+		for id := range c.ids {
+			if owners[id] != 1 || packages[id] == nil {
+				continue candidates
+			}
+		}
+		for ref := range c.licenses {
+			if licenseOwners[ref] != 1 {
+				continue candidates
+			}
+		}
+
+		f := &apkFragment{doc: &Document{}, roots: slices.Sorted(slices.Values(c.roots))}
+		for _, p := range prev.Packages {
+			if _, ok := c.ids[p.ID]; ok {
+				// The annotations of version conflicts are added to the
+				// whole document again.
+				p.Annotations = slices.DeleteFunc(slices.Clone(p.Annotations), func(a Annotation) bool {
+					return strings.HasPrefix(a.Comment, versionConflictPrefix)
+				})
+				f.doc.Packages = append(f.doc.Packages, p)
+			}
+		}
+		for _, r := range prev.Relationships {
+			if _, ok := c.ids[r.Element]; ok && !strings.HasPrefix(r.Related, "SPDXRef-File-") {
+				f.doc.Relationships = append(f.doc.Relationships, r)
+			}
+		}
+		for _, l := range prev.LicensingInfos {
+			if _, ok := c.licenses[l.LicenseID]; ok {
+				f.doc.LicensingInfos = append(f.doc.LicensingInfos, l)
+			}
+		}
+		fragments[key] = f
+	}
+	return fragments
+}
@@ -0,0 +1,186 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spdx
+
+import (
+	"cmp"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"chainguard.dev/apko/pkg/sbom/options"
+)
+
+// The SPDX license list data the license expressions are normalized against,
+// in the format of the licenses.json and exceptions.json files published in
+// https://github.com/spdx/license-list-data.
+var (
+	//go:embed licensedata/licenses.json
+	licensesJSON []byte
+	//go:embed licensedata/exceptions.json
+	exceptionsJSON []byte
+)
+
+// licenseList is the embedded SPDX license list.
+type licenseList struct {
+	// Version is the version of the license list.
+	Version string
+	// licenses and exceptions map the lowercase license and exception
+	// identifiers to their canonical form.
+	licenses   map[string]string
+	exceptions map[string]string
+	// deprecated holds the deprecated license identifiers.
+	deprecated map[string]bool
+}
+
+// embeddedLicenseList returns the embedded SPDX license list.
+var embeddedLicenseList = sync.OnceValue(func() *licenseList {
+	var licenses struct {
+		Version  string `json:"licenseListVersion"`
+		Licenses []struct {
+			ID         string `json:"licenseId"`
+			Deprecated bool   `json:"isDeprecatedLicenseId"`
+		} `json:"licenses"`
+	}
+	if err := json.Unmarshal(licensesJSON, &licenses); err != nil {
+		panic(fmt.Sprintf("parsing the embedded SPDX licenses: %v", err))
+	}
+	var exceptions struct {
+		Version    string `json:"licenseListVersion"`
+		Exceptions []struct {
+			ID string `json:"licenseExceptionId"`
+		} `json:"exceptions"`
+	}
+	if err := json.Unmarshal(exceptionsJSON, &exceptions); err != nil {
+		panic(fmt.Sprintf("parsing the embedded SPDX license exceptions: %v", err))
+	}
+	if licenses.Version != exceptions.Version {
+		panic(fmt.Sprintf("embedded SPDX licenses and exceptions are from versions %s and %s of the license list", licenses.Version, exceptions.Version))
+	}
+
+	l := &licenseList{
+		Version:    licenses.Version,
+		licenses:   map[string]string{},
+		exceptions: map[string]string{},
+		deprecated: map[string]bool{},
+	}
+	for _, lic := range licenses.Licenses {
+		l.licenses[strings.ToLower(lic.ID)] = lic.ID
+		if lic.Deprecated {
+			l.deprecated[lic.ID] = true
+		}
+	}
+	for _, exc := range exceptions.Exceptions {
+		l.exceptions[strings.ToLower(exc.ID)] = exc.ID
+	}
+	return l
+})
+
+// licenseListVersion returns the version of the SPDX license list declared
+// in the SBOMs. When the licenses are normalized it is the version of the
+// embedded license list, which a configured version must then match.
+func licenseListVersion(opts *options.Options) (string, error) {
+	if !opts.NormalizeLicenses {
+		return cmp.Or(opts.LicenseListVersion, DefaultLicenseListVersion), nil
+	}
+	version := embeddedLicenseList().Version
+	if opts.LicenseListVersion != "" && opts.LicenseListVersion != version {
+		return "", fmt.Errorf("license list version %s does not match the version %s of the license list the licenses are normalized with", opts.LicenseListVersion, version)
+	}
+	return version, nil
+}
+
+// normalizeLicense rewrites the license identifiers of the SPDX license
+// expression expr in their canonical form, e.g. "mit" to "MIT", and its
+// operators in uppercase. Deprecated GNU identifiers are replaced with their
+// -only and -or-later forms, e.g. "GPL-2.0+" with "GPL-2.0-or-later".
+// Identifiers not in the license list, such as LicenseRef- ones, are kept.
+func (l *licenseList) normalizeLicense(expr string) string {
+	if strings.EqualFold(expr, NOASSERTION) || strings.EqualFold(expr, "NONE") {
+		return strings.ToUpper(expr)
+	}
+
+	var b strings.Builder
+	prev, afterWith := "", false
+	for _, tok := range strings.Fields(strings.NewReplacer("(", " ( ", ")", " ) ").Replace(expr)) {
+		if prev != "" && prev != "(" && tok != ")" {
+			b.WriteByte(' ')
+		}
+		prev = tok
+
+		switch upper := strings.ToUpper(tok); {
+		case tok == "(" || tok == ")":
+			b.WriteString(tok)
+		case upper == "AND" || upper == "OR" || upper == "WITH":
+			b.WriteString(upper)
+			afterWith = upper == "WITH"
+			continue
+		case afterWith:
+			b.WriteString(cmp.Or(l.exceptions[strings.ToLower(tok)], tok))
+		default:
+			b.WriteString(l.normalizeLicenseID(tok))
+		}
+		afterWith = false
+	}
+	return b.String()
+}
+
+// normalizeLicenseID returns the canonical form of the license identifier
+// id, optionally followed by "+".
+func (l *licenseList) normalizeLicenseID(id string) string {
+	if canonical, ok := l.licenses[strings.ToLower(id)]; ok && !l.deprecated[canonical] {
+		return canonical
+	}
+	base, plus := strings.CutSuffix(id, "+")
+	canonical, ok := l.licenses[strings.ToLower(base)]
+	if !ok {
+		return id
+	}
+	if l.deprecated[canonical] {
+		if replacement, ok := l.licenses[strings.ToLower(canonical+"-or-later")]; ok && plus {
+			return replacement
+		}
+		if replacement, ok := l.licenses[strings.ToLower(canonical+"-only")]; ok && !plus {
+			return replacement
+		}
+	}
+	if plus {
+		return canonical + "+"
+	}
+	return canonical
+}
+
+// normalizeLicenses normalizes the license expressions of the packages and
+// files of doc, see normalizeLicense.
+func normalizeLicenses(doc *Document) {
+	l := embeddedLicenseList()
+	normalize := func(expr *string) {
+		if *expr != "" {
+			*expr = l.normalizeLicense(*expr)
+		}
+	}
+	for i := range doc.Packages {
+		normalize(&doc.Packages[i].LicenseDeclared)
+		normalize(&doc.Packages[i].LicenseConcluded)
+	}
+	for i := range doc.Files {
+		normalize(&doc.Files[i].LicenseConcluded)
+		for j := range doc.Files[i].LicenseInfoInFile {
+			normalize(&doc.Files[i].LicenseInfoInFile[j])
+		}
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spdx
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"chainguard.dev/apko/pkg/sbom/options"
+)
+
+// Values of the enumerations of the SPDX 2.3 JSON schema.
+var (
+	checksumAlgorithms = []string{
+		"SHA1", "SHA224", "SHA256", "SHA384", "SHA512", "SHA3-256", "SHA3-384", "SHA3-512",
+		"BLAKE2b-256", "BLAKE2b-384", "BLAKE2b-512", "BLAKE3", "MD2", "MD4", "MD5", "MD6", "ADLER32",
+	}
+	referenceCategories = []string{
+		"OTHER", "PERSISTENT-ID", "PERSISTENT_ID", "SECURITY", "PACKAGE-MANAGER", "PACKAGE_MANAGER",
+	}
+	annotationTypes = []string{"OTHER", "REVIEW"}
+)
+
+// Patterns of the identifiers of the SPDX 2.3 specification.
+var (
+	elementIDPattern   = regexp.MustCompile(`^SPDXRef-[a-zA-Z0-9.-]+$`)
+	documentRefPattern = regexp.MustCompile(`^DocumentRef-[a-zA-Z0-9.-]+$`)
+	licenseRefPattern  = regexp.MustCompile(`^LicenseRef-[a-zA-Z0-9.-]+$`)
+)
+
+// lintErrors collects the violations found in a document, each prefixed
+// with the JSON path of the offending element.
+type lintErrors []error
+
+func (e *lintErrors) required(path, value string) {
+	if value == "" {
+		*e = append(*e, fmt.Errorf("%s: is required", path))
+	}
+}
+
+func (e *lintErrors) enum(path, value string, values []string) {
+	if !slices.Contains(values, value) {
+		*e = append(*e, fmt.Errorf("%s: %q is not a valid value", path, value))
+	}
+}
+
+func (e *lintErrors) pattern(path, value string, re *regexp.Regexp) {
+	if value != "" && !re.MatchString(value) {
+		*e = append(*e, fmt.Errorf("%s: %q does not match %s", path, value, re))
+	}
+}
+
+// id checks the identifier of an element of the document, and that no other
+// element has the same.
+func (e *lintErrors) id(path, value string, ids map[string]bool) {
+	e.required(path, value)
+	e.pattern(path, value, elementIDPattern)
+	if value == "" {
+		return
+	}
+	if ids[value] {
+		*e = append(*e, fmt.Errorf("%s: %q is the identifier of another element", path, value))
+	}
+	ids[value] = true
+}
+
+// reference checks that value refers to an element of the document, or of a
+// document of refs as "DocumentRef-<id>:SPDXRef-<id>". NONE and NOASSERTION
+// are allowed if special is set.
+func (e *lintErrors) reference(path, value string, ids, refs map[string]bool, special bool) {
+	e.required(path, value)
+	switch {
+	case value == "":
+	case special && (value == NOASSERTION || value == "NONE"):
+	case strings.HasPrefix(value, "DocumentRef-"):
+		ref, id, _ := strings.Cut(value, ":")
+		if !refs[ref] {
+			*e = append(*e, fmt.Errorf("%s: %q is not an external document reference", path, ref))
+		}
+		e.pattern(path, id, elementIDPattern)
+	case !ids[value]:
+		*e = append(*e, fmt.Errorf("%s: %q is not an element of the document", path, value))
+	}
+}
+
+func (e *lintErrors) checksum(path string, c Checksum) {
+	e.enum(path+".algorithm", c.Algorithm, checksumAlgorithms)
+	e.required(path+".checksumValue", c.Value)
+}
+
+func (e *lintErrors) annotation(path string, a Annotation) {
+	e.required(path+".annotationDate", a.Date)
+	e.enum(path+".annotationType", a.Type, annotationTypes)
+	e.required(path+".annotator", a.Annotator)
+	e.required(path+".comment", a.Comment)
+}
+
+// Lint checks the document against the rules of the SPDX 2.3 JSON schema
+// and specification that apko can get wrong: that its required fields are
+// set, that the values of its enumerations are valid, that its identifiers
+// are well-formed and unique, and that its relationships refer to elements
+// of the document or of a referenced one. It is not a full validation
+// against the schema. It returns all the violations found, each with the
+// JSON path of the offending element, e.g.
+// "packages[2].downloadLocation: is required".
+func (doc *Document) Lint() error {
+	var errs lintErrors
+	if doc.Version != "SPDX-2.3" {
+		errs = append(errs, fmt.Errorf("spdxVersion: %q is not supported, only SPDX-2.3 is", doc.Version))
+	}
+	errs.required("SPDXID", doc.ID)
+	if doc.ID != "" && doc.ID != "SPDXRef-DOCUMENT" {
+		errs = append(errs, fmt.Errorf(`SPDXID: %q is not "SPDXRef-DOCUMENT"`, doc.ID))
+	}
+	errs.required("name", doc.Name)
+	errs.required("dataLicense", doc.DataLicense)
+	errs.required("documentNamespace", doc.Namespace)
+	if strings.Contains(doc.Namespace, "#") {
+		errs = append(errs, fmt.Errorf("documentNamespace: %q must not contain #", doc.Namespace))
+	}
+	errs.required("creationInfo.created", doc.CreationInfo.Created)
+	if len(doc.CreationInfo.Creators) == 0 {
+		errs = append(errs, errors.New("creationInfo.creators: must not be empty"))
+	}
+
+	ids := map[string]bool{doc.ID: true}
+	refs := map[string]bool{}
+	for i, p := range doc.Packages {
+		path := fmt.Sprintf("packages[%d]", i)
+		errs.id(path+".SPDXID", p.ID, ids)
+		errs.required(path+".name", p.Name)
+		errs.required(path+".downloadLocation", p.DownloadLocation)
+		if p.PrimaryPurpose != "" {
+			errs.enum(path+".primaryPackagePurpose", p.PrimaryPurpose, options.PackagePurposeValues)
+		}
+		for j, c := range p.Checksums {
+			errs.checksum(fmt.Sprintf("%s.checksums[%d]", path, j), c)
+		}
+		for j, r := range p.ExternalRefs {
+			refPath := fmt.Sprintf("%s.externalRefs[%d]", path, j)
+			errs.enum(refPath+".referenceCategory", r.Category, referenceCategories)
+			errs.required(refPath+".referenceLocator", r.Locator)
+			errs.required(refPath+".referenceType", r.Type)
+		}
+		for j, a := range p.Annotations {
+			errs.annotation(fmt.Sprintf("%s.annotations[%d]", path, j), a)
+		}
+	}
+
+	for i, f := range doc.Files {
+		path := fmt.Sprintf("files[%d]", i)
+		errs.id(path+".SPDXID", f.ID, ids)
+		errs.required(path+".fileName", f.Name)
+		if len(f.Checksums) == 0 {
+			errs = append(errs, fmt.Errorf("%s.checksums: must not be empty", path))
+		}
+		for j, c := range f.Checksums {
+			errs.checksum(fmt.Sprintf("%s.checksums[%d]", path, j), c)
+		}
+	}
+
+	for i, r := range doc.ExternalDocumentRefs {
+		path := fmt.Sprintf("externalDocumentRefs[%d]", i)
+		errs.checksum(path+".checksum", r.Checksum)
+		errs.required(path+".externalDocumentId", r.ExternalDocumentID)
+		errs.pattern(path+".externalDocumentId", r.ExternalDocumentID, documentRefPattern)
+		errs.required(path+".spdxDocument", r.SPDXDocument)
+		refs[r.ExternalDocumentID] = true
+	}
+
+	for i, r := range doc.Relationships {
+		path := fmt.Sprintf("relationships[%d]", i)
+		errs.reference(path+".spdxElementId", r.Element, ids, refs, false)
+		errs.enum(path+".relationshipType", r.Type, options.RelationshipTypeValues)
+		errs.reference(path+".relatedSpdxElement", r.Related, ids, refs, true)
+	}
+
+	for i, l := range doc.LicensingInfos {
+		path := fmt.Sprintf("hasExtractedLicensingInfos[%d]", i)
+		errs.required(path+".licenseId", l.LicenseID)
+		errs.pattern(path+".licenseId", l.LicenseID, licenseRefPattern)
+		errs.required(path+".extractedText", l.ExtractedText)
+	}
+
+	for i, a := range doc.Annotations {
+		errs.annotation(fmt.Sprintf("annotations[%d]", i), a)
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,51 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spdx
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/sbom/options"
+)
+
+// Metrics returns the counts of the elements of the document. The licenses
+// not on the SPDX license list are those of its extracted licensing infos.
+func (doc *Document) Metrics() types.SBOMMetrics {
+	return types.SBOMMetrics{
+		Packages:      len(doc.Packages),
+		Relationships: len(doc.Relationships),
+		Files:         len(doc.Files),
+		LicenseRefs:   len(doc.LicensingInfos),
+	}
+}
+
+// recordMetrics records the Metrics of doc as attributes of the current span
+// of ctx, and reports them to the OnMetrics hook of opts, if any.
+func recordMetrics(ctx context.Context, doc *Document, opts *options.Options) {
+	m := doc.Metrics()
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.Int("sbom.packages", m.Packages),
+		attribute.Int("sbom.relationships", m.Relationships),
+		attribute.Int("sbom.files", m.Files),
+		attribute.Int("sbom.license_refs", m.LicenseRefs),
+	)
+	if opts.OnMetrics != nil {
+		opts.OnMetrics(m)
+	}
+}
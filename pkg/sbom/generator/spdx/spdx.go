@@ -15,14 +15,25 @@
 package spdx
 
 import (
+	"bufio"
+	"bytes"
+	"cmp"
 	"context"
+	"crypto/sha1" //nolint:gosec // SPDX requires SHA1 checksums of files
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"maps"
 	"os"
+	"path"
+	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
-	"time"
 	"unicode/utf8"
 
 	"github.com/chainguard-dev/clog"
@@ -40,6 +51,9 @@ func init() {
 	generator.RegisterGenerator("spdx", func() generator.Generator {
 		return New()
 	})
+	generator.RegisterGenerator("spdx-tv", func() generator.Generator {
+		return NewTagValue()
+	})
 }
 
 // https://spdx.github.io/spdx-spec/3-package-information/#32-package-spdx-identifier
@@ -49,20 +63,36 @@ const (
 	NOASSERTION          = "NOASSERTION"
 	ExtRefPackageManager = "PACKAGE-MANAGER"
 	ExtRefTypePurl       = "purl"
+	ExtRefOther          = "OTHER"
+	ExtRefTypeOCIConfig  = "oci-config"
 	apkSBOMdir           = "/var/lib/db/sbom"
 )
 
-type SPDX struct{}
+type SPDX struct {
+	tagValue bool
+}
 
 func New() *SPDX {
 	return &SPDX{}
 }
 
+// NewTagValue returns a generator writing SPDX documents in the tag-value
+// format rather than JSON, for tools which do not read SPDX JSON.
+func NewTagValue() *SPDX {
+	return &SPDX{tagValue: true}
+}
+
 func (sx *SPDX) Key() string {
+	if sx.tagValue {
+		return "spdx-tv"
+	}
 	return "spdx"
 }
 
 func (sx *SPDX) Ext() string {
+	if sx.tagValue {
+		return "spdx"
+	}
 	return "spdx.json"
 }
 
@@ -90,8 +120,58 @@ func hashToString(h v1.Hash) string {
 	return h.String()
 }
 
+// digestChecksum returns the SPDX checksum for an OCI digest such as
+// "sha512:abcd...", labeled with the algorithm of the digest. Digests
+// without an algorithm are taken to be SHA256.
+func digestChecksum(digest string) Checksum {
+	algorithm, hex, ok := strings.Cut(digest, ":")
+	if !ok {
+		return Checksum{Algorithm: "SHA256", Value: digest}
+	}
+	return Checksum{Algorithm: strings.ToUpper(algorithm), Value: hex}
+}
+
+// DefaultLicenseListVersion is the version of the SPDX license list declared
+// in the SBOMs unless another one is configured or the licenses are
+// normalized, see licenseListVersion.
+const DefaultLicenseListVersion = "3.27"
+
+// documentNamespace is the namespace of the documents, which a content
+// namespace is appended to.
+const documentNamespace = "https://spdx.org/spdxdocs/apko/"
+
 // Generate writes an SPDX SBOM in path
 func (sx *SPDX) Generate(ctx context.Context, opts *options.Options, path string) error {
+	_, err := sx.GenerateContent(ctx, opts, path)
+	return err
+}
+
+// GenerateContent generates the image SBOM like Generate and also returns
+// it, so that it can be embedded e.g. in an annotation of the image without
+// reading the file back.
+func (sx *SPDX) GenerateContent(ctx context.Context, opts *options.Options, path string) ([]byte, error) {
+	doc, err := sx.document(ctx, opts, nil)
+	if err != nil {
+		return nil, err
+	}
+	return sx.write(ctx, doc, opts, path)
+}
+
+// document builds the image SBOM for opts. The elements of the apk packages
+// with an entry in fragments, see fragmentKey, are taken from there rather
+// than from the SBOMs of the packages.
+func (sx *SPDX) document(ctx context.Context, opts *options.Options, fragments map[string]*apkFragment) (*Document, error) {
+	if err := opts.ValidateDigests(); err != nil {
+		return nil, err
+	}
+	if t := opts.AppPackageRelationship; t != "" && !slices.Contains(options.RelationshipTypeValues, t) {
+		return nil, fmt.Errorf("invalid relationship type %q of the application packages", t)
+	}
+	licenseListVersion, err := licenseListVersion(opts)
+	if err != nil {
+		return nil, err
+	}
+
 	// The default document name makes no attempt to avoid
 	// clashes. Ensuring a unique name requires a digest
 	documentName := "sbom"
@@ -103,20 +183,133 @@ func (sx *SPDX) Generate(ctx context.Context, opts *options.Options, path string
 		Name:    documentName,
 		Version: "SPDX-2.3",
 		CreationInfo: CreationInfo{
-			Created: opts.ImageInfo.SourceDateEpoch.Format(time.RFC3339),
+			Created: opts.Timestamp(),
 			Creators: []string{
 				fmt.Sprintf("Tool: apko (%s)", version.GetVersionInfo().GitVersion),
 				"Organization: Chainguard, Inc",
 			},
-			LicenseListVersion: "3.27",
+			LicenseListVersion: licenseListVersion,
 		},
 		DataLicense:    "CC0-1.0",
-		Namespace:      "https://spdx.org/spdxdocs/apko/",
+		Namespace:      documentNamespace,
 		Packages:       []Package{},
 		Relationships:  []Relationship{},
 		LicensingInfos: []LicensingInfo{},
+		Comment:        opts.Comment,
+	}
+	for _, u := range slices.Sorted(maps.Keys(opts.IndexDigests)) {
+		doc.Annotations = append(doc.Annotations, annotation(opts, fmt.Sprintf("apk-index: %s %s", u, opts.IndexDigests[u])))
+	}
+	if len(opts.Config) != 0 {
+		doc.Annotations = append(doc.Annotations, configAnnotation(opts))
+	}
+
+	if opts.PackagesOnly {
+		root := packageCollection(opts)
+		doc.Packages = append(doc.Packages, root)
+		doc.DocumentDescribes = []string{root.ID}
+	} else {
+		sx.addImagePackages(doc, opts)
+	}
+
+	conflicts := opts.VersionConflicts()
+	if len(conflicts) != 0 && opts.DuplicateVersions == options.DuplicateVersionsFail {
+		name := slices.Min(slices.Collect(maps.Keys(conflicts)))
+		return nil, fmt.Errorf("package %s is listed with several versions: %s", name, strings.Join(conflicts[name], ", "))
+	}
+
+	for _, pkg := range opts.Packages {
+		if opts.PackageLabel != "" && !slices.Contains(opts.PackageLabels[pkg.Name], opts.PackageLabel) {
+			continue
+		}
+		if f, ok := fragments[fragmentKey(pkg.Name, pkg.Version)]; ok {
+			addFragment(ctx, opts, doc, pkg, f)
+			continue
+		}
+		// Check to see if the apk contains an sbom describing itself
+		f, err := sx.apkFragment(opts, pkg)
+		if err != nil {
+			return nil, fmt.Errorf("parsing internal apk SBOM: %w", err)
+		}
+		if f == nil {
+			// The packages without an SBOM are only described when the
+			// signature status of their index is recorded, on a package
+			// built from their metadata.
+			if _, ok := opts.IndexSignatures[pkg.Name]; !ok {
+				continue
+			}
+			f = metadataFragment(opts, &pkg.Package)
+		}
+		addFragment(ctx, opts, doc, pkg, f)
+	}
+
+	if opts.DuplicateVersions == options.DuplicateVersionsAnnotate {
+		annotateVersionConflicts(opts, doc, conflicts)
+	}
+
+	if !opts.PackagesOnly {
+		if err := addGeneratedFiles(doc, opts); err != nil {
+			return nil, fmt.Errorf("adding generated files: %w", err)
+		}
 	}
 
+	if err := addExtraPackages(doc, opts); err != nil {
+		return nil, fmt.Errorf("adding extra packages: %w", err)
+	}
+
+	dedupedPackages := make([]Package, 0, len(doc.Packages))
+	seenIDs := make(map[string]struct{})
+	for i := range doc.Packages {
+		if _, ok := seenIDs[doc.Packages[i].ID]; !ok {
+			seenIDs[doc.Packages[i].ID] = struct{}{}
+			dedupedPackages = append(dedupedPackages, doc.Packages[i])
+		} else {
+			clog.FromContext(ctx).Info("duplicate package ID found in SBOM, deduplicating package...", "ID", doc.Packages[i].ID)
+		}
+	}
+	doc.Packages = dedupedPackages
+
+	if opts.NormalizeLicenses {
+		normalizeLicenses(doc)
+	}
+
+	if opts.ContentNamespace {
+		doc.Namespace = contentNamespace(doc)
+	}
+
+	return doc, nil
+}
+
+// write writes doc to path, after linting it if requested, and returns
+// the encoded document, or nil if it was streamed.
+func (sx *SPDX) write(ctx context.Context, doc *Document, opts *options.Options, path string) ([]byte, error) {
+	recordMetrics(ctx, doc, opts)
+
+	if opts.Lint {
+		if err := doc.Lint(); err != nil {
+			return nil, fmt.Errorf("linting document: %w", err)
+		}
+	}
+
+	if opts.StreamPackages && !sx.tagValue {
+		if err := streamDoc(doc, path); err != nil {
+			return nil, fmt.Errorf("rendering document: %w", err)
+		}
+		return nil, nil
+	}
+
+	content, err := sx.render(doc, path)
+	if err != nil {
+		return nil, fmt.Errorf("rendering document: %w", err)
+	}
+
+	return content, nil
+}
+
+// addImagePackages adds the packages describing the image, its layers, the
+// operating system and the source of the image, with the image, or the
+// layer without one, as the root of the document.
+func (sx *SPDX) addImagePackages(doc *Document, opts *options.Options) {
 	var imagePackage *Package
 	if opts.ImageInfo.ImageDigest != "" {
 		imagePackage = sx.imagePackage(opts)
@@ -152,31 +345,24 @@ func (sx *SPDX) Generate(ctx context.Context, opts *options.Options, path string
 			addSourcePackage(opts.ImageInfo.VCSUrl, doc, imagePackage, opts)
 		}
 	}
+}
 
-	for _, pkg := range opts.Packages {
-		// Check to see if the apk contains an sbom describing itself
-		if err := sx.ProcessInternalApkSBOM(ctx, opts, doc, pkg); err != nil {
-			return fmt.Errorf("parsing internal apk SBOM: %w", err)
-		}
-	}
+// packageCollectionID is the SPDX identifier of the root of packages only
+// documents.
+const packageCollectionID = "SPDXRef-Package-Collection"
 
-	dedupedPackages := make([]Package, 0, len(doc.Packages))
-	seenIDs := make(map[string]struct{})
-	for i := range doc.Packages {
-		if _, ok := seenIDs[doc.Packages[i].ID]; !ok {
-			seenIDs[doc.Packages[i].ID] = struct{}{}
-			dedupedPackages = append(dedupedPackages, doc.Packages[i])
-		} else {
-			clog.FromContext(ctx).Info("duplicate package ID found in SBOM, deduplicating package...", "ID", doc.Packages[i].ID)
-		}
-	}
-	doc.Packages = dedupedPackages
-
-	if err := renderDoc(doc, path); err != nil {
-		return fmt.Errorf("rendering document: %w", err)
+// packageCollection returns the synthetic package at the root of packages
+// only documents, which contains the apk packages in place of the image.
+func packageCollection(opts *options.Options) Package {
+	return Package{
+		ID:               packageCollectionID,
+		Name:             "apk-packages",
+		Version:          opts.OS.Version,
+		Supplier:         supplier(opts),
+		FilesAnalyzed:    false,
+		Description:      "Collection of the apk packages installed in the image",
+		DownloadLocation: NOASSERTION,
 	}
-
-	return nil
 }
 
 // locateApkSBOM returns the path to the SBOM in the given filesystem, using the
@@ -206,21 +392,47 @@ func locateApkSBOM(fsys apkfs.ReaderFS, ipkg *apk.InstalledPackage) (string, err
 }
 
 func (sx *SPDX) ProcessInternalApkSBOM(ctx context.Context, opts *options.Options, doc *Document, ipkg *apk.InstalledPackage) error {
+	f, err := sx.apkFragment(opts, ipkg)
+	if err != nil || f == nil {
+		return err
+	}
+	addFragment(ctx, opts, doc, ipkg, f)
+	return nil
+}
+
+// apkFragment holds the elements the SBOM of an apk package contributes to
+// the image SBOM: the packages and relationships copied from it, with the
+// per-package options applied, and its licensing infos, in doc, and the
+// identifiers of the elements it describes in roots, sorted.
+type apkFragment struct {
+	doc   *Document
+	roots []string
+}
+
+// fragmentKey is the key of the apkFragment of a package in the maps of
+// fragments.
+func fragmentKey(name, version string) string {
+	return name + "@" + version
+}
+
+// apkFragment returns the elements of the SBOM of the apk package ipkg, or
+// nil if it has none.
+func (sx *SPDX) apkFragment(opts *options.Options, ipkg *apk.InstalledPackage) (*apkFragment, error) {
 	// Check if apk installed an SBOM
 	path, err := locateApkSBOM(opts.FS, ipkg)
 	if err != nil {
-		return fmt.Errorf("inspecting FS for internal apk SBOM: %w", err)
+		return nil, fmt.Errorf("inspecting FS for internal apk SBOM: %w", err)
 	}
 	if path == "" {
 		// The SBOM does not exist.
 		// (So just ignore that the package was specified to the SPDX Generate method?)
-		return nil
+		return nil, nil
 	}
 
 	apkSBOMDoc, err := sx.ParseInternalSBOM(opts, path)
 	if err != nil {
 		// TODO: Log error parsing apk SBOM
-		return nil
+		return nil, nil
 	}
 
 	// Cycle the top level elements...
@@ -260,26 +472,346 @@ func (sx *SPDX) ProcessInternalApkSBOM(ctx context.Context, opts *options.Option
 		todo[id] = struct{}{}
 	}
 
-	if err := copySBOMElements(apkSBOMDoc, doc, todo); err != nil {
-		return fmt.Errorf("copying element: %w", err)
+	f := &apkFragment{
+		doc:   &Document{LicensingInfos: apkSBOMDoc.LicensingInfos},
+		roots: slices.Sorted(maps.Keys(targetElementIDs)),
+	}
+	if err := copySBOMElements(apkSBOMDoc, f.doc, todo); err != nil {
+		return nil, fmt.Errorf("copying element: %w", err)
+	}
+
+	applyPackageOptions(opts, f.doc, targetElementIDs, &ipkg.Package)
+	return f, nil
+}
+
+// metadataFragment returns the fragment of the apk package pkg without an
+// SBOM of its own: its APKPackage.
+func metadataFragment(opts *options.Options, pkg *apk.Package) *apkFragment {
+	p := APKPackage(opts, pkg)
+	return &apkFragment{
+		doc:   &Document{Packages: []Package{p}},
+		roots: []string{p.ID},
 	}
+}
 
-	mergeLicensingInfos(ctx, apkSBOMDoc, doc)
+// addFragment adds the elements of f, the fragment of the apk package ipkg,
+// to doc, with CONTAINS relationships from the document root package to the
+// top-level elements of the fragment.
+func addFragment(ctx context.Context, opts *options.Options, doc *Document, ipkg *apk.InstalledPackage, f *apkFragment) {
+	doc.Packages = append(doc.Packages, f.doc.Packages...)
+	doc.Relationships = append(doc.Relationships, f.doc.Relationships...)
+
+	mergeLicensingInfos(ctx, f.doc, doc)
 
 	// Add CONTAINS relationships from the document root package to all top-level elements from the internal SBOM.
 	// This ensures they are reachable from the document root for tools that traverse the SBOM graph.
 	if len(doc.DocumentDescribes) > 0 {
 		rootPkgID := doc.DocumentDescribes[0]
-		for elementID := range targetElementIDs {
-			doc.Relationships = append(doc.Relationships, Relationship{
-				Element: rootPkgID,
-				Type:    "CONTAINS",
-				Related: elementID,
-			})
+		for _, elementID := range f.roots {
+			doc.Relationships = append(doc.Relationships, rootRelationship(opts, rootPkgID, elementID, ipkg.Name))
 		}
 	}
+}
 
-	return nil
+// appPackageComment is the comment of the OTHER relationships from the root
+// package to the application packages, see options.AppPackages.
+const appPackageComment = "APPLICATION_PACKAGE"
+
+// rootRelationship returns the relationship from root to the element id of
+// the apk package name: CONTAINS, or the relationship of the application
+// packages for those of the application, commented with the provenance of
+// the package when known.
+func rootRelationship(opts *options.Options, root, id, name string) Relationship {
+	r := Relationship{
+		Element: root,
+		Type:    "CONTAINS",
+		Related: id,
+		Comment: opts.RelationshipComments[name],
+	}
+	if !opts.IsAppPackage(name) {
+		return r
+	}
+	r.Type = cmp.Or(opts.AppPackageRelationship, "OTHER")
+	if r.Type == "OTHER" {
+		r.Comment = strings.Join(slices.DeleteFunc([]string{appPackageComment, r.Comment}, func(s string) bool { return s == "" }), "; ")
+	}
+	return r
+}
+
+// APKPackage returns the SPDX package describing the apk package pkg, built
+// from its metadata, as a fragment for the tools which enrich SBOMs package
+// by package. Its identifier and purl are those of the package SBOMs merged
+// into the image SBOMs, and the per-package options, e.g. the package name
+// template or split versions, apply to it as to them.
+func APKPackage(opts *options.Options, pkg *apk.Package) Package {
+	license := pkg.License
+	if license == "" {
+		license = NOASSERTION
+	}
+	p := Package{
+		ID:               "SPDXRef-Package-" + stringToIdentifier(pkg.Name+"-"+pkg.Version),
+		Name:             pkg.Name,
+		Version:          pkg.Version,
+		Supplier:         supplier(opts),
+		FilesAnalyzed:    false,
+		LicenseConcluded: NOASSERTION,
+		LicenseDeclared:  license,
+		CopyrightText:    NOASSERTION,
+		Description:      pkg.Description,
+		DownloadLocation: NOASSERTION,
+		ExternalRefs: []ExternalRef{{
+			Category: ExtRefPackageManager,
+			Type:     ExtRefTypePurl,
+			Locator:  APKPurl(opts, pkg),
+		}},
+	}
+
+	doc := &Document{Packages: []Package{p}}
+	applyPackageOptions(opts, doc, map[string]struct{}{p.ID: {}}, pkg)
+	return doc.Packages[0]
+}
+
+// APKPurl returns the purl of the apk package pkg, namespaced by the ID of
+// the operating system of the image, e.g.
+// "pkg:apk/wolfi/busybox@1.36.1-r5?arch=x86_64".
+func APKPurl(opts *options.Options, pkg *apk.Package) string {
+	namespace := strings.ToLower(opts.OS.ID)
+	if namespace == "" {
+		namespace = "unknown"
+	}
+	var qualifiers purl.Qualifiers
+	if pkg.Arch != "" {
+		qualifiers = purl.QualifiersFromMap(map[string]string{"arch": pkg.Arch})
+	}
+	return purl.NewPackageURL(purl.TypeApk, namespace, pkg.Name, pkg.Version, qualifiers, "").ToString()
+}
+
+// applyPackageOptions applies the per-package options to the packages in
+// ids, which describe the apk package pkg.
+func applyPackageOptions(opts *options.Options, doc *Document, ids map[string]struct{}, pkg *apk.Package) {
+	name := pkg.Name
+	if opts.PackageNameTemplate != "" {
+		renamePackages(opts, doc, ids, pkg.Arch)
+	}
+
+	if verified, ok := opts.IndexSignatures[name]; ok {
+		status := "unverified"
+		if verified {
+			status = "verified"
+		}
+		annotatePackages(opts, doc, ids, "index-signature: "+status)
+	}
+	if applets := opts.BusyboxApplets[name]; len(applets) > 0 {
+		annotatePackages(opts, doc, ids, "busybox-applets: "+strings.Join(applets, " "))
+	}
+	if opts.SplitPackageVersions {
+		splitPackageVersions(opts, doc, ids)
+	}
+	if opts.PackageVCS {
+		addVCSQualifiers(opts, doc, ids, pkg)
+	}
+	if opts.PackagePurposes {
+		setPackagePurposes(doc, ids, opts.PackagePurpose(pkg))
+	}
+}
+
+// setPackagePurposes sets the primaryPackagePurpose of the packages in ids.
+func setPackagePurposes(doc *Document, ids map[string]struct{}, purpose string) {
+	for i := range doc.Packages {
+		if _, ok := ids[doc.Packages[i].ID]; !ok {
+			continue
+		}
+		doc.Packages[i].PrimaryPurpose = purpose
+	}
+}
+
+// addVCSQualifiers adds the commit pkg was built from, when its metadata
+// has one, as the commit qualifier of the apk purls of the packages in ids,
+// and, when the options name the repository the packages are built from,
+// as the vcs_url qualifier too.
+func addVCSQualifiers(opts *options.Options, doc *Document, ids map[string]struct{}, pkg *apk.Package) {
+	if pkg.RepoCommit == "" {
+		return
+	}
+	for i := range doc.Packages {
+		p := &doc.Packages[i]
+		if _, ok := ids[p.ID]; !ok {
+			continue
+		}
+		for j := range p.ExternalRefs {
+			ref := &p.ExternalRefs[j]
+			if ref.Type != ExtRefTypePurl {
+				continue
+			}
+			pu, err := purl.FromString(ref.Locator)
+			if err != nil || pu.Type != purl.TypeApk {
+				continue
+			}
+			qualifiers := pu.Qualifiers.Map()
+			qualifiers["commit"] = pkg.RepoCommit
+			if opts.PackageVCSURL != "" {
+				qualifiers["vcs_url"] = "git+" + opts.PackageVCSURL + "@" + pkg.RepoCommit
+			}
+			pu.Qualifiers = purl.QualifiersFromMap(qualifiers)
+			ref.Locator = pu.ToString()
+		}
+	}
+}
+
+// renamePackages names the packages in ids after the package name template
+// of the options. Their SPDX identifiers are left alone.
+func renamePackages(opts *options.Options, doc *Document, ids map[string]struct{}, arch string) {
+	for i := range doc.Packages {
+		if _, ok := ids[doc.Packages[i].ID]; !ok {
+			continue
+		}
+		doc.Packages[i].Name = opts.PackageName(doc.Packages[i].Name, doc.Packages[i].Version, arch)
+	}
+}
+
+// annotatePackages adds an annotation with comment to the packages in ids.
+func annotatePackages(opts *options.Options, doc *Document, ids map[string]struct{}, comment string) {
+	for i := range doc.Packages {
+		if _, ok := ids[doc.Packages[i].ID]; !ok {
+			continue
+		}
+		doc.Packages[i].Annotations = append(doc.Packages[i].Annotations, annotation(opts, comment))
+	}
+}
+
+// versionConflictPrefix starts the comment of the annotations of the
+// versions of the packages in conflict.
+const versionConflictPrefix = "version-conflict: "
+
+// annotateVersionConflicts annotates the apk packages of doc named in
+// conflicts, as returned by VersionConflicts, with the versions of the
+// package in conflict. The apk packages are told apart by their purl, as
+// their names may have been changed by PackageNameTemplate.
+func annotateVersionConflicts(opts *options.Options, doc *Document, conflicts map[string][]string) {
+	for i, p := range doc.Packages {
+		for _, ref := range p.ExternalRefs {
+			if ref.Type != ExtRefTypePurl {
+				continue
+			}
+			pu, err := purl.FromString(ref.Locator)
+			if err != nil || pu.Type != purl.TypeApk {
+				continue
+			}
+			if versions, ok := conflicts[pu.Name]; ok {
+				doc.Packages[i].Annotations = append(doc.Packages[i].Annotations,
+					annotation(opts, versionConflictPrefix+strings.Join(versions, " ")))
+			}
+			break
+		}
+	}
+}
+
+// contentNamespace returns a namespace for doc derived from its packages,
+// their IDs, names, versions and checksums, so that documents describing
+// the same packages get the same namespace whatever the package order.
+func contentNamespace(doc *Document) string {
+	lines := make([]string, 0, len(doc.Packages))
+	for _, pkg := range doc.Packages {
+		line := fmt.Sprintf("%s %s %s", pkg.ID, pkg.Name, pkg.Version)
+		for _, c := range pkg.Checksums {
+			line += fmt.Sprintf(" %s:%s", c.Algorithm, c.Value)
+		}
+		lines = append(lines, line+"\n")
+	}
+	slices.Sort(lines)
+
+	h := sha256.New()
+	for _, line := range lines {
+		h.Write([]byte(line))
+	}
+	return documentNamespace + hex.EncodeToString(h.Sum(nil))
+}
+
+func annotation(opts *options.Options, comment string) Annotation {
+	return Annotation{
+		Date:      opts.Timestamp(),
+		Type:      "OTHER",
+		Annotator: fmt.Sprintf("Tool: apko (%s)", version.GetVersionInfo().GitVersion),
+		Comment:   comment,
+	}
+}
+
+// configAnnotationPrefix starts the comment of the annotation recording the
+// image configuration, followed by its digest and its base64 encoding.
+const configAnnotationPrefix = "apko-config: "
+
+// configAnnotation returns the annotation recording opts.Config.
+func configAnnotation(opts *options.Options) Annotation {
+	digest := sha256.Sum256(opts.Config)
+	return annotation(opts, fmt.Sprintf("%ssha256:%s %s", configAnnotationPrefix,
+		hex.EncodeToString(digest[:]), base64.StdEncoding.EncodeToString(opts.Config)))
+}
+
+// EmbeddedConfig returns the image configuration recorded in the document,
+// as YAML, after checking it against its recorded digest, or nil if none is.
+func EmbeddedConfig(doc *Document) ([]byte, error) {
+	for _, a := range doc.Annotations {
+		value, ok := strings.CutPrefix(a.Comment, configAnnotationPrefix)
+		if !ok {
+			continue
+		}
+		digest, encoded, ok := strings.Cut(value, " ")
+		if !ok {
+			return nil, fmt.Errorf("malformed image configuration annotation")
+		}
+		config, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("decoding image configuration: %w", err)
+		}
+		sum := sha256.Sum256(config)
+		if got := "sha256:" + hex.EncodeToString(sum[:]); got != digest {
+			return nil, fmt.Errorf("image configuration digest is %s, recorded %s", got, digest)
+		}
+		return config, nil
+	}
+	return nil, nil
+}
+
+// splitPackageVersions records the epoch and release of the versions of the
+// packages in ids as qualifiers of their apk purls, which keep the full
+// version, and all the parts of the versions in an annotation.
+func splitPackageVersions(opts *options.Options, doc *Document, ids map[string]struct{}) {
+	for i := range doc.Packages {
+		p := &doc.Packages[i]
+		if _, ok := ids[p.ID]; !ok || p.Version == "" {
+			continue
+		}
+		epoch, upstream, release := options.SplitPackageVersion(p.Version)
+
+		for j := range p.ExternalRefs {
+			ref := &p.ExternalRefs[j]
+			if ref.Type != ExtRefTypePurl {
+				continue
+			}
+			pu, err := purl.FromString(ref.Locator)
+			if err != nil || pu.Type != purl.TypeApk {
+				continue
+			}
+			qualifiers := pu.Qualifiers.Map()
+			if epoch != "" {
+				qualifiers["epoch"] = epoch
+			}
+			if release != "" {
+				qualifiers["release"] = release
+			}
+			pu.Qualifiers = purl.QualifiersFromMap(qualifiers)
+			ref.Locator = pu.ToString()
+		}
+
+		comment := "apk-version: upstream=" + upstream
+		if epoch != "" {
+			comment += " epoch=" + epoch
+		}
+		if release != "" {
+			comment += " release=" + release
+		}
+		p.Annotations = append(p.Annotations, annotation(opts, comment))
+	}
 }
 
 func copySBOMElements(sourceDoc, targetDoc *Document, todo map[string]struct{}) error {
@@ -383,15 +915,67 @@ func (sx *SPDX) ParseInternalSBOM(opts *options.Options, path string) (*Document
 	return internalSBOM, nil
 }
 
+// render encodes a document in the format of the generator, writes it to
+// disk and returns the encoded document.
+func (sx *SPDX) render(doc *Document, path string) ([]byte, error) {
+	var buf bytes.Buffer
+	if sx.tagValue {
+		if err := doc.WriteTagValue(&buf); err != nil {
+			return nil, fmt.Errorf("encoding spdx sbom: %w", err)
+		}
+	} else if err := encodeDoc(&buf, doc); err != nil {
+		return nil, err
+	}
+	if err := writeAtomic(path, func(w io.Writer) error {
+		_, err := w.Write(buf.Bytes())
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
 // renderDoc marshals a document to json and writes it to disk
 func renderDoc(doc *Document, path string) error {
-	out, err := os.Create(path)
+	return writeAtomic(path, func(w io.Writer) error {
+		return encodeDoc(w, doc)
+	})
+}
+
+// writeAtomic writes the SBOM at path with write, to a temporary file in the
+// same directory renamed to path once complete, so that readers, and SBOMs
+// generated concurrently, never see a partially written file.
+func writeAtomic(path string, write func(io.Writer) error) error {
+	out, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
 	if err != nil {
 		return fmt.Errorf("opening SBOM path %s for writing: %w", path, err)
 	}
+	defer os.Remove(out.Name())
 	defer out.Close()
 
-	enc := json.NewEncoder(out)
+	w := bufio.NewWriter(out)
+	if err := write(w); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("writing SBOM to %s: %w", path, err)
+	}
+	// CreateTemp creates the file 0600, SBOMs are readable by all.
+	if err := out.Chmod(0o644); err != nil {
+		return fmt.Errorf("writing SBOM to %s: %w", path, err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("writing SBOM to %s: %w", path, err)
+	}
+	if err := os.Rename(out.Name(), path); err != nil {
+		return fmt.Errorf("writing SBOM to %s: %w", path, err)
+	}
+	return nil
+}
+
+// encodeDoc marshals a document to json.
+func encodeDoc(w io.Writer, doc *Document) error {
+	enc := json.NewEncoder(w)
 	enc.SetIndent("", "  ")
 	enc.SetEscapeHTML(true)
 
@@ -401,6 +985,70 @@ func renderDoc(doc *Document, path string) error {
 	return nil
 }
 
+// streamDoc writes a document to disk as encodeDoc would, but encoding its
+// packages one at a time rather than the whole document into one buffer.
+func streamDoc(doc *Document, path string) error {
+	return writeAtomic(path, func(w io.Writer) error {
+		return encodeDocStream(w, doc)
+	})
+}
+
+// packagesPlaceholder is the packages of a document without any, as encoded
+// by encodeDoc, which encodeDocStream replaces with the packages.
+var packagesPlaceholder = []byte(`"packages": null`)
+
+// encodeDocStream marshals a document to json like encodeDoc, writing its
+// packages element by element.
+func encodeDocStream(w io.Writer, doc *Document) error {
+	// Encode the document without its packages, then write the packages in
+	// place of the null they are encoded as.
+	rest := *doc
+	rest.Packages = nil
+	var buf bytes.Buffer
+	if err := encodeDoc(&buf, &rest); err != nil {
+		return err
+	}
+	before, after, ok := bytes.Cut(buf.Bytes(), packagesPlaceholder)
+	if !ok {
+		return fmt.Errorf("encoding spdx sbom: packages not found")
+	}
+
+	if _, err := w.Write(before); err != nil {
+		return fmt.Errorf("encoding spdx sbom: %w", err)
+	}
+	if _, err := io.WriteString(w, `"packages": [`); err != nil {
+		return fmt.Errorf("encoding spdx sbom: %w", err)
+	}
+	for i := range doc.Packages {
+		b, err := json.MarshalIndent(&doc.Packages[i], "    ", "  ")
+		if err != nil {
+			return fmt.Errorf("encoding spdx sbom: %w", err)
+		}
+		sep := ",\n    "
+		if i == 0 {
+			sep = "\n    "
+		}
+		if _, err := io.WriteString(w, sep); err != nil {
+			return fmt.Errorf("encoding spdx sbom: %w", err)
+		}
+		if _, err := w.Write(b); err != nil {
+			return fmt.Errorf("encoding spdx sbom: %w", err)
+		}
+	}
+	if len(doc.Packages) != 0 {
+		if _, err := io.WriteString(w, "\n  "); err != nil {
+			return fmt.Errorf("encoding spdx sbom: %w", err)
+		}
+	}
+	if _, err := io.WriteString(w, "]"); err != nil {
+		return fmt.Errorf("encoding spdx sbom: %w", err)
+	}
+	if _, err := w.Write(after); err != nil {
+		return fmt.Errorf("encoding spdx sbom: %w", err)
+	}
+	return nil
+}
+
 func supplier(opts *options.Options) string {
 	if opts.OS.Name == "" {
 		return NOASSERTION
@@ -409,7 +1057,7 @@ func supplier(opts *options.Options) string {
 }
 
 func (sx *SPDX) imagePackage(opts *options.Options) (p *Package) {
-	return &Package{
+	p = &Package{
 		ID: stringToIdentifier(fmt.Sprintf(
 			"SPDXRef-Package-Image-%s", opts.ImageInfo.ImageDigest,
 		)),
@@ -421,37 +1069,79 @@ func (sx *SPDX) imagePackage(opts *options.Options) (p *Package) {
 		FilesAnalyzed:    false,
 		Description:      "apko container image",
 		Checksums: []Checksum{
-			{
-				Algorithm: "SHA256",
-				Value:     strings.TrimPrefix(opts.ImageInfo.ImageDigest, "sha256:"),
-			},
+			digestChecksum(opts.ImageInfo.ImageDigest),
 		},
 		ExternalRefs: []ExternalRef{
 			{
 				Category: ExtRefPackageManager,
 				Type:     ExtRefTypePurl,
-				Locator: purl.NewPackageURL(
-					purl.TypeOCI, "", opts.ImagePurlName(), opts.ImageInfo.ImageDigest,
-					nil, "",
-				).String() + "?" + opts.ImagePurlQualifiers().String(),
+				Locator:  opts.ImagePurl(),
 			},
 		},
 	}
+	if d := opts.ImageInfo.ConfigDigest; d != "" {
+		// Lets consumers correlate the SBOM with the config blob of the image.
+		p.ExternalRefs = append(p.ExternalRefs, ExternalRef{
+			Category: ExtRefOther,
+			Type:     ExtRefTypeOCIConfig,
+			Locator:  d,
+		})
+	}
+	if ref, ok := sourceExternalRef(opts); ok {
+		p.ExternalRefs = append(p.ExternalRefs, ref)
+	}
+	return p
+}
+
+// sourceExternalRef returns a generic purl pointing at the repository and
+// commit the image configuration was built from, if they are known.
+func sourceExternalRef(opts *options.Options) (ExternalRef, bool) {
+	repo := opts.ImageInfo.SourceRepository
+	if repo == "" {
+		return ExternalRef{}, false
+	}
+	commit := opts.ImageInfo.SourceCommit
+
+	vcsURL := repo
+	if !strings.HasPrefix(vcsURL, "git+") {
+		vcsURL = "git+" + vcsURL
+	}
+	if commit != "" {
+		vcsURL += "@" + commit
+	}
+	name := strings.TrimSuffix(path.Base(strings.TrimSuffix(repo, "/")), ".git")
+
+	return ExternalRef{
+		Category: ExtRefPackageManager,
+		Type:     ExtRefTypePurl,
+		Locator: purl.NewPackageURL(
+			purl.TypeGeneric, "", name, commit,
+			purl.QualifiersFromMap(map[string]string{"vcs_url": vcsURL}), "",
+		).ToString(),
+	}, true
 }
 
+// layerPackageIDPrefix is the prefix of the SPDX identifiers of the
+// packages describing the layers of the image.
+const layerPackageIDPrefix = "SPDXRef-Package-ImageLayer-"
+
 // LayerPackage returns a package describing the layer
 func (sx *SPDX) layerPackage(opts *options.Options, layer v1.Descriptor) *Package {
 	layerPackageName := hashToString(layer.Digest)
 	mainPkgID := stringToIdentifier(layerPackageName)
+	purpose := "CONTAINER"
+	if opts.PackagePurposes {
+		purpose = "OPERATING_SYSTEM"
+	}
 
 	return &Package{
-		ID:               fmt.Sprintf("SPDXRef-Package-ImageLayer-%s", mainPkgID),
+		ID:               layerPackageIDPrefix + mainPkgID,
 		Name:             layerPackageName,
 		Version:          opts.OS.Version,
 		FilesAnalyzed:    false,
 		Description:      "apko operating system layer",
 		DownloadLocation: NOASSERTION,
-		PrimaryPurpose:   "CONTAINER",
+		PrimaryPurpose:   purpose,
 		Originator:       "",
 		Supplier:         supplier(opts),
 		Checksums:        []Checksum{},
@@ -459,10 +1149,7 @@ func (sx *SPDX) layerPackage(opts *options.Options, layer v1.Descriptor) *Packag
 			{
 				Category: ExtRefPackageManager,
 				Type:     ExtRefTypePurl,
-				Locator: purl.NewPackageURL(
-					purl.TypeOCI, "", opts.ImagePurlName(), hashToString(layer.Digest),
-					nil, "",
-				).String() + "?" + opts.LayerPurlQualifiers(layer).String(),
+				Locator:  opts.OCIPurl(opts.ImagePurlName(), hashToString(layer.Digest), opts.LayerPurlQualifiers(layer)),
 			},
 		},
 	}
@@ -477,9 +1164,12 @@ type Document struct {
 	Namespace            string                `json:"documentNamespace"`
 	DocumentDescribes    []string              `json:"documentDescribes"`
 	Packages             []Package             `json:"packages"`
+	Files                []File                `json:"files,omitempty"`
 	Relationships        []Relationship        `json:"relationships"`
 	ExternalDocumentRefs []ExternalDocumentRef `json:"externalDocumentRefs,omitempty"`
 	LicensingInfos       []LicensingInfo       `json:"hasExtractedLicensingInfos,omitempty"`
+	Comment              string                `json:"comment,omitempty"`
+	Annotations          []Annotation          `json:"annotations,omitempty"`
 }
 
 type ExternalDocumentRef struct {
@@ -498,6 +1188,7 @@ type CreationInfo struct {
 	Created            string   `json:"created"` // Date
 	Creators           []string `json:"creators"`
 	LicenseListVersion string   `json:"licenseListVersion"`
+	Comment            string   `json:"comment,omitempty"`
 }
 
 type File struct {
@@ -530,6 +1221,14 @@ type Package struct {
 	Checksums        []Checksum               `json:"checksums,omitempty"`
 	ExternalRefs     []ExternalRef            `json:"externalRefs,omitempty"`
 	VerificationCode *PackageVerificationCode `json:"packageVerificationCode,omitempty"`
+	Annotations      []Annotation             `json:"annotations,omitempty"`
+}
+
+type Annotation struct {
+	Date      string `json:"annotationDate"`
+	Type      string `json:"annotationType"`
+	Annotator string `json:"annotator"`
+	Comment   string `json:"comment"`
 }
 
 type PackageVerificationCode struct {
@@ -547,16 +1246,29 @@ type ExternalRef struct {
 	Type     string `json:"referenceType"`
 }
 
+// Relationship is a relationship between two elements of a document. Its
+// optional Comment explains it, e.g. why a package was installed.
 type Relationship struct {
 	Element string `json:"spdxElementId"`
 	Type    string `json:"relationshipType"`
 	Related string `json:"relatedSpdxElement"`
+	Comment string `json:"comment,omitempty"`
 }
 
 func (sx *SPDX) GenerateIndex(opts *options.Options, path string) error {
+	return sx.GenerateIndexContext(context.Background(), opts, path)
+}
+
+// GenerateIndexContext generates the index SBOM like GenerateIndex, recording
+// its metrics on the span of ctx.
+func (sx *SPDX) GenerateIndexContext(ctx context.Context, opts *options.Options, path string) error {
 	if len(opts.ImageInfo.Images) == 0 {
 		return errors.New("unable to render index sbom, no architecture images found")
 	}
+	licenseListVersion, err := licenseListVersion(opts)
+	if err != nil {
+		return err
+	}
 	documentName := "sbom"
 	if opts.ImageInfo.IndexDigest.DeepCopy().String() != "" {
 		documentName = "sbom-" + opts.ImageInfo.IndexDigest.DeepCopy().String()
@@ -566,17 +1278,24 @@ func (sx *SPDX) GenerateIndex(opts *options.Options, path string) error {
 		Name:    documentName,
 		Version: "SPDX-2.3",
 		CreationInfo: CreationInfo{
-			Created: opts.ImageInfo.SourceDateEpoch.Format(time.RFC3339),
+			Created: opts.Timestamp(),
 			Creators: []string{
 				fmt.Sprintf("Tool: apko (%s)", version.GetVersionInfo().GitVersion),
 				"Organization: Chainguard, Inc",
 			},
-			LicenseListVersion: "3.27",
+			LicenseListVersion: licenseListVersion,
 		},
 		DataLicense:   "CC0-1.0",
-		Namespace:     "https://spdx.org/spdxdocs/apko/",
+		Namespace:     documentNamespace,
 		Packages:      []Package{},
 		Relationships: []Relationship{},
+		Comment:       opts.Comment,
+	}
+	if d := opts.ImageInfo.ReproducibilityManifestDigest; d != "" {
+		doc.CreationInfo.Comment = "Reproducibility manifest: " + d
+	}
+	if len(opts.Config) != 0 {
+		doc.Annotations = append(doc.Annotations, configAnnotation(opts))
 	}
 
 	// Create the index package
@@ -591,22 +1310,19 @@ func (sx *SPDX) GenerateIndex(opts *options.Options, path string) error {
 		DownloadLocation: NOASSERTION,
 		PrimaryPurpose:   "CONTAINER",
 		Checksums: []Checksum{
-			{
-				Algorithm: "SHA256",
-				Value:     opts.ImageInfo.IndexDigest.DeepCopy().Hex,
-			},
+			digestChecksum(opts.ImageInfo.IndexDigest.DeepCopy().String()),
 		},
 		ExternalRefs: []ExternalRef{
 			{
 				Category: ExtRefPackageManager,
 				Type:     ExtRefTypePurl,
-				Locator: purl.NewPackageURL(
-					purl.TypeOCI, "", opts.IndexPurlName(), opts.ImageInfo.IndexDigest.DeepCopy().String(),
-					nil, "",
-				).String() + "?" + opts.IndexPurlQualifiers().String(),
+				Locator:  opts.OCIPurl(opts.IndexPurlName(), opts.ImageInfo.IndexDigest.DeepCopy().String(), opts.IndexPurlQualifiers()),
 			},
 		},
 	}
+	if ref, ok := sourceExternalRef(opts); ok {
+		indexPackage.ExternalRefs = append(indexPackage.ExternalRefs, ref)
+	}
 
 	doc.Packages = append(doc.Packages, indexPackage)
 	doc.DocumentDescribes = append(doc.DocumentDescribes, indexPackage.ID)
@@ -616,26 +1332,20 @@ func (sx *SPDX) GenerateIndex(opts *options.Options, path string) error {
 
 		doc.Packages = append(doc.Packages, Package{
 			ID:               imagePackageID,
-			Name:             fmt.Sprintf("sha256:%s", info.Digest.DeepCopy().Hex),
-			Version:          fmt.Sprintf("sha256:%s", info.Digest.DeepCopy().Hex),
+			Name:             info.Digest.DeepCopy().String(),
+			Version:          info.Digest.DeepCopy().String(),
 			Supplier:         supplier(opts),
 			FilesAnalyzed:    false,
 			DownloadLocation: NOASSERTION,
 			PrimaryPurpose:   "CONTAINER",
 			Checksums: []Checksum{
-				{
-					Algorithm: "SHA256",
-					Value:     info.Digest.DeepCopy().Hex,
-				},
+				digestChecksum(info.Digest.DeepCopy().String()),
 			},
 			ExternalRefs: []ExternalRef{
 				{
 					Category: ExtRefPackageManager,
 					Type:     ExtRefTypePurl,
-					Locator: purl.NewPackageURL(
-						purl.TypeOCI, "", opts.ImagePurlName(), info.Digest.DeepCopy().String(),
-						nil, "",
-					).String() + "?" + opts.ArchImagePurlQualifiers(&opts.ImageInfo.Images[i]).String(),
+					Locator:  opts.OCIPurl(opts.ImagePurlName(), info.Digest.DeepCopy().String(), opts.ArchImagePurlQualifiers(&opts.ImageInfo.Images[i])),
 				},
 			},
 		})
@@ -651,7 +1361,19 @@ func (sx *SPDX) GenerateIndex(opts *options.Options, path string) error {
 		addSourcePackage(opts.ImageInfo.VCSUrl, doc, &indexPackage, opts)
 	}
 
-	if err := renderDoc(doc, path); err != nil {
+	if opts.ContentNamespace {
+		doc.Namespace = contentNamespace(doc)
+	}
+
+	recordMetrics(ctx, doc, opts)
+
+	if opts.Lint {
+		if err := doc.Lint(); err != nil {
+			return fmt.Errorf("linting document: %w", err)
+		}
+	}
+
+	if _, err := sx.render(doc, path); err != nil {
 		return fmt.Errorf("rendering document: %w", err)
 	}
 
@@ -674,6 +1396,169 @@ func addOperatingSystem(doc *Document, opts *options.Options) {
 	doc.Packages = append(doc.Packages, osPackage)
 }
 
+// apkoToolID is the SPDX identifier of the package describing apko itself,
+// which the files it generates are attributed to.
+const apkoToolID = "SPDXRef-Tool-apko"
+
+// configOfComment is the comment of the relationships of the configuration
+// files to the root package. SPDX 2.3 has no CONFIG_OF relationship type, so
+// they are OTHER relationships commented with it.
+const configOfComment = "CONFIG_OF"
+
+// addGeneratedFiles adds the files generated by apko to the document,
+// contained in the root package and GENERATED_FROM a package describing
+// apko. The checksums of symlinks are those of their target path. The
+// configuration files among them are typed as TEXT and related to the root
+// package with an OTHER relationship commented configOfComment.
+func addGeneratedFiles(doc *Document, opts *options.Options) error {
+	if len(opts.GeneratedFiles) == 0 {
+		return nil
+	}
+	if len(doc.DocumentDescribes) == 0 {
+		return errors.New("the document has no root")
+	}
+	root := doc.DocumentDescribes[0]
+
+	doc.Packages = append(doc.Packages, Package{
+		ID:               apkoToolID,
+		Name:             "apko",
+		Version:          version.GetVersionInfo().GitVersion,
+		Supplier:         "Organization: Chainguard, Inc",
+		FilesAnalyzed:    false,
+		LicenseDeclared:  "Apache-2.0",
+		Description:      "Tool which generated the files of the image not installed by packages",
+		DownloadLocation: "https://github.com/chainguard-dev/apko",
+		PrimaryPurpose:   "APPLICATION",
+	})
+
+	for _, p := range opts.GeneratedFiles {
+		var content []byte
+		if target, err := opts.FS.Readlink(p); err == nil {
+			content = []byte(target)
+		} else {
+			content, err = opts.FS.ReadFile(p)
+			if err != nil {
+				return fmt.Errorf("reading %s: %w", p, err)
+			}
+		}
+		sha1sum := sha1.Sum(content) //nolint:gosec // SPDX requires a SHA1 checksum of each file
+		sha256sum := sha256.Sum256(content)
+
+		f := File{
+			ID:   "SPDXRef-File-" + stringToIdentifier(strings.TrimPrefix(p, "/")),
+			Name: "/" + strings.TrimPrefix(p, "/"),
+			Checksums: []Checksum{
+				{Algorithm: "SHA1", Value: hex.EncodeToString(sha1sum[:])},
+				{Algorithm: "SHA256", Value: hex.EncodeToString(sha256sum[:])},
+			},
+			LicenseConcluded: NOASSERTION,
+			CopyrightText:    NOASSERTION,
+		}
+		config := slices.Contains(opts.ConfigFiles, f.Name)
+		if config {
+			f.FileTypes = []string{"TEXT"}
+		}
+		doc.Files = append(doc.Files, f)
+		doc.Relationships = append(doc.Relationships, Relationship{
+			Element: root,
+			Type:    "CONTAINS",
+			Related: f.ID,
+		}, Relationship{
+			Element: f.ID,
+			Type:    "GENERATED_FROM",
+			Related: apkoToolID,
+		})
+		if config {
+			doc.Relationships = append(doc.Relationships, Relationship{
+				Element: f.ID,
+				Type:    "OTHER",
+				Related: root,
+				Comment: configOfComment,
+			})
+		}
+	}
+	return nil
+}
+
+// addExtraPackages merges the user supplied packages into the document. The
+// IDs of the extra packages must not collide with the generated ones.
+func addExtraPackages(doc *Document, opts *options.Options) error {
+	if len(opts.ExtraPackages) == 0 {
+		return nil
+	}
+
+	ids := map[string]struct{}{doc.ID: {}}
+	for _, p := range doc.Packages {
+		ids[p.ID] = struct{}{}
+	}
+
+	for _, ep := range opts.ExtraPackages {
+		if ep.ID == "" {
+			return fmt.Errorf("extra package %q has no ID", ep.Name)
+		}
+		if ep.ID != stringToIdentifier(ep.ID) {
+			return fmt.Errorf("extra package ID %q contains invalid characters", ep.ID)
+		}
+		if _, ok := ids[ep.ID]; ok {
+			return fmt.Errorf("extra package ID %q collides with an existing element", ep.ID)
+		}
+		ids[ep.ID] = struct{}{}
+	}
+
+	for _, ep := range opts.ExtraPackages {
+		p := Package{
+			ID:               ep.ID,
+			Name:             ep.Name,
+			Version:          ep.Version,
+			FilesAnalyzed:    false,
+			LicenseDeclared:  ep.License,
+			Description:      ep.Description,
+			DownloadLocation: ep.DownloadLocation,
+			Supplier:         ep.Supplier,
+		}
+		if p.DownloadLocation == "" {
+			p.DownloadLocation = NOASSERTION
+		}
+		if p.Supplier == "" {
+			p.Supplier = supplier(opts)
+		}
+		if ep.Purl != "" {
+			p.ExternalRefs = []ExternalRef{{
+				Category: ExtRefPackageManager,
+				Type:     ExtRefTypePurl,
+				Locator:  ep.Purl,
+			}}
+		}
+		doc.Packages = append(doc.Packages, p)
+
+		if len(ep.Relationships) == 0 {
+			if len(doc.DocumentDescribes) == 0 {
+				return fmt.Errorf("extra package %q has no relationships and the document has no root", ep.ID)
+			}
+			doc.Relationships = append(doc.Relationships, Relationship{
+				Element: doc.DocumentDescribes[0],
+				Type:    "CONTAINS",
+				Related: ep.ID,
+			})
+			continue
+		}
+
+		for _, r := range ep.Relationships {
+			if _, ok := ids[r.Related]; !ok {
+				return fmt.Errorf("extra package %q is related to unknown element %q", ep.ID, r.Related)
+			}
+			doc.Relationships = append(doc.Relationships, Relationship{
+				Element: ep.ID,
+				Type:    r.Type,
+				Related: r.Related,
+				Comment: r.Comment,
+			})
+		}
+	}
+
+	return nil
+}
+
 // addSourcePackage creates a package describing the source code
 func addSourcePackage(vcsURL string, doc *Document, parent *Package, opts *options.Options) {
 	version := ""
@@ -15,21 +15,30 @@
 package spdx
 
 import (
+	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"maps"
 	"os"
 	"path"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	purl "github.com/package-url/packageurl-go"
 	"github.com/stretchr/testify/require"
 	"sigs.k8s.io/release-utils/command"
 
 	"chainguard.dev/apko/pkg/apk/apk"
 	apkfs "chainguard.dev/apko/pkg/apk/fs"
+	"chainguard.dev/apko/pkg/build/types"
+	"chainguard.dev/apko/pkg/sbom"
 	"chainguard.dev/apko/pkg/sbom/options"
 )
 
@@ -387,3 +396,1540 @@ func TestSourcePackage(t *testing.T) {
 	require.Equal(t, imagePackage.ID, doc.Relationships[0].Element)
 	require.Equal(t, doc.Packages[0].ID, doc.Relationships[0].Related)
 }
+
+func TestSourceExternalRef(t *testing.T) {
+	sx := New()
+	opts := &options.Options{
+		ImageInfo: options.ImageInfo{
+			ImageDigest:      "sha256:ebfca8a4f4ba2d8c0ea8ac5b1e0b4a5e30f1fdc8bd9ba4b6a7e4bdc0e5d8e3e1",
+			SourceRepository: "https://github.com/distroless/example.git",
+			SourceCommit:     "868f0dc23e721039f9669b56d01ea4b897f2fb24",
+		},
+	}
+
+	p := sx.imagePackage(opts)
+	require.Len(t, p.ExternalRefs, 2)
+	require.Equal(t, ExternalRef{
+		Category: ExtRefPackageManager,
+		Type:     ExtRefTypePurl,
+		Locator:  "pkg:generic/example@868f0dc23e721039f9669b56d01ea4b897f2fb24?vcs_url=git%2Bhttps%3A%2F%2Fgithub.com%2Fdistroless%2Fexample.git%40868f0dc23e721039f9669b56d01ea4b897f2fb24",
+	}, p.ExternalRefs[1])
+
+	// Without a repository, only the image purl is recorded.
+	opts.ImageInfo.SourceRepository = ""
+	require.Len(t, sx.imagePackage(opts).ExternalRefs, 1)
+}
+
+func TestConfigExternalRef(t *testing.T) {
+	sx := New()
+	opts := &options.Options{
+		ImageInfo: options.ImageInfo{
+			ImageDigest:  "sha256:ebfca8a4f4ba2d8c0ea8ac5b1e0b4a5e30f1fdc8bd9ba4b6a7e4bdc0e5d8e3e1",
+			ConfigDigest: "sha256:d0fb5f2c116b1db6b99ed363c37565c22826ab99a7148e4497fe5630d3569665",
+		},
+	}
+
+	p := sx.imagePackage(opts)
+	require.Len(t, p.ExternalRefs, 2)
+	require.Equal(t, ExternalRef{
+		Category: ExtRefOther,
+		Type:     ExtRefTypeOCIConfig,
+		Locator:  "sha256:d0fb5f2c116b1db6b99ed363c37565c22826ab99a7148e4497fe5630d3569665",
+	}, p.ExternalRefs[1])
+
+	// Without a config digest, only the image purl is recorded.
+	opts.ImageInfo.ConfigDigest = ""
+	require.Len(t, sx.imagePackage(opts).ExternalRefs, 1)
+}
+
+func TestEmptyImageName(t *testing.T) {
+	sx := New()
+	opts := &options.Options{
+		ImageInfo: options.ImageInfo{
+			ImageDigest: "sha256:ebfca8a4f4ba2d8c0ea8ac5b1e0b4a5e30f1fdc8bd9ba4b6a7e4bdc0e5d8e3e1",
+		},
+	}
+
+	// Without a name, the purls get the default name.
+	p := sx.imagePackage(opts)
+	require.Equal(t, "pkg:oci/image@sha256%3Aebfca8a4f4ba2d8c0ea8ac5b1e0b4a5e30f1fdc8bd9ba4b6a7e4bdc0e5d8e3e1?os=linux", p.ExternalRefs[0].Locator)
+
+	l := sx.layerPackage(opts, v1.Descriptor{MediaType: "application/vnd.oci.image.layer.v1.tar+gzip"})
+	require.Equal(t, "pkg:oci/image?mediaType=application%2Fvnd.oci.image.layer.v1.tar%2Bgzip&os=linux", l.ExternalRefs[0].Locator)
+
+	// Without qualifiers, there is no trailing "?".
+	require.Equal(t, "pkg:oci/image@sha256%3Aebfca8a4", (&options.Options{}).OCIPurl(options.DefaultImagePurlName, "sha256:ebfca8a4", nil))
+}
+
+func TestExtraPackages(t *testing.T) {
+	fsys := apkfs.NewMemFS()
+	opts := testOpts(fsys)
+	opts.ExtraPackages = []options.ExtraPackage{
+		{
+			ID:      "SPDXRef-Package-vendored-tool",
+			Name:    "vendored-tool",
+			Version: "1.2.3",
+			License: "Apache-2.0",
+			Purl:    "pkg:generic/vendored-tool@1.2.3",
+		},
+		{
+			ID:      "SPDXRef-Package-config-bundle",
+			Name:    "config-bundle",
+			Version: "4",
+			Relationships: []options.ExtraRelationship{
+				{Type: "DEPENDS_ON", Related: "SPDXRef-Package-vendored-tool", Comment: "runs the tool at startup"},
+			},
+		},
+	}
+
+	sx := New()
+	path := filepath.Join(t.TempDir(), opts.FileName+"."+sx.Ext())
+	require.NoError(t, sx.Generate(t.Context(), opts, path))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	doc := &Document{}
+	require.NoError(t, json.Unmarshal(data, doc))
+
+	pkgs := map[string]Package{}
+	for _, p := range doc.Packages {
+		pkgs[p.ID] = p
+	}
+	require.Contains(t, pkgs, "SPDXRef-Package-vendored-tool")
+	require.Contains(t, pkgs, "SPDXRef-Package-config-bundle")
+	require.Equal(t, "Apache-2.0", pkgs["SPDXRef-Package-vendored-tool"].LicenseDeclared)
+	require.Equal(t, "pkg:generic/vendored-tool@1.2.3", pkgs["SPDXRef-Package-vendored-tool"].ExternalRefs[0].Locator)
+
+	require.Contains(t, doc.Relationships, Relationship{
+		Element: doc.DocumentDescribes[0],
+		Type:    "CONTAINS",
+		Related: "SPDXRef-Package-vendored-tool",
+	})
+	require.Contains(t, doc.Relationships, Relationship{
+		Element: "SPDXRef-Package-config-bundle",
+		Type:    "DEPENDS_ON",
+		Related: "SPDXRef-Package-vendored-tool",
+		Comment: "runs the tool at startup",
+	})
+}
+
+func TestExtraPackagesErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		extra options.ExtraPackage
+	}{{
+		name:  "collides with generated package",
+		extra: options.ExtraPackage{ID: "SPDXRef-OperatingSystem-unknown", Name: "os"},
+	}, {
+		name:  "collides with document",
+		extra: options.ExtraPackage{ID: "SPDXRef-DOCUMENT", Name: "doc"},
+	}, {
+		name:  "missing ID",
+		extra: options.ExtraPackage{Name: "nameless"},
+	}, {
+		name: "unknown related element",
+		extra: options.ExtraPackage{
+			ID:            "SPDXRef-Package-orphan",
+			Name:          "orphan",
+			Relationships: []options.ExtraRelationship{{Type: "DEPENDS_ON", Related: "SPDXRef-Package-missing"}},
+		},
+	}} {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := testOpts(apkfs.NewMemFS())
+			opts.ExtraPackages = []options.ExtraPackage{tc.extra}
+			sx := New()
+			path := filepath.Join(t.TempDir(), opts.FileName+"."+sx.Ext())
+			require.Error(t, sx.Generate(t.Context(), opts, path))
+		})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	apkPackage := func(name, version string) Package {
+		return Package{
+			ID:      "SPDXRef-Package-" + name,
+			Name:    name,
+			Version: version,
+			ExternalRefs: []ExternalRef{{
+				Category: ExtRefPackageManager,
+				Type:     ExtRefTypePurl,
+				Locator:  "pkg:apk/wolfi/" + name + "@" + version + "?arch=x86_64",
+			}},
+		}
+	}
+	imagePackage := func(digest string) Package {
+		return Package{
+			ID:      "SPDXRef-Package-sha256-" + digest,
+			Name:    "sha256:" + digest,
+			Version: "sha256:" + digest,
+			ExternalRefs: []ExternalRef{{
+				Category: ExtRefPackageManager,
+				Type:     ExtRefTypePurl,
+				Locator:  "pkg:oci/image@sha256%3A" + digest + "?arch=amd64",
+			}},
+		}
+	}
+
+	dir := t.TempDir()
+	oldPath := filepath.Join(dir, "old.spdx.json")
+	newPath := filepath.Join(dir, "new.spdx.json")
+	require.NoError(t, renderDoc(&Document{Packages: []Package{
+		imagePackage("aaaa"),
+		apkPackage("foo", "1.0-r0"),
+		apkPackage("bar", "1.0-r0"),
+	}}, oldPath))
+	require.NoError(t, renderDoc(&Document{Packages: []Package{
+		imagePackage("bbbb"),
+		apkPackage("foo", "1.1-r0"),
+		apkPackage("baz", "1.0-r0"),
+	}}, newPath))
+
+	diff, err := Diff(oldPath, newPath)
+	require.NoError(t, err)
+	require.Equal(t, &sbom.Diff{
+		Added: []sbom.Component{{
+			Name: "baz", Version: "1.0-r0", Purl: "pkg:apk/wolfi/baz@1.0-r0?arch=x86_64",
+		}},
+		Removed: []sbom.Component{{
+			Name: "bar", Version: "1.0-r0", Purl: "pkg:apk/wolfi/bar@1.0-r0?arch=x86_64",
+		}},
+		Changed: []sbom.VersionChange{{
+			Name: "foo", Purl: "pkg:apk/wolfi/foo@1.1-r0?arch=x86_64", FromVersion: "1.0-r0", ToVersion: "1.1-r0",
+		}},
+	}, diff)
+
+	_, err = Diff(filepath.Join(dir, "missing.spdx.json"), newPath)
+	require.Error(t, err)
+}
+
+func TestGenerateContent(t *testing.T) {
+	dir := t.TempDir()
+	for _, sx := range []*SPDX{New(), NewTagValue()} {
+		path := filepath.Join(dir, "sbom."+sx.Ext())
+		content, err := sx.GenerateContent(t.Context(), testOpts(apkfs.NewMemFS()), path)
+		require.NoError(t, err)
+		require.NotEmpty(t, content)
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, data, content)
+	}
+}
+
+func TestDocumentComment(t *testing.T) {
+	dir := t.TempDir()
+	opts := testOpts(apkfs.NewMemFS())
+	opts.Comment = "nightly build"
+
+	sx := New()
+	path := filepath.Join(dir, "sbom."+sx.Ext())
+	require.NoError(t, sx.Generate(t.Context(), opts, path))
+
+	doc, err := ReadDocument(path)
+	require.NoError(t, err)
+	require.Equal(t, "nightly build", doc.Comment)
+}
+
+func TestIndexDigestAnnotations(t *testing.T) {
+	dir := t.TempDir()
+	opts := testOpts(apkfs.NewMemFS())
+	opts.IndexDigests = map[string]string{
+		"https://packages.wolfi.dev/os/x86_64/APKINDEX.tar.gz": "sha256:bbbb",
+		"https://example.com/extra/x86_64/APKINDEX.tar.gz":     "sha256:aaaa",
+	}
+
+	sx := New()
+	path := filepath.Join(dir, "sbom."+sx.Ext())
+	require.NoError(t, sx.Generate(t.Context(), opts, path))
+
+	doc, err := ReadDocument(path)
+	require.NoError(t, err)
+	require.Len(t, doc.Annotations, 2)
+	require.Equal(t, "apk-index: https://example.com/extra/x86_64/APKINDEX.tar.gz sha256:aaaa", doc.Annotations[0].Comment)
+	require.Equal(t, "apk-index: https://packages.wolfi.dev/os/x86_64/APKINDEX.tar.gz sha256:bbbb", doc.Annotations[1].Comment)
+
+	tv := NewTagValue()
+	content, err := tv.GenerateContent(t.Context(), opts, filepath.Join(dir, "sbom."+tv.Ext()))
+	require.NoError(t, err)
+	require.Contains(t, string(content), "SPDXREF: SPDXRef-DOCUMENT\nAnnotationComment: apk-index: https://example.com/extra/x86_64/APKINDEX.tar.gz sha256:aaaa")
+}
+
+func TestStreamPackages(t *testing.T) {
+	dir := t.TempDir()
+	opts := testOpts(apkfs.NewMemFS())
+	opts.ImageInfo.ImageDigest = "sha256:ebfca8a4f4ba2d8c0ea8ac5b1e0b4a5e30f1fdc8bd9ba4b6a7e4bdc0e5d8e3e1"
+
+	sx := New()
+	want, err := sx.GenerateContent(t.Context(), opts, filepath.Join(dir, "want."+sx.Ext()))
+	require.NoError(t, err)
+
+	opts.StreamPackages = true
+	path := filepath.Join(dir, "got."+sx.Ext())
+	content, err := sx.GenerateContent(t.Context(), opts, path)
+	require.NoError(t, err)
+	require.Nil(t, content)
+
+	got, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, string(want), string(got))
+}
+
+func TestContentNamespace(t *testing.T) {
+	dir := t.TempDir()
+	sx := New()
+	namespace := func(opts *options.Options) string {
+		content, err := sx.GenerateContent(t.Context(), opts, filepath.Join(dir, "sbom."+sx.Ext()))
+		require.NoError(t, err)
+		var doc Document
+		require.NoError(t, json.Unmarshal(content, &doc))
+		return doc.Namespace
+	}
+
+	opts := testOpts(apkfs.NewMemFS())
+	require.Equal(t, documentNamespace, namespace(opts))
+
+	opts.ContentNamespace = true
+	want := namespace(opts)
+	require.True(t, strings.HasPrefix(want, documentNamespace), want)
+	require.Len(t, strings.TrimPrefix(want, documentNamespace), 64)
+
+	// The namespace only depends on the packages.
+	opts.ImageInfo.SourceDateEpoch = time.Unix(1700000000, 0)
+	require.Equal(t, want, namespace(opts))
+
+	opts.OS.Version = "3.1"
+	require.NotEqual(t, want, namespace(opts))
+
+	a := Package{ID: "SPDXRef-Package-a", Name: "a", Version: "1"}
+	b := Package{ID: "SPDXRef-Package-b", Name: "b", Version: "2", Checksums: []Checksum{{Algorithm: "SHA1", Value: "abcd"}}}
+	require.Equal(t,
+		contentNamespace(&Document{Packages: []Package{a, b}}),
+		contentNamespace(&Document{Packages: []Package{b, a}}))
+}
+
+func TestEncodeDocStream(t *testing.T) {
+	for _, pkgs := range [][]Package{
+		{},
+		{{ID: "SPDXRef-Package-a", Name: "a", Description: "<html> & friends"}},
+		{{ID: "SPDXRef-Package-a", Name: "a"}, {ID: "SPDXRef-Package-b", Name: "b", Checksums: []Checksum{{Algorithm: "SHA1", Value: "abcd"}}}},
+	} {
+		doc := &Document{ID: "SPDXRef-DOCUMENT", Name: "sbom", Packages: pkgs, Relationships: []Relationship{}}
+
+		var want, got bytes.Buffer
+		require.NoError(t, encodeDoc(&want, doc))
+		require.NoError(t, encodeDocStream(&got, doc))
+		require.Equal(t, want.String(), got.String())
+	}
+}
+
+func TestDigestChecksum(t *testing.T) {
+	sha512 := "sha512:" + strings.Repeat("ab", 64)
+	for _, tc := range []struct {
+		digest   string
+		expected Checksum
+	}{
+		{"sha256:ebfca8a4", Checksum{Algorithm: "SHA256", Value: "ebfca8a4"}},
+		{sha512, Checksum{Algorithm: "SHA512", Value: strings.Repeat("ab", 64)}},
+		{"ebfca8a4", Checksum{Algorithm: "SHA256", Value: "ebfca8a4"}},
+	} {
+		require.Equal(t, tc.expected, digestChecksum(tc.digest), tc.digest)
+	}
+
+	p := New().imagePackage(&options.Options{
+		ImageInfo: options.ImageInfo{ImageDigest: sha512},
+	})
+	require.Equal(t, []Checksum{{Algorithm: "SHA512", Value: strings.Repeat("ab", 64)}}, p.Checksums)
+}
+
+func TestIndexSignatureAnnotation(t *testing.T) {
+	apkSBOM, err := os.ReadFile(filepath.Join("testdata", "apk_sboms", "libattr1-2.5.1-r2.spdx.json"))
+	require.NoError(t, err)
+
+	// busybox has no SBOM of its own: it is described from its metadata
+	// when its signature status is known.
+	for _, tc := range []struct {
+		name       string
+		signatures map[string]bool
+		expected   map[string][]string
+	}{
+		{"verified", map[string]bool{"libattr1": true, "busybox": true}, map[string][]string{
+			"SPDXRef-Package-libattr1-2.5.1-r2": {"index-signature: verified"},
+			"SPDXRef-Package-busybox-1.36.1-r0": {"index-signature: verified"},
+		}},
+		{"unverified", map[string]bool{"libattr1": false, "busybox": false}, map[string][]string{
+			"SPDXRef-Package-libattr1-2.5.1-r2": {"index-signature: unverified"},
+			"SPDXRef-Package-busybox-1.36.1-r0": {"index-signature: unverified"},
+		}},
+		{"unknown", nil, map[string][]string{}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fsys := apkfs.NewMemFS()
+			require.NoError(t, fsys.MkdirAll("var/lib/db/sbom", 0o750))
+			require.NoError(t, fsys.WriteFile("var/lib/db/sbom/libattr1-2.5.1-r2.spdx.json", apkSBOM, 0o644))
+
+			opts := testOpts(fsys)
+			opts.Packages = []*apk.InstalledPackage{{
+				Package: apk.Package{Name: "libattr1", Version: "2.5.1-r2"},
+			}, {
+				Package: apk.Package{Name: "busybox", Version: "1.36.1-r0"},
+			}}
+			opts.IndexSignatures = tc.signatures
+
+			sx := New()
+			path := filepath.Join(t.TempDir(), "sbom."+sx.Ext())
+			require.NoError(t, sx.Generate(t.Context(), opts, path))
+
+			doc, err := ReadDocument(path)
+			require.NoError(t, err)
+
+			comments := map[string][]string{}
+			for _, p := range doc.Packages {
+				for _, a := range p.Annotations {
+					if !strings.HasPrefix(a.Comment, "index-signature: ") {
+						continue
+					}
+					require.Equal(t, "OTHER", a.Type)
+					comments[p.ID] = append(comments[p.ID], a.Comment)
+				}
+			}
+			require.Equal(t, tc.expected, comments)
+		})
+	}
+}
+
+func TestPackageNameTemplate(t *testing.T) {
+	apkSBOM, err := os.ReadFile(filepath.Join("testdata", "apk_sboms", "libattr1-2.5.1-r2.spdx.json"))
+	require.NoError(t, err)
+
+	fsys := apkfs.NewMemFS()
+	require.NoError(t, fsys.MkdirAll("var/lib/db/sbom", 0o750))
+	require.NoError(t, fsys.WriteFile("var/lib/db/sbom/libattr1-2.5.1-r2.spdx.json", apkSBOM, 0o644))
+
+	opts := testOpts(fsys)
+	opts.Packages = []*apk.InstalledPackage{{
+		Package: apk.Package{Name: "libattr1", Version: "2.5.1-r2", Arch: "aarch64"},
+	}}
+	opts.PackageNameTemplate = "{distro}-{name}-{arch}"
+
+	sx := New()
+	path := filepath.Join(t.TempDir(), "sbom."+sx.Ext())
+	require.NoError(t, sx.Generate(t.Context(), opts, path))
+
+	doc, err := ReadDocument(path)
+	require.NoError(t, err)
+
+	names := map[string]string{}
+	for _, p := range doc.Packages {
+		names[p.ID] = p.Name
+	}
+	// The identifier is unchanged, and other packages are not renamed.
+	require.Equal(t, "unknown-libattr1-aarch64", names["SPDXRef-Package-libattr1-2.5.1-r2"])
+	require.Equal(t, "unknown", names["SPDXRef-OperatingSystem-unknown"])
+}
+
+func TestBusyboxAppletsAnnotation(t *testing.T) {
+	apkSBOM, err := os.ReadFile(filepath.Join("testdata", "apk_sboms", "libattr1-2.5.1-r2.spdx.json"))
+	require.NoError(t, err)
+
+	fsys := apkfs.NewMemFS()
+	require.NoError(t, fsys.MkdirAll("var/lib/db/sbom", 0o750))
+	require.NoError(t, fsys.WriteFile("var/lib/db/sbom/libattr1-2.5.1-r2.spdx.json", apkSBOM, 0o644))
+
+	opts := testOpts(fsys)
+	opts.Packages = []*apk.InstalledPackage{{
+		Package: apk.Package{Name: "libattr1", Version: "2.5.1-r2"},
+	}}
+	opts.BusyboxApplets = map[string][]string{"libattr1": {"/bin/ls", "/bin/sh"}}
+
+	sx := New()
+	path := filepath.Join(t.TempDir(), "sbom."+sx.Ext())
+	require.NoError(t, sx.Generate(t.Context(), opts, path))
+
+	doc, err := ReadDocument(path)
+	require.NoError(t, err)
+
+	for _, p := range doc.Packages {
+		if p.ID == "SPDXRef-Package-libattr1-2.5.1-r2" {
+			require.Len(t, p.Annotations, 1)
+			require.Equal(t, "busybox-applets: /bin/ls /bin/sh", p.Annotations[0].Comment)
+			return
+		}
+	}
+	t.Fatal("package not found in SBOM")
+}
+
+func TestRelationshipComments(t *testing.T) {
+	apkSBOM, err := os.ReadFile(filepath.Join("testdata", "apk_sboms", "libattr1-2.5.1-r2.spdx.json"))
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name     string
+		comments map[string]string
+		expected string
+	}{
+		{"commented", map[string]string{"libattr1": "pulled in transitively as a dependency of attr"}, "pulled in transitively as a dependency of attr"},
+		{"default", nil, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fsys := apkfs.NewMemFS()
+			require.NoError(t, fsys.MkdirAll("var/lib/db/sbom", 0o750))
+			require.NoError(t, fsys.WriteFile("var/lib/db/sbom/libattr1-2.5.1-r2.spdx.json", apkSBOM, 0o644))
+
+			opts := testOpts(fsys)
+			opts.Packages = []*apk.InstalledPackage{{
+				Package: apk.Package{Name: "libattr1", Version: "2.5.1-r2"},
+			}}
+			opts.RelationshipComments = tc.comments
+
+			sx := New()
+			path := filepath.Join(t.TempDir(), "sbom."+sx.Ext())
+			require.NoError(t, sx.Generate(t.Context(), opts, path))
+
+			raw, err := os.ReadFile(path)
+			require.NoError(t, err)
+			doc, err := ReadDocument(path)
+			require.NoError(t, err)
+
+			var found bool
+			for _, r := range doc.Relationships {
+				if r.Type != "CONTAINS" || r.Related != "SPDXRef-Package-libattr1-2.5.1-r2" {
+					continue
+				}
+				found = true
+				require.Equal(t, doc.DocumentDescribes[0], r.Element)
+				require.Equal(t, tc.expected, r.Comment)
+			}
+			require.True(t, found, "relationship to the package not found")
+			if tc.expected == "" {
+				// The default output has no relationship comments at all.
+				require.NotContains(t, string(raw), `"comment"`)
+			}
+		})
+	}
+}
+
+func TestPackageLabel(t *testing.T) {
+	apkSBOM, err := os.ReadFile(filepath.Join("testdata", "apk_sboms", "libattr1-2.5.1-r2.spdx.json"))
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name   string
+		labels map[string][]string
+		want   bool
+	}{
+		{"labeled", map[string][]string{"libattr1": {"runtime", "security-critical"}}, true},
+		{"other label", map[string][]string{"libattr1": {"runtime"}}, false},
+		{"unlabeled", nil, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fsys := apkfs.NewMemFS()
+			require.NoError(t, fsys.MkdirAll("var/lib/db/sbom", 0o750))
+			require.NoError(t, fsys.WriteFile("var/lib/db/sbom/libattr1-2.5.1-r2.spdx.json", apkSBOM, 0o644))
+
+			opts := testOpts(fsys)
+			opts.Packages = []*apk.InstalledPackage{{
+				Package: apk.Package{Name: "libattr1", Version: "2.5.1-r2"},
+			}}
+			opts.PackageLabel = "security-critical"
+			opts.PackageLabels = tc.labels
+
+			sx := New()
+			path := filepath.Join(t.TempDir(), "sbom."+sx.Ext())
+			require.NoError(t, sx.Generate(t.Context(), opts, path))
+			doc, err := ReadDocument(path)
+			require.NoError(t, err)
+
+			found := slices.ContainsFunc(doc.Packages, func(p Package) bool {
+				return p.ID == "SPDXRef-Package-libattr1-2.5.1-r2"
+			})
+			require.Equal(t, tc.want, found)
+		})
+	}
+}
+
+func TestPackagesOnly(t *testing.T) {
+	apkSBOM, err := os.ReadFile(filepath.Join("testdata", "apk_sboms", "libattr1-2.5.1-r2.spdx.json"))
+	require.NoError(t, err)
+	fsys := apkfs.NewMemFS()
+	require.NoError(t, fsys.MkdirAll("var/lib/db/sbom", 0o750))
+	require.NoError(t, fsys.WriteFile("var/lib/db/sbom/libattr1-2.5.1-r2.spdx.json", apkSBOM, 0o644))
+	require.NoError(t, fsys.MkdirAll("etc", 0o755))
+	require.NoError(t, fsys.WriteFile("etc/apko.json", []byte("{}\n"), 0o444))
+
+	opts := testOpts(fsys)
+	opts.ImageInfo.ImageDigest = "sha256:" + strings.Repeat("a", 64)
+	opts.ImageInfo.Layers = []v1.Descriptor{{Digest: v1.Hash{Algorithm: "sha256", Hex: strings.Repeat("b", 64)}}}
+	opts.Packages = []*apk.InstalledPackage{{
+		Package: apk.Package{Name: "libattr1", Version: "2.5.1-r2"},
+	}}
+	opts.GeneratedFiles = []string{"/etc/apko.json"}
+	opts.PackagesOnly = true
+
+	sx := New()
+	path := filepath.Join(t.TempDir(), "sbom."+sx.Ext())
+	require.NoError(t, sx.Generate(t.Context(), opts, path))
+	doc, err := ReadDocument(path)
+	require.NoError(t, err)
+
+	require.Equal(t, []string{packageCollectionID}, doc.DocumentDescribes)
+	ids := make([]string, 0, len(doc.Packages))
+	for _, p := range doc.Packages {
+		require.NotEqual(t, "CONTAINER", p.PrimaryPurpose, "%s describes the image", p.ID)
+		require.NotEqual(t, "OPERATING_SYSTEM", p.PrimaryPurpose, "%s describes the operating system", p.ID)
+		ids = append(ids, p.ID)
+	}
+	require.Contains(t, ids, "SPDXRef-Package-libattr1-2.5.1-r2")
+	require.Contains(t, doc.Relationships, Relationship{
+		Element: packageCollectionID,
+		Type:    "CONTAINS",
+		Related: "SPDXRef-Package-libattr1-2.5.1-r2",
+	})
+	require.Empty(t, doc.Files)
+}
+
+func TestImagePurlType(t *testing.T) {
+	opts := testOpts(apkfs.NewMemFS())
+	opts.ImageInfo.ImageDigest = "sha256:" + strings.Repeat("a", 64)
+	opts.ImageInfo.Layers = []v1.Descriptor{{Digest: v1.Hash{Algorithm: "sha256", Hex: strings.Repeat("b", 64)}}}
+	opts.ImagePurlType = "docker"
+	opts.ImagePurlNamespace = "library"
+
+	sx := New()
+	path := filepath.Join(t.TempDir(), "sbom."+sx.Ext())
+	require.NoError(t, sx.Generate(t.Context(), opts, path))
+	doc, err := ReadDocument(path)
+	require.NoError(t, err)
+
+	var versions []string
+	for _, p := range doc.Packages {
+		if p.PrimaryPurpose != "CONTAINER" {
+			continue
+		}
+		require.Equal(t, ExtRefTypePurl, p.ExternalRefs[0].Type)
+		pu, err := purl.FromString(p.ExternalRefs[0].Locator)
+		require.NoError(t, err)
+		require.Equal(t, "docker", pu.Type)
+		require.Equal(t, "library", pu.Namespace)
+		require.Equal(t, "image", pu.Name)
+		versions = append(versions, pu.Version)
+	}
+	require.Equal(t, []string{"sha256:" + strings.Repeat("a", 64), "sha256:" + strings.Repeat("b", 64)}, versions)
+
+	// The image and layer packages are still left out of comparisons.
+	for _, c := range doc.Components() {
+		require.NotContains(t, c.Purl, "pkg:docker/")
+	}
+}
+
+func TestLint(t *testing.T) {
+	apkSBOM, err := os.ReadFile(filepath.Join("testdata", "apk_sboms", "libattr1-2.5.1-r2.spdx.json"))
+	require.NoError(t, err)
+	fsys := apkfs.NewMemFS()
+	require.NoError(t, fsys.MkdirAll("var/lib/db/sbom", 0o750))
+	require.NoError(t, fsys.WriteFile("var/lib/db/sbom/libattr1-2.5.1-r2.spdx.json", apkSBOM, 0o644))
+
+	opts := testOpts(fsys)
+	opts.ImageInfo.ImageDigest = "sha256:" + strings.Repeat("a", 64)
+	opts.ImageInfo.Layers = []v1.Descriptor{{Digest: v1.Hash{Algorithm: "sha256", Hex: strings.Repeat("b", 64)}}}
+	opts.Packages = []*apk.InstalledPackage{{
+		Package: apk.Package{Name: "libattr1", Version: "2.5.1-r2"},
+	}}
+	opts.Lint = true
+
+	// The documents generated pass the checks.
+	sx := New()
+	path := filepath.Join(t.TempDir(), "sbom."+sx.Ext())
+	require.NoError(t, sx.Generate(t.Context(), opts, path))
+	doc, err := ReadDocument(path)
+	require.NoError(t, err)
+	require.NoError(t, doc.Lint())
+
+	// Violations are reported with the path of the offending element.
+	doc.Packages[0].DownloadLocation = ""
+	doc.Packages[0].PrimaryPurpose = "IMAGE"
+	doc.Relationships = append(doc.Relationships, Relationship{Element: doc.ID, Type: "INCLUDES", Related: doc.Packages[0].ID})
+	doc.CreationInfo.Creators = nil
+	err = doc.Lint()
+	require.ErrorContains(t, err, "creationInfo.creators: must not be empty")
+	require.ErrorContains(t, err, "packages[0].downloadLocation: is required")
+	require.ErrorContains(t, err, `packages[0].primaryPackagePurpose: "IMAGE" is not a valid value`)
+	require.ErrorContains(t, err, fmt.Sprintf(`relationships[%d].relationshipType: "INCLUDES" is not a valid value`, len(doc.Relationships)-1))
+
+	// So are malformed and duplicate identifiers, and dangling references.
+	doc, err = ReadDocument(path)
+	require.NoError(t, err)
+	doc.ID = "SPDXRef-Document"
+	require.ErrorContains(t, doc.Lint(), `SPDXID: "SPDXRef-Document" is not "SPDXRef-DOCUMENT"`)
+	doc, err = ReadDocument(path)
+	require.NoError(t, err)
+	doc.Packages = append(doc.Packages,
+		Package{ID: "SPDXRef-Package_extra", Name: "extra", DownloadLocation: NOASSERTION},
+		doc.Packages[0],
+	)
+	doc.Relationships = append(doc.Relationships,
+		Relationship{Element: doc.ID, Type: "DESCRIBES", Related: "SPDXRef-missing"},
+		Relationship{Element: doc.ID, Type: "DESCRIBES", Related: "DocumentRef-missing:SPDXRef-DOCUMENT"},
+		Relationship{Element: doc.ID, Type: "DESCRIBES", Related: "NONE"},
+	)
+	doc.LicensingInfos = append(doc.LicensingInfos, LicensingInfo{LicenseID: "Custom", ExtractedText: "text"})
+	p, r := len(doc.Packages), len(doc.Relationships)
+	err = doc.Lint()
+	require.ErrorContains(t, err, fmt.Sprintf(`packages[%d].SPDXID: "SPDXRef-Package_extra" does not match ^SPDXRef-[a-zA-Z0-9.-]+$`, p-2))
+	require.ErrorContains(t, err, fmt.Sprintf(`packages[%d].SPDXID: %q is the identifier of another element`, p-1, doc.Packages[0].ID))
+	require.ErrorContains(t, err, fmt.Sprintf(`relationships[%d].relatedSpdxElement: "SPDXRef-missing" is not an element of the document`, r-3))
+	require.ErrorContains(t, err, fmt.Sprintf(`relationships[%d].relatedSpdxElement: "DocumentRef-missing" is not an external document reference`, r-2))
+	require.NotContains(t, err.Error(), fmt.Sprintf("relationships[%d]", r-1))
+	require.ErrorContains(t, err, `hasExtractedLicensingInfos[0].licenseId: "Custom" does not match ^LicenseRef-[a-zA-Z0-9.-]+$`)
+
+	// Generation fails rather than writing a document that does not conform.
+	opts.ExtraPackages = []options.ExtraPackage{{
+		ID:            "SPDXRef-Package-extra",
+		Name:          "extra",
+		Relationships: []options.ExtraRelationship{{Type: "INCLUDES", Related: "SPDXRef-DOCUMENT"}},
+	}}
+	path = filepath.Join(t.TempDir(), "sbom."+sx.Ext())
+	require.ErrorContains(t, sx.Generate(t.Context(), opts, path), `"INCLUDES" is not a valid value`)
+	require.NoFileExists(t, path)
+}
+
+func TestDuplicateVersions(t *testing.T) {
+	apkSBOM, err := os.ReadFile(filepath.Join("testdata", "apk_sboms", "libattr1-2.5.1-r2.spdx.json"))
+	require.NoError(t, err)
+	fsys := apkfs.NewMemFS()
+	require.NoError(t, fsys.MkdirAll("var/lib/db/sbom", 0o750))
+	require.NoError(t, fsys.WriteFile("var/lib/db/sbom/libattr1-2.5.1-r2.spdx.json", apkSBOM, 0o644))
+	require.NoError(t, fsys.WriteFile("var/lib/db/sbom/libattr1-2.5.2-r0.spdx.json", bytes.ReplaceAll(apkSBOM, []byte("2.5.1-r2"), []byte("2.5.2-r0")), 0o644))
+
+	generate := func(mode string) (*Document, error) {
+		opts := testOpts(fsys)
+		opts.Packages = []*apk.InstalledPackage{
+			{Package: apk.Package{Name: "libattr1", Version: "2.5.1-r2"}},
+			{Package: apk.Package{Name: "libattr1", Version: "2.5.2-r0"}},
+		}
+		opts.DuplicateVersions = mode
+
+		sx := New()
+		path := filepath.Join(t.TempDir(), "sbom."+sx.Ext())
+		if err := sx.Generate(t.Context(), opts, path); err != nil {
+			return nil, err
+		}
+		return ReadDocument(path)
+	}
+	conflicts := func(doc *Document) map[string][]string {
+		got := map[string][]string{}
+		for _, p := range doc.Packages {
+			for _, a := range p.Annotations {
+				if strings.HasPrefix(a.Comment, "version-conflict: ") {
+					got[p.ID] = append(got[p.ID], a.Comment)
+				}
+			}
+		}
+		return got
+	}
+
+	// By default both versions are listed as is.
+	doc, err := generate("")
+	require.NoError(t, err)
+	require.Empty(t, conflicts(doc))
+
+	doc, err = generate(options.DuplicateVersionsAnnotate)
+	require.NoError(t, err)
+	require.Equal(t, map[string][]string{
+		"SPDXRef-Package-libattr1-2.5.1-r2": {"version-conflict: 2.5.1-r2 2.5.2-r0"},
+		"SPDXRef-Package-libattr1-2.5.2-r0": {"version-conflict: 2.5.1-r2 2.5.2-r0"},
+	}, conflicts(doc))
+
+	_, err = generate(options.DuplicateVersionsFail)
+	require.EqualError(t, err, "package libattr1 is listed with several versions: 2.5.1-r2, 2.5.2-r0")
+}
+
+func TestGeneratedFiles(t *testing.T) {
+	fsys := apkfs.NewMemFS()
+	require.NoError(t, fsys.MkdirAll("etc", 0o755))
+	require.NoError(t, fsys.WriteFile("etc/apko.json", []byte("{}\n"), 0o444))
+	require.NoError(t, fsys.MkdirAll("bin", 0o755))
+	require.NoError(t, fsys.WriteFile("bin/busybox", []byte("busybox"), 0o755))
+	require.NoError(t, fsys.Symlink("/bin/busybox", "bin/sh"))
+
+	opts := testOpts(fsys)
+	opts.GeneratedFiles = []string{"/bin/sh", "/etc/apko.json"}
+	opts.ConfigFiles = []string{"/etc/apko.json"}
+
+	sx := New()
+	path := filepath.Join(t.TempDir(), "sbom."+sx.Ext())
+	require.NoError(t, sx.Generate(t.Context(), opts, path))
+
+	doc, err := ReadDocument(path)
+	require.NoError(t, err)
+
+	require.Len(t, doc.Files, 2)
+	require.Equal(t, "/bin/sh", doc.Files[0].Name)
+	// The checksum of a symlink is the one of its target path.
+	require.Contains(t, doc.Files[0].Checksums, Checksum{
+		Algorithm: "SHA256",
+		Value:     "720be4f35da16d0da39268d0059b7e8334a1010c212ec8f1175540669a40f61f",
+	})
+
+	var tool *Package
+	for i := range doc.Packages {
+		if doc.Packages[i].ID == "SPDXRef-Tool-apko" {
+			tool = &doc.Packages[i]
+		}
+	}
+	require.NotNil(t, tool)
+	require.Equal(t, "apko", tool.Name)
+
+	for _, f := range doc.Files {
+		require.Contains(t, doc.Relationships, Relationship{Element: doc.DocumentDescribes[0], Type: "CONTAINS", Related: f.ID})
+		require.Contains(t, doc.Relationships, Relationship{Element: f.ID, Type: "GENERATED_FROM", Related: tool.ID})
+	}
+
+	// Only the configuration files are related to the image as such.
+	configOf := Relationship{Element: doc.Files[1].ID, Type: "OTHER", Related: doc.DocumentDescribes[0], Comment: "CONFIG_OF"}
+	require.Contains(t, doc.Relationships, configOf)
+	require.Equal(t, []string{"TEXT"}, doc.Files[1].FileTypes)
+	require.Empty(t, doc.Files[0].FileTypes)
+	require.NotContains(t, doc.Relationships, Relationship{Element: doc.Files[0].ID, Type: "OTHER", Related: doc.DocumentDescribes[0], Comment: "CONFIG_OF"})
+
+	// Without generated files, the document has no files.
+	opts.GeneratedFiles = nil
+	require.NoError(t, sx.Generate(t.Context(), opts, path))
+	doc, err = ReadDocument(path)
+	require.NoError(t, err)
+	require.Empty(t, doc.Files)
+}
+
+func TestAppPackages(t *testing.T) {
+	apkSBOM, err := os.ReadFile(filepath.Join("testdata", "apk_sboms", "libattr1-2.5.1-r2.spdx.json"))
+	require.NoError(t, err)
+	fsys := apkfs.NewMemFS()
+	require.NoError(t, fsys.MkdirAll("var/lib/db/sbom", 0o750))
+	require.NoError(t, fsys.WriteFile("var/lib/db/sbom/libattr1-2.5.1-r2.spdx.json", apkSBOM, 0o644))
+
+	opts := testOpts(fsys)
+	opts.Packages = []*apk.InstalledPackage{{
+		Package: apk.Package{Name: "libattr1", Version: "2.5.1-r2"},
+	}}
+	sx := New()
+	path := filepath.Join(t.TempDir(), "sbom."+sx.Ext())
+
+	rootRelationship := func() Relationship {
+		t.Helper()
+		require.NoError(t, sx.Generate(t.Context(), opts, path))
+		doc, err := ReadDocument(path)
+		require.NoError(t, err)
+		for _, r := range doc.Relationships {
+			if r.Element == doc.DocumentDescribes[0] && r.Related == "SPDXRef-Package-libattr1-2.5.1-r2" {
+				return r
+			}
+		}
+		t.Fatal("no relationship from the root to the package")
+		return Relationship{}
+	}
+
+	// The packages of the operating system are contained in the root.
+	opts.AppPackages = []string{"myapp-*"}
+	require.Equal(t, "CONTAINS", rootRelationship().Type)
+
+	opts.AppPackages = []string{"libattr?"}
+	r := rootRelationship()
+	require.Equal(t, "OTHER", r.Type)
+	require.Equal(t, "APPLICATION_PACKAGE", r.Comment)
+
+	// The provenance of the package is kept in the comment.
+	opts.RelationshipComments = map[string]string{"libattr1": "requested in the image configuration"}
+	require.Equal(t, "APPLICATION_PACKAGE; requested in the image configuration", rootRelationship().Comment)
+
+	opts.AppPackageRelationship = "DEPENDS_ON"
+	r = rootRelationship()
+	require.Equal(t, "DEPENDS_ON", r.Type)
+	require.Equal(t, "requested in the image configuration", r.Comment)
+
+	opts.AppPackageRelationship = "USES"
+	require.ErrorContains(t, sx.Generate(t.Context(), opts, path), `invalid relationship type "USES"`)
+}
+
+func TestMetrics(t *testing.T) {
+	fsys := apkfs.NewMemFS()
+	require.NoError(t, fsys.MkdirAll("etc", 0o755))
+	require.NoError(t, fsys.WriteFile("etc/apko.json", []byte("{}\n"), 0o444))
+
+	opts := testOpts(fsys)
+	opts.GeneratedFiles = []string{"/etc/apko.json"}
+	var metrics []types.SBOMMetrics
+	opts.OnMetrics = func(m types.SBOMMetrics) { metrics = append(metrics, m) }
+
+	sx := New()
+	path := filepath.Join(t.TempDir(), "sbom."+sx.Ext())
+	require.NoError(t, sx.Generate(t.Context(), opts, path))
+
+	doc, err := ReadDocument(path)
+	require.NoError(t, err)
+	require.Equal(t, []types.SBOMMetrics{doc.Metrics()}, metrics)
+	require.Equal(t, len(doc.Packages), metrics[0].Packages)
+	require.Equal(t, 1, metrics[0].Files)
+	require.NotZero(t, metrics[0].Relationships)
+}
+
+func TestSplitPackageVersions(t *testing.T) {
+	apkSBOM, err := os.ReadFile(filepath.Join("testdata", "apk_sboms", "libattr1-2.5.1-r2.spdx.json"))
+	require.NoError(t, err)
+
+	for _, split := range []bool{false, true} {
+		fsys := apkfs.NewMemFS()
+		require.NoError(t, fsys.MkdirAll("var/lib/db/sbom", 0o750))
+		require.NoError(t, fsys.WriteFile("var/lib/db/sbom/libattr1-2.5.1-r2.spdx.json", apkSBOM, 0o644))
+
+		opts := testOpts(fsys)
+		opts.Packages = []*apk.InstalledPackage{{
+			Package: apk.Package{Name: "libattr1", Version: "2.5.1-r2"},
+		}}
+		opts.SplitPackageVersions = split
+
+		sx := New()
+		path := filepath.Join(t.TempDir(), "sbom."+sx.Ext())
+		require.NoError(t, sx.Generate(t.Context(), opts, path))
+
+		doc, err := ReadDocument(path)
+		require.NoError(t, err)
+
+		var p *Package
+		for i := range doc.Packages {
+			if doc.Packages[i].ID == "SPDXRef-Package-libattr1-2.5.1-r2" {
+				p = &doc.Packages[i]
+			}
+		}
+		require.NotNil(t, p)
+		// The full version is kept.
+		require.Equal(t, "2.5.1-r2", p.Version)
+		require.Len(t, p.ExternalRefs, 1)
+		if !split {
+			require.Equal(t, "pkg:apk/wolfi/libattr1@2.5.1-r2?arch=x86_64", p.ExternalRefs[0].Locator)
+			require.Empty(t, p.Annotations)
+			continue
+		}
+		require.Equal(t, "pkg:apk/wolfi/libattr1@2.5.1-r2?arch=x86_64&release=2", p.ExternalRefs[0].Locator)
+		require.Len(t, p.Annotations, 1)
+		require.Equal(t, "apk-version: upstream=2.5.1 release=2", p.Annotations[0].Comment)
+	}
+}
+
+func TestAPKPackage(t *testing.T) {
+	opts := testOpts(apkfs.NewMemFS())
+	opts.OS.ID = "wolfi"
+	pkg := &apk.Package{Name: "libattr1", Version: "2.5.1-r2", Arch: "x86_64", License: "LGPL-2.1-or-later", Description: "library for managing filesystem extended attributes"}
+
+	// The identifier and purl are those of the package SBOM, see
+	// TestSplitPackageVersions.
+	p := APKPackage(opts, pkg)
+	require.Equal(t, "SPDXRef-Package-libattr1-2.5.1-r2", p.ID)
+	require.Equal(t, "libattr1", p.Name)
+	require.Equal(t, "2.5.1-r2", p.Version)
+	require.Equal(t, "LGPL-2.1-or-later", p.LicenseDeclared)
+	require.Equal(t, "Organization: unknown", p.Supplier)
+	require.Equal(t, []ExternalRef{{
+		Category: ExtRefPackageManager,
+		Type:     ExtRefTypePurl,
+		Locator:  "pkg:apk/wolfi/libattr1@2.5.1-r2?arch=x86_64",
+	}}, p.ExternalRefs)
+	require.Empty(t, p.Annotations)
+
+	// The per-package options apply.
+	opts.PackageNameTemplate = "{name}-{arch}"
+	opts.SplitPackageVersions = true
+	opts.IndexSignatures = map[string]bool{"libattr1": true}
+	p = APKPackage(opts, pkg)
+	require.Equal(t, "libattr1-x86_64", p.Name)
+	require.Equal(t, "pkg:apk/wolfi/libattr1@2.5.1-r2?arch=x86_64&release=2", p.ExternalRefs[0].Locator)
+	require.Len(t, p.Annotations, 2)
+	require.Equal(t, "index-signature: verified", p.Annotations[0].Comment)
+	require.Equal(t, "apk-version: upstream=2.5.1 release=2", p.Annotations[1].Comment)
+
+	// Without an operating system or license.
+	opts = testOpts(apkfs.NewMemFS())
+	opts.OS.ID = ""
+	p = APKPackage(opts, &apk.Package{Name: "local", Version: "1.0-r0"})
+	require.Equal(t, NOASSERTION, p.LicenseDeclared)
+	require.Equal(t, "pkg:apk/unknown/local@1.0-r0", p.ExternalRefs[0].Locator)
+}
+
+func TestPackageVCS(t *testing.T) {
+	opts := testOpts(apkfs.NewMemFS())
+	opts.OS.ID = "wolfi"
+	opts.PackageVCS = true
+	pkg := &apk.Package{Name: "libattr1", Version: "2.5.1-r2", Arch: "x86_64", RepoCommit: "0123abcd"}
+
+	p := APKPackage(opts, pkg)
+	require.Equal(t, "pkg:apk/wolfi/libattr1@2.5.1-r2?arch=x86_64&commit=0123abcd", p.ExternalRefs[0].Locator)
+
+	opts.PackageVCSURL = "https://github.com/wolfi-dev/os"
+	p = APKPackage(opts, pkg)
+	pu, err := purl.FromString(p.ExternalRefs[0].Locator)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"arch":    "x86_64",
+		"commit":  "0123abcd",
+		"vcs_url": "git+https://github.com/wolfi-dev/os@0123abcd",
+	}, pu.Qualifiers.Map())
+
+	// Packages without a commit are left alone.
+	pkg.RepoCommit = ""
+	p = APKPackage(opts, pkg)
+	require.Equal(t, "pkg:apk/wolfi/libattr1@2.5.1-r2?arch=x86_64", p.ExternalRefs[0].Locator)
+}
+
+func TestLicenseListVersion(t *testing.T) {
+	embedded := embeddedLicenseList().Version
+	require.Equal(t, DefaultLicenseListVersion, embedded)
+
+	for _, tc := range []struct {
+		version   string
+		normalize bool
+		want      string
+		wantErr   bool
+	}{
+		{version: "", want: DefaultLicenseListVersion},
+		{version: "3.16", want: "3.16"},
+		{version: "", normalize: true, want: embedded},
+		{version: embedded, normalize: true, want: embedded},
+		{version: "3.16", normalize: true, wantErr: true},
+	} {
+		t.Run(fmt.Sprintf("%s-%t", tc.version, tc.normalize), func(t *testing.T) {
+			opts := testOpts(apkfs.NewMemFS())
+			opts.LicenseListVersion = tc.version
+			opts.NormalizeLicenses = tc.normalize
+
+			sx := New()
+			path := filepath.Join(t.TempDir(), "sbom."+sx.Ext())
+			err := sx.Generate(t.Context(), opts, path)
+			if tc.wantErr {
+				require.ErrorContains(t, err, "does not match the version "+embedded)
+				return
+			}
+			require.NoError(t, err)
+
+			doc, err := ReadDocument(path)
+			require.NoError(t, err)
+			require.Equal(t, tc.want, doc.CreationInfo.LicenseListVersion)
+		})
+	}
+}
+
+func TestNormalizeLicense(t *testing.T) {
+	l := embeddedLicenseList()
+	for expr, want := range map[string]string{
+		"MIT":                            "MIT",
+		"mit":                            "MIT",
+		"apache-2.0 and bsd-3-clause":    "Apache-2.0 AND BSD-3-Clause",
+		"(mit OR  gpl-2.0-only)and zlib": "(MIT OR GPL-2.0-only) AND Zlib",
+		"GPL-2.0":                        "GPL-2.0-only",
+		"GPL-2.0+":                       "GPL-2.0-or-later",
+		"lgpl-2.1+ OR mpl-2.0":           "LGPL-2.1-or-later OR MPL-2.0",
+		"Apache-2.0+":                    "Apache-2.0+",
+		"gpl-2.0-only with classpath-exception-2.0": "GPL-2.0-only WITH Classpath-exception-2.0",
+		"Apache-2.0 WITH LLVM-exception":            "Apache-2.0 WITH LLVM-exception",
+		"LicenseRef-custom OR mit":                  "LicenseRef-custom OR MIT",
+		"Not-A-License":                             "Not-A-License",
+		"noassertion":                               "NOASSERTION",
+		"NONE":                                      "NONE",
+	} {
+		require.Equal(t, want, l.normalizeLicense(expr), expr)
+	}
+}
+
+func TestNormalizeLicenses(t *testing.T) {
+	apkSBOM, err := os.ReadFile(filepath.Join("testdata", "apk_sboms", "libattr1-2.5.1-r2.spdx.json"))
+	require.NoError(t, err)
+	fsys := apkfs.NewMemFS()
+	require.NoError(t, fsys.MkdirAll("var/lib/db/sbom", 0o750))
+	apkSBOM = bytes.ReplaceAll(apkSBOM, []byte(`"GPL-2.0-or-later"`), []byte(`"gpl-2.0+"`))
+	require.NoError(t, fsys.WriteFile("var/lib/db/sbom/libattr1-2.5.1-r2.spdx.json", apkSBOM, 0o644))
+
+	licenses := func(normalize bool) map[string]string {
+		opts := testOpts(fsys)
+		opts.NormalizeLicenses = normalize
+		opts.Packages = []*apk.InstalledPackage{{Package: apk.Package{Name: "libattr1", Version: "2.5.1-r2"}}}
+		opts.ExtraPackages = []options.ExtraPackage{{ID: "SPDXRef-Package-extra", Name: "extra", Version: "1.0", License: "mit or apache-2.0"}}
+
+		sx := New()
+		path := filepath.Join(t.TempDir(), "sbom."+sx.Ext())
+		require.NoError(t, sx.Generate(t.Context(), opts, path))
+		doc, err := ReadDocument(path)
+		require.NoError(t, err)
+		got := map[string]string{}
+		for _, p := range doc.Packages {
+			got[p.Name] = p.LicenseDeclared
+		}
+		return got
+	}
+
+	got := licenses(false)
+	require.Equal(t, "gpl-2.0+", got["libattr1"])
+	require.Equal(t, "mit or apache-2.0", got["extra"])
+	want := got
+	want["libattr1"] = "GPL-2.0-or-later"
+	want["extra"] = "MIT OR Apache-2.0"
+	require.Equal(t, want, licenses(true))
+}
+
+// parseTagValue parses SPDX tag-value output into tag and value pairs in
+// order, unwrapping multi-line <text> values.
+func parseTagValue(t *testing.T, in string) [][2]string {
+	t.Helper()
+	var pairs [][2]string
+	lines := strings.Split(in, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		tag, value, ok := strings.Cut(line, ": ")
+		require.True(t, ok, "malformed line %q", line)
+		if strings.HasPrefix(value, "<text>") {
+			for !strings.HasSuffix(value, "</text>") {
+				i++
+				require.Less(t, i, len(lines), "unterminated <text> in %s", tag)
+				value += "\n" + lines[i]
+			}
+			value = strings.TrimSuffix(strings.TrimPrefix(value, "<text>"), "</text>")
+		}
+		pairs = append(pairs, [2]string{tag, value})
+	}
+	return pairs
+}
+
+// readTagValue parses a document written by WriteTagValue back into a
+// Document. The relationships before the first package are the ones the
+// document describes.
+func readTagValue(t *testing.T, in string) *Document {
+	t.Helper()
+	doc := &Document{}
+	var (
+		pkg        *Package
+		file       *File
+		annotation *Annotation
+		relation   *Relationship
+		license    *LicensingInfo
+	)
+	checksum := func(value string) Checksum {
+		alg, v, ok := strings.Cut(value, ": ")
+		require.True(t, ok, "malformed checksum %q", value)
+		return Checksum{Algorithm: alg, Value: v}
+	}
+	for _, pair := range parseTagValue(t, in) {
+		tag, value := pair[0], pair[1]
+		switch tag {
+		case "SPDXVersion":
+			doc.Version = value
+		case "DataLicense":
+			doc.DataLicense = value
+		case "DocumentName":
+			doc.Name = value
+		case "DocumentNamespace":
+			doc.Namespace = value
+		case "DocumentComment":
+			doc.Comment = value
+		case "ExternalDocumentRef":
+			fields := strings.SplitN(value, " ", 3)
+			require.Len(t, fields, 3, "malformed external document reference %q", value)
+			doc.ExternalDocumentRefs = append(doc.ExternalDocumentRefs, ExternalDocumentRef{
+				ExternalDocumentID: fields[0], SPDXDocument: fields[1], Checksum: checksum(fields[2]),
+			})
+		case "Creator":
+			doc.CreationInfo.Creators = append(doc.CreationInfo.Creators, value)
+		case "Created":
+			doc.CreationInfo.Created = value
+		case "LicenseListVersion":
+			doc.CreationInfo.LicenseListVersion = value
+		case "CreatorComment":
+			doc.CreationInfo.Comment = value
+		case "SPDXID":
+			switch {
+			case file != nil:
+				file.ID = value
+			case pkg != nil:
+				pkg.ID = value
+			default:
+				doc.ID = value
+			}
+		case "Annotator":
+			annotation = &Annotation{Annotator: value}
+		case "AnnotationDate":
+			annotation.Date = value
+		case "AnnotationType":
+			annotation.Type = value
+		case "AnnotationComment":
+			annotation.Comment = value
+		case "SPDXREF":
+			// The comment comes last, so it is set on the appended
+			// annotation.
+			if value == doc.ID {
+				doc.Annotations = append(doc.Annotations, *annotation)
+				annotation = &doc.Annotations[len(doc.Annotations)-1]
+			} else {
+				require.Equal(t, pkg.ID, value, "annotation of another element")
+				pkg.Annotations = append(pkg.Annotations, *annotation)
+				annotation = &pkg.Annotations[len(pkg.Annotations)-1]
+			}
+		case "Relationship":
+			fields := strings.Fields(value)
+			require.Len(t, fields, 3, "malformed relationship %q", value)
+			if len(doc.Packages) == 0 {
+				require.Equal(t, []string{doc.ID, "DESCRIBES"}, fields[:2])
+				doc.DocumentDescribes = append(doc.DocumentDescribes, fields[2])
+				continue
+			}
+			doc.Relationships = append(doc.Relationships, Relationship{Element: fields[0], Type: fields[1], Related: fields[2]})
+			relation = &doc.Relationships[len(doc.Relationships)-1]
+		case "RelationshipComment":
+			relation.Comment = value
+		case "PackageName":
+			doc.Packages = append(doc.Packages, Package{Name: value})
+			pkg = &doc.Packages[len(doc.Packages)-1]
+		case "PackageVersion":
+			pkg.Version = value
+		case "PackageSupplier":
+			pkg.Supplier = value
+		case "PackageOriginator":
+			pkg.Originator = value
+		case "PackageDownloadLocation":
+			pkg.DownloadLocation = value
+		case "FilesAnalyzed":
+			pkg.FilesAnalyzed = value == "true"
+		case "PackageVerificationCode":
+			pkg.VerificationCode = &PackageVerificationCode{Value: value}
+		case "PackageChecksum":
+			pkg.Checksums = append(pkg.Checksums, checksum(value))
+		case "PackageSourceInfo":
+			pkg.SourceInfo = value
+		case "PackageLicenseConcluded":
+			pkg.LicenseConcluded = value
+		case "PackageLicenseDeclared":
+			pkg.LicenseDeclared = value
+		case "PackageCopyrightText":
+			pkg.CopyrightText = value
+		case "PackageDescription":
+			pkg.Description = value
+		case "PackageAttributionText":
+			pkg.AttributionText = value
+		case "PrimaryPackagePurpose":
+			pkg.PrimaryPurpose = value
+		case "ExternalRef":
+			fields := strings.SplitN(value, " ", 3)
+			require.Len(t, fields, 3, "malformed external reference %q", value)
+			pkg.ExternalRefs = append(pkg.ExternalRefs, ExternalRef{Category: fields[0], Type: fields[1], Locator: fields[2]})
+		case "FileName":
+			doc.Files = append(doc.Files, File{Name: value})
+			file = &doc.Files[len(doc.Files)-1]
+		case "FileType":
+			file.FileTypes = append(file.FileTypes, value)
+		case "FileChecksum":
+			file.Checksums = append(file.Checksums, checksum(value))
+		case "LicenseConcluded":
+			file.LicenseConcluded = value
+		case "LicenseInfoInFile":
+			file.LicenseInfoInFile = append(file.LicenseInfoInFile, value)
+		case "FileCopyrightText":
+			file.CopyrightText = value
+		case "FileComment":
+			file.Description = value
+		case "FileNotice":
+			file.NoticeText = value
+		case "LicenseID":
+			doc.LicensingInfos = append(doc.LicensingInfos, LicensingInfo{LicenseID: value})
+			license = &doc.LicensingInfos[len(doc.LicensingInfos)-1]
+		case "ExtractedText":
+			license.ExtractedText = value
+		default:
+			require.Failf(t, "unknown tag", "%s: %s", tag, value)
+		}
+	}
+	return doc
+}
+
+func TestTagValue(t *testing.T) {
+	doc := &Document{
+		ID:          "SPDXRef-DOCUMENT",
+		Name:        "sbom-test",
+		Version:     "SPDX-2.3",
+		DataLicense: "CC0-1.0",
+		Namespace:   "https://spdx.org/spdxdocs/apko/",
+		CreationInfo: CreationInfo{
+			Created:            "2024-01-02T03:04:05Z",
+			Creators:           []string{"Tool: apko (devel)", "Organization: Chainguard, Inc"},
+			LicenseListVersion: "3.27",
+		},
+		Comment: "built by apko\nfor testing",
+		ExternalDocumentRefs: []ExternalDocumentRef{{
+			ExternalDocumentID: "DocumentRef-base",
+			SPDXDocument:       "https://example.com/base.spdx.json",
+			Checksum:           Checksum{Algorithm: "SHA256", Value: "beef"},
+		}},
+		Annotations: []Annotation{{
+			Date: "2024-01-02T03:04:05Z", Type: "OTHER", Annotator: "Tool: apko (devel)", Comment: "document annotation",
+		}},
+		DocumentDescribes: []string{"SPDXRef-Package-image"},
+		Packages: []Package{{
+			ID:               "SPDXRef-Package-image",
+			Name:             "image",
+			DownloadLocation: NOASSERTION,
+			PrimaryPurpose:   "CONTAINER",
+			Annotations: []Annotation{{
+				Date: "2024-01-02T03:04:05Z", Type: "REVIEW", Annotator: "Person: Jane Doe", Comment: "looks good",
+			}},
+		}, {
+			ID:               "SPDXRef-Package-musl-1.2.2-r7",
+			Name:             "musl",
+			Version:          "1.2.2-r7",
+			LicenseDeclared:  "MIT",
+			DownloadLocation: NOASSERTION,
+			CopyrightText:    "Copyright (c) 2005-2020 Rich Felker,\net al.",
+			Checksums:        []Checksum{{Algorithm: "SHA1", Value: "0de6f48c"}},
+			ExternalRefs: []ExternalRef{{
+				Category: ExtRefPackageManager,
+				Type:     ExtRefTypePurl,
+				Locator:  "pkg:apk/wolfi/musl@1.2.2-r7?arch=x86_64",
+			}},
+		}},
+		Files: []File{{
+			ID:                "SPDXRef-File-etc-apko.json",
+			Name:              "/etc/apko.json",
+			FileTypes:         []string{"TEXT"},
+			Checksums:         []Checksum{{Algorithm: "SHA1", Value: "cafe"}},
+			LicenseConcluded:  "MIT",
+			LicenseInfoInFile: []string{"MIT"},
+		}},
+		Relationships: []Relationship{{
+			Element: "SPDXRef-Package-image",
+			Type:    "CONTAINS",
+			Related: "SPDXRef-Package-musl-1.2.2-r7",
+			Comment: "requested in the image configuration",
+		}},
+		LicensingInfos: []LicensingInfo{{
+			LicenseID:     "LicenseRef-custom",
+			ExtractedText: "line one\nline two",
+		}},
+	}
+
+	var buf strings.Builder
+	require.NoError(t, doc.WriteTagValue(&buf))
+	pairs := parseTagValue(t, buf.String())
+
+	// The document header must come first.
+	require.Equal(t, [][2]string{
+		{"SPDXVersion", "SPDX-2.3"},
+		{"DataLicense", "CC0-1.0"},
+		{"SPDXID", "SPDXRef-DOCUMENT"},
+		{"DocumentName", "sbom-test"},
+		{"DocumentNamespace", "https://spdx.org/spdxdocs/apko/"},
+	}, pairs[:5])
+
+	// Everything written is read back.
+	require.Equal(t, doc, readTagValue(t, buf.String()))
+}
+
+func TestGenerateTagValue(t *testing.T) {
+	dir := t.TempDir()
+	opts := testOpts(apkfs.NewMemFS())
+	sx := NewTagValue()
+	require.Equal(t, "spdx-tv", sx.Key())
+	require.Equal(t, "spdx", sx.Ext())
+
+	path := filepath.Join(dir, opts.FileName+"."+sx.Ext())
+	require.NoError(t, sx.Generate(t.Context(), opts, path))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	pairs := parseTagValue(t, string(data))
+	require.Contains(t, pairs, [2]string{"PrimaryPackagePurpose", "OPERATING_SYSTEM"})
+
+	// The document is the one the JSON generator writes for the same input.
+	apkSBOM, err := os.ReadFile(filepath.Join("testdata", "apk_sboms", "libattr1-2.5.1-r2.spdx.json"))
+	require.NoError(t, err)
+	fsys := apkfs.NewMemFS()
+	require.NoError(t, fsys.MkdirAll("var/lib/db/sbom", 0o750))
+	require.NoError(t, fsys.WriteFile("var/lib/db/sbom/libattr1-2.5.1-r2.spdx.json", apkSBOM, 0o644))
+	opts = testOpts(fsys)
+	opts.ImageInfo.ImageDigest = "sha256:" + strings.Repeat("a", 64)
+	opts.ImageInfo.Layers = []v1.Descriptor{{Digest: v1.Hash{Algorithm: "sha256", Hex: strings.Repeat("b", 64)}}}
+	opts.Packages = []*apk.InstalledPackage{{
+		Package: apk.Package{Name: "libattr1", Version: "2.5.1-r2", Provides: []string{"so:libattr.so.1=1.1.2501"}},
+	}}
+	opts.Config = []byte("contents:\n  packages:\n    - libattr1\n")
+
+	require.NoError(t, sx.Generate(t.Context(), opts, path))
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	jsonPath := filepath.Join(dir, opts.FileName+"."+New().Ext())
+	require.NoError(t, New().Generate(t.Context(), opts, jsonPath))
+	want, err := ReadDocument(jsonPath)
+	require.NoError(t, err)
+	require.NotEmpty(t, want.Packages)
+	require.NotEmpty(t, want.Relationships)
+	require.Equal(t, want, readTagValue(t, string(data)))
+}
+
+func TestMalformedDigest(t *testing.T) {
+	opts := testOpts(apkfs.NewMemFS())
+	opts.ImageInfo.ImageDigest = "sha256:ebfca8a4"
+	opts.ImageInfo.Layers = []v1.Descriptor{{Digest: v1.Hash{Algorithm: "sha256", Hex: strings.Repeat("b", 64)}}}
+
+	sx := New()
+	path := filepath.Join(t.TempDir(), "sbom."+sx.Ext())
+	err := sx.Generate(t.Context(), opts, path)
+	require.ErrorContains(t, err, `image digest: digest "sha256:ebfca8a4" is not 64 lowercase hex digits`)
+	require.NoFileExists(t, path)
+
+	opts.ImageInfo.ImageDigest = "sha256:" + strings.Repeat("a", 64)
+	opts.ImageInfo.Layers[0].Digest.Hex = "not/hex"
+	require.ErrorContains(t, sx.Generate(t.Context(), opts, path), "digest of layer 0")
+}
+
+func TestPackagePurposes(t *testing.T) {
+	apkSBOM, err := os.ReadFile(filepath.Join("testdata", "apk_sboms", "libattr1-2.5.1-r2.spdx.json"))
+	require.NoError(t, err)
+	fsys := apkfs.NewMemFS()
+	require.NoError(t, fsys.MkdirAll("var/lib/db/sbom", 0o750))
+	require.NoError(t, fsys.WriteFile("var/lib/db/sbom/libattr1-2.5.1-r2.spdx.json", apkSBOM, 0o644))
+
+	opts := testOpts(fsys)
+	opts.ImageInfo.ImageDigest = "sha256:" + strings.Repeat("a", 64)
+	opts.ImageInfo.Layers = []v1.Descriptor{{Digest: v1.Hash{Algorithm: "sha256", Hex: strings.Repeat("b", 64)}}}
+	opts.Packages = []*apk.InstalledPackage{{
+		Package: apk.Package{Name: "libattr1", Version: "2.5.1-r2", Provides: []string{"so:libattr.so.1=1.1.2501"}},
+	}}
+
+	purposes := func(opts *options.Options) map[string]string {
+		sx := New()
+		path := filepath.Join(t.TempDir(), "sbom."+sx.Ext())
+		require.NoError(t, sx.Generate(t.Context(), opts, path))
+		doc, err := ReadDocument(path)
+		require.NoError(t, err)
+		purposes := map[string]string{}
+		for _, p := range doc.Packages {
+			purposes[p.ID] = p.PrimaryPurpose
+		}
+		return purposes
+	}
+	imageID := "SPDXRef-Package-Image-sha256-" + strings.Repeat("a", 64)
+	layerID := "SPDXRef-Package-ImageLayer-sha256-" + strings.Repeat("b", 64)
+	apkID := "SPDXRef-Package-libattr1-2.5.1-r2"
+
+	// By default, the layers are containers and the apks have no purpose.
+	got := purposes(opts)
+	require.Equal(t, "CONTAINER", got[imageID])
+	require.Equal(t, "CONTAINER", got[layerID])
+	require.Empty(t, got[apkID])
+
+	opts.PackagePurposes = true
+	got = purposes(opts)
+	require.Equal(t, "CONTAINER", got[imageID])
+	require.Equal(t, "OPERATING_SYSTEM", got[layerID])
+	require.Equal(t, "LIBRARY", got[apkID])
+
+	opts.PackagePurposeOverrides = map[string]string{"libattr1": "OTHER"}
+	require.Equal(t, "OTHER", purposes(opts)[apkID])
+
+	// Packages providing commands are applications.
+	opts.PackagePurposeOverrides = nil
+	p := APKPackage(opts, &apk.Package{Name: "busybox", Version: "1.36.1-r5", Provides: []string{"cmd:sh=1.36.1-r5"}})
+	require.Equal(t, "APPLICATION", p.PrimaryPurpose)
+}
+
+func TestEmbeddedConfig(t *testing.T) {
+	opts := testOpts(apkfs.NewMemFS())
+	sx := New()
+	path := filepath.Join(t.TempDir(), "sbom."+sx.Ext())
+	require.NoError(t, sx.Generate(t.Context(), opts, path))
+	doc, err := ReadDocument(path)
+	require.NoError(t, err)
+	config, err := EmbeddedConfig(doc)
+	require.NoError(t, err)
+	require.Nil(t, config)
+
+	opts.Config = []byte("contents:\n  packages:\n    - busybox\n")
+	require.NoError(t, sx.Generate(t.Context(), opts, path))
+	doc, err = ReadDocument(path)
+	require.NoError(t, err)
+	config, err = EmbeddedConfig(doc)
+	require.NoError(t, err)
+	require.Equal(t, opts.Config, config)
+
+	// The configuration is checked against its digest.
+	for i, a := range doc.Annotations {
+		if strings.HasPrefix(a.Comment, configAnnotationPrefix) {
+			doc.Annotations[i].Comment = configAnnotationPrefix + "sha256:" + strings.Repeat("0", 64) + " " + base64.StdEncoding.EncodeToString(opts.Config)
+		}
+	}
+	_, err = EmbeddedConfig(doc)
+	require.ErrorContains(t, err, "recorded sha256:"+strings.Repeat("0", 64))
+}
+
+func TestUpdate(t *testing.T) {
+	fsys := apkfs.NewMemFS()
+	require.NoError(t, fsys.MkdirAll("var/lib/db/sbom", 0o750))
+	for _, name := range []string{
+		"libattr1-2.5.1-r2", "font-ubuntu-0.869-r1",
+		"unbound-1.23.0-r0", "unbound-config-1.23.0-r0", "unbound-libs-1.23.0-r0",
+	} {
+		b, err := os.ReadFile(filepath.Join("testdata", "apk_sboms", name+".spdx.json"))
+		require.NoError(t, err)
+		require.NoError(t, fsys.WriteFile("var/lib/db/sbom/"+name+".spdx.json", b, 0o644))
+		if name == "libattr1-2.5.1-r2" {
+			// The SBOM of the next release of the package.
+			b = bytes.ReplaceAll(b, []byte("2.5.1-r2"), []byte("2.5.1-r3"))
+			require.NoError(t, fsys.WriteFile("var/lib/db/sbom/libattr1-2.5.1-r3.spdx.json", b, 0o644))
+		}
+	}
+	installed := func(nameVersions ...string) []*apk.InstalledPackage {
+		pkgs := make([]*apk.InstalledPackage, 0, len(nameVersions))
+		for _, nv := range nameVersions {
+			name, version, _ := strings.Cut(nv, "@")
+			pkgs = append(pkgs, &apk.InstalledPackage{Package: apk.Package{Name: name, Version: version, Arch: "x86_64"}})
+		}
+		return pkgs
+	}
+
+	opts := testOpts(fsys)
+	opts.ImageInfo.ImageDigest = "sha256:" + strings.Repeat("a", 64)
+	opts.ImageInfo.Layers = []v1.Descriptor{{Digest: v1.Hash{Algorithm: "sha256", Hex: strings.Repeat("b", 64)}}}
+	opts.Packages = installed("font-ubuntu@0.869-r1", "libattr1@2.5.1-r2",
+		"unbound@1.23.0-r0", "unbound-config@1.23.0-r0", "unbound-libs@1.23.0-r0")
+	sx := New()
+	dir := t.TempDir()
+	_, err := sx.GenerateContent(t.Context(), opts, filepath.Join(dir, "prev.spdx.json"))
+	require.NoError(t, err)
+	prev, err := ReadDocument(filepath.Join(dir, "prev.spdx.json"))
+	require.NoError(t, err)
+
+	// Change the version of one package.
+	old := sbom.InstalledComponents(opts.Packages)
+	opts.Packages = installed("font-ubuntu@0.869-r1", "libattr1@2.5.1-r3",
+		"unbound@1.23.0-r0", "unbound-config@1.23.0-r0", "unbound-libs@1.23.0-r0")
+	diff := sbom.Compare(old, sbom.InstalledComponents(opts.Packages))
+	require.Len(t, diff.Changed, 1)
+
+	// Only the packages whose elements are their own are reused, the
+	// unbound packages share the package of their build configuration.
+	fragments := prevFragments(prev, changedPackages(diff))
+	require.Equal(t, []string{"font-ubuntu@0.869-r1"}, slices.Sorted(maps.Keys(fragments)))
+
+	// So are those of application packages, which the root does not contain.
+	opts.AppPackages = []string{"font-*"}
+	_, err = sx.GenerateContent(t.Context(), opts, filepath.Join(dir, "app.spdx.json"))
+	require.NoError(t, err)
+	appPrev, err := ReadDocument(filepath.Join(dir, "app.spdx.json"))
+	require.NoError(t, err)
+	require.Contains(t, prevFragments(appPrev, changedPackages(diff)), "font-ubuntu@0.869-r1")
+	opts.AppPackages = nil
+
+	full, err := sx.GenerateContent(t.Context(), opts, filepath.Join(dir, "full.spdx.json"))
+	require.NoError(t, err)
+	// The reused package is not read again.
+	require.NoError(t, fsys.Remove("var/lib/db/sbom/font-ubuntu-0.869-r1.spdx.json"))
+	updated, err := sx.Update(t.Context(), prev, diff, opts, filepath.Join(dir, "updated.spdx.json"))
+	require.NoError(t, err)
+	require.Equal(t, string(full), string(updated))
+	require.Contains(t, string(updated), "libattr1-2.5.1-r3")
+	require.NotContains(t, string(updated), "libattr1-2.5.1-r2")
+}
@@ -0,0 +1,169 @@
+// Copyright 2026 Chainguard, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spdx
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteTagValue writes the document to w in the SPDX 2.3 tag-value format.
+// See https://spdx.github.io/spdx-spec/v2.3/ for the tags.
+func (doc *Document) WriteTagValue(w io.Writer) error {
+	tw := &tagWriter{w: bufio.NewWriter(w)}
+
+	tw.tag("SPDXVersion", doc.Version)
+	tw.tag("DataLicense", doc.DataLicense)
+	tw.tag("SPDXID", doc.ID)
+	tw.tag("DocumentName", doc.Name)
+	tw.tag("DocumentNamespace", doc.Namespace)
+	for _, ref := range doc.ExternalDocumentRefs {
+		tw.tag("ExternalDocumentRef", fmt.Sprintf("%s %s %s: %s",
+			ref.ExternalDocumentID, ref.SPDXDocument, ref.Checksum.Algorithm, ref.Checksum.Value))
+	}
+	tw.text("DocumentComment", doc.Comment)
+
+	tw.section("Creation Information")
+	for _, c := range doc.CreationInfo.Creators {
+		tw.tag("Creator", c)
+	}
+	tw.tag("Created", doc.CreationInfo.Created)
+	tw.tag("LicenseListVersion", doc.CreationInfo.LicenseListVersion)
+	tw.text("CreatorComment", doc.CreationInfo.Comment)
+	for _, a := range doc.Annotations {
+		tw.annotation(doc.ID, a)
+	}
+
+	for _, id := range doc.DocumentDescribes {
+		tw.tag("Relationship", fmt.Sprintf("%s DESCRIBES %s", doc.ID, id))
+	}
+
+	for i := range doc.Packages {
+		tw.pkg(&doc.Packages[i])
+	}
+
+	for i := range doc.Files {
+		tw.file(&doc.Files[i])
+	}
+
+	if len(doc.LicensingInfos) > 0 {
+		tw.section("Other Licensing Information")
+		for _, li := range doc.LicensingInfos {
+			tw.tag("LicenseID", li.LicenseID)
+			tw.text("ExtractedText", li.ExtractedText)
+		}
+	}
+
+	if len(doc.Relationships) > 0 {
+		tw.section("Relationships")
+		for _, r := range doc.Relationships {
+			tw.tag("Relationship", fmt.Sprintf("%s %s %s", r.Element, r.Type, r.Related))
+			tw.text("RelationshipComment", r.Comment)
+		}
+	}
+
+	return tw.w.Flush()
+}
+
+// tagWriter writes tag-value pairs. Write errors are sticky in the
+// bufio.Writer and are returned by its Flush.
+type tagWriter struct {
+	w *bufio.Writer
+}
+
+// tag writes a single line tag. Empty values are omitted.
+func (tw *tagWriter) tag(tag, value string) {
+	if value == "" {
+		return
+	}
+	fmt.Fprintf(tw.w, "%s: %s\n", tag, value)
+}
+
+// text writes a tag whose value is free form text, wrapped in <text> when it
+// spans several lines as the specification requires.
+func (tw *tagWriter) text(tag, value string) {
+	if value == "" {
+		return
+	}
+	if strings.Contains(value, "\n") {
+		value = "<text>" + value + "</text>"
+	}
+	tw.tag(tag, value)
+}
+
+func (tw *tagWriter) section(name string) {
+	fmt.Fprintf(tw.w, "\n##### %s\n\n", name)
+}
+
+func (tw *tagWriter) pkg(p *Package) {
+	tw.section("Package: " + p.Name)
+	// Parsers start a new package at PackageName, so it is written even
+	// when empty, as for the layer package of an image without a digest.
+	fmt.Fprintf(tw.w, "PackageName: %s\n", p.Name)
+	tw.tag("SPDXID", p.ID)
+	tw.tag("PackageVersion", p.Version)
+	tw.tag("PackageSupplier", p.Supplier)
+	tw.tag("PackageOriginator", p.Originator)
+	tw.tag("PackageDownloadLocation", p.DownloadLocation)
+	tw.tag("FilesAnalyzed", fmt.Sprintf("%t", p.FilesAnalyzed))
+	if p.VerificationCode != nil {
+		tw.tag("PackageVerificationCode", p.VerificationCode.Value)
+	}
+	for _, c := range p.Checksums {
+		tw.tag("PackageChecksum", fmt.Sprintf("%s: %s", c.Algorithm, c.Value))
+	}
+	tw.text("PackageSourceInfo", p.SourceInfo)
+	tw.tag("PackageLicenseConcluded", p.LicenseConcluded)
+	tw.tag("PackageLicenseDeclared", p.LicenseDeclared)
+	tw.text("PackageCopyrightText", p.CopyrightText)
+	tw.text("PackageDescription", p.Description)
+	tw.text("PackageAttributionText", p.AttributionText)
+	tw.tag("PrimaryPackagePurpose", p.PrimaryPurpose)
+	for _, ref := range p.ExternalRefs {
+		tw.tag("ExternalRef", fmt.Sprintf("%s %s %s", ref.Category, ref.Type, ref.Locator))
+	}
+	for _, a := range p.Annotations {
+		tw.annotation(p.ID, a)
+	}
+}
+
+func (tw *tagWriter) annotation(id string, a Annotation) {
+	tw.tag("Annotator", a.Annotator)
+	tw.tag("AnnotationDate", a.Date)
+	tw.tag("AnnotationType", a.Type)
+	tw.tag("SPDXREF", id)
+	tw.text("AnnotationComment", a.Comment)
+}
+
+func (tw *tagWriter) file(f *File) {
+	tw.section("File: " + f.Name)
+	tw.tag("FileName", f.Name)
+	tw.tag("SPDXID", f.ID)
+	for _, t := range f.FileTypes {
+		tw.tag("FileType", t)
+	}
+	for _, c := range f.Checksums {
+		tw.tag("FileChecksum", fmt.Sprintf("%s: %s", c.Algorithm, c.Value))
+	}
+	tw.tag("LicenseConcluded", f.LicenseConcluded)
+	for _, l := range f.LicenseInfoInFile {
+		tw.tag("LicenseInfoInFile", l)
+	}
+	tw.text("FileCopyrightText", f.CopyrightText)
+	tw.text("FileComment", f.Description)
+	tw.text("FileNotice", f.NoticeText)
+}
@@ -15,13 +15,18 @@
 package options
 
 import (
+	"cmp"
 	"fmt"
+	"maps"
 	"net/url"
+	"path"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"sort"
+	"strings"
 	"time"
 
-	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	ggcrtypes "github.com/google/go-containerregistry/pkg/v1/types"
 	purl "github.com/package-url/packageurl-go"
@@ -50,6 +55,371 @@ type Options struct {
 
 	// Packages is a list of packages which will be listed in the SBOM
 	Packages []*apk.InstalledPackage
+
+	// ExtraPackages are components not tracked by apk which are merged
+	// into the SBOM alongside the apk-derived packages.
+	ExtraPackages []ExtraPackage
+
+	// Comment is a free-form comment on the SBOM document.
+	Comment string
+
+	// IndexSignatures maps the names of the packages to whether the
+	// signature of the index they were resolved from was verified. Packages
+	// missing from the map are not annotated; those in it without an SBOM
+	// of their own are described from their metadata.
+	IndexSignatures map[string]bool
+
+	// IndexDigests are the digests of the repository index archives the
+	// packages were resolved from, keyed by the URI of the index, recorded
+	// as annotations of the document.
+	IndexDigests map[string]string
+
+	// BusyboxApplets are the links to busybox applets created in the image,
+	// keyed by the name of the package providing busybox.
+	BusyboxApplets map[string][]string
+
+	// LicenseListVersion is the version of the SPDX license list the
+	// license expressions in the SBOM refer to, or empty for the
+	// generator's default.
+	LicenseListVersion string
+
+	// NormalizeLicenses rewrites the license expressions in the SBOM in
+	// their canonical form against the SPDX license list embedded in the
+	// generator, whose version the SBOM then declares.
+	NormalizeLicenses bool
+
+	// PackageNameTemplate is the template of the names of the apk packages
+	// in the SBOM, see PackageName, or empty to use the package name.
+	PackageNameTemplate string
+
+	// RelationshipComments maps the names of the packages to a comment on
+	// the relationship from the image to them, e.g. why they were
+	// installed. Packages missing from the map get no comment.
+	RelationshipComments map[string]string
+
+	// GeneratedFiles are the paths of the files apko generated in the
+	// image, rather than installed from packages. They are added to the
+	// SBOM as generated from apko.
+	GeneratedFiles []string
+
+	// ConfigFiles are the paths, among GeneratedFiles, of the configuration
+	// files apko injects in the image from its configuration, such as
+	// /etc/apko.json and the profile snippets. They are also related to the
+	// image as its configuration.
+	ConfigFiles []string
+
+	// SplitPackageVersions records the upstream version, epoch and release
+	// of the apk packages separately, see SplitPackageVersion, in addition
+	// to their full version.
+	SplitPackageVersions bool
+
+	// StreamPackages encodes the packages of JSON documents to the file one
+	// at a time rather than encoding the whole document in memory first.
+	// The documents are still built whole in memory, so this does not bound
+	// the memory of the generation. Their content is then not returned by
+	// GenerateContent.
+	StreamPackages bool
+
+	// ContentNamespace derives the namespace of the documents from the
+	// packages they describe, so that the same packages always yield the
+	// same namespace, rather than using the same namespace for all.
+	ContentNamespace bool
+
+	// PackageVCS adds the commit the apk packages were built from, when
+	// their metadata has it, as a qualifier of their purls, along with the
+	// vcs_url qualifier when PackageVCSURL is set.
+	PackageVCS bool
+	// PackageVCSURL is the URL of the repository the apk packages are built
+	// from, e.g. "https://github.com/wolfi-dev/os", which their commits are
+	// commits of.
+	PackageVCSURL string
+
+	// PackageLabel, when set, restricts the apk packages of the documents
+	// to those with the label in PackageLabels, which maps package names to
+	// their labels.
+	PackageLabel  string
+	PackageLabels map[string][]string
+
+	// PackagesOnly leaves the image, its layers, the operating system and
+	// the files apko generated out of the documents, which then describe a
+	// collection of the apk packages.
+	PackagesOnly bool
+
+	// ImagePurlType and ImagePurlNamespace are the type and namespace of the
+	// purls of the image, its index and its layers, by default "oci" and
+	// none.
+	ImagePurlType      string
+	ImagePurlNamespace string
+
+	// Lint checks the documents for the schema violations apko can make,
+	// such as missing required fields or malformed identifiers, before
+	// writing them.
+	Lint bool
+
+	// DuplicateVersions is how packages listed in Packages with several
+	// versions are handled: DuplicateVersionsAnnotate or
+	// DuplicateVersionsFail. They are listed as is when empty.
+	DuplicateVersions string
+
+	// PackagePurposes sets the primaryPackagePurpose of the packages by
+	// their type: OPERATING_SYSTEM for the layers, rather than CONTAINER,
+	// and that returned by PackagePurpose for the apk packages, which
+	// otherwise have none.
+	PackagePurposes bool
+	// PackagePurposeOverrides maps the names of apk packages to their
+	// primaryPackagePurpose, over the default of PackagePurposes.
+	PackagePurposeOverrides map[string]string
+
+	// AppPackages are the patterns, as matched by path.Match, of the names
+	// of the apk packages of the application, as opposed to those of the
+	// operating system base. The root package is related to them with
+	// AppPackageRelationship rather than CONTAINS.
+	AppPackages []string
+	// AppPackageRelationship is the type of the relationships from the root
+	// package to the application packages, by default OTHER, commented to
+	// tell them from the other OTHER relationships.
+	AppPackageRelationship string
+
+	// TimestampFormat is the Go time layout of the timestamps of the
+	// documents, by default time.RFC3339.
+	TimestampFormat string
+
+	// Config is the image configuration the image was built from, as YAML,
+	// recorded with its digest in an annotation of the documents when set.
+	Config []byte
+
+	// OnMetrics, when set, is called with the metrics of each image or
+	// index SBOM generated, by the generators which report them.
+	OnMetrics func(types.SBOMMetrics)
+}
+
+// Timestamp returns ImageInfo.SourceDateEpoch as the timestamps of the
+// documents, in UTC so that it does not depend on the timezone of the host,
+// e.g. "2023-01-02T03:04:05Z", in TimestampFormat.
+func (o *Options) Timestamp() string {
+	return o.ImageInfo.SourceDateEpoch.UTC().Format(cmp.Or(o.TimestampFormat, time.RFC3339))
+}
+
+// PackagePurposeValues are the values of the primaryPackagePurpose of SPDX
+// 2.3 packages.
+var PackagePurposeValues = []string{
+	"APPLICATION", "FRAMEWORK", "LIBRARY", "CONTAINER", "OPERATING_SYSTEM", "DEVICE",
+	"FIRMWARE", "SOURCE", "ARCHIVE", "FILE", "INSTALL", "OTHER",
+}
+
+// RelationshipTypeValues are the values of the relationshipType of SPDX 2.3
+// relationships.
+var RelationshipTypeValues = []string{
+	"AMENDS", "ANCESTOR_OF", "BUILD_DEPENDENCY_OF", "BUILD_TOOL_OF", "CONTAINED_BY", "CONTAINS",
+	"COPY_OF", "DATA_FILE_OF", "DEPENDENCY_MANIFEST_OF", "DEPENDENCY_OF", "DEPENDS_ON",
+	"DESCENDANT_OF", "DESCRIBED_BY", "DESCRIBES", "DEV_DEPENDENCY_OF", "DEV_TOOL_OF",
+	"DISTRIBUTION_ARTIFACT", "DOCUMENTATION_OF", "DYNAMIC_LINK", "EXAMPLE_OF",
+	"EXPANDED_FROM_ARCHIVE", "FILE_ADDED", "FILE_DELETED", "FILE_MODIFIED", "GENERATED_FROM",
+	"GENERATES", "HAS_PREREQUISITE", "METAFILE_OF", "OPTIONAL_COMPONENT_OF",
+	"OPTIONAL_DEPENDENCY_OF", "OTHER", "PACKAGE_OF", "PATCH_APPLIED", "PATCH_FOR",
+	"PREREQUISITE_FOR", "PROVIDED_DEPENDENCY_OF", "REQUIREMENT_DESCRIPTION_FOR",
+	"RUNTIME_DEPENDENCY_OF", "SPECIFICATION_FOR", "STATIC_LINK", "TEST_CASE_OF",
+	"TEST_DEPENDENCY_OF", "TEST_OF", "TEST_TOOL_OF", "VARIANT_OF",
+}
+
+// PackagePurpose returns the primaryPackagePurpose of the apk package pkg:
+// that in PackagePurposeOverrides, or APPLICATION for the packages which
+// provide commands, and LIBRARY for the others.
+func (o *Options) PackagePurpose(pkg *apk.Package) string {
+	if purpose, ok := o.PackagePurposeOverrides[pkg.Name]; ok {
+		return purpose
+	}
+	for _, p := range pkg.Provides {
+		if strings.HasPrefix(p, "cmd:") {
+			return "APPLICATION"
+		}
+	}
+	return "LIBRARY"
+}
+
+// IsAppPackage reports whether the apk package named name is one of the
+// application, see AppPackages.
+func (o *Options) IsAppPackage(name string) bool {
+	return slices.ContainsFunc(o.AppPackages, func(pattern string) bool {
+		ok, _ := path.Match(pattern, name)
+		return ok
+	})
+}
+
+// Modes of the handling of packages with several versions.
+const (
+	// DuplicateVersionsAnnotate annotates the entries of the packages with
+	// the versions in conflict.
+	DuplicateVersionsAnnotate = "annotate"
+	// DuplicateVersionsFail fails the generation of the documents.
+	DuplicateVersionsFail = "fail"
+)
+
+// VersionConflicts returns the versions of the packages listed in Packages
+// with several versions, keyed by package name. The versions are sorted in
+// apk version order, versions that don't parse sort lexically after those
+// that do.
+func (o *Options) VersionConflicts() map[string][]string {
+	versions := map[string][]string{}
+	for _, pkg := range o.Packages {
+		if !slices.Contains(versions[pkg.Name], pkg.Version) {
+			versions[pkg.Name] = append(versions[pkg.Name], pkg.Version)
+		}
+	}
+	maps.DeleteFunc(versions, func(_ string, v []string) bool { return len(v) < 2 })
+	for _, v := range versions {
+		slices.SortFunc(v, compareVersions)
+	}
+	return versions
+}
+
+// compareVersions compares the apk versions a and b.
+func compareVersions(a, b string) int {
+	va, erra := apk.ParseVersion(a)
+	vb, errb := apk.ParseVersion(b)
+	switch {
+	case erra == nil && errb == nil:
+		return apk.CompareVersions(va, vb)
+	case erra == nil:
+		return -1
+	case errb == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// digestRe matches a digest as defined by the OCI image specification, an
+// algorithm and an encoded value.
+var digestRe = regexp.MustCompile(`^[a-z0-9]+(?:[.+_-][a-z0-9]+)*:[a-zA-Z0-9=_-]+$`)
+
+// digestHexLengths are the lengths of the lowercase hex encoded digests of
+// the registered algorithms.
+var digestHexLengths = map[string]int{
+	"sha256": 64,
+	"sha512": 128,
+}
+
+// ValidateDigest checks that digest is a well-formed digest, e.g.
+// "sha256:" followed by 64 lowercase hex digits. Digests of algorithms
+// other than sha256 and sha512 only need to match the grammar of the OCI
+// image specification.
+func ValidateDigest(digest string) error {
+	if !digestRe.MatchString(digest) {
+		return fmt.Errorf("digest %q is not of the form <algorithm>:<encoded>", digest)
+	}
+	algorithm, encoded, _ := strings.Cut(digest, ":")
+	if n, ok := digestHexLengths[algorithm]; ok {
+		if len(encoded) != n || strings.Trim(encoded, "0123456789abcdef") != "" {
+			return fmt.Errorf("digest %q is not %d lowercase hex digits", digest, n)
+		}
+	}
+	return nil
+}
+
+// ValidateDigests checks that the digests of the image and of its layers
+// which are set are well-formed, see ValidateDigest, since they end up in
+// the identifiers and purls of the SBOMs.
+func (o *Options) ValidateDigests() error {
+	if d := o.ImageInfo.ImageDigest; d != "" {
+		if err := ValidateDigest(d); err != nil {
+			return fmt.Errorf("image digest: %w", err)
+		}
+	}
+	for i, layer := range o.ImageInfo.Layers {
+		if layer.Digest == (v1.Hash{}) {
+			continue
+		}
+		if err := ValidateDigest(layer.Digest.String()); err != nil {
+			return fmt.Errorf("digest of layer %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// packageNamePlaceholderRe matches the placeholders of a package name
+// template.
+var packageNamePlaceholderRe = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// ValidatePackageNameTemplate checks that the placeholders of a package name
+// template are all known, see PackageName.
+func ValidatePackageNameTemplate(tmpl string) error {
+	for _, m := range packageNamePlaceholderRe.FindAllStringSubmatch(tmpl, -1) {
+		switch m[1] {
+		case "name", "version", "arch", "distro":
+		default:
+			return fmt.Errorf("unknown placeholder %s in package name template %q", m[0], tmpl)
+		}
+	}
+	return nil
+}
+
+// PackageName returns the name of an apk package in the SBOM, by expanding
+// the {name}, {version}, {arch} and {distro} placeholders of
+// PackageNameTemplate. {distro} is the ID of the operating system of the
+// image.
+func (o *Options) PackageName(name, version, arch string) string {
+	if o.PackageNameTemplate == "" {
+		return name
+	}
+	return packageNamePlaceholderRe.ReplaceAllStringFunc(o.PackageNameTemplate, func(p string) string {
+		switch p {
+		case "{name}":
+			return name
+		case "{version}":
+			return version
+		case "{arch}":
+			return arch
+		case "{distro}":
+			return o.OS.ID
+		}
+		return p
+	})
+}
+
+// packageVersionRe splits an apk version into its optional epoch, its
+// upstream version and its optional release.
+var packageVersionRe = regexp.MustCompile(`^(?:(\d+):)?(.+?)(?:-r(\d+))?$`)
+
+// SplitPackageVersion splits an apk version such as "1:1.2.3-r4" into its
+// epoch "1", upstream version "1.2.3" and release "4". The epoch and release
+// are empty when the version has none.
+func SplitPackageVersion(version string) (epoch, upstream, release string) {
+	m := packageVersionRe.FindStringSubmatch(version)
+	if m == nil {
+		return "", version, ""
+	}
+	return m[1], m[2], m[3]
+}
+
+// ExtraPackage describes a component which is not installed by apk, such
+// as a vendored binary or a configuration bundle, to list in the SBOM.
+type ExtraPackage struct {
+	// ID is the identifier of the package in the SBOM. It must not collide
+	// with any identifier generated by apko.
+	ID               string
+	Name             string
+	Version          string
+	License          string
+	Supplier         string
+	Description      string
+	DownloadLocation string
+	// Purl, when set, is added as a package manager external reference.
+	Purl string
+	// Relationships from this package to other elements in the SBOM. When
+	// empty, the package is related to the document's root element.
+	Relationships []ExtraRelationship
+}
+
+// ExtraRelationship is a relationship from an ExtraPackage to another
+// element of the SBOM.
+type ExtraRelationship struct {
+	// Type is the relationship type, e.g. DEPENDS_ON.
+	Type string
+	// Related is the identifier of the related element.
+	Related string
+	// Comment, when set, explains the relationship to the readers of the
+	// SBOM.
+	Comment string
 }
 
 type PurlQualifiers map[string]string
@@ -66,6 +436,7 @@ type ImageInfo struct {
 	Name            string
 	Repository      string
 	ImageDigest     string
+	ConfigDigest    string
 	Layers          []v1.Descriptor
 	VCSUrl          string
 	IndexMediaType  ggcrtypes.MediaType
@@ -74,6 +445,15 @@ type ImageInfo struct {
 	Images          []ArchImageInfo
 	Arch            types.Architecture
 	SourceDateEpoch time.Time
+
+	// SourceRepository and SourceCommit identify the source the image
+	// configuration was built from.
+	SourceRepository string
+	SourceCommit     string
+
+	// ReproducibilityManifestDigest is the digest of the manifest of the
+	// build inputs, if one was written.
+	ReproducibilityManifestDigest string
 }
 
 type ArchImageInfo struct {
@@ -82,23 +462,60 @@ type ArchImageInfo struct {
 	SBOMDigest string
 }
 
-// ImagePurlName returns a name to represent the image in a purl
+// DefaultImagePurlName is the name of the image in purls when the image has
+// no name, or one without a repository.
+const DefaultImagePurlName = "image"
+
+// ImagePurlName returns a name to represent the image in a purl, the last
+// component of the repository of ImageInfo.Name, or DefaultImagePurlName, so
+// that it is never empty.
 func (o *Options) ImagePurlName() string {
-	repoName := "image"
-	if o.ImageInfo.Name != "" {
-		ref, err := name.ParseReference(o.ImageInfo.Name)
-		if err != nil {
-			return repoName
-		}
-		repoName = filepath.Base(ref.Context().RepositoryStr())
+	if strings.TrimSpace(o.ImageInfo.Name) == "" {
+		return DefaultImagePurlName
 	}
-	return repoName
+	ref, err := types.NormalizeReference(o.ImageInfo.Name)
+	if err != nil {
+		return DefaultImagePurlName
+	}
+	switch repoName := filepath.Base(ref.Context().RepositoryStr()); repoName {
+	case "", ".", "/":
+		return DefaultImagePurlName
+	default:
+		return repoName
+	}
+}
+
+// ImagePurl returns the purl of the image described by info, as the SBOMs
+// apko generates list it with the default purl type and namespace, e.g.
+// pkg:oci/static@sha256%3A...?arch=amd64&os=linux&repository_url=cgr.dev%2Fchainguard%2Fstatic
+// for an image named cgr.dev/chainguard/static, so that it can be used
+// elsewhere, e.g. in logs, in exactly the same format.
+func ImagePurl(info ImageInfo) string {
+	o := &Options{ImageInfo: info}
+	return o.ImagePurl()
+}
+
+// ImagePurl returns the purl of the image in the SBOMs, see OCIPurl.
+func (o *Options) ImagePurl() string {
+	return o.OCIPurl(o.ImagePurlName(), o.ImageInfo.ImageDigest, o.ImagePurlQualifiers())
+}
+
+// OCIPurl returns the purl of an image, index or layer with the given name
+// and digest, of type ImagePurlType, by default oci, in ImagePurlNamespace.
+// The qualifiers are left out when there are none rather than leaving a
+// trailing "?".
+func (o *Options) OCIPurl(name, digest string, qualifiers PurlQualifiers) string {
+	p := purl.NewPackageURL(cmp.Or(o.ImagePurlType, purl.TypeOCI), o.ImagePurlNamespace, name, digest, nil, "").String()
+	if q := qualifiers.String(); q != "" {
+		p += "?" + q
+	}
+	return p
 }
 
 // IndexPurlName returns a name to refer to the image index in purls
 func (o *Options) IndexPurlName() string {
 	repoName := o.ImagePurlName()
-	if repoName == "image" {
+	if repoName == DefaultImagePurlName {
 		return "index"
 	}
 	return repoName
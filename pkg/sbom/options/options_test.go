@@ -15,9 +15,16 @@
 package options
 
 import (
+	"strings"
 	"testing"
+	"time"
 
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	ggcrtypes "github.com/google/go-containerregistry/pkg/v1/types"
 	"github.com/stretchr/testify/require"
+
+	"chainguard.dev/apko/pkg/apk/apk"
+	"chainguard.dev/apko/pkg/build/types"
 )
 
 func TestPurlQualifierString(t *testing.T) {
@@ -45,3 +52,134 @@ func TestPurlQualifierString(t *testing.T) {
 		require.Equal(t, tc.e, tc.q.String())
 	}
 }
+
+func TestImagePurlName(t *testing.T) {
+	for name, want := range map[string]string{
+		"":                                 DefaultImagePurlName,
+		"  ":                               DefaultImagePurlName,
+		"Not A Reference":                  DefaultImagePurlName,
+		"cgr.dev/chainguard/static:latest": "static",
+		"localhost/apko/golden:latest":     "golden",
+		"golden@sha256:" + strings.Repeat("a", 64): "golden",
+	} {
+		o := &Options{ImageInfo: ImageInfo{Name: name}}
+		require.Equal(t, want, o.ImagePurlName(), name)
+	}
+
+	o := &Options{}
+	require.Equal(t, "index", o.IndexPurlName())
+}
+
+func TestImagePurl(t *testing.T) {
+	info := ImageInfo{
+		Name:           "cgr.dev/chainguard/static:latest",
+		Repository:     "cgr.dev/chainguard/static",
+		ImageDigest:    "sha256:ebfca8a4",
+		ImageMediaType: ggcrtypes.OCIManifestSchema1,
+		Arch:           types.ParseArchitecture("arm64"),
+	}
+	require.Equal(t, "pkg:oci/static@sha256%3Aebfca8a4?arch=arm64&mediaType=application%2Fvnd.oci.image.manifest.v1%2Bjson&os=linux&repository_url=cgr.dev%2Fchainguard%2Fstatic", ImagePurl(info))
+
+	// Without a name, the purl gets the default name.
+	require.Equal(t, "pkg:oci/image@sha256%3Aebfca8a4?os=linux", ImagePurl(ImageInfo{ImageDigest: "sha256:ebfca8a4"}))
+
+	// The SBOMs use the configured purl type and namespace.
+	o := &Options{ImageInfo: info, ImagePurlType: "docker", ImagePurlNamespace: "chainguard"}
+	require.True(t, strings.HasPrefix(o.ImagePurl(), "pkg:docker/chainguard/static@sha256%3Aebfca8a4?"), o.ImagePurl())
+}
+
+func TestPackageName(t *testing.T) {
+	o := &Options{OS: OSInfo{ID: "wolfi"}}
+	require.Equal(t, "musl", o.PackageName("musl", "1.2.5-r0", "x86_64"))
+
+	for tmpl, want := range map[string]string{
+		"{name}":                    "musl",
+		"{name}-{arch}":             "musl-x86_64",
+		"{distro}/{name}@{version}": "wolfi/musl@1.2.5-r0",
+		"{name}{name}":              "muslmusl",
+	} {
+		o.PackageNameTemplate = tmpl
+		require.NoError(t, ValidatePackageNameTemplate(tmpl))
+		require.Equal(t, want, o.PackageName("musl", "1.2.5-r0", "x86_64"), tmpl)
+	}
+
+	require.NoError(t, ValidatePackageNameTemplate(""))
+	require.ErrorContains(t, ValidatePackageNameTemplate("{name}-{release}"), "{release}")
+}
+
+func TestSplitPackageVersion(t *testing.T) {
+	for version, want := range map[string][3]string{
+		"1.2.3-r4":         {"", "1.2.3", "4"},
+		"2:1.2.3-r0":       {"2", "1.2.3", "0"},
+		"1.2.3":            {"", "1.2.3", ""},
+		"6.5_p20250125-r1": {"", "6.5_p20250125", "1"},
+		"1.0-rc1":          {"", "1.0-rc1", ""},
+	} {
+		epoch, upstream, release := SplitPackageVersion(version)
+		require.Equal(t, want, [3]string{epoch, upstream, release}, version)
+	}
+}
+
+func TestVersionConflicts(t *testing.T) {
+	var o Options
+	for _, pkg := range [][2]string{
+		{"musl", "1.2.5-r0"},
+		{"libattr1", "2.10.0-r0"},
+		{"libattr1", "2.9.1-r2"},
+		{"libattr1", "2.9.1-r10"},
+		{"libattr1", "2.9.1-r2"},
+		{"libattr1", "not-a-version"},
+		{"zlib", "1.3-r0"},
+		{"zlib", "1.3_rc1-r0"},
+	} {
+		o.Packages = append(o.Packages, &apk.InstalledPackage{Package: apk.Package{Name: pkg[0], Version: pkg[1]}})
+	}
+	require.Equal(t, map[string][]string{
+		"libattr1": {"2.9.1-r2", "2.9.1-r10", "2.10.0-r0", "not-a-version"},
+		"zlib":     {"1.3_rc1-r0", "1.3-r0"},
+	}, o.VersionConflicts())
+}
+
+func TestValidateDigests(t *testing.T) {
+	for _, digest := range []string{
+		"sha256:" + strings.Repeat("a", 64),
+		"sha512:" + strings.Repeat("0f", 64),
+		"blake3:ABC-def_0=",
+	} {
+		require.NoError(t, ValidateDigest(digest), digest)
+	}
+	for _, digest := range []string{
+		"",
+		"sha256",
+		"sha256:",
+		"ebfca8a4",
+		"sha256:ebfca8a4",
+		"sha256:" + strings.Repeat("A", 64),
+		"sha256:" + strings.Repeat("g", 64),
+		"SHA256:" + strings.Repeat("a", 64),
+		"sha256:" + strings.Repeat("a", 64) + "/x",
+	} {
+		require.Error(t, ValidateDigest(digest), digest)
+	}
+
+	// Unset digests are not checked.
+	o := &Options{ImageInfo: ImageInfo{Layers: []v1.Descriptor{{}}}}
+	require.NoError(t, o.ValidateDigests())
+
+	o.ImageInfo.ImageDigest = "sha256:ebfca8a4"
+	require.ErrorContains(t, o.ValidateDigests(), "image digest")
+
+	o.ImageInfo.ImageDigest = "sha256:" + strings.Repeat("a", 64)
+	o.ImageInfo.Layers = append(o.ImageInfo.Layers, v1.Descriptor{Digest: v1.Hash{Algorithm: "sha256", Hex: "xyz"}})
+	require.ErrorContains(t, o.ValidateDigests(), "digest of layer 1")
+}
+
+func TestTimestamp(t *testing.T) {
+	o := &Options{ImageInfo: ImageInfo{
+		SourceDateEpoch: time.Date(2023, 1, 2, 5, 4, 5, 600, time.FixedZone("CEST", 2*60*60)),
+	}}
+	require.Equal(t, "2023-01-02T03:04:05Z", o.Timestamp())
+
+	o.TimestampFormat = time.RFC3339Nano
+	require.Equal(t, "2023-01-02T03:04:05.0000006Z", o.Timestamp())
+}